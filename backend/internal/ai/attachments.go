@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/extract"
+)
+
+// ErrUnsupportedAttachment is returned when the chosen model cannot read an
+// attachment's type
+var ErrUnsupportedAttachment = errors.New("unsupported attachment")
+
+// AttachmentKind says how an attachment is sent to the model, and so which
+// models can take it
+type AttachmentKind string
+
+const (
+	// AttachmentImage is sent as an image part and needs a vision model
+	AttachmentImage AttachmentKind = "image"
+	// AttachmentDocument (PDF, DOCX, XLSX) is sent as a file part to vision
+	// models that read PDFs, and as its extracted text to the others
+	AttachmentDocument AttachmentKind = "document"
+	// AttachmentText is inlined as text, which every model reads
+	AttachmentText AttachmentKind = "text"
+)
+
+// textTypes are non-text/* types that are sent as text
+var textTypes = map[string]bool{
+	"application/json":   true,
+	"application/xml":    true,
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"application/toml":   true,
+	"application/sql":    true,
+}
+
+// ClassifyAttachment returns how a file of mimeType is sent to the model;
+// false when no model can take it
+func ClassifyAttachment(mimeType string) (AttachmentKind, bool) {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return AttachmentImage, true
+	}
+	switch extract.Kind("", mimeType) {
+	case extract.KindPDF, extract.KindDOCX, extract.KindXLSX:
+		return AttachmentDocument, true
+	}
+	if strings.HasPrefix(mimeType, "text/") || textTypes[mimeType] {
+		return AttachmentText, true
+	}
+	return "", false
+}
+
+// AllowedAttachmentTypes lists what model accepts, for error messages and
+// the model catalogue: text and documents always, images with vision
+func AllowedAttachmentTypes(model *database.ModelConfig) []AttachmentKind {
+	if model.SupportsVision {
+		return []AttachmentKind{AttachmentText, AttachmentDocument, AttachmentImage}
+	}
+	return []AttachmentKind{AttachmentText, AttachmentDocument}
+}
+
+// checkAttachments rejects attachments model cannot read
+func checkAttachments(model *database.ModelConfig, attachments []database.Attachment) error {
+	for _, a := range attachments {
+		kind, ok := ClassifyAttachment(a.MimeType)
+		if !ok {
+			return fmt.Errorf("%w: %s (%s) cannot be sent to a model; attach text, PDF, DOCX, XLSX or images",
+				ErrUnsupportedAttachment, a.Name, a.MimeType)
+		}
+		if kind == AttachmentImage && !model.SupportsVision {
+			return fmt.Errorf("%w: model %s does not accept images (%s); it reads text and documents only",
+				ErrUnsupportedAttachment, model.Name, a.Name)
+		}
+	}
+	return nil
+}
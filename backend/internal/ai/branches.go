@@ -0,0 +1,256 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gryt-backend/internal/database"
+)
+
+var (
+	// ErrSessionNotFound is returned for a session that does not exist or
+	// belongs to another user
+	ErrSessionNotFound = errors.New("chat session not found")
+	// ErrMessageNotFound is returned for a message that is not in the session
+	ErrMessageNotFound = errors.New("chat message not found")
+	// ErrInvalidBranch is returned when a message cannot be edited or
+	// regenerated the way it was asked
+	ErrInvalidBranch = errors.New("invalid branch")
+)
+
+// historyLimit is how many messages of the active path are replayed
+const historyLimit = 10
+
+// BranchPoint says where a turn attaches in the session's message tree.
+// A request without one continues the active branch.
+type BranchPoint struct {
+	// ParentID is the message the new user message follows; empty starts a
+	// new root (editing the first message)
+	ParentID string
+	// ReplyTo is an existing user message to answer again; no new user
+	// message is saved
+	ReplyTo string
+}
+
+// turn is where a chat turn is saved and the history it replays
+type turn struct {
+	parentID *string // parent of the new user message
+	replyTo  string  // set when an existing user message is answered again
+	history  []database.ChatMessage
+}
+
+// loadTurn finds the branch req continues and the last historyLimit
+// messages on it, oldest first
+func (s *Service) loadTurn(ctx context.Context, req *ServiceChatRequest) (*turn, error) {
+	repo := s.chatRepo.WithContext(ctx)
+	t := &turn{}
+
+	var leaf string
+	switch {
+	case req.Branch == nil:
+		leafMsg, err := s.activeLeaf(ctx, req.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if leafMsg == nil {
+			return t, nil
+		}
+		leaf = leafMsg.ID
+	case req.Branch.ReplyTo != "":
+		t.replyTo = req.Branch.ReplyTo
+		leaf = req.Branch.ReplyTo
+	case req.Branch.ParentID != "":
+		leaf = req.Branch.ParentID
+	default:
+		return t, nil
+	}
+
+	path, err := repo.Path(leaf)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 || path[len(path)-1].SessionID != req.SessionID {
+		return nil, ErrMessageNotFound
+	}
+
+	if t.replyTo != "" {
+		// The message being answered is sent as the prompt, not as history
+		path = path[:len(path)-1]
+	} else {
+		t.parentID = &leaf
+	}
+	if len(path) > historyLimit {
+		path = path[len(path)-historyLimit:]
+	}
+	t.history = path
+
+	return t, nil
+}
+
+// activeLeaf returns the last message of the session's active branch. A
+// session without one, or whose active message was deleted, uses its newest
+// message.
+func (s *Service) activeLeaf(ctx context.Context, sessionID string) (*database.ChatMessage, error) {
+	repo := s.chatRepo.WithContext(ctx)
+
+	session, err := repo.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	if session.ActiveMessageID != nil {
+		msg, err := repo.GetMessage(sessionID, *session.ActiveMessageID)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+	return repo.LastMessage(sessionID)
+}
+
+// ActivePath returns the messages of the session's active branch, oldest
+// first
+func (s *Service) ActivePath(ctx context.Context, userID, sessionID string) ([]database.ChatMessage, error) {
+	if err := s.ownSession(ctx, userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	leaf, err := s.activeLeaf(ctx, sessionID)
+	if err != nil || leaf == nil {
+		return []database.ChatMessage{}, err
+	}
+	return s.chatRepo.WithContext(ctx).Path(leaf.ID)
+}
+
+// Siblings returns the versions of a message: the messages sharing its
+// parent, oldest first
+func (s *Service) Siblings(ctx context.Context, userID, sessionID, messageID string) ([]database.ChatMessage, error) {
+	msg, err := s.message(ctx, userID, sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return s.chatRepo.WithContext(ctx).Siblings(sessionID, msg.ParentID)
+}
+
+// SetActiveBranch switches the session to the branch through messageID.
+// The branch continues to the most recently written message below it, so
+// switching back to a version restores where the user left it. It returns
+// the new active message.
+func (s *Service) SetActiveBranch(ctx context.Context, userID, sessionID, messageID string) (string, error) {
+	if _, err := s.message(ctx, userID, sessionID, messageID); err != nil {
+		return "", err
+	}
+
+	repo := s.chatRepo.WithContext(ctx)
+	nodes, err := repo.Tree(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	leaf := newestDescendant(nodes, messageID)
+	if err := repo.SetActiveMessage(sessionID, leaf); err != nil {
+		return "", err
+	}
+	return leaf, nil
+}
+
+// newestDescendant returns the most recently created message in the
+// subtree rooted at id (id itself when it has no children)
+func newestDescendant(nodes []database.MessageNode, id string) string {
+	children := make(map[string][]database.MessageNode)
+	for _, n := range nodes {
+		if n.ParentID != nil {
+			children[*n.ParentID] = append(children[*n.ParentID], n)
+		}
+	}
+
+	newest := database.MessageNode{ID: id}
+	stack := []string{id}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range children[current] {
+			if !child.CreatedAt.Before(newest.CreatedAt) {
+				newest = child
+			}
+			stack = append(stack, child.ID)
+		}
+	}
+	return newest.ID
+}
+
+// PrepareEdit returns where an edited version of a user message goes: a
+// new sibling with the same parent
+func (s *Service) PrepareEdit(ctx context.Context, userID, sessionID, messageID string) (*BranchPoint, error) {
+	msg, err := s.message(ctx, userID, sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Role != "user" {
+		return nil, fmt.Errorf("%w: only user messages can be edited", ErrInvalidBranch)
+	}
+
+	point := &BranchPoint{}
+	if msg.ParentID != nil {
+		point.ParentID = *msg.ParentID
+	}
+	return point, nil
+}
+
+// PrepareRegenerate returns the branch point and prompt for a new reply.
+// For an assistant message that is the user message it answered; a user
+// message is answered again directly.
+func (s *Service) PrepareRegenerate(ctx context.Context, userID, sessionID, messageID string) (*BranchPoint, string, error) {
+	msg, err := s.message(ctx, userID, sessionID, messageID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if msg.Role == "assistant" {
+		if msg.ParentID == nil {
+			return nil, "", fmt.Errorf("%w: reply has no prompt to regenerate from", ErrInvalidBranch)
+		}
+		msg, err = s.chatRepo.WithContext(ctx).GetMessage(sessionID, *msg.ParentID)
+		if err != nil {
+			return nil, "", err
+		}
+		if msg == nil {
+			return nil, "", ErrMessageNotFound
+		}
+	}
+	if msg.Role != "user" {
+		return nil, "", fmt.Errorf("%w: only replies to user messages can be regenerated", ErrInvalidBranch)
+	}
+
+	return &BranchPoint{ReplyTo: msg.ID}, msg.Content, nil
+}
+
+// message returns a message of a session owned by userID
+func (s *Service) message(ctx context.Context, userID, sessionID, messageID string) (*database.ChatMessage, error) {
+	if err := s.ownSession(ctx, userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.chatRepo.WithContext(ctx).GetMessage(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+// ownSession checks that the session exists and belongs to userID
+func (s *Service) ownSession(ctx context.Context, userID, sessionID string) error {
+	session, err := s.chatRepo.WithContext(ctx).GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return nil
+}
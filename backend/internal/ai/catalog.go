@@ -0,0 +1,254 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+)
+
+// catalogTTL bounds how stale the cached catalogue may be on instances that
+// did not make an admin change themselves
+const catalogTTL = 30 * time.Second
+
+// Catalog is the model catalogue backed by ai_model_configs. The config
+// file's ai.models only seeds it; after that admins manage it through the
+// API and the gateway sync fills in new models (disabled) and missing
+// context length and pricing.
+type Catalog struct {
+	repo *database.ModelRepository
+
+	mu       sync.RWMutex
+	enabled  []database.ModelConfig
+	loadedAt time.Time
+}
+
+// NewCatalog creates a catalogue reading from db
+func NewCatalog(db *database.DB) *Catalog {
+	return &Catalog{repo: database.NewModelRepository(db)}
+}
+
+// Enabled returns the enabled models, cached for catalogTTL
+func (c *Catalog) Enabled(ctx context.Context) ([]database.ModelConfig, error) {
+	c.mu.RLock()
+	if !c.loadedAt.IsZero() && time.Since(c.loadedAt) < catalogTTL {
+		models := c.enabled
+		c.mu.RUnlock()
+		return models, nil
+	}
+	c.mu.RUnlock()
+
+	models, err := c.repo.WithContext(ctx).List(true)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.enabled = models
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+	return models, nil
+}
+
+// Lookup returns the enabled model called name, or nil
+func (c *Catalog) Lookup(ctx context.Context, name string) (*database.ModelConfig, error) {
+	models, err := c.Enabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range models {
+		if models[i].Name == name {
+			model := models[i]
+			return &model, nil
+		}
+	}
+	return nil, nil
+}
+
+// Invalidate drops the cache so the next read hits the database
+func (c *Catalog) Invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// Default resolves the model used when a request does not pick one:
+// AI_MODEL if it is enabled in the catalogue, else the first enabled model.
+// When the catalogue is empty or unreadable the configured model is used
+// as-is with every capability assumed, so chat keeps working.
+func (c *Catalog) Default(ctx context.Context, cfg *config.AIConfig) *database.ModelConfig {
+	models, err := c.Enabled(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "model catalogue unavailable, using AI_MODEL", "model", cfg.Model, "error", err)
+	}
+	for i := range models {
+		if models[i].Name == cfg.Model {
+			model := models[i]
+			return &model
+		}
+	}
+	if len(models) > 0 {
+		slog.WarnContext(ctx, "AI_MODEL is not enabled in the catalogue, falling back", "model", cfg.Model, "fallback", models[0].Name)
+		model := models[0]
+		return &model
+	}
+
+	return &database.ModelConfig{
+		Name:              cfg.Model,
+		DisplayName:       cfg.Model,
+		Provider:          database.ProviderOf(cfg.Model),
+		MaxTokens:         cfg.MaxTokens,
+		Temperature:       cfg.Temperature,
+		Enabled:           true,
+		SupportsStreaming: true,
+		SupportsTools:     true,
+		SupportsVision:    true,
+	}
+}
+
+// Seed inserts config models the catalogue does not know yet. Existing rows
+// are left alone so admin edits survive restarts and reloads.
+func (c *Catalog) Seed(ctx context.Context, models map[string]config.ModelConfig) (int, error) {
+	repo := c.repo.WithContext(ctx)
+	added := 0
+	for _, m := range models {
+		created, err := repo.CreateIfMissing(&database.ModelConfig{
+			Name:              m.Name,
+			DisplayName:       displayName(m.Name),
+			Provider:          database.ProviderOf(m.Name),
+			MaxTokens:         m.MaxTokens,
+			Temperature:       m.Temperature,
+			Enabled:           m.Enabled,
+			SupportsStreaming: true,
+			SupportsTools:     true,
+			Source:            database.ModelSourceConfig,
+		})
+		if err != nil {
+			return added, err
+		}
+		if created {
+			added++
+		}
+	}
+	if added > 0 {
+		c.Invalidate()
+	}
+	return added, nil
+}
+
+// SyncResult summarises a gateway sync
+type SyncResult struct {
+	Gateway int `json:"gateway"` // models listed by the gateway
+	Added   int `json:"added"`   // new, inserted disabled
+	Updated int `json:"updated"` // already known, metadata refreshed
+}
+
+// Sync pulls the gateway's model list. Unknown models are added disabled
+// for an admin to review; known ones get context length and pricing where
+// the catalogue has none.
+func (c *Catalog) Sync(ctx context.Context, client *Client) (*SyncResult, error) {
+	list, err := client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateway models: %w", err)
+	}
+
+	repo := c.repo.WithContext(ctx)
+	result := &SyncResult{Gateway: len(list)}
+	for _, gm := range list {
+		if gm.ID == "" || (gm.Type != "" && gm.Type != "language") {
+			continue
+		}
+		input, output := perThousand(gm.Pricing.Input), perThousand(gm.Pricing.Output)
+
+		created, err := repo.CreateIfMissing(&database.ModelConfig{
+			Name:              gm.ID,
+			DisplayName:       firstNonEmpty(gm.Name, displayName(gm.ID)),
+			Provider:          firstNonEmpty(gm.OwnedBy, database.ProviderOf(gm.ID)),
+			Description:       gm.Description,
+			ContextLength:     gm.ContextWindow,
+			MaxTokens:         firstPositive(gm.MaxTokens, 4096),
+			Temperature:       0.7,
+			Enabled:           false,
+			InputCostPer1K:    input,
+			OutputCostPer1K:   output,
+			SupportsStreaming: true,
+			SupportsTools:     true,
+			Source:            database.ModelSourceGateway,
+		})
+		if err != nil {
+			return result, err
+		}
+		if err := repo.FillFromGateway(gm.ID, gm.ContextWindow, input, output); err != nil {
+			return result, err
+		}
+		if created {
+			result.Added++
+		} else {
+			result.Updated++
+		}
+	}
+
+	c.Invalidate()
+	return result, nil
+}
+
+// RunSync syncs every interval until ctx is done
+func (c *Catalog) RunSync(ctx context.Context, client *Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := c.Sync(ctx, client)
+			if err != nil {
+				slog.Error("model catalogue sync failed", "error", err)
+				continue
+			}
+			slog.Info("model catalogue synced", "gateway", result.Gateway, "added", result.Added, "updated", result.Updated)
+		}
+	}
+}
+
+// displayName turns "openai/gpt-4o" into "gpt-4o"
+func displayName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// perThousand converts a per-token USD price string to per 1K tokens
+func perThousand(perToken string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(perToken), 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return f * 1000
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
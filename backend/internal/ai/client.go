@@ -13,8 +13,17 @@ import (
 	"time"
 
 	"gryt-backend/internal/config"
+	"gryt-backend/internal/metrics"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("gryt-backend/internal/ai")
+
 // Client represents Vercel AI Gateway client
 type Client struct {
 	baseURL    string
@@ -109,6 +118,12 @@ type ChatRequest struct {
 	Stop              interface{} `json:"stop,omitempty"`
 	Tools             []Tool      `json:"tools,omitempty"`
 	ToolChoice        interface{} `json:"tool_choice,omitempty"`
+	StreamOptions     *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions asks the gateway to append a usage chunk to streams
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatResponse represents chat completion response
@@ -144,6 +159,7 @@ type StreamChunk struct {
 	Created int64    `json:"created"`
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
 }
 
 // ErrorResponse represents API error response
@@ -157,9 +173,27 @@ type ErrorResponse struct {
 }
 
 // CreateChatCompletion creates a non-streaming chat completion
-func (c *Client) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+func (c *Client) CreateChatCompletion(ctx context.Context, req *ChatRequest) (resp *ChatResponse, err error) {
 	req.Stream = false
-	
+
+	ctx, span := startChatSpan(ctx, req)
+	start := time.Now()
+	defer func() {
+		metrics.ObserveAIRequest(req.Model, false, err, time.Since(start))
+		var usage *Usage
+		var toolCalls []string
+		if resp != nil {
+			usage = resp.Usage
+			if usage != nil {
+				metrics.AddTokens(req.Model, usage.PromptTokens, usage.CompletionTokens)
+			}
+			for _, choice := range resp.Choices {
+				toolCalls = appendToolCallNames(toolCalls, choice)
+			}
+		}
+		endChatSpan(span, usage, toolCalls, err)
+	}()
+
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -172,23 +206,24 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*C
 
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 	httpReq.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
 
-	resp, err := c.httpClient.Do(httpReq)
+	httpResp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
+	defer httpResp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if httpResp.StatusCode != http.StatusOK {
 		var errResp ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			return nil, fmt.Errorf("API error (status %d): failed to decode error response", resp.StatusCode)
+		if err := json.NewDecoder(httpResp.Body).Decode(&errResp); err != nil {
+			return nil, fmt.Errorf("API error (status %d): failed to decode error response", httpResp.StatusCode)
 		}
 		return nil, fmt.Errorf("API error: %s (type: %s, code: %s)", errResp.Error.Message, errResp.Error.Type, errResp.Error.Code)
 	}
 
 	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+	if err := json.NewDecoder(httpResp.Body).Decode(&chatResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
@@ -198,33 +233,54 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*C
 // CreateChatCompletionStream creates a streaming chat completion
 func (c *Client) CreateChatCompletionStream(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, <-chan error) {
 	req.Stream = true
-	
+	req.StreamOptions = &StreamOptions{IncludeUsage: true}
+
 	chunkChan := make(chan StreamChunk, 10)
 	errorChan := make(chan error, 1)
 
+	ctx, span := startChatSpan(ctx, req)
+
 	go func() {
 		defer close(chunkChan)
 		defer close(errorChan)
 
+		start := time.Now()
+		firstToken := false
+		var streamErr error
+		var usage *Usage
+		var toolCalls []string
+		defer func() {
+			metrics.ObserveAIRequest(req.Model, true, streamErr, time.Since(start))
+			if usage != nil {
+				metrics.AddTokens(req.Model, usage.PromptTokens, usage.CompletionTokens)
+			}
+			endChatSpan(span, usage, toolCalls, streamErr)
+		}()
+		fail := func(err error) {
+			streamErr = err
+			errorChan <- err
+		}
+
 		reqBody, err := json.Marshal(req)
 		if err != nil {
-			errorChan <- fmt.Errorf("failed to marshal request: %w", err)
+			fail(fmt.Errorf("failed to marshal request: %w", err))
 			return
 		}
 
 		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/chat/completions", bytes.NewReader(reqBody))
 		if err != nil {
-			errorChan <- fmt.Errorf("failed to create request: %w", err)
+			fail(fmt.Errorf("failed to create request: %w", err))
 			return
 		}
 
 		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 		httpReq.Header.Set("Content-Type", "application/json")
 		httpReq.Header.Set("Accept", "text/event-stream")
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
 
 		resp, err := c.httpClient.Do(httpReq)
 		if err != nil {
-			errorChan <- fmt.Errorf("failed to send request: %w", err)
+			fail(fmt.Errorf("failed to send request: %w", err))
 			return
 		}
 		defer resp.Body.Close()
@@ -232,10 +288,10 @@ func (c *Client) CreateChatCompletionStream(ctx context.Context, req *ChatReques
 		if resp.StatusCode != http.StatusOK {
 			var errResp ErrorResponse
 			if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-				errorChan <- fmt.Errorf("API error (status %d): failed to decode error response", resp.StatusCode)
+				fail(fmt.Errorf("API error (status %d): failed to decode error response", resp.StatusCode))
 				return
 			}
-			errorChan <- fmt.Errorf("API error: %s (type: %s, code: %s)", errResp.Error.Message, errResp.Error.Type, errResp.Error.Code)
+			fail(fmt.Errorf("API error: %s (type: %s, code: %s)", errResp.Error.Message, errResp.Error.Type, errResp.Error.Code))
 			return
 		}
 
@@ -244,7 +300,7 @@ func (c *Client) CreateChatCompletionStream(ctx context.Context, req *ChatReques
 		for scanner.Scan() {
 			select {
 			case <-ctx.Done():
-				errorChan <- ctx.Err()
+				fail(ctx.Err())
 				return
 			default:
 			}
@@ -263,20 +319,230 @@ func (c *Client) CreateChatCompletionStream(ctx context.Context, req *ChatReques
 					continue
 				}
 
+				if chunk.Usage != nil {
+					usage = chunk.Usage
+				}
+				for _, choice := range chunk.Choices {
+					toolCalls = appendToolCallNames(toolCalls, choice)
+				}
+				if !firstToken && hasContent(chunk) {
+					firstToken = true
+					ttft := time.Since(start)
+					metrics.ObserveTimeToFirstToken(req.Model, ttft)
+					span.AddEvent("first_token", trace.WithAttributes(attribute.Int64("gen_ai.response.time_to_first_token_ms", ttft.Milliseconds())))
+				}
+
 				chunkChan <- chunk
 			}
 		}
 
 		if err := scanner.Err(); err != nil {
-			errorChan <- fmt.Errorf("failed to read stream: %w", err)
+			fail(fmt.Errorf("failed to read stream: %w", err))
 		}
 	}()
 
 	return chunkChan, errorChan
 }
 
-// GetModels retrieves available models
-func (c *Client) GetModels(ctx context.Context) ([]string, error) {
+// startChatSpan opens the client span for a chat completion call
+func startChatSpan(ctx context.Context, req *ChatRequest) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("gen_ai.operation.name", "chat"),
+		attribute.String("gen_ai.request.model", req.Model),
+		attribute.Bool("gen_ai.request.stream", req.Stream),
+		attribute.Int("gen_ai.request.message_count", len(req.Messages)),
+	}
+	if req.MaxTokens != nil {
+		attrs = append(attrs, attribute.Int("gen_ai.request.max_tokens", *req.MaxTokens))
+	}
+	if req.Temperature != nil {
+		attrs = append(attrs, attribute.Float64("gen_ai.request.temperature", *req.Temperature))
+	}
+	if len(req.Tools) > 0 {
+		names := make([]string, len(req.Tools))
+		for i, tool := range req.Tools {
+			names[i] = tool.Function.Name
+		}
+		attrs = append(attrs, attribute.StringSlice("gen_ai.request.tools", names))
+	}
+
+	return tracer.Start(ctx, "ai.chat_completion",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endChatSpan records usage, requested tool calls and the outcome, then ends
+// the span
+func endChatSpan(span trace.Span, usage *Usage, toolCalls []string, err error) {
+	if usage != nil {
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			attribute.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+		)
+	}
+	if len(toolCalls) > 0 {
+		span.SetAttributes(attribute.StringSlice("gen_ai.response.tool_calls", toolCalls))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func appendToolCallNames(names []string, choice Choice) []string {
+	for _, call := range choice.ToolCalls {
+		// Streamed tool calls repeat with an empty name for argument deltas
+		if call.Function.Name != "" {
+			names = append(names, call.Function.Name)
+		}
+	}
+	return names
+}
+
+// hasContent reports whether a stream chunk carries generated output
+func hasContent(chunk StreamChunk) bool {
+	for _, choice := range chunk.Choices {
+		if choice.Delta == nil {
+			continue
+		}
+		if text, ok := choice.Delta.Content.(string); ok && text != "" {
+			return true
+		}
+		if len(choice.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// APIError is an error response of the gateway
+type APIError struct {
+	StatusCode int
+	Message    string
+	Type       string
+	Code       string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API error (status %d): failed to decode error response", e.StatusCode)
+	}
+	return fmt.Sprintf("API error: %s (type: %s, code: %s)", e.Message, e.Type, e.Code)
+}
+
+// EmbeddingRequest asks for one embedding per input. Dimensions shortens
+// the vectors on models that support it.
+type EmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+// EmbeddingResponse holds the embeddings in Data, matched to the inputs by
+// Index
+type EmbeddingResponse struct {
+	Model string      `json:"model"`
+	Data  []Embedding `json:"data"`
+	Usage *Usage      `json:"usage,omitempty"`
+}
+
+// Embedding is the vector of one input
+type Embedding struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// CreateEmbeddings embeds req.Input and returns the vectors in input order
+func (c *Client) CreateEmbeddings(ctx context.Context, req *EmbeddingRequest) (vectors [][]float32, err error) {
+	ctx, span := tracer.Start(ctx, "ai.embeddings",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.operation.name", "embeddings"),
+			attribute.String("gen_ai.request.model", req.Model),
+			attribute.Int("gen_ai.request.input_count", len(req.Input)),
+		),
+	)
+	start := time.Now()
+	var usage *Usage
+	defer func() {
+		metrics.ObserveAIRequest(req.Model, false, err, time.Since(start))
+		if usage != nil {
+			metrics.AddTokens(req.Model, usage.PromptTokens, 0)
+		}
+		endChatSpan(span, usage, nil, err)
+	}()
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/embeddings", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: httpResp.StatusCode}
+		var errResp ErrorResponse
+		if err := json.NewDecoder(httpResp.Body).Decode(&errResp); err == nil {
+			apiErr.Message, apiErr.Type, apiErr.Code = errResp.Error.Message, errResp.Error.Type, errResp.Error.Code
+		}
+		return nil, apiErr
+	}
+
+	var embResp EmbeddingResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&embResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	usage = embResp.Usage
+
+	vectors = make([][]float32, len(req.Input))
+	for _, e := range embResp.Data {
+		if e.Index < 0 || e.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", e.Index)
+		}
+		vectors[e.Index] = e.Embedding
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// GatewayModel describes a model as listed by the gateway. Fields other
+// than ID are optional; gateways that only return ids leave them zero.
+type GatewayModel struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	OwnedBy       string `json:"owned_by"`
+	Type          string `json:"type"`
+	ContextWindow int    `json:"context_window"`
+	MaxTokens     int    `json:"max_tokens"`
+	Pricing       struct {
+		// USD per token, as decimal strings
+		Input  string `json:"input"`
+		Output string `json:"output"`
+	} `json:"pricing"`
+}
+
+// ListModels retrieves the models offered by the gateway
+func (c *Client) ListModels(ctx context.Context) ([]GatewayModel, error) {
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/v1/models", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -295,17 +561,25 @@ func (c *Client) GetModels(ctx context.Context) ([]string, error) {
 	}
 
 	var modelsResp struct {
-		Data []struct {
-			ID string `json:"id"`
-		} `json:"data"`
+		Data []GatewayModel `json:"data"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	models := make([]string, len(modelsResp.Data))
-	for i, model := range modelsResp.Data {
+	return modelsResp.Data, nil
+}
+
+// GetModels retrieves available model ids
+func (c *Client) GetModels(ctx context.Context) ([]string, error) {
+	list, err := c.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, len(list))
+	for i, model := range list {
 		models[i] = model.ID
 	}
 
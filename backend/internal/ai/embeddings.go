@@ -0,0 +1,314 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/vector"
+)
+
+const (
+	// embedBatch is how many messages go into one embeddings request
+	embedBatch = 64
+	// embedInput is how much of a message is embedded, in runes
+	embedInput = 8000
+	// loadBatch is how many vectors are read per query when loading the
+	// in-process index
+	loadBatch = 1000
+)
+
+var ErrEmbeddingsDisabled = errors.New("semantic search is not enabled")
+
+// EmbeddingsEnabled reports whether an embedding model is configured
+func (s *Service) EmbeddingsEnabled() bool {
+	return s.config().EmbeddingModel != ""
+}
+
+// newVectorIndex creates the configured index, falling back to HNSW
+func newVectorIndex(cfg config.VectorConfig) vector.Index {
+	index, err := vector.New(vector.Config{Backend: cfg.Backend, URL: cfg.URL, APIKey: cfg.APIKey, Collection: cfg.Collection})
+	if err != nil {
+		slog.Error("failed to create vector index, using hnsw", "backend", cfg.Backend, "error", err)
+		return vector.NewHNSW(16, 200, 64)
+	}
+	return index
+}
+
+// RunEmbeddings loads the in-process vector index from the database, then
+// embeds new messages and document chunks every interval, or soon after a
+// chat or document is saved, until ctx is done
+func (s *Service) RunEmbeddings(ctx context.Context, interval time.Duration) {
+	if vector.InMemory(s.vectors) {
+		n, err := s.loadVectors(ctx)
+		if err != nil {
+			slog.Error("failed to load vector index", "loaded", n, "error", err)
+		} else if n > 0 {
+			slog.Info("vector index loaded", "vectors", n)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.EmbedPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("message embedding failed", "embedded", n, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.embedWake:
+		}
+	}
+}
+
+// WakeEmbeddings asks the worker to embed new messages and chunks now
+func (s *Service) WakeEmbeddings() {
+	select {
+	case s.embedWake <- struct{}{}:
+	default:
+	}
+}
+
+// EmbedPending embeds the messages and knowledge base chunks that have no
+// embedding for the current model yet and adds them to the vector index
+func (s *Service) EmbedPending(ctx context.Context) (int, error) {
+	cfg := s.config()
+	model, dims := cfg.EmbeddingModel, cfg.EmbeddingDimensions
+	if model == "" {
+		return 0, nil
+	}
+
+	messages, err := s.embedPendingMessages(ctx, model, dims)
+	if err != nil {
+		return messages, err
+	}
+	chunks, err := s.embedPendingChunks(ctx, model, dims)
+	return messages + chunks, err
+}
+
+// embedPendingMessages embeds messages without an embedding, newest first
+func (s *Service) embedPendingMessages(ctx context.Context, model string, dims int) (int, error) {
+	repo := s.chatRepo.WithContext(ctx)
+	total := 0
+	for {
+		messages, err := repo.PendingEmbeddings(model, dims, embedBatch)
+		if err != nil || len(messages) == 0 {
+			return total, err
+		}
+
+		ids, inputs := make([]string, len(messages)), make([]string, len(messages))
+		for i, msg := range messages {
+			ids[i], inputs[i] = msg.ID, msg.Content
+		}
+		vectors, err := s.embedInputs(ctx, model, dims, ids, inputs)
+		if err != nil {
+			return total, err
+		}
+
+		// Index first: a message is only marked as embedded once it is
+		// searchable
+		items := make([]vector.Item, 0, len(messages))
+		embeddings := make([]database.MessageEmbedding, len(messages))
+		for i, msg := range messages {
+			embeddings[i] = database.MessageEmbedding{MessageID: msg.ID, UserID: msg.UserID, Model: model, Dimensions: dims, Vector: vectors[i]}
+			if vectors[i] != nil {
+				items = append(items, vector.Item{ID: msg.ID, Owner: msg.UserID, Vector: vectors[i]})
+			}
+		}
+		if err := s.vectors.Upsert(ctx, items); err != nil {
+			return total, err
+		}
+		if err := repo.SaveEmbeddings(embeddings); err != nil {
+			return total, err
+		}
+		total += len(items)
+
+		if len(messages) < embedBatch {
+			return total, nil
+		}
+	}
+}
+
+// embedPendingChunks embeds knowledge base chunks without an embedding,
+// oldest document first, then updates the documents' status
+func (s *Service) embedPendingChunks(ctx context.Context, model string, dims int) (int, error) {
+	repo := s.knowledgeRepo.WithContext(ctx)
+	total, seen := 0, false
+	for {
+		chunks, err := repo.PendingChunks(model, dims, embedBatch)
+		if err != nil {
+			return total, err
+		}
+		if len(chunks) == 0 {
+			break
+		}
+		seen = true
+
+		ids, inputs := make([]string, len(chunks)), make([]string, len(chunks))
+		for i, c := range chunks {
+			ids[i], inputs[i] = c.ID, c.Content
+		}
+		vectors, err := s.embedInputs(ctx, model, dims, ids, inputs)
+		if err != nil {
+			return total, err
+		}
+
+		items := make([]vector.Item, 0, len(chunks))
+		embeddings := make([]database.ChunkEmbedding, len(chunks))
+		for i, c := range chunks {
+			embeddings[i] = database.ChunkEmbedding{ChunkID: c.ID, KnowledgeBaseID: c.KnowledgeBaseID, Model: model, Dimensions: dims, Vector: vectors[i]}
+			if vectors[i] != nil {
+				items = append(items, vector.Item{ID: c.ID, Owner: knowledgeOwner(c.KnowledgeBaseID), Vector: vectors[i]})
+			}
+		}
+		if err := s.vectors.Upsert(ctx, items); err != nil {
+			return total, err
+		}
+		if err := repo.SaveEmbeddings(embeddings); err != nil {
+			return total, err
+		}
+		total += len(items)
+
+		if len(chunks) < embedBatch {
+			break
+		}
+	}
+
+	if !seen {
+		return total, nil
+	}
+	return total, repo.SyncDocumentStatus(model, dims)
+}
+
+// embedInputs embeds a batch of texts identified by ids. When the gateway
+// rejects the batch each input is tried alone; those it rejects get a nil
+// vector so they are not retried.
+func (s *Service) embedInputs(ctx context.Context, model string, dims int, ids, texts []string) ([][]float32, error) {
+	inputs := make([]string, len(texts))
+	for i, text := range texts {
+		inputs[i] = excerpt(text, embedInput)
+	}
+
+	vectors, err := s.client.CreateEmbeddings(ctx, &EmbeddingRequest{Model: model, Input: inputs, Dimensions: dims})
+	switch {
+	case err == nil:
+		return vectors, nil
+	case !rejected(err):
+		return nil, err
+	case len(inputs) == 1:
+		slog.Warn("input cannot be embedded", "id", ids[0], "error", err)
+		return make([][]float32, 1), nil
+	}
+
+	vectors = make([][]float32, len(inputs))
+	for i := range inputs {
+		one, err := s.client.CreateEmbeddings(ctx, &EmbeddingRequest{Model: model, Input: inputs[i : i+1], Dimensions: dims})
+		switch {
+		case err == nil:
+			vectors[i] = one[0]
+		case rejected(err):
+			slog.Warn("input cannot be embedded", "id", ids[i], "error", err)
+		default:
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+// rejected reports whether the gateway refused the input itself, as
+// opposed to failing
+func rejected(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// loadVectors fills the in-process index with the stored message and
+// chunk vectors of the current model
+func (s *Service) loadVectors(ctx context.Context) (int, error) {
+	cfg := s.config()
+	model, dims := cfg.EmbeddingModel, cfg.EmbeddingDimensions
+	if model == "" {
+		return 0, nil
+	}
+
+	repo := s.chatRepo.WithContext(ctx)
+	total, after := 0, ""
+	for {
+		embeddings, err := repo.Embeddings(model, dims, after, loadBatch)
+		if err != nil {
+			return total, err
+		}
+
+		items := make([]vector.Item, len(embeddings))
+		for i, e := range embeddings {
+			items[i] = vector.Item{ID: e.MessageID, Owner: e.UserID, Vector: e.Vector}
+		}
+		if err := s.vectors.Upsert(ctx, items); err != nil {
+			return total, err
+		}
+		total += len(items)
+
+		if len(embeddings) < loadBatch {
+			break
+		}
+		after = embeddings[len(embeddings)-1].MessageID
+	}
+
+	kb := s.knowledgeRepo.WithContext(ctx)
+	after = ""
+	for {
+		embeddings, err := kb.Embeddings(model, dims, after, loadBatch)
+		if err != nil {
+			return total, err
+		}
+
+		items := make([]vector.Item, len(embeddings))
+		for i, e := range embeddings {
+			items[i] = vector.Item{ID: e.ChunkID, Owner: knowledgeOwner(e.KnowledgeBaseID), Vector: e.Vector}
+		}
+		if err := s.vectors.Upsert(ctx, items); err != nil {
+			return total, err
+		}
+		total += len(items)
+
+		if len(embeddings) < loadBatch {
+			return total, nil
+		}
+		after = embeddings[len(embeddings)-1].ChunkID
+	}
+}
+
+// SearchSimilar returns up to k of the user's messages closest in meaning
+// to query, best first. Messages of deleted sessions may be included.
+func (s *Service) SearchSimilar(ctx context.Context, userID, query string, k int) ([]vector.Match, error) {
+	cfg := s.config()
+	if cfg.EmbeddingModel == "" {
+		return nil, ErrEmbeddingsDisabled
+	}
+
+	vectors, err := s.client.CreateEmbeddings(ctx, &EmbeddingRequest{
+		Model:      cfg.EmbeddingModel,
+		Input:      []string{excerpt(query, embedInput)},
+		Dimensions: cfg.EmbeddingDimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.vectors.Search(ctx, userID, vectors[0], k)
+}
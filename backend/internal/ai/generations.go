@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gryt-backend/internal/metrics"
+)
+
+// ErrShuttingDown is returned for chats started while the server drains,
+// and is the cancel cause of generations aborted when the drain window ends
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Generations tracks in-flight chat generations so shutdown can wait for
+// them. Once Drain is called no new generation may start.
+type Generations struct {
+	mu       sync.Mutex
+	active   map[uint64]context.CancelCauseFunc
+	nextID   uint64
+	draining bool
+	drained  chan struct{}
+}
+
+// NewGenerations creates an empty tracker
+func NewGenerations() *Generations {
+	return &Generations{
+		active: make(map[uint64]context.CancelCauseFunc),
+	}
+}
+
+// Begin registers a generation. The returned context is cancelled with
+// ErrShuttingDown when Abort is called; done must be called when the
+// generation (including persisting it) has finished.
+func (g *Generations) Begin(ctx context.Context) (context.Context, func(), error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.draining {
+		return nil, nil, ErrShuttingDown
+	}
+
+	genCtx, cancel := context.WithCancelCause(ctx)
+	id := g.nextID
+	g.nextID++
+	g.active[id] = cancel
+	stopGauge := metrics.GenerationStarted()
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			stopGauge()
+			cancel(nil)
+
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			delete(g.active, id)
+			if g.draining && len(g.active) == 0 {
+				close(g.drained)
+			}
+		})
+	}
+	return genCtx, done, nil
+}
+
+// Active returns the number of generations in flight
+func (g *Generations) Active() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.active)
+}
+
+// Draining reports whether Drain has been called
+func (g *Generations) Draining() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.draining
+}
+
+// Drain stops new generations from starting and waits until the in-flight
+// ones finish or ctx expires
+func (g *Generations) Drain(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.draining {
+		g.draining = true
+		g.drained = make(chan struct{})
+		if len(g.active) == 0 {
+			close(g.drained)
+		}
+	}
+	drained := g.drained
+	g.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Abort cancels every in-flight generation. Streaming generations persist
+// what they produced so far before returning.
+func (g *Generations) Abort() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, cancel := range g.active {
+		cancel(ErrShuttingDown)
+	}
+}
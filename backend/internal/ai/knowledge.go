@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/models"
+	"gryt-backend/internal/vector"
+)
+
+const (
+	// knowledgeMinScore drops chunks too far from the question to help
+	knowledgeMinScore = 0.25
+	// citationExcerpt is how much of a chunk a citation quotes, in runes
+	citationExcerpt = 200
+)
+
+// knowledgeOwner is the vector index owner of a knowledge base's chunks,
+// kept apart from the user IDs that own message vectors
+func knowledgeOwner(kbID string) string {
+	return "kb:" + kbID
+}
+
+// ForgetVectors removes chunks of deleted documents from the vector index
+func (s *Service) ForgetVectors(ctx context.Context, ids []string) error {
+	return s.vectors.Delete(ctx, ids)
+}
+
+// retrieval is what a turn found in the session's knowledge bases
+type retrieval struct {
+	citations []models.Citation
+	passages  []string // chunk text, in citation order
+}
+
+// message gives the passages to the model as numbered sources
+func (r *retrieval) message() Message {
+	var b strings.Builder
+	b.WriteString("The following excerpts come from the user's documents. Use them when they are relevant " +
+		"to the question and cite them by number in square brackets, e.g. [1]. If they do not contain the " +
+		"answer, say so instead of guessing.\n")
+	for i, c := range r.citations {
+		fmt.Fprintf(&b, "\n[%d] %s, page %d:\n%s\n", c.Index, c.DocumentName, c.Page, r.passages[i])
+	}
+	return NewTextMessage("system", b.String())
+}
+
+// retrieve returns the cfg.KnowledgeTopK chunks of the session's knowledge
+// bases closest to query, best first, or nil when the session has none
+// attached or nothing is close enough. A failure is logged and the turn
+// goes on without sources.
+func (s *Service) retrieve(ctx context.Context, cfg *config.AIConfig, sessionID, query string) *retrieval {
+	if cfg.KnowledgeTopK == 0 || cfg.EmbeddingModel == "" || strings.TrimSpace(query) == "" {
+		return nil
+	}
+	r, err := s.searchKnowledge(ctx, cfg, sessionID, query)
+	if err != nil {
+		slog.WarnContext(ctx, "knowledge retrieval failed", "session_id", sessionID, "error", err)
+		return nil
+	}
+	return r
+}
+
+func (s *Service) searchKnowledge(ctx context.Context, cfg *config.AIConfig, sessionID, query string) (*retrieval, error) {
+	repo := s.knowledgeRepo.WithContext(ctx)
+	kbIDs, err := repo.SessionBases(sessionID)
+	if err != nil || len(kbIDs) == 0 {
+		return nil, err
+	}
+
+	vectors, err := s.client.CreateEmbeddings(ctx, &EmbeddingRequest{
+		Model:      cfg.EmbeddingModel,
+		Input:      []string{excerpt(query, embedInput)},
+		Dimensions: cfg.EmbeddingDimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k := cfg.KnowledgeTopK
+	var matches []vector.Match
+	for _, id := range kbIDs {
+		found, err := s.vectors.Search(ctx, knowledgeOwner(id), vectors[0], k)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range found {
+			if m.Score >= knowledgeMinScore {
+				matches = append(matches, m)
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	// Chunks of documents deleted since they were indexed are skipped
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	hits, err := repo.GetChunks(kbIDs, ids)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make(map[string]database.ChunkHit, len(hits))
+	for _, h := range hits {
+		chunks[h.ID] = h
+	}
+
+	r := &retrieval{}
+	for _, m := range matches {
+		h, ok := chunks[m.ID]
+		if !ok {
+			continue
+		}
+		r.citations = append(r.citations, models.Citation{
+			Index:           len(r.citations) + 1,
+			KnowledgeBaseID: h.KnowledgeBaseID,
+			DocumentID:      h.DocumentID,
+			DocumentName:    h.DocumentName,
+			Page:            h.Page,
+			ChunkID:         h.ID,
+			Score:           m.Score,
+			Excerpt:         excerpt(h.Content, citationExcerpt),
+		})
+		r.passages = append(r.passages, h.Content)
+	}
+	if len(r.citations) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/models"
+)
+
+// ErrInvalidParams is returned when the requested model or parameters are
+// not allowed by the model catalogue
+var ErrInvalidParams = errors.New("invalid generation parameters")
+
+// MaxSystemPrompt keeps session and persona prompts well inside the TEXT
+// column and the model's context
+const MaxSystemPrompt = 16000
+
+// Generation is the resolved model, parameters and persona settings for one
+// chat turn
+type Generation struct {
+	Model       *database.ModelConfig
+	Temperature float64
+	MaxTokens   int
+	TopP        float64
+
+	PersonaID    string
+	SystemPrompt string   // empty = configured system prompt
+	AllowedTools []string // nil = every enabled tool
+}
+
+// Metadata records the effective parameters on a generated message
+func (g *Generation) Metadata() models.MessageMetadata {
+	temperature, topP := g.Temperature, g.TopP
+	return models.MessageMetadata{
+		Model:       g.Model.Name,
+		Temperature: &temperature,
+		MaxTokens:   g.MaxTokens,
+		TopP:        &topP,
+		PersonaID:   g.PersonaID,
+	}
+}
+
+// ResolveGeneration picks the model and parameters for req: values in the
+// request win over the session defaults, then the session's persona, then
+// the configured defaults. Explicit choices are validated against the
+// catalogue and rejected with ErrInvalidParams; the configured max_tokens is
+// only capped. The session's own system prompt wins over the persona's.
+// A session that is missing, trashed or another user's is ErrSessionNotFound.
+func (s *Service) ResolveGeneration(ctx context.Context, userID string, req *ServiceChatRequest) (*Generation, error) {
+	var defaults models.GenerationParams
+	var persona *database.Persona
+	var systemPrompt string
+	session, err := s.chatRepo.WithContext(ctx).GetSession(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserID != userID {
+		return nil, ErrSessionNotFound
+	}
+	defaults = session.Params
+	if session.PersonaID != nil {
+		persona, err = s.Persona(ctx, userID, *session.PersonaID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if session.SystemPrompt != nil {
+		systemPrompt = *session.SystemPrompt
+	}
+	if persona != nil {
+		defaults = defaults.Merge(persona.Params)
+	}
+
+	gen, err := s.resolveParams(ctx, s.config(), req.Params.Merge(defaults))
+	if err != nil {
+		return nil, err
+	}
+	if persona != nil {
+		gen.PersonaID = persona.ID
+		gen.AllowedTools = persona.AllowedTools
+		if systemPrompt == "" {
+			systemPrompt = persona.SystemPrompt
+		}
+	}
+	gen.SystemPrompt = systemPrompt
+
+	// A regenerated reply gets the attachments of the message it answers
+	if req.Branch != nil && req.Branch.ReplyTo != "" && req.Attachments == nil {
+		req.Attachments, err = s.messageAttachments(ctx, req.Branch.ReplyTo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkAttachments(gen.Model, req.Attachments); err != nil {
+		return nil, err
+	}
+
+	return gen, nil
+}
+
+// Persona returns the persona called id if userID may use it (own or
+// global), or nil
+func (s *Service) Persona(ctx context.Context, userID, id string) (*database.Persona, error) {
+	persona, err := s.personaRepo.WithContext(ctx).GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if persona == nil || (!persona.IsGlobal() && *persona.UserID != userID) {
+		return nil, nil
+	}
+	return persona, nil
+}
+
+// ValidateParams checks params that are about to be stored as session
+// defaults
+func (s *Service) ValidateParams(ctx context.Context, params models.GenerationParams) error {
+	_, err := s.resolveParams(ctx, s.config(), params)
+	return err
+}
+
+func (s *Service) resolveParams(ctx context.Context, cfg *config.AIConfig, params models.GenerationParams) (*Generation, error) {
+	var model *database.ModelConfig
+	if params.Model != "" {
+		var err error
+		model, err = s.catalog.Lookup(ctx, params.Model)
+		if err != nil {
+			return nil, err
+		}
+		if model == nil {
+			return nil, fmt.Errorf("%w: model %q is not available", ErrInvalidParams, params.Model)
+		}
+	} else {
+		model = s.catalog.Default(ctx, cfg)
+	}
+
+	gen := &Generation{
+		Model:       model,
+		Temperature: cfg.Temperature,
+		MaxTokens:   capTokens(cfg.MaxTokens, model),
+		TopP:        cfg.TopP,
+	}
+
+	if params.Temperature != nil {
+		if *params.Temperature < 0 || *params.Temperature > 2 {
+			return nil, fmt.Errorf("%w: temperature must be between 0 and 2", ErrInvalidParams)
+		}
+		gen.Temperature = *params.Temperature
+	}
+	if params.TopP != nil {
+		if *params.TopP <= 0 || *params.TopP > 1 {
+			return nil, fmt.Errorf("%w: top_p must be greater than 0 and at most 1", ErrInvalidParams)
+		}
+		gen.TopP = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		limit := model.MaxTokens
+		if limit <= 0 {
+			limit = model.ContextLength
+		}
+		if *params.MaxTokens < 1 || (limit > 0 && *params.MaxTokens > limit) {
+			return nil, fmt.Errorf("%w: max_tokens must be between 1 and %d for %s", ErrInvalidParams, limit, model.Name)
+		}
+		gen.MaxTokens = *params.MaxTokens
+	}
+
+	return gen, nil
+}
+
+// capTokens limits the configured max_tokens to what model allows
+func capTokens(maxTokens int, model *database.ModelConfig) int {
+	if model.MaxTokens > 0 && maxTokens > model.MaxTokens {
+		return model.MaxTokens
+	}
+	return maxTokens
+}
+
+// messageAttachments returns the attachments a message was sent with
+func (s *Service) messageAttachments(ctx context.Context, messageID string) ([]database.Attachment, error) {
+	linked, err := s.attachmentRepo.WithContext(ctx).ForMessages([]string{messageID})
+	if err != nil {
+		return nil, err
+	}
+	attachments := make([]database.Attachment, len(linked))
+	for i, a := range linked {
+		attachments[i] = a.Attachment
+	}
+	return attachments, nil
+}
+
+// attachmentIDs returns the IDs of attachments, in order
+func attachmentIDs(attachments []database.Attachment) []string {
+	ids := make([]string, len(attachments))
+	for i, a := range attachments {
+		ids[i] = a.ID
+	}
+	return ids
+}
@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/models"
+)
+
+// newTestParamsService returns a service whose catalogue is already cached,
+// so resolving parameters needs no database
+func newTestParamsService(defaultModel string) *Service {
+	return &Service{
+		settings: config.NewStaticStore(&config.Config{AI: config.AIConfig{
+			Model:       defaultModel,
+			Temperature: 0.7,
+			MaxTokens:   8000,
+			TopP:        0.9,
+		}}),
+		catalog: &Catalog{
+			enabled: []database.ModelConfig{
+				{Name: "gpt-4o", MaxTokens: 4096, ContextLength: 128000},
+				{Name: "llama-3-8b", ContextLength: 8192},
+				{Name: "unbounded"},
+			},
+			loadedAt: time.Now(),
+		},
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	float := func(f float64) *float64 { return &f }
+	integer := func(i int) *int { return &i }
+
+	tests := []struct {
+		name         string
+		defaultModel string
+		params       models.GenerationParams
+		want         Generation // Model holds only the name
+		wantErr      string
+	}{
+		{
+			name:         "configured defaults, max_tokens capped to the model",
+			defaultModel: "gpt-4o",
+			want:         Generation{Temperature: 0.7, MaxTokens: 4096, TopP: 0.9},
+		},
+		{
+			name:         "AI_MODEL not enabled falls back to the first model",
+			defaultModel: "retired-model",
+			want:         Generation{Temperature: 0.7, MaxTokens: 4096, TopP: 0.9},
+		},
+		{
+			name:   "model without a max_tokens limit keeps the configured value",
+			params: models.GenerationParams{Model: "llama-3-8b"},
+			want:   Generation{Temperature: 0.7, MaxTokens: 8000, TopP: 0.9},
+		},
+		{
+			name: "explicit values",
+			params: models.GenerationParams{Model: "gpt-4o", Temperature: float(0), MaxTokens: integer(1),
+				TopP: float(1)},
+			want: Generation{Temperature: 0, MaxTokens: 1, TopP: 1},
+		},
+		{name: "temperature 2", params: models.GenerationParams{Temperature: float(2)},
+			want: Generation{Temperature: 2, MaxTokens: 4096, TopP: 0.9}},
+		{name: "max_tokens at the model limit", params: models.GenerationParams{MaxTokens: integer(4096)},
+			want: Generation{Temperature: 0.7, MaxTokens: 4096, TopP: 0.9}},
+		{name: "max_tokens up to the context length", params: models.GenerationParams{Model: "llama-3-8b", MaxTokens: integer(8192)},
+			want: Generation{Temperature: 0.7, MaxTokens: 8192, TopP: 0.9}},
+		{name: "max_tokens on a model without limits", params: models.GenerationParams{Model: "unbounded", MaxTokens: integer(1 << 20)},
+			want: Generation{Temperature: 0.7, MaxTokens: 1 << 20, TopP: 0.9}},
+
+		{name: "unknown model", params: models.GenerationParams{Model: "gpt-5"}, wantErr: `model "gpt-5" is not available`},
+		{name: "negative temperature", params: models.GenerationParams{Temperature: float(-0.1)}, wantErr: "temperature"},
+		{name: "temperature above 2", params: models.GenerationParams{Temperature: float(2.01)}, wantErr: "temperature"},
+		{name: "top_p 0", params: models.GenerationParams{TopP: float(0)}, wantErr: "top_p"},
+		{name: "top_p above 1", params: models.GenerationParams{TopP: float(1.5)}, wantErr: "top_p"},
+		{name: "max_tokens 0", params: models.GenerationParams{MaxTokens: integer(0)}, wantErr: "max_tokens must be between 1 and 4096 for gpt-4o"},
+		{name: "max_tokens above the model limit", params: models.GenerationParams{MaxTokens: integer(4097)}, wantErr: "between 1 and 4096"},
+		{name: "max_tokens above the context length", params: models.GenerationParams{Model: "llama-3-8b", MaxTokens: integer(8193)},
+			wantErr: "between 1 and 8192 for llama-3-8b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.defaultModel == "" {
+				tt.defaultModel = "gpt-4o"
+			}
+			s := newTestParamsService(tt.defaultModel)
+			gen, err := s.resolveParams(context.Background(), s.config(), tt.params)
+			if verr := s.ValidateParams(context.Background(), tt.params); (verr == nil) != (err == nil) {
+				t.Errorf("ValidateParams = %v, resolveParams = %v", verr, err)
+			}
+
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidParams) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want ErrInvalidParams with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantModel := tt.params.Model
+			if wantModel == "" {
+				wantModel = "gpt-4o"
+			}
+			if gen.Model == nil || gen.Model.Name != wantModel {
+				t.Errorf("model = %+v, want %s", gen.Model, wantModel)
+			}
+			if gen.Temperature != tt.want.Temperature || gen.MaxTokens != tt.want.MaxTokens || gen.TopP != tt.want.TopP {
+				t.Errorf("temperature, max_tokens, top_p = %v, %d, %v; want %v, %d, %v",
+					gen.Temperature, gen.MaxTokens, gen.TopP, tt.want.Temperature, tt.want.MaxTokens, tt.want.TopP)
+			}
+		})
+	}
+}
+
+// Request values win over the session's, which win over the persona's
+func TestGenerationParamsPrecedence(t *testing.T) {
+	float := func(f float64) *float64 { return &f }
+	integer := func(i int) *int { return &i }
+
+	request := models.GenerationParams{Temperature: float(0.1)}
+	session := models.GenerationParams{Model: "llama-3-8b", Temperature: float(0.5)}
+	persona := models.GenerationParams{Model: "gpt-4o", Temperature: float(1.5), MaxTokens: integer(100)}
+
+	s := newTestParamsService("gpt-4o")
+	gen, err := s.resolveParams(context.Background(), s.config(), request.Merge(session.Merge(persona)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Model.Name != "llama-3-8b" || gen.Temperature != 0.1 || gen.MaxTokens != 100 || gen.TopP != 0.9 {
+		t.Errorf("generation = %s, %v, %d, %v; want llama-3-8b, 0.1, 100, 0.9", gen.Model.Name, gen.Temperature, gen.MaxTokens, gen.TopP)
+	}
+
+	meta := gen.Metadata()
+	if meta.Model != "llama-3-8b" || *meta.Temperature != 0.1 || meta.MaxTokens != 100 || *meta.TopP != 0.9 {
+		t.Errorf("metadata = %+v", meta)
+	}
+}
@@ -8,62 +8,129 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"mime/multipart"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"gryt-backend/internal/config"
 	"gryt-backend/internal/database"
+	"gryt-backend/internal/extract"
 	"gryt-backend/internal/models"
+	"gryt-backend/internal/storage"
+	"gryt-backend/internal/vector"
 )
 
 // Service provides AI-related business logic
 type Service struct {
-	client     *Client
-	db         *database.DB
-	config     *config.AIConfig
-	chatRepo   *database.ChatRepository
-	searchRepo *database.SearchRepository
-	toolExec   *ToolExecutor
+	client      *Client
+	db          *database.DB
+	settings    *config.Store
+	chatRepo    *database.ChatRepository
+	searchRepo  *database.SearchRepository
+	toolExec    *ToolExecutor
+	catalog     *Catalog
+	personaRepo *database.PersonaRepository
+	generations *Generations  // in-flight chats, drained on shutdown
+	titling     sync.Map      // session IDs with a title being generated
+	vectors     vector.Index  // message and chunk embeddings
+	embedWake   chan struct{} // nudges the embedding worker
+
+	knowledgeRepo  *database.KnowledgeRepository
+	attachmentRepo *database.AttachmentRepository
+	blobs          storage.Store // attachment bytes
 }
 
 // NewService creates a new AI service
-func NewService(client *Client, db *database.DB, config *config.AIConfig) *Service {
+func NewService(client *Client, db *database.DB, settings *config.Store, blobs storage.Store) *Service {
 	chatRepo := database.NewChatRepository(db)
 	searchRepo := database.NewSearchRepository(db)
 	toolExec := NewToolExecutor()
 	
 	return &Service{
-		client:     client,
-		db:         db,
-		config:     config,
-		chatRepo:   chatRepo,
-		searchRepo: searchRepo,
-		toolExec:   toolExec,
+		client:      client,
+		db:          db,
+		settings:    settings,
+		chatRepo:    chatRepo,
+		searchRepo:  searchRepo,
+		toolExec:    toolExec,
+		catalog:     NewCatalog(db),
+		personaRepo: database.NewPersonaRepository(db),
+		generations: NewGenerations(),
+		vectors:     newVectorIndex(settings.Get().AI.Vector),
+		embedWake:   make(chan struct{}, 1),
+
+		knowledgeRepo:  database.NewKnowledgeRepository(db),
+		attachmentRepo: database.NewAttachmentRepository(db),
+		blobs:          blobs,
 	}
 }
 
+// config returns the current AI configuration snapshot. Read it once per
+// request so a reload mid-request cannot mix old and new values.
+func (s *Service) config() *config.AIConfig {
+	return &s.settings.Get().AI
+}
+
 // GetDB returns the database connection
 func (s *Service) GetDB() *database.DB {
 	return s.db
 }
 
+// GetClient returns the AI gateway client
+func (s *Service) GetClient() *Client {
+	return s.client
+}
+
+// Generations returns the in-flight generation tracker
+func (s *Service) Generations() *Generations {
+	return s.generations
+}
+
+// Catalog returns the model catalogue
+func (s *Service) Catalog() *Catalog {
+	return s.catalog
+}
+
+// DefaultModel returns the model used when a request does not pick one
+func (s *Service) DefaultModel(ctx context.Context) *database.ModelConfig {
+	return s.catalog.Default(ctx, s.config())
+}
+
 // ServiceChatRequest represents a chat request from user
 type ServiceChatRequest struct {
-	SessionID string                `json:"session_id"`
-	Message   string                `json:"message"`
-	Files     []*multipart.FileHeader `json:"-"`
-	Stream    bool                  `json:"stream,omitempty"`
+	SessionID string                  `json:"session_id"`
+	Message   string                  `json:"message"`
+	Stream    bool                    `json:"stream,omitempty"`
+	Params    models.GenerationParams `json:"params,omitempty"`
+
+	// Attachments are stored uploads sent with the message; they are
+	// linked to the saved user message
+	Attachments []database.Attachment `json:"-"`
+
+	// Generation is the result of ResolveGeneration when the caller has
+	// already validated the request; resolved again when nil
+	Generation *Generation `json:"-"`
+
+	// Branch edits or regenerates instead of continuing the active branch
+	Branch *BranchPoint `json:"-"`
+	// Reply is the saved assistant message, set before the stream's
+	// channels close
+	Reply *database.ChatMessage `json:"-"`
 }
 
 // ServiceChatResponse represents a chat response
 type ServiceChatResponse struct {
-	ID        string    `json:"id"`
-	SessionID string    `json:"session_id"`
-	Message   string    `json:"message"`
-	Tokens    int       `json:"tokens"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string            `json:"id"`
+	SessionID string            `json:"session_id"`
+	MessageID string            `json:"message_id"` // the saved reply
+	ParentID  string            `json:"parent_id"`  // the user message it answers
+	Message   string            `json:"message"`
+	Model     string            `json:"model"`
+	Tokens    int               `json:"tokens"`
+	Citations []models.Citation `json:"citations,omitempty"` // knowledge base passages it was given
+	CreatedAt time.Time         `json:"created_at"`
 }
 
 // SearchRequest represents a search request
@@ -93,26 +160,62 @@ type SearchResult struct {
 
 // ProcessChatMessage processes a chat message with AI
 func (s *Service) ProcessChatMessage(ctx context.Context, userID string, req *ServiceChatRequest) (*ServiceChatResponse, error) {
-	// Get conversation history
-	history, err := s.getChatHistory(ctx, req.SessionID, 10)
+	ctx, done, err := s.generations.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	gen, err := s.generation(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.processChatMessage(ctx, s.config(), gen, userID, req)
+}
+
+// generation returns the request's resolved parameters. Either way the
+// session must belong to userID: it is replayed and written to.
+func (s *Service) generation(ctx context.Context, userID string, req *ServiceChatRequest) (*Generation, error) {
+	if req.Generation == nil {
+		return s.ResolveGeneration(ctx, userID, req)
+	}
+	if err := s.ownSession(ctx, userID, req.SessionID); err != nil {
+		return nil, err
+	}
+	return req.Generation, nil
+}
+
+// processChatMessage runs one non-streaming chat turn
+func (s *Service) processChatMessage(ctx context.Context, cfg *config.AIConfig, gen *Generation, userID string, req *ServiceChatRequest) (*ServiceChatResponse, error) {
+	started := time.Now()
+
+	// Get conversation history along the branch
+	t, err := s.loadTurn(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chat history: %w", err)
 	}
+	history := t.history
 
 	// Build messages array
 	messages := make([]Message, 0, len(history)+1)
 	
 	// Add system message
-	systemMsg := s.buildSystemMessage()
+	systemMsg := s.buildSystemMessage(cfg, gen)
 	messages = append(messages, systemMsg)
+
+	// Add passages from the session's knowledge bases
+	sources := s.retrieve(ctx, cfg, req.SessionID, req.Message)
+	if sources != nil {
+		messages = append(messages, sources.message())
+	}
 	
 	// Add conversation history
 	for _, msg := range history {
-		messages = append(messages, NewTextMessage(msg.Role, msg.Content.Text))
+		messages = append(messages, NewTextMessage(msg.Role, msg.Content))
 	}
 
 	// Process user message with files if any
-	userMessage, err := s.buildUserMessage(req.Message, req.Files)
+	userMessage, err := s.buildUserMessage(ctx, gen.Model, req.Message, req.Attachments)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build user message: %w", err)
 	}
@@ -120,21 +223,22 @@ func (s *Service) ProcessChatMessage(ctx context.Context, userID string, req *Se
 
 	// Create AI request
 	aiReq := &ChatRequest{
-		Model:            s.config.Model,
+		Model:            gen.Model.Name,
 		Messages:         messages,
-		Temperature:      &s.config.Temperature,
-		MaxTokens:        &s.config.MaxTokens,
-		TopP:             &s.config.TopP,
-		FrequencyPenalty: &s.config.FrequencyPenalty,
-		PresencePenalty:  &s.config.PresencePenalty,
-		Stream:           req.Stream,
-		Tools:            s.getAvailableTools(),
-		ToolChoice:       "auto",
+		Temperature:      &gen.Temperature,
+		MaxTokens:        &gen.MaxTokens,
+		TopP:             &gen.TopP,
+		FrequencyPenalty: &cfg.FrequencyPenalty,
+		PresencePenalty:  &cfg.PresencePenalty,
+	}
+	if gen.Model.SupportsTools {
+		aiReq.Tools = s.getAvailableTools(cfg, gen.AllowedTools)
+		aiReq.ToolChoice = "auto"
 	}
 	
 	// Add stop sequences if configured
-	if len(s.config.Stop) > 0 {
-		aiReq.Stop = s.config.Stop
+	if len(cfg.Stop) > 0 {
+		aiReq.Stop = cfg.Stop
 	}
 
 	// Call AI API
@@ -152,7 +256,7 @@ func (s *Service) ProcessChatMessage(ctx context.Context, userID string, req *Se
 	
 	// Handle tool calls if present
 	if len(choice.ToolCalls) > 0 {
-		toolResults, err := s.handleToolCalls(ctx, choice.ToolCalls)
+		toolResults, err := s.handleToolCalls(ctx, cfg, gen, choice.ToolCalls)
 		if err != nil {
 			return nil, fmt.Errorf("failed to handle tool calls: %w", err)
 		}
@@ -170,15 +274,26 @@ func (s *Service) ProcessChatMessage(ctx context.Context, userID string, req *Se
 	}
 
 	// Save messages to database
-	if err := s.saveChatMessages(ctx, userID, req.SessionID, req.Message, responseContent, tokens); err != nil {
+	meta := gen.Metadata()
+	meta.TokensUsed = tokens
+	meta.Latency = time.Since(started).Milliseconds()
+	if sources != nil {
+		meta.Citations = sources.citations
+	}
+	reply, err := s.saveChatMessages(ctx, userID, req, t, responseContent, tokens, meta)
+	if err != nil {
 		return nil, fmt.Errorf("failed to save chat messages: %w", err)
 	}
 
 	return &ServiceChatResponse{
 		ID:        aiResp.ID,
 		SessionID: req.SessionID,
+		MessageID: reply.ID,
+		ParentID:  *reply.ParentID,
 		Message:   responseContent,
+		Model:     gen.Model.Name,
 		Tokens:    tokens,
+		Citations: meta.Citations,
 		CreatedAt: time.Now(),
 	}, nil
 }
@@ -188,31 +303,69 @@ func (s *Service) ProcessChatMessageStream(ctx context.Context, userID string, r
 	responseChan := make(chan string, 10)
 	errorChan := make(chan error, 1)
 
+	ctx, done, err := s.generations.Begin(ctx)
+	if err != nil {
+		errorChan <- err
+		close(errorChan)
+		close(responseChan)
+		return responseChan, errorChan
+	}
+
 	go func() {
+		defer done()
 		defer close(responseChan)
 		defer close(errorChan)
 
-		// Get conversation history
-		history, err := s.getChatHistory(ctx, req.SessionID, 10)
+		cfg := s.config()
+		started := time.Now()
+		gen, err := s.generation(ctx, userID, req)
+		if err != nil {
+			errorChan <- err
+			return
+		}
+
+		if !gen.Model.SupportsStreaming {
+			// Deliver the whole reply as a single chunk
+			resp, err := s.processChatMessage(ctx, cfg, gen, userID, req)
+			if err != nil {
+				errorChan <- err
+				return
+			}
+			select {
+			case responseChan <- resp.Message:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		// Get conversation history along the branch
+		t, err := s.loadTurn(ctx, req)
 		if err != nil {
 			errorChan <- fmt.Errorf("failed to get chat history: %w", err)
 			return
 		}
+		history := t.history
 
 		// Build messages array
 		messages := make([]Message, 0, len(history)+1)
 		
 		// Add system message
-		systemMsg := s.buildSystemMessage()
+		systemMsg := s.buildSystemMessage(cfg, gen)
 		messages = append(messages, systemMsg)
+
+		// Add passages from the session's knowledge bases
+		sources := s.retrieve(ctx, cfg, req.SessionID, req.Message)
+		if sources != nil {
+			messages = append(messages, sources.message())
+		}
 		
 		// Add conversation history
 		for _, msg := range history {
-			messages = append(messages, NewTextMessage(msg.Role, msg.Content.Text))
+			messages = append(messages, NewTextMessage(msg.Role, msg.Content))
 		}
 
 		// Process user message
-		userMessage, err := s.buildUserMessage(req.Message, req.Files)
+		userMessage, err := s.buildUserMessage(ctx, gen.Model, req.Message, req.Attachments)
 		if err != nil {
 			errorChan <- fmt.Errorf("failed to build user message: %w", err)
 			return
@@ -221,13 +374,16 @@ func (s *Service) ProcessChatMessageStream(ctx context.Context, userID string, r
 
 		// Create AI request
 		aiReq := &ChatRequest{
-			Model:       s.config.Model,
+			Model:       gen.Model.Name,
 			Messages:    messages,
-			Temperature: &s.config.Temperature,
-			MaxTokens:   &s.config.MaxTokens,
+			Temperature: &gen.Temperature,
+			MaxTokens:   &gen.MaxTokens,
+			TopP:        &gen.TopP,
 			Stream:      true,
-			Tools:       s.getAvailableTools(),
-			ToolChoice:  "auto",
+		}
+		if gen.Model.SupportsTools {
+			aiReq.Tools = s.getAvailableTools(cfg, gen.AllowedTools)
+			aiReq.ToolChoice = "auto"
 		}
 
 		// Call AI API with streaming
@@ -235,33 +391,55 @@ func (s *Service) ProcessChatMessageStream(ctx context.Context, userID string, r
 		
 		fullResponse := ""
 		totalTokens := 0
+		metadata := func() models.MessageMetadata {
+			meta := gen.Metadata()
+			meta.TokensUsed = totalTokens
+			meta.Latency = time.Since(started).Milliseconds()
+			if sources != nil {
+				meta.Citations = sources.citations
+			}
+			return meta
+		}
 
 		for {
 			select {
 			case chunk, ok := <-chunkChan:
 				if !ok {
 					// Stream finished, save to database
-					if err := s.saveChatMessages(ctx, userID, req.SessionID, req.Message, fullResponse, totalTokens); err != nil {
+					if _, err := s.saveChatMessages(ctx, userID, req, t, fullResponse, totalTokens, metadata()); err != nil {
 						errorChan <- fmt.Errorf("failed to save chat messages: %w", err)
 					}
 					return
 				}
 
+				if chunk.Usage != nil {
+					totalTokens = chunk.Usage.TotalTokens
+				}
+
 				if len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil {
 					if content, ok := chunk.Choices[0].Delta.Content.(string); ok {
 						fullResponse += content
-						responseChan <- content
+						select {
+						case responseChan <- content:
+						case <-ctx.Done():
+							errorChan <- s.savePartial(ctx, userID, req, t, fullResponse, totalTokens, metadata())
+							return
+						}
 					}
 				}
 
 			case err := <-errChan:
 				if err != nil {
+					if ctx.Err() != nil {
+						// The upstream call failed because we were cancelled
+						err = s.savePartial(ctx, userID, req, t, fullResponse, totalTokens, metadata())
+					}
 					errorChan <- err
 					return
 				}
 
 			case <-ctx.Done():
-				errorChan <- ctx.Err()
+				errorChan <- s.savePartial(ctx, userID, req, t, fullResponse, totalTokens, metadata())
 				return
 			}
 		}
@@ -272,22 +450,28 @@ func (s *Service) ProcessChatMessageStream(ctx context.Context, userID string, r
 
 // ProcessSearchQuery processes a search query with AI
 func (s *Service) ProcessSearchQuery(ctx context.Context, userID string, req *SearchRequest) (*SearchResponse, error) {
+	cfg := s.config()
+
 	// Build search prompt
 	searchPrompt := s.buildSearchPrompt(req.Query)
 	
 	messages := []Message{
-		NewTextMessage("system", "You are a helpful search assistant. Provide comprehensive and accurate search results."),
+		NewTextMessage("system", cfg.SearchSystemPrompt),
 		NewTextMessage("user", searchPrompt),
 	}
 
 	// Create AI request with search tools
+	model := s.catalog.Default(ctx, cfg)
+	maxTokens := capTokens(cfg.MaxTokens, model)
 	aiReq := &ChatRequest{
-		Model:       s.config.Model,
+		Model:       model.Name,
 		Messages:    messages,
-		Temperature: &s.config.Temperature,
-		MaxTokens:   &s.config.MaxTokens,
-		Tools:       s.getSearchTools(),
-		ToolChoice:  "auto",
+		Temperature: &cfg.Temperature,
+		MaxTokens:   &maxTokens,
+	}
+	if model.SupportsTools {
+		aiReq.Tools = s.getSearchTools()
+		aiReq.ToolChoice = "auto"
 	}
 
 	// Call AI API
@@ -326,8 +510,13 @@ func (s *Service) ProcessSearchQuery(ctx context.Context, userID string, req *Se
 
 // Helper methods
 
-func (s *Service) buildSystemMessage() Message {
-	systemPrompt := s.config.SystemPrompt
+// buildSystemMessage uses the session's or persona's prompt when the
+// generation has one, else the configured prompt
+func (s *Service) buildSystemMessage(cfg *config.AIConfig, gen *Generation) Message {
+	systemPrompt := gen.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = cfg.SystemPrompt
+	}
 	if systemPrompt == "" {
 		// Fallback system prompt if not configured
 		systemPrompt = "You are GRYT, an advanced AI assistant powered by Vercel AI Gateway. You are designed to be helpful, accurate, and efficient. You have access to various tools and can handle multiple types of content including text, images, and documents. Always provide clear, concise, and helpful responses while maintaining a professional yet friendly tone."
@@ -336,8 +525,12 @@ func (s *Service) buildSystemMessage() Message {
 	return NewTextMessage("system", systemPrompt)
 }
 
-func (s *Service) buildUserMessage(message string, files []*multipart.FileHeader) (Message, error) {
-	if len(files) == 0 {
+// buildUserMessage sends the attachments' bytes from the blob store along
+// with the text: images as image parts, PDFs as file parts for vision
+// models, other documents as their extracted text and text files inlined
+// as text parts
+func (s *Service) buildUserMessage(ctx context.Context, model *database.ModelConfig, message string, attachments []database.Attachment) (Message, error) {
+	if len(attachments) == 0 {
 		return NewTextMessage("user", message), nil
 	}
 
@@ -346,30 +539,47 @@ func (s *Service) buildUserMessage(message string, files []*multipart.FileHeader
 		NewTextContent(message),
 	}
 
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
+	for _, a := range attachments {
+		data, err := storage.ReadAll(ctx, s.blobs, a.SHA256)
 		if err != nil {
-			return Message{}, fmt.Errorf("failed to open file %s: %w", fileHeader.Filename, err)
+			return Message{}, fmt.Errorf("failed to read attachment %s: %w", a.Name, err)
 		}
-		defer file.Close()
 
-		fileData, err := io.ReadAll(file)
-		if err != nil {
-			return Message{}, fmt.Errorf("failed to read file %s: %w", fileHeader.Filename, err)
+		switch kind, _ := ClassifyAttachment(a.MimeType); kind {
+		case AttachmentText:
+			contents = append(contents, NewTextContent(fmt.Sprintf("File %s:\n%s", a.Name, strings.ToValidUTF8(string(data), "\uFFFD"))))
+		case AttachmentImage:
+			contents = append(contents, NewImageContent(base64.StdEncoding.EncodeToString(data), a.MimeType, "auto"))
+		default:
+			if model.SupportsVision && a.MimeType == "application/pdf" {
+				contents = append(contents, NewFileContent(base64.StdEncoding.EncodeToString(data), a.MimeType, a.Name))
+			} else {
+				contents = append(contents, NewTextContent(documentText(a, data)))
+			}
 		}
+	}
 
-		fileBase64 := base64.StdEncoding.EncodeToString(fileData)
-		contentType := fileHeader.Header.Get("Content-Type")
+	return NewMultiModalMessage("user", contents), nil
+}
 
-		// Handle different file types
-		if strings.HasPrefix(contentType, "image/") {
-			contents = append(contents, NewImageContent(fileBase64, contentType, "auto"))
-		} else {
-			contents = append(contents, NewFileContent(fileBase64, contentType, fileHeader.Filename))
-		}
+// documentText is the extracted text of a document attachment, for models
+// that cannot read the file itself. A document that cannot be read becomes
+// a note, so the model can tell the user instead of the chat failing.
+func documentText(a database.Attachment, data []byte) string {
+	doc, err := extract.Extract(a.Name, a.MimeType, data)
+	if err != nil {
+		slog.Warn("Failed to extract attachment text", "attachment", a.Name, "error", err)
+		return fmt.Sprintf("File %s could not be read: %v", a.Name, err)
 	}
 
-	return NewMultiModalMessage("user", contents), nil
+	text := doc.PagedText()
+	if text == "" {
+		return fmt.Sprintf("File %s (%s, pages: %d) has no extractable text; it may be scanned.", a.Name, doc.Kind, len(doc.Pages))
+	}
+	if n := utf8.RuneCountInString(text); n > maxExtractedText {
+		text = fmt.Sprintf("%s\n\n[Truncated: showing the first %d of %d characters]", truncateRunes(text, maxExtractedText), maxExtractedText, n)
+	}
+	return fmt.Sprintf("File %s (%s, pages: %d):\n%s", a.Name, doc.Kind, len(doc.Pages), text)
 }
 
 func (s *Service) buildSearchPrompt(query string) string {
@@ -384,7 +594,46 @@ Provide comprehensive search results including:
 Format the response as structured search results.`, query)
 }
 
-func (s *Service) getAvailableTools() []Tool {
+// getAvailableTools lists the chat tools enabled in cfg. A non-nil allowed
+// list (from a persona) narrows them further.
+func (s *Service) getAvailableTools(cfg *config.AIConfig, allowed []string) []Tool {
+	all := chatTools()
+	tools := make([]Tool, 0, len(all))
+	for _, tool := range all {
+		if toolAllowed(cfg, allowed, tool.Function.Name) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// ToolNames lists every chat tool, enabled or not
+func ToolNames() []string {
+	all := chatTools()
+	names := make([]string, len(all))
+	for i, tool := range all {
+		names[i] = tool.Function.Name
+	}
+	return names
+}
+
+func toolAllowed(cfg *config.AIConfig, allowed []string, name string) bool {
+	if !toolEnabled(cfg.Tools, name) {
+		return false
+	}
+	if allowed == nil {
+		return true
+	}
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chatTools defines the tools offered in chat
+func chatTools() []Tool {
 	return []Tool{
 		NewTool(
 			"web_search",
@@ -400,20 +649,7 @@ func (s *Service) getAvailableTools() []Tool {
 				"required": []string{"query"},
 			},
 		),
-		NewTool(
-			"calculate",
-			"Perform mathematical calculations",
-			map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"expression": map[string]interface{}{
-						"type":        "string",
-						"description": "Mathematical expression to calculate",
-					},
-				},
-				"required": []string{"expression"},
-			},
-		),
+		calculateTool(),
 		NewTool(
 			"get_current_time",
 			"Get the current date and time",
@@ -425,6 +661,25 @@ func (s *Service) getAvailableTools() []Tool {
 	}
 }
 
+// toolEnabled maps a tool name to its ai.tools switch. Tools without a
+// switch (get_current_time) are always available.
+func toolEnabled(tools config.ToolsConfig, name string) bool {
+	switch name {
+	case "web_search":
+		return tools.WebSearch.Enabled
+	case "calculate":
+		return tools.Calculator.Enabled
+	case "get_weather":
+		return tools.Weather.Enabled
+	case "translate_text":
+		return tools.Translation.Enabled
+	case "analyze_image":
+		return tools.ImageAnalysis.Enabled
+	default:
+		return true
+	}
+}
+
 func (s *Service) getSearchTools() []Tool {
 	return []Tool{
 		NewTool(
@@ -449,10 +704,15 @@ func (s *Service) getSearchTools() []Tool {
 	}
 }
 
-func (s *Service) handleToolCalls(ctx context.Context, toolCalls []ToolCall) (string, error) {
+func (s *Service) handleToolCalls(ctx context.Context, cfg *config.AIConfig, gen *Generation, toolCalls []ToolCall) (string, error) {
 	results := make([]string, 0, len(toolCalls))
 
 	for _, toolCall := range toolCalls {
+		// The model may still call a tool disabled by a reload mid-conversation
+		// or one the persona does not allow
+		if !toolAllowed(cfg, gen.AllowedTools, toolCall.Function.Name) {
+			return "", fmt.Errorf("tool %s is disabled", toolCall.Function.Name)
+		}
 		result, err := s.executeToolCall(ctx, toolCall)
 		if err != nil {
 			return "", fmt.Errorf("failed to execute tool %s: %w", toolCall.Function.Name, err)
@@ -468,7 +728,7 @@ func (s *Service) executeToolCall(ctx context.Context, toolCall ToolCall) (strin
 	case "web_search":
 		return "Search functionality would be implemented here", nil
 	case "calculate":
-		return "Calculation functionality would be implemented here", nil
+		return s.toolExec.ExecuteTool(ctx, toolCall)
 	case "get_current_time":
 		return fmt.Sprintf("Current time: %s", time.Now().Format(time.RFC3339)), nil
 	default:
@@ -492,39 +752,80 @@ func (s *Service) processSearchResults(choice Choice) []SearchResult {
 
 // Database helper methods (these would interact with the database layer)
 
-func (s *Service) getChatHistory(ctx context.Context, sessionID string, limit int) ([]*models.ChatMessage, error) {
-	// This would fetch chat history from database
-	return []*models.ChatMessage{}, nil
-}
-
-func (s *Service) saveChatMessages(ctx context.Context, userID, sessionID, userMessage, aiResponse string, tokens int) error {
-	// Save user message
-	userMsg := &database.ChatMessage{
-		ID:        generateID(),
-		SessionID: sessionID,
-		Role:      "user",
-		Content:   userMessage,
-		Tokens:    0,
-		CreatedAt: time.Now(),
-	}
-	if err := s.chatRepo.CreateMessage(userMsg); err != nil {
-		return fmt.Errorf("failed to save user message: %w", err)
+// saveChatMessages stores the turn on its branch and makes the reply the
+// session's active message. The user message is skipped when an existing
+// one was answered again. A session with a placeholder title gets one
+// generated in the background.
+func (s *Service) saveChatMessages(ctx context.Context, userID string, req *ServiceChatRequest, t *turn, aiResponse string, tokens int, meta models.MessageMetadata) (*database.ChatMessage, error) {
+	// Keep the trace but not the cancellation: a finished answer is stored
+	// even if the client disconnects right after the last chunk
+	ctx = context.WithoutCancel(ctx)
+	repo := s.chatRepo.WithContext(ctx)
+
+	parentID := t.replyTo
+	if parentID == "" {
+		// Save user message
+		userMsg := &database.ChatMessage{
+			ID:        generateID(),
+			SessionID: req.SessionID,
+			ParentID:  t.parentID,
+			UserID:    userID,
+			Role:      "user",
+			Content:   req.Message,
+			Tokens:    0,
+			CreatedAt: time.Now(),
+		}
+		if err := repo.CreateMessage(userMsg); err != nil {
+			return nil, fmt.Errorf("failed to save user message: %w", err)
+		}
+		if err := s.attachmentRepo.WithContext(ctx).LinkMessage(userMsg.ID, attachmentIDs(req.Attachments)); err != nil {
+			return nil, err
+		}
+		parentID = userMsg.ID
 	}
 
 	// Save AI response
 	aiMsg := &database.ChatMessage{
 		ID:        generateID(),
-		SessionID: sessionID,
+		SessionID: req.SessionID,
+		ParentID:  &parentID,
+		UserID:    userID,
 		Role:      "assistant",
 		Content:   aiResponse,
 		Tokens:    tokens,
+		Metadata:  meta,
 		CreatedAt: time.Now(),
 	}
-	if err := s.chatRepo.CreateMessage(aiMsg); err != nil {
-		return fmt.Errorf("failed to save AI message: %w", err)
+	if err := repo.CreateMessage(aiMsg); err != nil {
+		return nil, fmt.Errorf("failed to save AI message: %w", err)
 	}
 
-	return nil
+	if err := repo.SetActiveMessage(req.SessionID, aiMsg.ID); err != nil {
+		return nil, err
+	}
+	req.Reply = aiMsg
+	s.titleSession(ctx, req.SessionID, req.Message, aiResponse)
+	s.WakeEmbeddings()
+
+	return aiMsg, nil
+}
+
+// savePartial stores an interrupted streaming answer (client disconnect or
+// shutdown) so the user keeps what was already generated. It returns the
+// cancellation cause for the caller to report.
+func (s *Service) savePartial(ctx context.Context, userID string, req *ServiceChatRequest, t *turn, partial string, tokens int, meta models.MessageMetadata) error {
+	cause := context.Cause(ctx)
+	if partial == "" {
+		return cause
+	}
+
+	meta.Partial = true
+	if _, err := s.saveChatMessages(ctx, userID, req, t, partial, tokens, meta); err != nil {
+		slog.ErrorContext(ctx, "failed to persist partial generation", "session_id", req.SessionID, "error", err)
+		return cause
+	}
+	slog.WarnContext(ctx, "persisted partial generation", "session_id", req.SessionID, "chars", len(partial), "reason", cause)
+	return cause
 }
 
 func (s *Service) saveSearchQuery(ctx context.Context, userID, query string, results []SearchResult, tokens int) (string, error) {
@@ -543,7 +844,7 @@ func (s *Service) saveSearchQuery(ctx context.Context, userID, query string, res
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.searchRepo.CreateQuery(searchQuery); err != nil {
+	if err := s.searchRepo.WithContext(ctx).CreateQuery(searchQuery); err != nil {
 		return "", fmt.Errorf("failed to save search query: %w", err)
 	}
 
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// purgeBatch bounds each delete so a large backlog does not hold long locks
+const purgeBatch = 500
+
+// PurgeDeletedSessions permanently deletes sessions that have been in the
+// trash longer than the configured retention, with their messages and the
+// messages' vectors
+func (s *Service) PurgeDeletedSessions(ctx context.Context) (int64, error) {
+	retention := s.config().SessionRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	repo := s.chatRepo.WithContext(ctx)
+	cutoff := time.Now().Add(-retention)
+	forget := func(messageIDs []string) error {
+		return s.vectors.Delete(ctx, messageIDs)
+	}
+	var total int64
+	for {
+		n, err := repo.PurgeDeletedSessions(cutoff, purgeBatch, forget)
+		total += n
+		if err != nil || n < purgeBatch {
+			return total, err
+		}
+	}
+}
+
+// RunPurge purges expired sessions every interval until ctx is done
+func (s *Service) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeDeletedSessions(ctx)
+			if err != nil {
+				slog.Error("chat session purge failed", "purged", n, "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.Info("purged deleted chat sessions", "purged", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// generatedTitleLength keeps generated titles short enough for a sidebar
+	generatedTitleLength = 80
+	// titleExcerpt is how much of each message the title model sees
+	titleExcerpt  = 2000
+	titleTimeout  = 30 * time.Second
+	titleMaxToken = 24
+)
+
+const titlePrompt = "Write a short title (at most 6 words) for the conversation below. " +
+	"Use the language of the conversation. Reply with the title only, without quotes."
+
+// titleSession generates a title in the background when the session still
+// has its placeholder. Failures are only logged; the next exchange tries
+// again.
+func (s *Service) titleSession(ctx context.Context, sessionID, userMessage, reply string) {
+	model := s.config().TitleModel
+	if model == "" || strings.TrimSpace(reply) == "" {
+		return
+	}
+
+	session, err := s.chatRepo.WithContext(ctx).GetSession(sessionID)
+	if err != nil || session == nil || !session.AutoTitle {
+		return
+	}
+
+	// One title request per session at a time
+	if _, busy := s.titling.LoadOrStore(sessionID, struct{}{}); busy {
+		return
+	}
+
+	// Tracked like a chat so shutdown waits for it (or aborts it)
+	genCtx, done, err := s.generations.Begin(context.WithoutCancel(ctx))
+	if err != nil {
+		s.titling.Delete(sessionID)
+		return
+	}
+
+	go func() {
+		defer done()
+		defer s.titling.Delete(sessionID)
+
+		ctx, cancel := context.WithTimeout(genCtx, titleTimeout)
+		defer cancel()
+
+		title, err := s.generateTitle(ctx, model, userMessage, reply)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to generate session title", "session_id", sessionID, "error", err)
+			return
+		}
+		if title == "" {
+			return
+		}
+
+		if _, err := s.chatRepo.WithContext(ctx).SetGeneratedTitle(sessionID, title); err != nil {
+			slog.WarnContext(ctx, "failed to save session title", "session_id", sessionID, "error", err)
+		}
+	}()
+}
+
+// generateTitle asks the title model for a title of the exchange
+func (s *Service) generateTitle(ctx context.Context, model, userMessage, reply string) (string, error) {
+	m, err := s.catalog.Lookup(ctx, model)
+	if err != nil {
+		return "", err
+	}
+	if m == nil {
+		return "", fmt.Errorf("title model %q is not enabled in the catalogue", model)
+	}
+
+	conversation := "User: " + excerpt(userMessage, titleExcerpt) + "\n\nAssistant: " + excerpt(reply, titleExcerpt)
+	temperature, maxTokens := 0.3, titleMaxToken
+	resp, err := s.client.CreateChatCompletion(ctx, &ChatRequest{
+		Model: m.Name,
+		Messages: []Message{
+			NewTextMessage("system", titlePrompt),
+			NewTextMessage("user", conversation),
+		},
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return "", errors.New("no response from AI")
+	}
+
+	content, _ := resp.Choices[0].Message.Content.(string)
+	return cleanTitle(content), nil
+}
+
+// titleQuotes are the quotes and Markdown emphasis models put around titles
+const titleQuotes = "\"'`*“”‘’«» \t\r"
+
+// cleanTitle keeps the first non-empty line of the model's answer without
+// quotes, Markdown, a "Title:" prefix or trailing punctuation
+func cleanTitle(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimLeft(line, titleQuotes+"#")
+		if len(line) >= 6 && strings.EqualFold(line[:6], "title:") {
+			line = strings.TrimLeft(line[6:], titleQuotes)
+		}
+		line = strings.TrimRight(line, titleQuotes+".!:;")
+		if line != "" {
+			return excerpt(line, generatedTitleLength)
+		}
+	}
+	return ""
+}
+
+// excerpt cuts s to at most n runes
+func excerpt(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n]))
+}
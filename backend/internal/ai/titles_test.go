@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanTitle(t *testing.T) {
+	long := strings.Repeat("Sangat panjang ", 10)
+
+	tests := []struct {
+		in, want string
+	}{
+		{"Nginx reverse proxy setup", "Nginx reverse proxy setup"},
+		{"  Nginx reverse proxy setup.  ", "Nginx reverse proxy setup"},
+		{`"Nginx reverse proxy setup"`, "Nginx reverse proxy setup"},
+		{`Title: "Nginx reverse proxy".`, "Nginx reverse proxy"},
+		{"TITLE:Nginx", "Nginx"},
+		{"**Title:** Debugging Go panics", "Debugging Go panics"},
+		{"## Debugging Go panics", "Debugging Go panics"},
+		{"“Resep rendang padang”", "Resep rendang padang"},
+		{"'Deploy with Docker'!", "Deploy with Docker"},
+		{"Why is my query slow?", "Why is my query slow?"},
+		{"Learning C#", "Learning C#"},
+		{"Title:\n\nPython packaging\nSecond line", "Python packaging"},
+		{"\r\n  \r\nWindows line endings\r\n", "Windows line endings"},
+		{"Title: Tips: a list", "Tips: a list"},
+		{"Titles for kids' books", "Titles for kids' books"},
+		{"", ""},
+		{"\n \"\" \n...", ""},
+		{"Title:", ""},
+		{long, strings.TrimSpace(string([]rune(long)[:generatedTitleLength]))},
+	}
+	for _, tt := range tests {
+		if got := cleanTitle(tt.in); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"cut here and not further", 8, "cut here"},
+		{"ends in a space", 8, "ends in"},
+		{"héllo wörld", 5, "héllo"},
+		{"日本語のタイトル", 3, "日本語"},
+	}
+	for _, tt := range tests {
+		got := excerpt(tt.in, tt.n)
+		if got != tt.want || utf8.RuneCountInString(got) > tt.n {
+			t.Errorf("excerpt(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,24 @@ package ai
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"gryt-backend/internal/calc"
+	"gryt-backend/internal/extract"
+	"gryt-backend/internal/metrics"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ToolExecutor handles execution of AI tools
@@ -29,6 +39,38 @@ func NewToolExecutor() *ToolExecutor {
 
 // ExecuteTool executes a tool call and returns the result
 func (te *ToolExecutor) ExecuteTool(ctx context.Context, toolCall ToolCall) (string, error) {
+	name := toolMetricName(toolCall.Function.Name)
+	ctx, span := tracer.Start(ctx, "tool.execute", trace.WithAttributes(
+		attribute.String("tool.name", name),
+		attribute.String("tool.call_id", toolCall.ID),
+	))
+	defer span.End()
+
+	start := time.Now()
+	result, err := te.executeTool(ctx, toolCall)
+	metrics.ObserveTool(name, err, time.Since(start))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("tool.result_length", len(result)))
+	}
+	return result, err
+}
+
+// toolMetricName keeps unknown tool names requested by the model out of
+// metric labels
+func toolMetricName(name string) string {
+	for _, tool := range GetAvailableTools() {
+		if tool.Function.Name == name {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func (te *ToolExecutor) executeTool(ctx context.Context, toolCall ToolCall) (string, error) {
 	// Parse arguments from JSON string
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
@@ -124,14 +166,42 @@ func (te *ToolExecutor) executeCalculate(ctx context.Context, args map[string]in
 		return "", fmt.Errorf("expression parameter is required for calculate")
 	}
 
-	// Simple calculator implementation
-	// This is a basic implementation - in production, you'd want a more robust math parser
-	result, err := te.evaluateExpression(expression)
+	env := calc.NewEnv()
+	if vars, ok := args["variables"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var value calc.Value
+			var err error
+			switch v := vars[name].(type) {
+			case float64:
+				value, err = calc.Eval(strconv.FormatFloat(v, 'g', -1, 64))
+			case string:
+				value, err = calc.Eval(v)
+			default:
+				err = fmt.Errorf("must be a number or an expression")
+			}
+			if err == nil {
+				err = env.Set(name, value)
+			}
+			if err != nil {
+				return fmt.Sprintf("❌ Invalid variable %s: %s", name, err), nil
+			}
+		}
+	}
+
+	// Ekspresi yang salah dibalas sebagai hasil, supaya model bisa
+	// memperbaikinya dari posisi errornya
+	result, err := env.Eval(expression)
 	if err != nil {
-		return "", fmt.Errorf("failed to calculate expression '%s': %w", expression, err)
+		return fmt.Sprintf("❌ Cannot calculate %s: %s", expression, err), nil
 	}
 
-	return fmt.Sprintf("Calculation: %s = %g", expression, result), nil
+	return fmt.Sprintf("Calculation: %s = %s", expression, result), nil
 }
 
 // Get Current Time Tool
@@ -266,51 +336,64 @@ Confidence: 0.98`,
 
 // Analyze Document Tool
 func (te *ToolExecutor) analyzeDocument(ctx context.Context, args map[string]interface{}) (string, error) {
-	_, ok := args["document_data"].(string)
+	documentData, ok := args["document_data"].(string)
 	if !ok {
 		return "", fmt.Errorf("document_data parameter is required for analyze_document")
 	}
+	documentType, _ := args["document_type"].(string)
 
-	documentType := "pdf" // default
-	if dType, ok := args["document_type"].(string); ok {
-		documentType = dType
+	doc, err := readDocument(documentData, documentType)
+	if err != nil {
+		return "", err
 	}
+	text := doc.Text()
 
-	// Simulate document analysis
-	analysis := map[string]interface{}{
-		"document_type":    documentType,
-		"page_count":       15,
-		"word_count":       2847,
-		"language":         "English",
-		"topics":           []string{"Technology", "AI", "Machine Learning"},
-		"key_entities":     []string{"OpenAI", "GPT", "Neural Networks"},
-		"sentiment":        "Neutral",
-		"readability":      "Professional",
-		"has_tables":       true,
-		"has_images":       true,
+	language := extract.LanguageName(doc.Language())
+	if language == "" {
+		language = "unknown"
+	}
+
+	tables := "none"
+	if len(doc.Tables) > 0 {
+		parts := make([]string, len(doc.Tables))
+		for i := range doc.Tables {
+			t := &doc.Tables[i]
+			parts[i] = fmt.Sprintf("page %d: %d rows × %d columns", t.Page, len(t.Rows), t.Columns())
+		}
+		tables = fmt.Sprintf("%d (%s)", len(doc.Tables), strings.Join(parts, "; "))
+	}
+
+	// Halaman tanpa teks biasanya hasil scan (gambar), tidak ada OCR di sini
+	var empty []string
+	for _, p := range doc.Pages {
+		if p.Text == "" {
+			empty = append(empty, strconv.Itoa(p.Number))
+		}
+	}
+	emptyPages := "none"
+	if len(empty) > 0 {
+		emptyPages = strings.Join(empty, ", ") + " (scanned or image-only pages have no text)"
 	}
 
 	return fmt.Sprintf(`Document Analysis:
 - Type: %s
 - Pages: %d
 - Words: %d
+- Characters: %d
 - Language: %s
-- Topics: %s
-- Key Entities: %s
-- Sentiment: %s
-- Readability: %s
-- Contains Tables: %t
-- Contains Images: %t`,
-		analysis["document_type"],
-		analysis["page_count"],
-		analysis["word_count"],
-		analysis["language"],
-		strings.Join(analysis["topics"].([]string), ", "),
-		strings.Join(analysis["key_entities"].([]string), ", "),
-		analysis["sentiment"],
-		analysis["readability"],
-		analysis["has_tables"],
-		analysis["has_images"]), nil
+- Tables: %s
+- Pages without text: %s
+
+Preview:
+%s`,
+		doc.Kind,
+		len(doc.Pages),
+		doc.Words(),
+		utf8.RuneCountInString(text),
+		language,
+		tables,
+		emptyPages,
+		truncateRunes(text, documentPreview)), nil
 }
 
 // Generate Code Tool
@@ -441,154 +524,94 @@ func (te *ToolExecutor) validateJSON(ctx context.Context, args map[string]interf
 
 // Extract Text Tool
 func (te *ToolExecutor) extractText(ctx context.Context, args map[string]interface{}) (string, error) {
-	_, ok := args["file_data"].(string)
+	fileData, ok := args["file_data"].(string)
 	if !ok {
 		return "", fmt.Errorf("file_data parameter is required for extract_text")
 	}
+	fileType, _ := args["file_type"].(string)
 
-	fileType := "pdf" // default
-	if fType, ok := args["file_type"].(string); ok {
-		fileType = fType
+	doc, err := readDocument(fileData, fileType)
+	if err != nil {
+		return "", err
+	}
+	text := doc.PagedText()
+	if text == "" {
+		return fmt.Sprintf("The %s file has no extractable text (scanned or image-only documents need OCR).", doc.Kind), nil
 	}
 
-	// Simulate text extraction
-	extractedText := fmt.Sprintf(`Extracted text from %s file:
-
-This is sample extracted text content. In a real implementation, this would:
-- Parse PDF files using libraries like pdfplumber or PyPDF2
-- Extract text from images using OCR (Tesseract)
-- Parse Word documents using python-docx
-- Handle various file formats
-
-The extracted content would preserve formatting and structure where possible.
-
-File type: %s
-Extraction confidence: 95%%
-Character count: 1,247
-Word count: 203`, fileType, fileType)
-
-	return extractedText, nil
-}
-
-// Helper function for basic expression evaluation
-func (te *ToolExecutor) evaluateExpression(expr string) (float64, error) {
-	// Remove spaces
-	expr = strings.ReplaceAll(expr, " ", "")
-
-	// Simple regex-based calculator for basic operations
-	// This is a simplified implementation - for production use a proper math parser
-	
-	// Handle parentheses first (simplified)
-	for strings.Contains(expr, "(") {
-		// Find innermost parentheses
-		re := regexp.MustCompile(`\(([^()]+)\)`)
-		matches := re.FindStringSubmatch(expr)
-		if len(matches) < 2 {
-			break
-		}
-		inner := matches[1]
-		result, err := te.evaluateSimpleExpression(inner)
-		if err != nil {
-			return 0, err
-		}
-		expr = strings.Replace(expr, matches[0], fmt.Sprintf("%g", result), 1)
+	header := fmt.Sprintf("Extracted text (%s, pages: %d, words: %d", doc.Kind, len(doc.Pages), doc.Words())
+	if language := doc.Language(); language != "" {
+		header += ", language: " + extract.LanguageName(language)
 	}
+	header += "):\n\n"
 
-	return te.evaluateSimpleExpression(expr)
+	if n := utf8.RuneCountInString(text); n > maxExtractedText {
+		return fmt.Sprintf("%s%s\n\n[Truncated: showing the first %d of %d characters]",
+			header, truncateRunes(text, maxExtractedText), maxExtractedText, n), nil
+	}
+	return header + text, nil
 }
 
-func (te *ToolExecutor) evaluateSimpleExpression(expr string) (float64, error) {
-	// Handle multiplication and division first
-	for {
-		re := regexp.MustCompile(`(-?\d+(?:\.\d+)?)([*/])(-?\d+(?:\.\d+)?)`)
-		matches := re.FindStringSubmatch(expr)
-		if len(matches) < 4 {
-			break
-		}
-
-		left, err := strconv.ParseFloat(matches[1], 64)
-		if err != nil {
-			return 0, err
-		}
-
-		right, err := strconv.ParseFloat(matches[3], 64)
-		if err != nil {
-			return 0, err
-		}
+const (
+	// maxExtractedText caps the text extract_text returns to the model
+	maxExtractedText = 50000
+	// documentPreview is how much text analyze_document shows
+	documentPreview = 500
+)
 
-		var result float64
-		switch matches[2] {
-		case "*":
-			result = left * right
-		case "/":
-			if right == 0 {
-				return 0, fmt.Errorf("division by zero")
-			}
-			result = left / right
+// readDocument decodes base64 file data (optionally a data: URL) and
+// extracts its text. fileType is an extension such as "pdf" or "docx";
+// when empty the type is recognised from the content.
+func readDocument(encoded, fileType string) (*extract.Document, error) {
+	mimeType := ""
+	if rest, ok := strings.CutPrefix(encoded, "data:"); ok {
+		meta, payload, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, fmt.Errorf("file data must be base64 encoded")
 		}
-
-		expr = strings.Replace(expr, matches[0], fmt.Sprintf("%g", result), 1)
+		mimeType, encoded = strings.TrimSuffix(meta, ";base64"), payload
 	}
+	encoded = strings.Join(strings.Fields(encoded), "")
 
-	// Handle addition and subtraction
-	for {
-		re := regexp.MustCompile(`(-?\d+(?:\.\d+)?)([+-])(-?\d+(?:\.\d+)?)`)
-		matches := re.FindStringSubmatch(expr)
-		if len(matches) < 4 {
+	var data []byte
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err = enc.DecodeString(encoded); err == nil {
 			break
 		}
-
-		left, err := strconv.ParseFloat(matches[1], 64)
-		if err != nil {
-			return 0, err
-		}
-
-		right, err := strconv.ParseFloat(matches[3], 64)
-		if err != nil {
-			return 0, err
-		}
-
-		var result float64
-		switch matches[2] {
-		case "+":
-			result = left + right
-		case "-":
-			result = left - right
-		}
-
-		expr = strings.Replace(expr, matches[0], fmt.Sprintf("%g", result), 1)
 	}
-
-	// Handle mathematical functions
-	if strings.HasPrefix(expr, "sqrt(") && strings.HasSuffix(expr, ")") {
-		inner := expr[5 : len(expr)-1]
-		val, err := strconv.ParseFloat(inner, 64)
-		if err != nil {
-			return 0, err
-		}
-		return math.Sqrt(val), nil
+	if err != nil {
+		return nil, fmt.Errorf("file data is not valid base64: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("file data is empty")
 	}
 
-	if strings.HasPrefix(expr, "sin(") && strings.HasSuffix(expr, ")") {
-		inner := expr[4 : len(expr)-1]
-		val, err := strconv.ParseFloat(inner, 64)
-		if err != nil {
-			return 0, err
-		}
-		return math.Sin(val), nil
+	name := "document"
+	if fileType = strings.Trim(strings.ToLower(fileType), ". "); fileType != "" {
+		name += "." + fileType
 	}
+	doc, err := extract.Extract(name, mimeType, data)
+	if errors.Is(err, extract.ErrUnsupported) && utf8.Valid(data) {
+		// Tipe yang tidak dikenal tapi isinya teks dibaca sebagai teks biasa
+		doc, err = extract.Extract("document.txt", "", data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text: %w", err)
+	}
+	return doc, nil
+}
 
-	if strings.HasPrefix(expr, "cos(") && strings.HasSuffix(expr, ")") {
-		inner := expr[4 : len(expr)-1]
-		val, err := strconv.ParseFloat(inner, 64)
-		if err != nil {
-			return 0, err
+// truncateRunes cuts s to at most n characters
+func truncateRunes(s string, n int) string {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
 		}
-		return math.Cos(val), nil
+		i++
 	}
-
-	// Try to parse as a simple number
-	return strconv.ParseFloat(expr, 64)
+	return s
 }
 
 // GetAvailableTools returns the list of available tools with their schemas
@@ -615,20 +638,7 @@ func GetAvailableTools() []Tool {
 				"required": []string{"query"},
 			},
 		),
-		NewTool(
-			"calculate",
-			"Perform mathematical calculations and solve equations",
-			map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"expression": map[string]interface{}{
-						"type":        "string",
-						"description": "Mathematical expression to calculate (supports +, -, *, /, parentheses, sqrt, sin, cos)",
-					},
-				},
-				"required": []string{"expression"},
-			},
-		),
+		calculateTool(),
 		NewTool(
 			"get_current_time",
 			"Get the current date and time in various formats",
@@ -701,7 +711,7 @@ func GetAvailableTools() []Tool {
 		),
 		NewTool(
 			"analyze_document",
-			"Analyze documents (PDF, Word, etc.) to extract insights and metadata",
+			"Analyze documents (PDF, Word, Excel, CSV, HTML, Markdown, text) for page, word and table counts and language",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -711,8 +721,7 @@ func GetAvailableTools() []Tool {
 					},
 					"document_type": map[string]interface{}{
 						"type":        "string",
-						"description": "Document type: 'pdf', 'docx', 'txt', 'rtf'",
-						"default":     "pdf",
+						"description": "Document type: 'pdf', 'docx', 'xlsx', 'csv', 'html', 'md', 'txt'; detected from the content when omitted",
 					},
 				},
 				"required": []string{"document_data"},
@@ -772,7 +781,7 @@ func GetAvailableTools() []Tool {
 		),
 		NewTool(
 			"extract_text",
-			"Extract text content from various file formats",
+			"Extract the text of PDF, Word, Excel, CSV, HTML, Markdown and text files, page by page",
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -782,12 +791,37 @@ func GetAvailableTools() []Tool {
 					},
 					"file_type": map[string]interface{}{
 						"type":        "string",
-						"description": "File type: 'pdf', 'docx', 'txt', 'image'",
-						"default":     "pdf",
+						"description": "File type: 'pdf', 'docx', 'xlsx', 'csv', 'html', 'md', 'txt'; detected from the content when omitted",
 					},
 				},
 				"required": []string{"file_data"},
 			},
 		),
 	}
-}
\ No newline at end of file
+}
+
+// calculateTool is the calculate tool, offered in chat and by the executor
+func calculateTool() Tool {
+	return NewTool(
+		"calculate",
+		"Perform mathematical calculations and solve equations",
+		map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"expression": map[string]interface{}{
+					"type": "string",
+					"description": "Mathematical expression to calculate, computed exactly (0.1 + 0.2 = 0.3). " +
+						"Operators + - * / % ^ and parentheses; functions sqrt, cbrt, pow, abs, round(x, decimals), floor, ceil, min, max, " +
+						"exp, ln, log (base 10, or log(x, base)), log2, log10, sin, cos, tan, asin, acos, atan (radians; use deg for degrees: sin(30 deg)); " +
+						"constants pi, e. Units multiply numbers and convert with 'to': '10 km / 2 h', '3 ft to cm', '1 GiB to MB'. " +
+						"Assign with ';': 'r = 2 m; pi * r^2'",
+				},
+				"variables": map[string]interface{}{
+					"type":        "object",
+					"description": "Optional variables for the expression, name to number or expression (e.g. {\"price\": 12.5, \"d\": \"42 km\"})",
+				},
+			},
+			"required": []string{"expression"},
+		},
+	)
+}
@@ -1,11 +1,14 @@
 package api
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 
+	"gryt-backend/internal/config"
 	"gryt-backend/internal/database"
 	"gryt-backend/internal/handlers"
+	"gryt-backend/internal/health"
+	"gryt-backend/internal/metrics"
 	"gryt-backend/internal/middleware"
 	"gryt-backend/internal/services"
 
@@ -13,9 +16,14 @@ import (
 )
 
 // SetupRoutes configures all API routes
-func SetupRoutes(r *gin.Engine, services *services.Services, db *database.DB) {
-	// Health check
-	r.GET("/health", healthCheck)
+func SetupRoutes(r *gin.Engine, services *services.Services, db *database.DB, cfg *config.Config, checker *health.Checker) {
+	// Liveness & readiness probes (/livez, /readyz, legacy /health)
+	handlers.NewHealthHandler(checker).RegisterRoutes(r)
+
+	// Prometheus metrics, only when a scrape token is configured
+	if cfg.Server.MetricsToken != "" {
+		r.GET("/metrics", middleware.MetricsAuth(cfg.Server.MetricsToken), gin.WrapH(metrics.Handler()))
+	}
 
 	// API group
 	api := r.Group("/api")
@@ -26,20 +34,33 @@ func SetupRoutes(r *gin.Engine, services *services.Services, db *database.DB) {
 			auth.POST("/validate-key", validateAccessKey(services.Auth))
 			auth.POST("/login", login(services.Auth))
 			auth.POST("/refresh", refreshToken(services.Auth))
+			auth.GET("/unlock", unlockAccount(services.Auth))
+			auth.POST("/unlock", unlockAccount(services.Auth))
+			auth.GET("/oidc/login", oidcLogin(services.OIDC))
+			auth.GET("/oidc/callback", oidcCallback(services.Auth, services.OIDC))
 		}
 
+		// Attachment downloads (signed links, no login)
+		attachmentHandler := handlers.NewAttachmentHandler(services.Attachments)
+		attachmentHandler.RegisterDownloadRoutes(api)
+
 		// Protected routes
 		protected := api.Group("/")
 		protected.Use(middleware.Auth(services.Auth))
 		{
 			// Initialize AI handler
-			aiHandler := handlers.NewAIHandler(services.AI, db)
+			aiHandler := handlers.NewAIHandler(services.AI, services.Attachments, db, cfg.AI.Streaming.Timeout)
 			
 			// AI routes with rate limiting
 			ai := protected.Group("/ai")
 			ai.Use(middleware.AIRateLimit())
 			{
 				aiHandler.RegisterRoutes(ai)
+				handlers.NewPersonaHandler(services.Personas).RegisterRoutes(ai)
+				handlers.NewTemplateHandler(services.Templates, aiHandler).RegisterRoutes(ai)
+				handlers.NewSessionHandler(services.Sessions).RegisterRoutes(ai)
+				handlers.NewKnowledgeHandler(services.Knowledge).RegisterRoutes(ai)
+				attachmentHandler.RegisterRoutes(ai)
 			}
 
 			// Legacy chat routes (keeping for backward compatibility)
@@ -58,6 +79,16 @@ func SetupRoutes(r *gin.Engine, services *services.Services, db *database.DB) {
 				search.GET("/history", getSearchHistory(services.Search))
 			}
 
+			// Teams (sharing prompt templates)
+			handlers.NewTeamHandler(services.Teams).RegisterRoutes(protected)
+
+			// Admin routes (permission checked per route)
+			adminHandler := handlers.NewAdminHandler(services.Admin, services.Audit, services.Auth, services.Models, services.Personas)
+			admin := protected.Group("/admin")
+			{
+				adminHandler.RegisterRoutes(admin)
+			}
+
 			// User routes
 			user := protected.Group("/user")
 			{
@@ -68,25 +99,14 @@ func SetupRoutes(r *gin.Engine, services *services.Services, db *database.DB) {
 	}
 }
 
-// Health check endpoint
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "ok",
-		"message": "Server is running",
-		"version": "1.0.0",
-	})
-}
-
 // Auth handlers
 func validateAccessKey(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		log.Printf("[DEBUG] validateAccessKey handler called")
 		var req struct {
 			AccessKey string `json:"access_key" binding:"required"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("[DEBUG] validateAccessKey: JSON bind error: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid request format",
 				"message": "access_key is required",
@@ -94,10 +114,11 @@ func validateAccessKey(authService *services.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		log.Printf("[DEBUG] validateAccessKey: calling ValidateAccessKey with: %s", req.AccessKey)
-		user, err := authService.ValidateAccessKey(req.AccessKey)
+		user, err := authService.LoginWithAccessKey(middleware.GetAuditActor(c), req.AccessKey)
+		if middleware.RespondLoginBlocked(c, err) {
+			return
+		}
 		if err != nil || user == nil {
-			log.Printf("[DEBUG] validateAccessKey: validation failed, err: %v, user: %v", err, user)
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid access key",
 				"message": "Please check your access key and try again",
@@ -143,7 +164,10 @@ func login(authService *services.AuthService) gin.HandlerFunc {
 		}
 
 		// Authenticate user with email/password
-		user, err := authService.AuthenticateUser(req.Email, req.Password)
+		user, err := authService.LoginWithPassword(middleware.GetAuditActor(c), req.Email, req.Password)
+		if middleware.RespondLoginBlocked(c, err) {
+			return
+		}
 		if err != nil || user == nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid credentials",
@@ -185,6 +209,47 @@ func login(authService *services.AuthService) gin.HandlerFunc {
 	}
 }
 
+// unlockAccount lifts an account lockout with the token from the unlock email.
+// GET serves the emailed link directly, POST takes {"token": "..."}.
+func unlockAccount(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if c.Request.Method == http.MethodPost {
+			var req struct {
+				Token string `json:"token" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid request format",
+					"message": "token is required",
+				})
+				return
+			}
+			token = req.Token
+		}
+
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request format",
+				"message": "token is required",
+			})
+			return
+		}
+
+		if err := authService.UnlockWithToken(middleware.GetAuditActor(c), token); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid unlock token",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Account unlocked, you can log in again",
+		})
+	}
+}
+
 func refreshToken(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
@@ -200,7 +265,7 @@ func refreshToken(authService *services.AuthService) gin.HandlerFunc {
 		}
 
 		// Validate refresh token and get user ID
-		userID, err := authService.ValidateRefreshToken(req.RefreshToken)
+		userID, err := authService.Refresh(middleware.GetAuditActor(c), req.RefreshToken)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid or expired refresh token",
@@ -234,6 +299,110 @@ func refreshToken(authService *services.AuthService) gin.HandlerFunc {
 	}
 }
 
+// oidcStateCookie carries the signed OIDC state from login to callback
+const oidcStateCookie = "gryt_oidc_state"
+
+func setOIDCStateCookie(c *gin.Context, oidcService *services.OIDCService, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   maxAge,
+		Secure:   oidcService.SecureCookie(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func oidcLogin(oidcService *services.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !oidcService.Enabled() {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "OIDC login is not enabled",
+			})
+			return
+		}
+
+		authURL, state, err := oidcService.AuthCodeURL(c.Request.Context())
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "OIDC login failed", "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": "Failed to start OIDC login",
+			})
+			return
+		}
+
+		// The callback only accepts the state together with this cookie, so
+		// a callback link started in another browser cannot log this one in
+		setOIDCStateCookie(c, oidcService, state, int(services.OIDCStateTTL.Seconds()))
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+func oidcCallback(authService *services.AuthService, oidcService *services.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !oidcService.Enabled() {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "OIDC login is not enabled",
+			})
+			return
+		}
+
+		if errParam := c.Query("error"); errParam != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "OIDC login was rejected",
+				"message": c.Query("error_description"),
+			})
+			return
+		}
+
+		stateCookie, _ := c.Cookie(oidcStateCookie)
+		setOIDCStateCookie(c, oidcService, "", -1)
+
+		user, err := oidcService.Exchange(c.Request.Context(), stateCookie, c.Query("state"), c.Query("code"))
+		authService.RecordLogin(middleware.GetAuditActor(c), "oidc", user, err)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "OIDC callback failed", "error", err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "OIDC login failed",
+				"message": "Please try signing in again",
+			})
+			return
+		}
+
+		// Generate JWT token
+		token, err := authService.GenerateToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate token",
+			})
+			return
+		}
+
+		// Generate refresh token
+		refreshToken, err := authService.GenerateRefreshToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate refresh token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Login successful",
+			"token":   token,
+			"refresh_token": refreshToken,
+			"user": gin.H{
+				"id":            user.ID,
+				"name":          user.Name,
+				"email":         user.Email,
+				"chat_tokens":   user.ChatTokens,
+				"search_tokens": user.SearchTokens,
+			},
+		})
+	}
+}
+
 // Chat handlers
 func createChatSession(chatService *services.ChatService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -456,6 +625,7 @@ func getUserProfile(authService *services.AuthService) gin.HandlerFunc {
 				"id":            user.ID,
 				"name":          user.Name,
 				"email":         user.Email,
+				"role":          user.Role,
 				"is_active":     user.IsActive,
 				"chat_tokens":   user.ChatTokens,
 				"search_tokens": user.SearchTokens,
@@ -0,0 +1,229 @@
+package calc
+
+import "math/big"
+
+// Precision of inexact results. Series are summed with calcPrec bits, the
+// guard bits absorbing rounding, and shown to workPrec.
+const (
+	workPrec = 256
+	calcPrec = workPrec + 64
+)
+
+const (
+	piDigits  = "3.1415926535897932384626433832795028841971693993751058209749445923078164062862089986280348253421170679"
+	eDigits   = "2.7182818284590452353602874713526624977572470936999595749669676277240766303535475945713821785251664274"
+	ln2Digits = "0.6931471805599453094172321214581765680755001343602552541206800094933936219696947156058633269964186875"
+)
+
+var (
+	piRat = mustRat(piDigits)
+	ln2   = floatOf(mustRat(ln2Digits))
+
+	// maxExpArg bounds x in exp(x), so results stay within maxBits
+	maxExpArg = big.NewFloat(20000)
+	// maxTrigArg bounds trig arguments: beyond it, reducing by 2π with a
+	// 100-digit pi no longer leaves accurate digits
+	maxTrigArg = big.NewFloat(1e20)
+)
+
+func mustRat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic("calc: bad constant " + s)
+	}
+	return r
+}
+
+func newFloat() *big.Float {
+	return new(big.Float).SetPrec(calcPrec)
+}
+
+func floatOf(r *big.Rat) *big.Float {
+	return newFloat().SetRat(r)
+}
+
+func ratOf(f *big.Float) *big.Rat {
+	r, _ := f.Rat(nil)
+	return r
+}
+
+// roundInt rounds f to the nearest integer, halves away from zero
+func roundInt(f *big.Float) *big.Int {
+	half := big.NewFloat(0.5)
+	if f.Sign() < 0 {
+		half.Neg(half)
+	}
+	i, _ := newFloat().Add(f, half).Int(nil)
+	return i
+}
+
+// converged reports whether term no longer changes sum. A sum that is
+// still zero converges once the term is far below any shown digit.
+func converged(term, sum *big.Float) bool {
+	if term.Sign() == 0 {
+		return true
+	}
+	if sum.Sign() == 0 {
+		return term.MantExp(nil) < -4*calcPrec
+	}
+	return term.MantExp(nil) < sum.MantExp(nil)-calcPrec-2
+}
+
+// maxTerms stops a series that does not converge; none of the series
+// here need more than a few hundred
+const maxTerms = 10000
+
+// bigExp returns e^x, for |x| <= maxExpArg
+func bigExp(x *big.Float) *big.Float {
+	// x = k·ln2 + r, lalu e^r = (e^(r/2^16))^(2^16)
+	k := roundInt(newFloat().Quo(x, ln2))
+	r := newFloat().Sub(x, newFloat().Mul(newFloat().SetInt(k), ln2))
+	r.SetMantExp(r, -16)
+
+	sum := newFloat().SetInt64(1)
+	term := newFloat().SetInt64(1)
+	for i := int64(1); i < maxTerms; i++ {
+		term.Mul(term, r)
+		term.Quo(term, newFloat().SetInt64(i))
+		if converged(term, sum) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < 16; i++ {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetMantExp(sum, int(k.Int64()))
+}
+
+// bigLn returns the natural logarithm of x > 0
+func bigLn(x *big.Float) *big.Float {
+	// x = m·2^k dengan m di [√½, √2), ln m = 2·atanh((m-1)/(m+1))
+	m := newFloat()
+	k := x.MantExp(m)
+	if m.Cmp(big.NewFloat(0.7071067811865476)) < 0 {
+		m.SetMantExp(m, 1)
+		k--
+	}
+	one := newFloat().SetInt64(1)
+	z := newFloat().Quo(newFloat().Sub(m, one), newFloat().Add(m, one))
+	z2 := newFloat().Mul(z, z)
+
+	sum := newFloat().Set(z)
+	term := newFloat().Set(z)
+	for i := int64(3); i < maxTerms; i += 2 {
+		term.Mul(term, z2)
+		t := newFloat().Quo(term, newFloat().SetInt64(i))
+		if converged(t, sum) {
+			break
+		}
+		sum.Add(sum, t)
+	}
+	sum.SetMantExp(sum, 1)
+	return sum.Add(sum, newFloat().Mul(newFloat().SetInt64(int64(k)), ln2))
+}
+
+// reduceAngle returns x minus the nearest multiple of 2π
+func reduceAngle(x *big.Float) *big.Float {
+	twoPi := newFloat().Mul(floatOf(piRat), newFloat().SetInt64(2))
+	k := roundInt(newFloat().Quo(x, twoPi))
+	return newFloat().Sub(x, newFloat().Mul(newFloat().SetInt(k), twoPi))
+}
+
+// bigSin and bigCos sum their Taylor series after reducing x to [-π, π]
+func bigSin(x *big.Float) *big.Float {
+	return taylor(reduceAngle(x), 1)
+}
+
+func bigCos(x *big.Float) *big.Float {
+	return taylor(reduceAngle(x), 0)
+}
+
+// taylor sums the series of sin (first 1) or cos (first 0): the terms
+// (-1)^n·x^(2n+first)/(2n+first)!
+func taylor(x *big.Float, first int64) *big.Float {
+	term := newFloat().SetInt64(1)
+	if first == 1 {
+		term.Set(x)
+	}
+	sum := newFloat().Set(term)
+	x2 := newFloat().Mul(x, x)
+	for i := first + 1; i < maxTerms; i += 2 {
+		term.Mul(term, x2)
+		term.Quo(term, newFloat().SetInt64(i*(i+1)))
+		term.Neg(term)
+		if converged(term, sum) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	return sum
+}
+
+// bigAtan returns the arc tangent of x
+func bigAtan(x *big.Float) *big.Float {
+	a := new(big.Float).Abs(x).SetPrec(calcPrec)
+	one := newFloat().SetInt64(1)
+	inverted := a.Cmp(one) > 0
+	if inverted {
+		a.Quo(one, a)
+	}
+	// atan(a) = 2·atan(a/(1+√(1+a²))), tiga kali sampai a < 0.1
+	for i := 0; i < 3; i++ {
+		s := newFloat().Mul(a, a)
+		s.Add(s, one).Sqrt(s).Add(s, one)
+		a.Quo(a, s)
+	}
+
+	sum := newFloat().Set(a)
+	term := newFloat().Set(a)
+	a2 := newFloat().Mul(a, a)
+	for i := int64(3); i < maxTerms; i += 2 {
+		term.Mul(term, a2).Neg(term)
+		t := newFloat().Quo(term, newFloat().SetInt64(i))
+		if converged(t, sum) {
+			break
+		}
+		sum.Add(sum, t)
+	}
+	sum.SetMantExp(sum, 3)
+
+	if inverted {
+		halfPi := newFloat().Quo(floatOf(piRat), newFloat().SetInt64(2))
+		sum.Sub(halfPi, sum)
+	}
+	if x.Sign() < 0 {
+		sum.Neg(sum)
+	}
+	return sum
+}
+
+// bigAsin returns the arc sine of x in [-1, 1]
+func bigAsin(x *big.Float) *big.Float {
+	one := newFloat().SetInt64(1)
+	c := newFloat().Sub(one, newFloat().Mul(x, x))
+	if c.Sign() == 0 {
+		halfPi := newFloat().Quo(floatOf(piRat), newFloat().SetInt64(2))
+		if x.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return halfPi
+	}
+	return bigAtan(newFloat().Quo(x, c.Sqrt(c)))
+}
+
+// snapZero returns zero for a trig result that is only rounding error:
+// far below the precision of its argument x
+func snapZero(f, x *big.Float) *big.Float {
+	if f.Sign() == 0 || x.Sign() == 0 {
+		return f
+	}
+	limit := -workPrec + 16
+	if e := x.MantExp(nil); e > 0 {
+		limit += e
+	}
+	if f.MantExp(nil) < limit && x.MantExp(nil) > -100 {
+		return newFloat()
+	}
+	return f
+}
@@ -0,0 +1,169 @@
+// Package calc evaluates arithmetic expressions for the calculate tool.
+//
+// Numbers are exact rationals, so 0.1 + 0.2 is 0.3 and 2 - 3 - 4 is -5;
+// functions without exact results (exp, ln, trig, fractional powers) are
+// computed to 256 bits. Expressions can use units (5 km / 2 h, 3 ft to cm),
+// the constants pi and e, and variables, either given by the caller or
+// assigned in the expression: "r = 2 m; pi * r^2".
+package calc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits keep a single expression cheap to evaluate
+const (
+	// MaxLength is the longest expression accepted, in characters
+	MaxLength = 4096
+	// maxDepth is how deeply parentheses, operators and calls may nest
+	maxDepth = 200
+	// maxBits bounds the size of numbers, in bits either side of the point
+	maxBits = 1 << 16
+	// maxDenomBits is the longest denominator kept exact
+	maxDenomBits = 4 * calcPrec
+	// displayDigits is how many significant digits inexact results show
+	displayDigits = 30
+)
+
+// Error is an invalid expression, or one that cannot be evaluated, with
+// the position (in characters, from 1) where the problem is
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func errorf(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Value is a number, possibly with a unit
+type Value struct {
+	num   *big.Rat  // in SI base units
+	dim   dimension // of num
+	units unitList  // how to display it, nil for SI base units
+}
+
+// number returns a dimensionless value
+func number(r *big.Rat) Value {
+	return Value{num: r}
+}
+
+// Rat returns the value in its display units
+func (v Value) Rat() *big.Rat {
+	if v.units == nil {
+		return new(big.Rat).Set(v.num)
+	}
+	return new(big.Rat).Quo(v.num, v.units.scale())
+}
+
+// Unit returns the unit the value is displayed in, "" for plain numbers
+func (v Value) Unit() string {
+	if v.units != nil {
+		return v.units.String()
+	}
+	return siUnits(v.dim).String()
+}
+
+// String formats the value: exactly when it is an integer of up to 60
+// digits, else rounded to 30 significant digits, followed by its unit
+func (v Value) String() string {
+	s := formatRat(v.Rat())
+	if u := v.Unit(); u != "" {
+		s += " " + u
+	}
+	return s
+}
+
+func formatRat(r *big.Rat) string {
+	if r.IsInt() {
+		if s := r.Num().String(); len(s) <= 60 {
+			return s
+		}
+	}
+	f := new(big.Float).SetPrec(workPrec).SetRat(r)
+	s := f.Text('g', displayDigits)
+	if mant, exp, ok := strings.Cut(s, "e"); ok {
+		// 1.5e+20 → 1.5e20, seperti yang bisa diketik balik
+		return mant + "e" + strings.TrimPrefix(exp, "+")
+	}
+	return s
+}
+
+// Env holds variables across evaluations
+type Env struct {
+	vars map[string]Value
+}
+
+// NewEnv returns an environment without variables
+func NewEnv() *Env {
+	return &Env{vars: make(map[string]Value)}
+}
+
+// Set defines a variable. Names are letters, digits and underscores, not
+// starting with a digit, and cannot be a constant or function name.
+func (e *Env) Set(name string, v Value) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	e.vars[name] = v
+	return nil
+}
+
+func checkName(name string) error {
+	if name == "" {
+		return fmt.Errorf("variable name is empty")
+	}
+	for i, r := range name {
+		if !isNameRune(r) || (i == 0 && unicode.IsDigit(r)) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	if _, ok := constants[name]; ok {
+		return fmt.Errorf("%s is a constant", name)
+	}
+	if _, ok := functions[name]; ok {
+		return fmt.Errorf("%s is a function", name)
+	}
+	if keywords[name] {
+		return fmt.Errorf("%s is a keyword", name)
+	}
+	return nil
+}
+
+// Eval evaluates expr, a list of statements separated by semicolons, and
+// returns the value of the last one. Assignments (x = 2 km) stay in e.
+func (e *Env) Eval(expr string) (Value, error) {
+	if n := utf8.RuneCountInString(expr); n > MaxLength {
+		return Value{}, errorf(MaxLength+1, "expression is longer than %d characters", MaxLength)
+	}
+	statements, err := parse(expr)
+	if err != nil {
+		return Value{}, err
+	}
+
+	var result Value
+	for _, s := range statements {
+		v, err := s.value.eval(e)
+		if err != nil {
+			return Value{}, err
+		}
+		if s.name != "" {
+			e.vars[s.name] = v
+		}
+		result = v
+	}
+	return result, nil
+}
+
+// Eval evaluates expr without predefined variables
+func Eval(expr string) (Value, error) {
+	return NewEnv().Eval(expr)
+}
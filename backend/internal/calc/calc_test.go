@@ -0,0 +1,250 @@
+package calc
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type evalTest struct {
+	expr string
+	want string
+}
+
+func runEvalTests(t *testing.T, tests []evalTest) {
+	t.Helper()
+	for _, tt := range tests {
+		v, err := Eval(tt.expr)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got := v.String(); got != tt.want {
+			t.Errorf("Eval(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"2 - 3 - 4", "-5"},
+		{"100 / 10 / 5", "2"},
+		{"7 % 3", "1"},
+		{"7 % -3", "-2"},
+		{"-7 % 3", "2"},
+		{"2 * 3 % 4", "2"},
+		{"-2^2", "-4"},
+		{"(-2)^2", "4"},
+		{"2^-1", "0.5"},
+		{"--3", "3"},
+		{"3 - -3", "6"},
+		{"0.1 + 0.2", "0.3"},
+		{"1/3 + 1/6", "0.5"},
+		{"1/3", "0.333333333333333333333333333333"},
+		{"1_000_000 * 3", "3000000"},
+		{"1.5e3 + 2E-1", "1500.2"},
+		{".5 + .25", "0.75"},
+		{"2 pi", "6.28318530717958647692528676656"},
+		{"2(3 + 4)", "14"},
+		{"2^100", "1267650600228229401496703205376"},
+		{"1e70", "1e70"},
+		{"10^61", "1e61"},
+		{"10^60", "1e60"},
+		{"10^59", "100000000000000000000000000000000000000000000000000000000000"},
+	})
+}
+
+func TestPowerIsRightAssociative(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"2^3^2", "512"},
+		{"(2^3)^2", "64"},
+		{"2^2^-1", "1.41421356237309504880168872421"},
+		{"4^0.5", "2"},
+		{"8^(1/3)", "2"},
+		{"(-8)^(1/3)", "-2"},
+		{"(27/8)^(2/3)", "2.25"},
+		{"0^0", "1"},
+		{"2^pi", "8.82497782707628762385642960421"},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"sqrt(16)", "4"},
+		{"sqrt(2)", "1.41421356237309504880168872421"},
+		{"cbrt(-27)", "-3"},
+		{"pow(2, 10)", "1024"},
+		{"abs(-3.5)", "3.5"},
+		{"floor(-2.5)", "-3"},
+		{"ceil(-2.5)", "-2"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-3"},
+		{"round(3.14159, 2)", "3.14"},
+		{"round(1234, -2)", "1200"},
+		{"min(3, 1, 2)", "1"},
+		{"max(3, 1, 2)", "3"},
+		{"exp(0)", "1"},
+		{"exp(1)", "2.71828182845904523536028747135"},
+		{"ln(e)", "1"},
+		{"log(1000)", "3"},
+		{"log(8, 2)", "3"},
+		{"log2(1/8)", "-3"},
+		{"log10(0.001)", "-3"},
+		{"ln(2)", "0.693147180559945309417232121458"},
+		{"sin(pi)", "0"},
+		{"sin(pi/6)", "0.5"},
+		{"cos(pi)", "-1"},
+		{"tan(pi/4)", "1"},
+		{"asin(1)", "1.57079632679489661923132169164"},
+		{"acos(1)", "0"},
+		{"atan(1) * 4", "3.14159265358979323846264338328"},
+		{"sin(30 deg)", "0.5"},
+		{"sin(90°)", "1"},
+	})
+}
+
+func TestUnits(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"5 km + 300 m", "5.3 km"},
+		{"300 m + 5 km", "5300 m"},
+		{"10 km / 2 h", "5 km/h"},
+		{"3 ft to cm", "91.44 cm"},
+		{"1 mi to km", "1.609344 km"},
+		{"100 km/h to m/s", "27.7777777777777777777777777778 m/s"},
+		{"60 mph to km/h", "96.56064 km/h"},
+		{"2 m * 3 m", "6 m^2"},
+		{"1 ha to m^2", "10000 m^2"},
+		{"1 L to cm^3", "1000 cm^3"},
+		{"1 km / 1 m", "1000"},
+		{"1 GiB to MB", "1073.741824 MB"},
+		{"8 bit to B", "1 B"},
+		{"90 deg to rad", "1.57079632679489661923132169164 rad"},
+		{"2 * 30 deg", "60 deg"},
+		{"1 day to h", "24 h"},
+		{"5 kg * 2 m / s^2", "10 kg*m/s^2"},
+		{"1 / 2 s", "0.5 s^-1"},
+		{"sqrt(16 m^2)", "4 m"},
+		{"floor(2.7 km)", "2 km"},
+		{"max(1 km, 900 m)", "1 km"},
+		{"1 lb + 1 oz to g", "481.941893125 g"},
+		{"5 km as m", "5000 m"},
+	})
+}
+
+func TestVariables(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"x = 3; x^2 + 1", "10"},
+		{"r = 2 m; pi * r^2", "12.5663706143591729538505735331 m^2"},
+		{"a = 2; b = a * 3; a + b", "8"},
+		{"d = 42 km; t = 30 min; d / t to km/h", "84 km/h"},
+		{"x = 1; x = x + 1; x", "2"},
+	})
+
+	env := NewEnv()
+	if err := env.Set("price", number(big.NewRat(25, 2))); err != nil {
+		t.Fatal(err)
+	}
+	v, err := env.Eval("total = price * 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "50" {
+		t.Errorf("total = %s, want 50", v)
+	}
+	// Assignments stay in the environment
+	if v, err := env.Eval("total - price"); err != nil || v.String() != "37.5" {
+		t.Errorf("total - price = %v, %v; want 37.5", v, err)
+	}
+
+	for _, name := range []string{"", "2x", "a-b", "pi", "sqrt", "to"} {
+		if err := env.Set(name, number(big.NewRat(1, 1))); err == nil {
+			t.Errorf("Set(%q) accepted", name)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"", 1, "empty"},
+		{"1 +", 4, "expected"},
+		{"(1 + 2", 7, "expected ')'"},
+		{"1 + 2)", 6, "unexpected"},
+		{"1 / 0", 3, "division by zero"},
+		{"5 % 0", 3, "modulo by zero"},
+		{"2 + foo", 5, `unknown name "foo"`},
+		{"foo(2)", 1, `unknown function "foo"`},
+		{"sqrt", 1, "is a function"},
+		{"sqrt(1, 2)", 1, "sqrt takes 1 argument"},
+		{"1 km + 2 kg", 6, "cannot add km and kg"},
+		{"3 kg to m", 6, "cannot convert kg to m"},
+		{"3 m to 5", 5, "expected a unit"},
+		{"sqrt(-4)", 1, "even root of a negative number"},
+		{"ln(0)", 1, "needs a positive number"},
+		{"asin(2)", 1, "from -1 to 1"},
+		{"sin(2 m)", 1, "needs a plain number"},
+		{"2 ^ 1 m", 3, "exponent must be a plain number"},
+		{"2 m ^ 0.5", 5, "cannot take the root of m"},
+		{"10^10^10", 3, "too large"},
+		{"exp(100000)", 1, "out of range"},
+		{"1e999999", 1, "exponent is larger"},
+		{"2 # 3", 3, "unexpected"},
+		{"x = ; 1", 5, "expected"},
+		{"pi = 3", 1, "pi is a constant"},
+		{"tan(pi/2)", 1, "undefined"},
+	}
+
+	for _, tt := range tests {
+		_, err := Eval(tt.expr)
+		var calcErr *Error
+		if !errors.As(err, &calcErr) {
+			t.Errorf("Eval(%q) error = %v, want *Error", tt.expr, err)
+			continue
+		}
+		if calcErr.Pos != tt.pos || !strings.Contains(calcErr.Msg, tt.msg) {
+			t.Errorf("Eval(%q) = %q at %d, want %q at %d", tt.expr, calcErr.Msg, calcErr.Pos, tt.msg, tt.pos)
+		}
+	}
+
+	if _, err := Eval(strings.Repeat("1+", MaxLength)); err == nil {
+		t.Error("overlong expression accepted")
+	}
+	if _, err := Eval(strings.Repeat("(", 1000) + "1" + strings.Repeat(")", 1000)); err == nil {
+		t.Error("deeply nested expression accepted")
+	}
+}
+
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		"1 + 2 * 3", "2^3^2", "(-8)^(1/3)", "0.1 + 0.2", "1/3 * 3",
+		"sqrt(2)^2", "round(3.14159, 2)", "log(8, 2)", "sin(pi/6) + cos(0)",
+		"5 km + 300 m", "100 km/h to m/s", "3 ft to cm", "1 GiB to MB",
+		"r = 2 m; pi * r^2", "x = 1; x = x * 1.5; x^x", "2e3", "1_000.5e-3",
+		"exp(ln(10))", "min(1 km, 2 mi)", "floor(-2.5 h)", "10^10^10", "atan(1e30)",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, expr string) {
+		start := time.Now()
+		v, err := Eval(expr)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("Eval(%q) took %v", expr, elapsed)
+		}
+		if err != nil {
+			var calcErr *Error
+			if !errors.As(err, &calcErr) {
+				t.Fatalf("Eval(%q) error %v is not an *Error", expr, err)
+			}
+			return
+		}
+		_ = v.String()
+	})
+}
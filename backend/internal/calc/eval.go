@@ -0,0 +1,377 @@
+package calc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// node is a parsed expression
+type node interface {
+	eval(e *Env) (Value, error)
+}
+
+type numNode struct {
+	v *big.Rat
+}
+
+type nameNode struct {
+	name string
+	pos  int
+}
+
+type negNode struct {
+	x   node
+	pos int
+}
+
+type binaryNode struct {
+	op   string
+	l, r node
+	pos  int
+}
+
+type callNode struct {
+	name string
+	args []node
+	pos  int
+}
+
+// convertNode is "x to unit"
+type convertNode struct {
+	x, target node
+	pos       int
+}
+
+func (n *numNode) eval(*Env) (Value, error) {
+	return number(n.v), nil
+}
+
+// eval looks a name up as a variable, then a constant, then a unit
+func (n *nameNode) eval(e *Env) (Value, error) {
+	if v, ok := e.vars[n.name]; ok {
+		return v, nil
+	}
+	if c, ok := constants[n.name]; ok {
+		return number(c), nil
+	}
+	if name, u, ok := lookupUnit(n.name); ok {
+		return Value{num: u.scale, dim: u.dim, units: unitList{{name, 1}}}, nil
+	}
+	if _, ok := functions[n.name]; ok {
+		return Value{}, errorf(n.pos, "%s is a function, call it as %s(...)", n.name, n.name)
+	}
+	return Value{}, errorf(n.pos, "unknown name %q", n.name)
+}
+
+func (n *negNode) eval(e *Env) (Value, error) {
+	v, err := n.x.eval(e)
+	if err != nil {
+		return Value{}, err
+	}
+	v.num = new(big.Rat).Neg(v.num)
+	return v, nil
+}
+
+func (n *binaryNode) eval(e *Env) (Value, error) {
+	l, err := n.l.eval(e)
+	if err != nil {
+		return Value{}, err
+	}
+	r, err := n.r.eval(e)
+	if err != nil {
+		return Value{}, err
+	}
+
+	var v Value
+	switch n.op {
+	case "+", "-":
+		if l.dim != r.dim {
+			return Value{}, errorf(n.pos, "cannot %s %s and %s", map[string]string{"+": "add", "-": "subtract"}[n.op], describeUnit(l), describeUnit(r))
+		}
+		v = Value{num: new(big.Rat), dim: l.dim, units: sumUnits(l, r)}
+		if n.op == "+" {
+			v.num.Add(l.num, r.num)
+		} else {
+			v.num.Sub(l.num, r.num)
+		}
+	case "*":
+		v = product(l, r, 1)
+		v.num = new(big.Rat).Mul(l.num, r.num)
+	case "/":
+		if r.num.Sign() == 0 {
+			return Value{}, errorf(n.pos, "division by zero")
+		}
+		v = product(l, r, -1)
+		v.num = new(big.Rat).Quo(l.num, r.num)
+	case "%":
+		if l.dim != r.dim {
+			return Value{}, errorf(n.pos, "cannot take %s modulo %s", describeUnit(l), describeUnit(r))
+		}
+		if r.num.Sign() == 0 {
+			return Value{}, errorf(n.pos, "modulo by zero")
+		}
+		v = Value{num: mod(l.num, r.num), dim: l.dim, units: sumUnits(l, r)}
+	case "^":
+		if !r.dim.isZero() {
+			return Value{}, errorf(n.pos, "exponent must be a plain number, not %s", describeUnit(r))
+		}
+		if v, err = pow(l, r.num); err != nil {
+			return Value{}, errorf(n.pos, "%v", err)
+		}
+	}
+	return normalize(v, n.pos)
+}
+
+func (n *callNode) eval(e *Env) (Value, error) {
+	fn, ok := functions[n.name]
+	if !ok {
+		if _, isVar := e.vars[n.name]; isVar {
+			return Value{}, errorf(n.pos, "%s is a variable, not a function", n.name)
+		}
+		return Value{}, errorf(n.pos, "unknown function %q", n.name)
+	}
+	if len(n.args) < fn.min || (fn.max >= 0 && len(n.args) > fn.max) {
+		return Value{}, errorf(n.pos, "%s takes %s", n.name, fn.arity())
+	}
+
+	args := make([]Value, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return Value{}, err
+		}
+		args[i] = v
+	}
+	v, err := fn.call(args)
+	if err != nil {
+		return Value{}, errorf(n.pos, "%s: %v", n.name, err)
+	}
+	return normalize(v, n.pos)
+}
+
+// eval keeps the quantity of x but displays it in the unit of target
+func (n *convertNode) eval(e *Env) (Value, error) {
+	x, err := n.x.eval(e)
+	if err != nil {
+		return Value{}, err
+	}
+	target, err := n.target.eval(e)
+	if err != nil {
+		return Value{}, err
+	}
+	units := target.displayUnits()
+	if units == nil || target.Rat().Cmp(big.NewRat(1, 1)) != 0 {
+		return Value{}, errorf(n.pos, "expected a unit after 'to', such as km or m/s")
+	}
+	if x.dim != target.dim {
+		return Value{}, errorf(n.pos, "cannot convert %s to %s", describeUnit(x), units)
+	}
+	return Value{num: x.num, dim: x.dim, units: units}, nil
+}
+
+// displayUnits returns the units of v, in SI base units when it has none
+func (v Value) displayUnits() unitList {
+	if v.units != nil {
+		return v.units
+	}
+	return siUnits(v.dim)
+}
+
+func describeUnit(v Value) string {
+	if u := v.Unit(); u != "" {
+		return u
+	}
+	return "a plain number"
+}
+
+// sumUnits picks the display units of a sum: those of the left side, e.g.
+// 5 km + 300 m is 5.3 km
+func sumUnits(l, r Value) unitList {
+	if l.units != nil {
+		return l.units
+	}
+	return r.units
+}
+
+// product multiplies (sign 1) or divides (sign -1) the dimensions and
+// units of l and r. A result without dimension is a plain number (km/m is
+// 1000), unless only angles are left (2 * 30 deg is 60 deg).
+func product(l, r Value, sign int) Value {
+	v := Value{dim: l.dim.add(r.dim, sign)}
+	v.units = l.displayUnits().mul(r.displayUnits(), sign)
+	if v.dim.isZero() {
+		for _, u := range v.units {
+			if _, def, _ := lookupUnit(u.name); !def.dim.isZero() {
+				v.units = nil
+				break
+			}
+		}
+	}
+	return v
+}
+
+// mod is the floored remainder: its sign is that of b, like 7 % -3 = -2
+func mod(a, b *big.Rat) *big.Rat {
+	q := new(big.Rat).Quo(a, b)
+	floor := new(big.Int).Div(q.Num(), q.Denom())
+	m := new(big.Rat).Mul(b, new(big.Rat).SetInt(floor))
+	return m.Sub(a, m)
+}
+
+// Limits of pow: units take powers up to maxUnitPower, and exact roots
+// are tried up to maxRoot
+const (
+	maxUnitPower = 100
+	maxRoot      = 64
+)
+
+// pow raises base to exp: exactly for integer exponents and for fractions
+// whose root is rational (8^(1/3) = 2), else through exp and ln
+func pow(base Value, exp *big.Rat) (Value, error) {
+	p, q := exp.Num(), exp.Denom()
+	small := p.IsInt64() && abs64(p.Int64()) <= 1<<30 && q.IsInt64() && q.Int64() <= maxRoot
+	var pn, qn int
+	if small {
+		pn, qn = int(p.Int64()), int(q.Int64())
+	}
+
+	v := Value{dim: base.dim}
+	if units := base.displayUnits(); units != nil {
+		if !small || abs(pn) > maxUnitPower {
+			return Value{}, fmt.Errorf("%s can only be raised to powers up to %d", base.Unit(), maxUnitPower)
+		}
+		for _, u := range units {
+			if u.power%qn != 0 {
+				return Value{}, fmt.Errorf("cannot take the root of %s", base.Unit())
+			}
+		}
+		for i, d := range base.dim {
+			v.dim[i] = d / qn * pn
+		}
+		raised := make(unitList, len(units))
+		for i, u := range units {
+			raised[i] = unitPower{u.name, u.power / qn * pn}
+		}
+		v.units = raised.mul(nil, 1)
+	}
+
+	x := base.num
+	switch {
+	case x.Sign() == 0:
+		if exp.Sign() < 0 {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		v.num = new(big.Rat)
+		if exp.Sign() == 0 {
+			v.num.SetInt64(1)
+		}
+		return v, nil
+	case x.Sign() < 0 && q.Bit(0) == 0:
+		return Value{}, fmt.Errorf("even root of a negative number")
+	case x.Num().CmpAbs(x.Denom()) == 0:
+		// ±1 to any power
+		v.num = big.NewRat(1, 1)
+		if x.Sign() < 0 && p.Bit(0) == 1 {
+			v.num.Neg(v.num)
+		}
+		return v, nil
+	}
+
+	if small {
+		if root, ok := ratRoot(x, qn); ok {
+			if max(root.Num().BitLen(), root.Denom().BitLen())*abs(pn) > maxBits+abs(pn) {
+				return Value{}, fmt.Errorf("result is too large")
+			}
+			v.num = ratPow(root, abs(pn))
+			if pn < 0 {
+				v.num.Inv(v.num)
+			}
+			return v, nil
+		}
+	} else if exp.IsInt() {
+		return Value{}, fmt.Errorf("result is too large")
+	}
+
+	y := newFloat().Mul(bigLn(floatOf(new(big.Rat).Abs(x))), floatOf(exp))
+	if new(big.Float).Abs(y).Cmp(maxExpArg) > 0 {
+		return Value{}, fmt.Errorf("result is out of range")
+	}
+	f := bigExp(y)
+	if x.Sign() < 0 && p.Bit(0) == 1 {
+		f.Neg(f)
+	}
+	v.num, _ = f.Rat(nil)
+	return v, nil
+}
+
+// ratPow returns r^n for n >= 0
+func ratPow(r *big.Rat, n int) *big.Rat {
+	e := big.NewInt(int64(n))
+	num := new(big.Int).Exp(r.Num(), e, nil)
+	den := new(big.Int).Exp(r.Denom(), e, nil)
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// ratRoot returns the q-th root of r when it is rational
+func ratRoot(r *big.Rat, q int) (*big.Rat, bool) {
+	if q == 1 {
+		return r, true
+	}
+	num, ok := intRoot(new(big.Int).Abs(r.Num()), q)
+	if !ok {
+		return nil, false
+	}
+	den, ok := intRoot(r.Denom(), q)
+	if !ok {
+		return nil, false
+	}
+	if r.Sign() < 0 {
+		num.Neg(num)
+	}
+	return new(big.Rat).SetFrac(num, den), true
+}
+
+// intRoot returns the q-th root of n >= 0 when it is an integer
+func intRoot(n *big.Int, q int) (*big.Int, bool) {
+	if n.Sign() == 0 || n.Cmp(big.NewInt(1)) == 0 {
+		return new(big.Int).Set(n), true
+	}
+	if q == 2 {
+		s := new(big.Int).Sqrt(n)
+		return s, new(big.Int).Mul(s, s).Cmp(n) == 0
+	}
+	// Tebakan lewat ln, lalu cek tetangganya secara eksak
+	guess := bigExp(newFloat().Quo(bigLn(newFloat().SetInt(n)), newFloat().SetInt64(int64(q))))
+	c := roundInt(guess)
+	qn := big.NewInt(int64(q))
+	for _, d := range []int64{0, -1, 1} {
+		cand := new(big.Int).Add(c, big.NewInt(d))
+		if cand.Sign() > 0 && new(big.Int).Exp(cand, qn, nil).Cmp(n) == 0 {
+			return cand, true
+		}
+	}
+	return nil, false
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// normalize rejects numbers too large or too small to hold, and rounds
+// fractions with very long denominators (1/3^300, or chains of inexact
+// results) to the working precision; they are shown far shorter anyway
+func normalize(v Value, pos int) (Value, error) {
+	num, den := v.num.Num().BitLen(), v.num.Denom().BitLen()
+	switch {
+	case num-den > maxBits:
+		return Value{}, errorf(pos, "number is too large")
+	case v.num.Sign() != 0 && den-num > maxBits:
+		return Value{}, errorf(pos, "number is too small")
+	case den > maxDenomBits:
+		v.num = ratOf(floatOf(v.num))
+	}
+	return v, nil
+}
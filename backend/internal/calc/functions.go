@@ -0,0 +1,231 @@
+package calc
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// constants are the named numbers. pi and e are rationals exact to 100
+// digits, far beyond the precision results are shown with.
+var constants = map[string]*big.Rat{
+	"pi":  piRat,
+	"π":   piRat,
+	"tau": new(big.Rat).Mul(piRat, big.NewRat(2, 1)),
+	"e":   mustRat(eDigits),
+}
+
+// function is a built-in function taking min to max arguments (max -1
+// for any number)
+type function struct {
+	min, max int
+	call     func(args []Value) (Value, error)
+}
+
+func (f function) arity() string {
+	switch {
+	case f.min == f.max && f.min == 1:
+		return "1 argument"
+	case f.min == f.max:
+		return strconv.Itoa(f.min) + " arguments"
+	case f.max < 0:
+		return fmt.Sprintf("at least %d argument(s)", f.min)
+	}
+	return fmt.Sprintf("%d to %d arguments", f.min, f.max)
+}
+
+// functions are the built-in functions by name
+var functions = map[string]function{
+	"sqrt":  {1, 1, func(a []Value) (Value, error) { return pow(a[0], big.NewRat(1, 2)) }},
+	"cbrt":  {1, 1, func(a []Value) (Value, error) { return pow(a[0], big.NewRat(1, 3)) }},
+	"pow":   {2, 2, powFunc},
+	"abs":   {1, 1, rounding(func(r *big.Rat) *big.Rat { return r.Abs(r) })},
+	"floor": {1, 1, rounding(func(r *big.Rat) *big.Rat { return r.SetInt(floorInt(r)) })},
+	"ceil":  {1, 1, rounding(func(r *big.Rat) *big.Rat { return r.SetInt(floorInt(r.Neg(r))).Neg(r) })},
+	"round": {1, 2, round},
+	"min":   {1, -1, extreme(-1)},
+	"max":   {1, -1, extreme(1)},
+	"exp":   {1, 1, plain(expFunc)},
+	"ln":    {1, 1, plain(func(x *big.Rat) (*big.Rat, error) { return logBase(x, nil) })},
+	"log":   {1, 2, logFunc},
+	"log2":  {1, 1, plain(func(x *big.Rat) (*big.Rat, error) { return logBase(x, big.NewRat(2, 1)) })},
+	"log10": {1, 1, plain(func(x *big.Rat) (*big.Rat, error) { return logBase(x, big.NewRat(10, 1)) })},
+	"sin":   {1, 1, plain(trig(bigSin))},
+	"cos":   {1, 1, plain(trig(bigCos))},
+	"tan":   {1, 1, plain(tanFunc)},
+	"asin":  {1, 1, plain(inverseSine(false))},
+	"acos":  {1, 1, plain(inverseSine(true))},
+	"atan":  {1, 1, plain(func(x *big.Rat) (*big.Rat, error) { return ratOf(bigAtan(floatOf(x))), nil })},
+}
+
+// plain adapts a function of one plain number (angles count as plain, in
+// radians)
+func plain(fn func(x *big.Rat) (*big.Rat, error)) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		x := args[0]
+		if !x.dim.isZero() {
+			return Value{}, fmt.Errorf("needs a plain number, not %s", x.Unit())
+		}
+		r, err := fn(x.num)
+		if err != nil {
+			return Value{}, err
+		}
+		return number(r), nil
+	}
+}
+
+// rounding adapts a function that rounds the number shown, so floor(2.7 km)
+// is 2 km, not 2000 m rounded
+func rounding(fn func(r *big.Rat) *big.Rat) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		v := args[0]
+		r := fn(v.Rat())
+		if v.units != nil {
+			r.Mul(r, v.units.scale())
+		}
+		v.num = r
+		return v, nil
+	}
+}
+
+// round rounds half away from zero, to a number of decimals when given;
+// negative decimals round to tens, hundreds...
+func round(args []Value) (Value, error) {
+	digits := 0
+	if len(args) == 2 {
+		d := args[1]
+		if !d.dim.isZero() || !d.num.IsInt() || !d.num.Num().IsInt64() || abs64(d.num.Num().Int64()) > 1000 {
+			return Value{}, fmt.Errorf("decimals must be a whole number from -1000 to 1000")
+		}
+		digits = int(d.num.Num().Int64())
+	}
+	scale := new(big.Rat).SetInt(pow10(abs(digits)))
+	if digits < 0 {
+		scale.Inv(scale)
+	}
+	return rounding(func(r *big.Rat) *big.Rat {
+		neg := r.Sign() < 0
+		r.Abs(r).Mul(r, scale).Add(r, big.NewRat(1, 2))
+		r.SetInt(floorInt(r)).Quo(r, scale)
+		if neg {
+			r.Neg(r)
+		}
+		return r
+	})(args[:1])
+}
+
+func floorInt(r *big.Rat) *big.Int {
+	// Div pada big.Int adalah pembagian Euclid: untuk penyebut positif
+	// hasilnya floor
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+// extreme returns min (sign -1) or max (sign 1) of quantities of the same
+// dimension
+func extreme(sign int) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		best := args[0]
+		for _, v := range args[1:] {
+			if v.dim != best.dim {
+				return Value{}, fmt.Errorf("cannot compare %s and %s", describeUnit(best), describeUnit(v))
+			}
+			if v.num.Cmp(best.num)*sign > 0 {
+				best = v
+			}
+		}
+		return best, nil
+	}
+}
+
+func powFunc(args []Value) (Value, error) {
+	if !args[1].dim.isZero() {
+		return Value{}, fmt.Errorf("exponent must be a plain number, not %s", args[1].Unit())
+	}
+	return pow(args[0], args[1].num)
+}
+
+func expFunc(x *big.Rat) (*big.Rat, error) {
+	f := floatOf(x)
+	if new(big.Float).Abs(f).Cmp(maxExpArg) > 0 {
+		return nil, fmt.Errorf("argument is out of range")
+	}
+	return ratOf(bigExp(f)), nil
+}
+
+func logFunc(args []Value) (Value, error) {
+	var base *big.Rat
+	if len(args) == 2 {
+		if !args[1].dim.isZero() {
+			return Value{}, fmt.Errorf("base must be a plain number, not %s", args[1].Unit())
+		}
+		base = args[1].num
+	} else {
+		base = big.NewRat(10, 1)
+	}
+	return plain(func(x *big.Rat) (*big.Rat, error) { return logBase(x, base) })(args[:1])
+}
+
+// logBase returns the logarithm of x to base, or the natural one when base
+// is nil. Exact powers of the base give exact results: log(1000) is 3.
+func logBase(x, base *big.Rat) (*big.Rat, error) {
+	if x.Sign() <= 0 {
+		return nil, fmt.Errorf("needs a positive number")
+	}
+	if x.Cmp(big.NewRat(1, 1)) == 0 {
+		return new(big.Rat), nil
+	}
+	lnx := bigLn(floatOf(x))
+	if base == nil {
+		return ratOf(lnx), nil
+	}
+	if base.Sign() <= 0 || base.Cmp(big.NewRat(1, 1)) == 0 {
+		return nil, fmt.Errorf("base must be positive and not 1")
+	}
+
+	result := newFloat().Quo(lnx, bigLn(floatOf(base)))
+	if k := roundInt(result); k.IsInt64() && abs64(k.Int64()) <= maxRoot {
+		n := int(k.Int64())
+		if p := ratPow(base, abs(n)); n < 0 && p.Inv(p).Cmp(x) == 0 || n >= 0 && p.Cmp(x) == 0 {
+			return new(big.Rat).SetInt(k), nil
+		}
+	}
+	return ratOf(result), nil
+}
+
+// trig adapts sin or cos. Values within rounding error of zero are zero,
+// so sin(pi) is 0 and not 1e-100.
+func trig(fn func(*big.Float) *big.Float) func(*big.Rat) (*big.Rat, error) {
+	return func(x *big.Rat) (*big.Rat, error) {
+		f := floatOf(x)
+		if new(big.Float).Abs(f).Cmp(maxTrigArg) > 0 {
+			return nil, fmt.Errorf("argument is too large")
+		}
+		return ratOf(snapZero(fn(f), f)), nil
+	}
+}
+
+func tanFunc(x *big.Rat) (*big.Rat, error) {
+	f := floatOf(x)
+	if new(big.Float).Abs(f).Cmp(maxTrigArg) > 0 {
+		return nil, fmt.Errorf("argument is too large")
+	}
+	cos := snapZero(bigCos(f), f)
+	if cos.Sign() == 0 {
+		return nil, fmt.Errorf("undefined at this angle")
+	}
+	return ratOf(snapZero(newFloat().Quo(bigSin(f), cos), f)), nil
+}
+
+// inverseSine returns asin, or acos when cos is set
+func inverseSine(cos bool) func(*big.Rat) (*big.Rat, error) {
+	return func(x *big.Rat) (*big.Rat, error) {
+		if new(big.Rat).Abs(x).Cmp(big.NewRat(1, 1)) > 0 {
+			return nil, fmt.Errorf("needs a number from -1 to 1")
+		}
+		f := bigAsin(floatOf(x))
+		if cos {
+			f.Sub(newFloat().Quo(floatOf(piRat), newFloat().SetInt64(2)), f)
+		}
+		return ratOf(f), nil
+	}
+}
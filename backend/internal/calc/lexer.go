@@ -0,0 +1,159 @@
+package calc
+
+import (
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokName
+	tokOp // + - * / % ^ ( ) , ; =
+	tokTo // "to" or "as", converting to a unit
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  *big.Rat // for tokNumber
+	pos  int      // in characters, from 1
+}
+
+// keywords are names that are operators
+var keywords = map[string]bool{"to": true, "as": true}
+
+// opAliases are the typographic forms of operators
+var opAliases = map[rune]string{'×': "*", '·': "*", '÷': "/", '−': "-"}
+
+// maxExponent bounds the exponent of number literals like 1e300
+const maxExponent = 10000
+
+func isNameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lex splits expr into tokens, ending with a tokEOF
+func lex(expr string) ([]token, error) {
+	src := []rune(expr)
+	var tokens []token
+	for i := 0; i < len(src); {
+		r := src[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case isDigit(r) || (r == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			n, end, err := lexNumber(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(src[i:end]), num: n, pos: pos})
+			i = end
+		case r == '°':
+			tokens = append(tokens, token{kind: tokName, text: "°", pos: pos})
+			i++
+		case isNameRune(r):
+			end := i
+			for end < len(src) && isNameRune(src[end]) {
+				end++
+			}
+			name := string(src[i:end])
+			kind := tokName
+			if keywords[name] {
+				kind = tokTo
+			}
+			tokens = append(tokens, token{kind: kind, text: name, pos: pos})
+			i = end
+		case r == '*' && i+1 < len(src) && src[i+1] == '*':
+			tokens = append(tokens, token{kind: tokOp, text: "^", pos: pos})
+			i += 2
+		case strings.ContainsRune("+-*/%^(),;=", r):
+			tokens = append(tokens, token{kind: tokOp, text: string(r), pos: pos})
+			i++
+		case opAliases[r] != "":
+			tokens = append(tokens, token{kind: tokOp, text: opAliases[r], pos: pos})
+			i++
+		default:
+			return nil, errorf(pos, "unexpected character %q", r)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src) + 1}), nil
+}
+
+// lexNumber reads a number literal starting at src[start]: digits with
+// optional _ separators, a fraction and an exponent (1_000.5e-3)
+func lexNumber(src []rune, start int) (*big.Rat, int, error) {
+	var digits strings.Builder
+	i := start
+	readDigits := func() int {
+		n := 0
+		for i < len(src) {
+			switch {
+			case isDigit(src[i]):
+				digits.WriteRune(src[i])
+				n++
+			case src[i] == '_' && n > 0 && i+1 < len(src) && isDigit(src[i+1]):
+			default:
+				return n
+			}
+			i++
+		}
+		return n
+	}
+
+	readDigits()
+	fraction := 0
+	if i < len(src) && src[i] == '.' {
+		i++
+		fraction = readDigits()
+	}
+	if digits.Len() == 0 {
+		return nil, 0, errorf(start+1, "invalid number")
+	}
+
+	exp := 0
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		sign := 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			if src[j] == '-' {
+				sign = -1
+			}
+			j++
+		}
+		// "2e" tanpa digit adalah 2 kali konstanta e, bukan eksponen
+		if j < len(src) && isDigit(src[j]) {
+			i = j
+			for i < len(src) && isDigit(src[i]) {
+				if exp = exp*10 + int(src[i]-'0'); exp > maxExponent {
+					return nil, 0, errorf(start+1, "exponent is larger than %d", maxExponent)
+				}
+				i++
+			}
+			exp *= sign
+		}
+	}
+
+	mant, _ := new(big.Int).SetString(digits.String(), 10)
+	n := new(big.Rat).SetInt(mant)
+	if shift := exp - fraction; shift >= 0 {
+		n.Mul(n, new(big.Rat).SetInt(pow10(shift)))
+	} else {
+		n.Quo(n, new(big.Rat).SetInt(pow10(-shift)))
+	}
+	return n, i, nil
+}
+
+// isDigit accepts ASCII digits only: digits of other scripts lex as names
+// and fail as unknown ones
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,231 @@
+package calc
+
+import "fmt"
+
+// Operator precedence, lowest first. A number followed directly by a name
+// or parenthesis (2 pi, 3 km, 2(1 + 3)) multiplies tighter than * and /,
+// so 10 km / 2 h is a speed; ^ binds tighter still and is right
+// associative, and -2^2 is -4.
+const (
+	precTo = iota + 1
+	precAdd
+	precMul
+	precUnary
+	precPow
+)
+
+// statement is one expression of a program, assigned to name if set
+type statement struct {
+	name  string
+	value node
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	depth  int
+}
+
+// parse parses statements separated by semicolons
+func parse(expr string) ([]statement, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var statements []statement
+	for p.peek().kind != tokEOF {
+		if p.isOp(";") {
+			p.i++
+			continue
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, s)
+		if t := p.peek(); t.kind != tokEOF && !p.isOp(";") {
+			return nil, errorf(t.pos, "unexpected %s", describe(t))
+		}
+	}
+	if len(statements) == 0 {
+		return nil, errorf(1, "expression is empty")
+	}
+	return statements, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) statement() (statement, error) {
+	t := p.peek()
+	if t.kind == tokName && p.tokens[p.i+1].kind == tokOp && p.tokens[p.i+1].text == "=" {
+		if err := checkName(t.text); err != nil {
+			return statement{}, errorf(t.pos, "cannot assign to %s: %v", t.text, err)
+		}
+		p.i += 2
+		value, err := p.expr(0)
+		return statement{name: t.text, value: value}, err
+	}
+	value, err := p.expr(0)
+	return statement{value: value}, err
+}
+
+// infixPrec returns the precedence of t as a binary operator, 0 if it is
+// not one
+func infixPrec(t token) int {
+	switch {
+	case t.kind == tokTo:
+		return precTo
+	case t.kind != tokOp:
+		return 0
+	}
+	switch t.text {
+	case "+", "-":
+		return precAdd
+	case "*", "/", "%":
+		return precMul
+	case "^":
+		return precPow
+	}
+	return 0
+}
+
+// expr parses operators of at least precedence min
+func (p *parser) expr(min int) (node, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, errorf(p.peek().pos, "expression is nested more than %d levels deep", maxDepth)
+	}
+	defer func() { p.depth-- }()
+
+	left, err := p.prefix()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		prec := infixPrec(op)
+		if prec == 0 || prec < min {
+			return left, nil
+		}
+		p.next()
+
+		// ^ is right associative: its right side may hold another ^
+		next := prec + 1
+		if prec == precPow {
+			next = precPow
+		}
+		right, err := p.expr(next)
+		if err != nil {
+			return nil, err
+		}
+		if op.kind == tokTo {
+			left = &convertNode{x: left, target: right, pos: op.pos}
+		} else {
+			left = &binaryNode{op: op.text, l: left, r: right, pos: op.pos}
+		}
+	}
+}
+
+// prefix parses a number, name, call, parenthesised expression or sign
+func (p *parser) prefix() (node, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokNumber:
+		n := &numNode{v: t.num}
+		// Implicit multiplication: 2 pi, 3 km^2, 2(1 + 3)
+		if next := p.peek(); next.kind == tokName || (next.kind == tokOp && next.text == "(") {
+			right, err := p.expr(precPow)
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{op: "*", l: n, r: right, pos: next.pos}, nil
+		}
+		return n, nil
+
+	case t.kind == tokName:
+		if p.isOp("(") {
+			return p.call(t)
+		}
+		return &nameNode{name: t.text, pos: t.pos}, nil
+
+	case t.kind == tokOp && t.text == "(":
+		x, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			u := p.peek()
+			return nil, errorf(u.pos, "expected ')' to close '(' at position %d, found %s", t.pos, describe(u))
+		}
+		p.next()
+		return x, nil
+
+	case t.kind == tokOp && (t.text == "-" || t.text == "+"):
+		x, err := p.expr(precUnary)
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			return x, nil
+		}
+		return &negNode{x: x, pos: t.pos}, nil
+	}
+
+	if t.kind == tokEOF {
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %s", describe(t))
+}
+
+// call parses the arguments of name(...)
+func (p *parser) call(name token) (node, error) {
+	open := p.next()
+	c := &callNode{name: name.text, pos: name.pos}
+	if p.isOp(")") {
+		p.next()
+		return c, nil
+	}
+	for {
+		arg, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+
+		switch t := p.next(); {
+		case t.kind == tokOp && t.text == ",":
+		case t.kind == tokOp && t.text == ")":
+			return c, nil
+		default:
+			return nil, errorf(t.pos, "expected ',' or ')' in call to %s at position %d, found %s", name.text, open.pos, describe(t))
+		}
+	}
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokNumber:
+		return "number " + t.text
+	case tokName:
+		return fmt.Sprintf("name %q", t.text)
+	}
+	return "'" + t.text + "'"
+}
@@ -0,0 +1,237 @@
+package calc
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Base dimensions. Every quantity is held in their SI units: metre,
+// kilogram, second and byte.
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimData
+	numDims
+)
+
+var baseUnits = [numDims]string{"m", "kg", "s", "B"}
+
+// dimension is the power of each base dimension, e.g. speed is {1, 0, -1, 0}
+type dimension [numDims]int
+
+func (d dimension) add(o dimension, sign int) dimension {
+	for i := range d {
+		d[i] += sign * o[i]
+	}
+	return d
+}
+
+func (d dimension) scale(n int) dimension {
+	for i := range d {
+		d[i] *= n
+	}
+	return d
+}
+
+func (d dimension) isZero() bool {
+	return d == dimension{}
+}
+
+// unit is a named unit: how many SI base units it is, and of what
+type unit struct {
+	scale *big.Rat
+	dim   dimension
+}
+
+// units are the units names can refer to. Temperatures are not here: their
+// scales do not start at zero, so they cannot be multiplied like the rest.
+var units = map[string]unit{}
+
+// unitAliases are other spellings of the names in units
+var unitAliases = map[string]string{
+	"meter": "m", "meters": "m", "metre": "m", "metres": "m",
+	"µm": "um", "inch": "in", "inches": "in", "foot": "ft", "feet": "ft",
+	"mile": "mi", "miles": "mi", "yard": "yd", "yards": "yd",
+	"gram": "g", "grams": "g", "tonne": "t", "lbs": "lb",
+	"sec": "s", "second": "s", "seconds": "s", "µs": "us",
+	"minute": "min", "minutes": "min", "hr": "h", "hour": "h", "hours": "h",
+	"days": "day", "weeks": "week", "year": "yr", "years": "yr",
+	"l": "L", "liter": "L", "liters": "L", "litre": "L", "litres": "L", "ml": "mL",
+	"byte": "B", "bytes": "B", "bits": "bit",
+	"degree": "deg", "degrees": "deg", "°": "deg", "radian": "rad", "radians": "rad",
+}
+
+func init() {
+	length := dimension{dimLength: 1}
+	mass := dimension{dimMass: 1}
+	time := dimension{dimTime: 1}
+	data := dimension{dimData: 1}
+
+	def := func(name, scale string, dim dimension) {
+		r, ok := new(big.Rat).SetString(scale)
+		if !ok {
+			panic("calc: bad scale for " + name)
+		}
+		units[name] = unit{scale: r, dim: dim}
+	}
+
+	def("m", "1", length)
+	def("km", "1000", length)
+	def("cm", "1/100", length)
+	def("mm", "1/1000", length)
+	def("um", "1/1000000", length)
+	def("nm", "1/1000000000", length)
+	def("in", "0.0254", length)
+	def("ft", "0.3048", length)
+	def("yd", "0.9144", length)
+	def("mi", "1609.344", length)
+
+	def("kg", "1", mass)
+	def("g", "1/1000", mass)
+	def("mg", "1/1000000", mass)
+	def("t", "1000", mass)
+	def("lb", "0.45359237", mass)
+	def("oz", "0.028349523125", mass)
+
+	def("s", "1", time)
+	def("ms", "1/1000", time)
+	def("us", "1/1000000", time)
+	def("ns", "1/1000000000", time)
+	def("min", "60", time)
+	def("h", "3600", time)
+	def("day", "86400", time)
+	def("week", "604800", time)
+	def("yr", "31557600", time) // tahun Julian, 365.25 hari
+
+	def("mph", "0.44704", length.add(time, -1))
+	def("ha", "10000", length.scale(2))
+	def("L", "1/1000", length.scale(3))
+	def("mL", "1/1000000", length.scale(3))
+
+	def("B", "1", data)
+	def("bit", "1/8", data)
+	for i, prefix := range []string{"K", "M", "G", "T", "P"} {
+		def(prefix+"B", new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(i+1)), nil).String(), data)
+		def(prefix+"iB", new(big.Int).Lsh(big.NewInt(1), uint(10*(i+1))).String(), data)
+	}
+
+	// Sudut tidak berdimensi; rad adalah satuan dasarnya
+	def("rad", "1", dimension{})
+	units["deg"] = unit{scale: new(big.Rat).Quo(piRat, big.NewRat(180, 1))}
+}
+
+// lookupUnit returns the unit called name and its canonical name
+func lookupUnit(name string) (string, unit, bool) {
+	if canonical, ok := unitAliases[name]; ok {
+		name = canonical
+	}
+	u, ok := units[name]
+	return name, u, ok
+}
+
+// unitPower is one factor of how a value is displayed, e.g. h^-1 in km/h
+type unitPower struct {
+	name  string
+	power int
+}
+
+// unitList is a product of unit powers, in the order they were written
+type unitList []unitPower
+
+// mul multiplies two unit lists, raising o to sign first
+func (l unitList) mul(o unitList, sign int) unitList {
+	out := append(unitList(nil), l...)
+	for _, u := range o {
+		found := false
+		for i := range out {
+			if out[i].name == u.name {
+				out[i].power += sign * u.power
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, unitPower{u.name, sign * u.power})
+		}
+	}
+
+	kept := out[:0]
+	for _, u := range out {
+		if u.power != 0 {
+			kept = append(kept, u)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// scale returns how many SI base units one of l is
+func (l unitList) scale() *big.Rat {
+	s := big.NewRat(1, 1)
+	for _, u := range l {
+		_, def, _ := lookupUnit(u.name)
+		f := ratPow(def.scale, abs(u.power))
+		if u.power < 0 {
+			s.Quo(s, f)
+		} else {
+			s.Mul(s, f)
+		}
+	}
+	return s
+}
+
+// siUnits is the unit list of dim in SI base units
+func siUnits(dim dimension) unitList {
+	var l unitList
+	for i, p := range dim {
+		if p != 0 {
+			l = append(l, unitPower{baseUnits[i], p})
+		}
+	}
+	return l
+}
+
+// String writes l the way it would be typed: km/h, m^2, kg*m/s^2,
+// kg/(m*s^2); only negative powers become s^-1
+func (l unitList) String() string {
+	var num, den []string
+	for _, u := range l {
+		switch {
+		case u.power == 1:
+			num = append(num, u.name)
+		case u.power > 1:
+			num = append(num, u.name+"^"+strconv.Itoa(u.power))
+		case u.power == -1:
+			den = append(den, u.name)
+		default:
+			den = append(den, u.name+"^"+strconv.Itoa(-u.power))
+		}
+	}
+
+	if len(num) == 0 {
+		parts := make([]string, len(l))
+		for i, u := range l {
+			parts[i] = u.name + "^" + strconv.Itoa(u.power)
+		}
+		return strings.Join(parts, "*")
+	}
+	s := strings.Join(num, "*")
+	switch len(den) {
+	case 0:
+		return s
+	case 1:
+		return s + "/" + den[0]
+	}
+	return s + "/(" + strings.Join(den, "*") + ")"
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
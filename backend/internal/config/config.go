@@ -8,11 +8,35 @@ import (
 	"time"
 )
 
+const (
+	defaultSystemPrompt       = "You are GRYT, an advanced AI assistant powered by Vercel AI Gateway. You are designed to be helpful, accurate, and efficient. You have access to various tools and can handle multiple types of content including text, images, and documents. Always provide clear, concise, and helpful responses while maintaining a professional yet friendly tone."
+	defaultSearchSystemPrompt = "You are a helpful search assistant. Provide comprehensive and accurate search results."
+)
+
+// defaultModels is the catalogue used when the config file has no
+// ai.models section
+var defaultModels = map[string]ModelConfig{
+	// OpenAI Models
+	"openai/gpt-4o":      {Name: "openai/gpt-4o", MaxTokens: 4096, Temperature: 0.7, Enabled: true},
+	"openai/gpt-4o-mini": {Name: "openai/gpt-4o-mini", MaxTokens: 2048, Temperature: 0.7, Enabled: true},
+	"openai/gpt-4-turbo": {Name: "openai/gpt-4-turbo", MaxTokens: 4096, Temperature: 0.7, Enabled: true},
+	// Anthropic Models
+	"anthropic/claude-sonnet-4":            {Name: "anthropic/claude-sonnet-4", MaxTokens: 4096, Temperature: 0.7, Enabled: true},
+	"anthropic/claude-3-5-sonnet-20241022": {Name: "anthropic/claude-3-5-sonnet-20241022", MaxTokens: 4096, Temperature: 0.7, Enabled: true},
+	"anthropic/claude-3-haiku-20240307":    {Name: "anthropic/claude-3-haiku-20240307", MaxTokens: 2048, Temperature: 0.7, Enabled: true},
+	// Google Models
+	"google/gemini-1.5-pro":   {Name: "google/gemini-1.5-pro", MaxTokens: 4096, Temperature: 0.7, Enabled: true},
+	"google/gemini-1.5-flash": {Name: "google/gemini-1.5-flash", MaxTokens: 2048, Temperature: 0.7, Enabled: true},
+}
+
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	Auth     AuthConfig
 	Limits   LimitsConfig
+	Mail     MailConfig
+	Tracing  TracingConfig
+	Storage  StorageConfig
 	AI       AIConfig
 }
 
@@ -21,6 +45,21 @@ type ServerConfig struct {
 	Environment string
 	FrontendURL string
 	Domain      string
+	LogLevel    string
+	LogFormat   string
+	// MetricsToken guards /metrics; the endpoint is disabled when empty
+	MetricsToken string
+	ReadTimeout  time.Duration
+	// WriteTimeout applies to regular routes; streaming routes use
+	// AI.Streaming.Timeout instead
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// DrainTimeout is how long shutdown waits for in-flight generations
+	// before cancelling them (partial answers are persisted)
+	DrainTimeout time.Duration
+	// TrustedProxies are the proxy IPs or CIDRs whose X-Forwarded-For is
+	// believed for the client IP; none by default
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -39,6 +78,84 @@ type AuthConfig struct {
 	AccessKey     string
 	TokenExpiry   time.Duration
 	RefreshExpiry time.Duration
+	OIDC          OIDCConfig
+	Lockout       LockoutConfig
+}
+
+// LockoutConfig controls brute-force protection on the login endpoints.
+// Failures are counted per account and per IP inside Window; every failure
+// doubles the wait before the next attempt (BaseDelay up to MaxDelay) and
+// reaching the threshold locks the key for LockoutDuration.
+type LockoutConfig struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	Window             time.Duration
+	LockoutDuration    time.Duration
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	UnlockURL          string
+}
+
+// TracingConfig selects the OpenTelemetry span exporter. Exporter is one of
+// "otlp", "stdout", "file" or "none"; OTLP falls back to FilePath (or
+// stdout) when no endpoint is configured.
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	FilePath     string
+	SampleRatio  float64
+	ServiceName  string
+}
+
+// StorageConfig selects where chat attachments are kept: Backend "local"
+// (files under Path) or "s3" (a bucket of any S3-compatible service).
+// Identical files are stored once; UserQuota (0 = unlimited) caps the bytes
+// of distinct files a user keeps.
+type StorageConfig struct {
+	Backend     string
+	Path        string
+	S3          S3Config
+	MaxFileSize int64 // bytes
+	// MaxMessageSize caps all files uploaded with one chat message
+	MaxMessageSize int64 // bytes
+	UserQuota      int64 // bytes
+	// URLSecret signs download links (JWT secret when empty); links expire
+	// after URLExpiry
+	URLSecret string
+	URLExpiry time.Duration
+	// PublicURL is the base of download links; relative links when empty
+	PublicURL string
+}
+
+// S3Config addresses an S3-compatible bucket. PathStyle puts the bucket in
+// the path (MinIO and most self-hosted services) instead of the host name.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// MailConfig configures outgoing mail. When SMTPHost is empty messages are
+// written to the log instead.
+type MailConfig struct {
+	SMTPHost string
+	SMTPPort int
+	Username string
+	Password string
+	From     string
+}
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider
+type OIDCConfig struct {
+	Enabled      bool
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
 }
 
 type LimitsConfig struct {
@@ -55,27 +172,52 @@ type AIConfig struct {
 	MaxTokens   int
 	Temperature float64
 	Timeout     time.Duration
-	
+
 	// System Prompt Configuration
-	SystemPrompt string
-	
+	SystemPrompt       string
+	SearchSystemPrompt string
+
+	// TitleModel names the cheap catalogue model that titles new chat
+	// sessions; empty disables automatic titles
+	TitleModel string
+
+	// SessionRetention is how long deleted chat sessions stay restorable
+	// before they are purged; 0 keeps them forever
+	SessionRetention time.Duration
+
+	// EmbeddingModel embeds chat messages for semantic search; empty
+	// disables it. EmbeddingDimensions > 0 asks for shorter vectors.
+	EmbeddingModel      string
+	EmbeddingDimensions int
+
+	// Vector selects where message and knowledge base embeddings are
+	// indexed
+	Vector VectorConfig
+
+	// KnowledgeTopK is how many knowledge base chunks are added to a turn
+	// of a session with knowledge bases attached; 0 disables retrieval
+	KnowledgeTopK int
+
 	// Advanced Parameters
 	TopP             float64
 	FrequencyPenalty float64
 	PresencePenalty  float64
 	Stop             []string
-	
-	// Model Configurations
-	Models      map[string]ModelConfig
-	
+
+	// Model Configurations. Models only seeds the database catalogue
+	// (ai_model_configs); ModelSyncInterval > 0 also pulls the gateway's
+	// model list periodically.
+	Models            map[string]ModelConfig
+	ModelSyncInterval time.Duration
+
 	// Tool Configurations
-	Tools       ToolsConfig
-	
+	Tools ToolsConfig
+
 	// Rate Limiting
-	RateLimit   RateLimitConfig
-	
+	RateLimit RateLimitConfig
+
 	// Streaming
-	Streaming   StreamingConfig
+	Streaming StreamingConfig
 }
 
 type ModelConfig struct {
@@ -86,10 +228,10 @@ type ModelConfig struct {
 }
 
 type ToolsConfig struct {
-	WebSearch   ToolConfig
-	Calculator  ToolConfig
-	Weather     ToolConfig
-	Translation ToolConfig
+	WebSearch     ToolConfig
+	Calculator    ToolConfig
+	Weather       ToolConfig
+	Translation   ToolConfig
 	ImageAnalysis ToolConfig
 }
 
@@ -105,202 +247,228 @@ type RateLimitConfig struct {
 	RequestsPerDay    int
 }
 
+// VectorConfig selects the vector index: "hnsw" or "flat" in process
+// (rebuilt from the database on start) or "qdrant" (URL, APIKey and
+// Collection)
+type VectorConfig struct {
+	Backend    string
+	URL        string
+	APIKey     string
+	Collection string
+}
+
 type StreamingConfig struct {
-	Enabled     bool
-	BufferSize  int
-	Timeout     time.Duration
+	Enabled    bool
+	BufferSize int
+	Timeout    time.Duration
 }
 
+// Load reads the configuration from the environment, layered over the
+// optional YAML/TOML file named by CONFIG_FILE
 func Load() (*Config, error) {
-	// Validate required environment variables
-	requiredEnvs := []string{
-		"DB_HOST", "DB_USER", "DB_PASSWORD", "DB_NAME",
-		"JWT_SECRET", "ACCESS_KEY", "AI_API_KEY",
-	}
-
-	for _, env := range requiredEnvs {
-		if os.Getenv(env) == "" {
-			return nil, fmt.Errorf("required environment variable %s is not set", env)
-		}
-	}
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
 
-	// Parse database port
-	dbPort, err := strconv.Atoi(getEnvOrDefault("DB_PORT", "3306"))
+// LoadFile reads the configuration with path as the config file (empty for
+// environment only). Every invalid or unknown setting is reported in the
+// returned error.
+func LoadFile(path string) (*Config, error) {
+	l, err := newLoader(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid DB_PORT: %v", err)
+		return nil, err
 	}
 
-	// Parse connection limits
-	maxOpenConns, _ := strconv.Atoi(getEnvOrDefault("DB_MAX_OPEN_CONNS", "25"))
-	maxIdleConns, _ := strconv.Atoi(getEnvOrDefault("DB_MAX_IDLE_CONNS", "10"))
-	maxLifetime, _ := time.ParseDuration(getEnvOrDefault("DB_MAX_LIFETIME", "5m"))
-
-	// Parse token limits
-	chatTokens, _ := strconv.Atoi(getEnvOrDefault("CHAT_TOKENS_PER_USER", "10"))
-	searchTokens, _ := strconv.Atoi(getEnvOrDefault("SEARCH_TOKENS_PER_USER", "100"))
-	rateLimitPerMin, _ := strconv.Atoi(getEnvOrDefault("RATE_LIMIT_PER_MINUTE", "30"))
-
-	// Parse AI config
-	maxTokens, _ := strconv.Atoi(getEnvOrDefault("AI_MAX_TOKENS", "4096"))
-	temperature, _ := strconv.ParseFloat(getEnvOrDefault("AI_TEMPERATURE", "0.7"), 64)
-	aiTimeout, _ := time.ParseDuration(getEnvOrDefault("AI_TIMEOUT", "30s"))
-	
-	// Parse advanced AI parameters
-	topP, _ := strconv.ParseFloat(getEnvOrDefault("AI_TOP_P", "1.0"), 64)
-	frequencyPenalty, _ := strconv.ParseFloat(getEnvOrDefault("AI_FREQUENCY_PENALTY", "0.0"), 64)
-	presencePenalty, _ := strconv.ParseFloat(getEnvOrDefault("AI_PRESENCE_PENALTY", "0.0"), 64)
-	stopSequences := strings.Split(getEnvOrDefault("AI_STOP_SEQUENCES", ""), ",")
-	if len(stopSequences) == 1 && stopSequences[0] == "" {
-		stopSequences = []string{}
-	}
-	
-	// Parse rate limiting
-	rpmLimit, _ := strconv.Atoi(getEnvOrDefault("AI_RATE_LIMIT_RPM", "60"))
-	rphLimit, _ := strconv.Atoi(getEnvOrDefault("AI_RATE_LIMIT_RPH", "1000"))
-	rpdLimit, _ := strconv.Atoi(getEnvOrDefault("AI_RATE_LIMIT_RPD", "10000"))
-	
-	// Parse streaming config
-	streamingEnabled, _ := strconv.ParseBool(getEnvOrDefault("AI_STREAMING_ENABLED", "true"))
-	streamingBufferSize, _ := strconv.Atoi(getEnvOrDefault("AI_STREAMING_BUFFER_SIZE", "1024"))
-	streamingTimeout, _ := time.ParseDuration(getEnvOrDefault("AI_STREAMING_TIMEOUT", "60s"))
-
-	// Parse JWT expiry
-	tokenExpiry, _ := time.ParseDuration(getEnvOrDefault("JWT_TOKEN_EXPIRY", "24h"))
-	refreshExpiry, _ := time.ParseDuration(getEnvOrDefault("JWT_REFRESH_EXPIRY", "168h"))
-
-	return &Config{
+	const maxInt = int(^uint(0) >> 1)
+
+	frontendURL := l.String("FRONTEND_URL", "server.frontend_url", "https://lipdev.id")
+
+	cfg := &Config{
 		Server: ServerConfig{
-			Port:        getEnvOrDefault("PORT", "8080"),
-			Environment: getEnvOrDefault("ENVIRONMENT", "development"),
-			FrontendURL: getEnvOrDefault("FRONTEND_URL", "https://lipdev.id"),
-			Domain:      getEnvOrDefault("DOMAIN", "lipdev.id"),
+			Port:           strconv.Itoa(l.Int("PORT", "server.port", 8080, 1, 65535)),
+			Environment:    l.String("ENVIRONMENT", "server.environment", "development"),
+			FrontendURL:    frontendURL,
+			Domain:         l.String("DOMAIN", "server.domain", "lipdev.id"),
+			LogLevel:       l.OneOf("LOG_LEVEL", "server.log_level", "info", "debug", "info", "warn", "error"),
+			LogFormat:      l.OneOf("LOG_FORMAT", "server.log_format", "json", "json", "text"),
+			MetricsToken:   l.String("METRICS_TOKEN", "server.metrics_token", ""),
+			ReadTimeout:    l.Duration("SERVER_READ_TIMEOUT", "server.read_timeout", 15*time.Second),
+			WriteTimeout:   l.Duration("SERVER_WRITE_TIMEOUT", "server.write_timeout", 15*time.Second),
+			IdleTimeout:    l.Duration("SERVER_IDLE_TIMEOUT", "server.idle_timeout", 60*time.Second),
+			DrainTimeout:   l.Duration("SHUTDOWN_DRAIN_TIMEOUT", "server.drain_timeout", 60*time.Second),
+			TrustedProxies: l.List("TRUSTED_PROXIES", "server.trusted_proxies", nil),
 		},
 		Database: DatabaseConfig{
-			Host:         os.Getenv("DB_HOST"),
-			Port:         dbPort,
-			User:         os.Getenv("DB_USER"),
-			Password:     os.Getenv("DB_PASSWORD"),
-			Database:     os.Getenv("DB_NAME"),
-			MaxOpenConns: maxOpenConns,
-			MaxIdleConns: maxIdleConns,
-			MaxLifetime:  maxLifetime,
+			Host:         l.Required("DB_HOST", "database.host"),
+			Port:         l.Int("DB_PORT", "database.port", 3306, 1, 65535),
+			User:         l.Required("DB_USER", "database.user"),
+			Password:     l.Required("DB_PASSWORD", "database.password"),
+			Database:     l.Required("DB_NAME", "database.name"),
+			MaxOpenConns: l.Int("DB_MAX_OPEN_CONNS", "database.max_open_conns", 25, 1, 10000),
+			MaxIdleConns: l.Int("DB_MAX_IDLE_CONNS", "database.max_idle_conns", 10, 0, 10000),
+			MaxLifetime:  l.Duration("DB_MAX_LIFETIME", "database.max_lifetime", 5*time.Minute),
 		},
 		Auth: AuthConfig{
-			JWTSecret:     os.Getenv("JWT_SECRET"),
-			AccessKey:     os.Getenv("ACCESS_KEY"),
-			TokenExpiry:   tokenExpiry,
-			RefreshExpiry: refreshExpiry,
+			JWTSecret:     l.Required("JWT_SECRET", "auth.jwt_secret"),
+			AccessKey:     l.Required("ACCESS_KEY", "auth.access_key"),
+			TokenExpiry:   l.Duration("JWT_TOKEN_EXPIRY", "auth.token_expiry", 24*time.Hour),
+			RefreshExpiry: l.Duration("JWT_REFRESH_EXPIRY", "auth.refresh_expiry", 168*time.Hour),
+			OIDC: OIDCConfig{
+				Enabled:      l.Bool("OIDC_ENABLED", "auth.oidc.enabled", false),
+				IssuerURL:    strings.TrimSuffix(l.String("OIDC_ISSUER_URL", "auth.oidc.issuer_url", ""), "/"),
+				ClientID:     l.String("OIDC_CLIENT_ID", "auth.oidc.client_id", ""),
+				ClientSecret: l.String("OIDC_CLIENT_SECRET", "auth.oidc.client_secret", ""),
+				RedirectURL:  l.String("OIDC_REDIRECT_URL", "auth.oidc.redirect_url", ""),
+				Scopes:       l.List("OIDC_SCOPES", "auth.oidc.scopes", []string{"openid", "email", "profile"}),
+			},
+			Lockout: LockoutConfig{
+				MaxAccountFailures: l.Int("LOGIN_MAX_ACCOUNT_FAILURES", "auth.lockout.max_account_failures", 5, 1, maxInt),
+				MaxIPFailures:      l.Int("LOGIN_MAX_IP_FAILURES", "auth.lockout.max_ip_failures", 20, 1, maxInt),
+				Window:             l.Duration("LOGIN_FAILURE_WINDOW", "auth.lockout.window", 15*time.Minute),
+				LockoutDuration:    l.Duration("LOGIN_LOCKOUT_DURATION", "auth.lockout.duration", 15*time.Minute),
+				BaseDelay:          l.Duration("LOGIN_DELAY_BASE", "auth.lockout.delay_base", time.Second),
+				MaxDelay:           l.Duration("LOGIN_DELAY_MAX", "auth.lockout.delay_max", 30*time.Second),
+				UnlockURL:          l.String("LOGIN_UNLOCK_URL", "auth.lockout.unlock_url", strings.TrimSuffix(frontendURL, "/")+"/auth/unlock"),
+			},
+		},
+		Tracing: TracingConfig{
+			Exporter:     l.OneOf("TRACING_EXPORTER", "tracing.exporter", "none", "otlp", "stdout", "file", "none"),
+			OTLPEndpoint: l.String("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "tracing.otlp_endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+			FilePath:     l.String("TRACING_FILE", "tracing.file", ""),
+			SampleRatio:  l.Float("TRACING_SAMPLE_RATIO", "tracing.sample_ratio", 1.0, 0, 1),
+			ServiceName:  l.String("OTEL_SERVICE_NAME", "tracing.service_name", "gryt-backend"),
+		},
+		Storage: StorageConfig{
+			Backend: l.OneOf("STORAGE_BACKEND", "storage.backend", "local", "local", "s3"),
+			Path:    l.String("STORAGE_PATH", "storage.path", "./data/attachments"),
+			S3: S3Config{
+				Endpoint:  l.String("STORAGE_S3_ENDPOINT", "storage.s3.endpoint", ""),
+				Region:    l.String("STORAGE_S3_REGION", "storage.s3.region", "us-east-1"),
+				Bucket:    l.String("STORAGE_S3_BUCKET", "storage.s3.bucket", ""),
+				AccessKey: l.String("STORAGE_S3_ACCESS_KEY", "storage.s3.access_key", ""),
+				SecretKey: l.String("STORAGE_S3_SECRET_KEY", "storage.s3.secret_key", ""),
+				PathStyle: l.Bool("STORAGE_S3_PATH_STYLE", "storage.s3.path_style", true),
+			},
+			MaxFileSize:    int64(l.Int("STORAGE_MAX_FILE_MB", "storage.max_file_mb", 20, 1, 1024)) << 20,
+			MaxMessageSize: int64(l.Int("STORAGE_MAX_MESSAGE_MB", "storage.max_message_mb", 50, 1, 4096)) << 20,
+			UserQuota:      int64(l.Int("STORAGE_USER_QUOTA_MB", "storage.user_quota_mb", 1024, 0, maxInt)) << 20,
+			URLSecret:      l.String("STORAGE_URL_SECRET", "storage.url_secret", ""),
+			URLExpiry:      l.Duration("STORAGE_URL_EXPIRY", "storage.url_expiry", time.Hour),
+			PublicURL:      strings.TrimSuffix(l.String("STORAGE_PUBLIC_URL", "storage.public_url", ""), "/"),
+		},
+		Mail: MailConfig{
+			SMTPHost: l.String("SMTP_HOST", "mail.smtp_host", ""),
+			SMTPPort: l.Int("SMTP_PORT", "mail.smtp_port", 587, 1, 65535),
+			Username: l.String("SMTP_USERNAME", "mail.username", ""),
+			Password: l.String("SMTP_PASSWORD", "mail.password", ""),
+			From:     l.String("MAIL_FROM", "mail.from", "GRYT <no-reply@lipdev.id>"),
 		},
 		Limits: LimitsConfig{
-			ChatTokensPerUser:   chatTokens,
-			SearchTokensPerUser: searchTokens,
-			RateLimitPerMinute:  rateLimitPerMin,
+			ChatTokensPerUser:   l.Int("CHAT_TOKENS_PER_USER", "limits.chat_tokens_per_user", 10, 0, maxInt),
+			SearchTokensPerUser: l.Int("SEARCH_TOKENS_PER_USER", "limits.search_tokens_per_user", 100, 0, maxInt),
+			RateLimitPerMinute:  l.Int("RATE_LIMIT_PER_MINUTE", "limits.rate_limit_per_minute", 30, 1, maxInt),
 		},
 		AI: AIConfig{
-			APIKey:      os.Getenv("AI_API_KEY"),
-			BaseURL:     getEnvOrDefault("AI_BASE_URL", "https://ai-gateway.vercel.sh/v1"),
-			Model:       getEnvOrDefault("AI_MODEL", "anthropic/claude-sonnet-4"),
-			MaxTokens:   maxTokens,
-			Temperature: temperature,
-			Timeout:     aiTimeout,
-			SystemPrompt: getEnvOrDefault("AI_SYSTEM_PROMPT", "You are GRYT, an advanced AI assistant powered by Vercel AI Gateway. You are designed to be helpful, accurate, and efficient. You have access to various tools and can handle multiple types of content including text, images, and documents. Always provide clear, concise, and helpful responses while maintaining a professional yet friendly tone."),
-			TopP:             topP,
-			FrequencyPenalty: frequencyPenalty,
-			PresencePenalty:  presencePenalty,
-			Stop:             stopSequences,
-			Models: map[string]ModelConfig{
-				// OpenAI Models
-				"openai/gpt-4o": {
-					Name:        "openai/gpt-4o",
-					MaxTokens:   4096,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				"openai/gpt-4o-mini": {
-					Name:        "openai/gpt-4o-mini",
-					MaxTokens:   2048,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				"openai/gpt-4-turbo": {
-					Name:        "openai/gpt-4-turbo",
-					MaxTokens:   4096,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				// Anthropic Models
-				"anthropic/claude-sonnet-4": {
-					Name:        "anthropic/claude-sonnet-4",
-					MaxTokens:   4096,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				"anthropic/claude-3-5-sonnet-20241022": {
-					Name:        "anthropic/claude-3-5-sonnet-20241022",
-					MaxTokens:   4096,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				"anthropic/claude-3-haiku-20240307": {
-					Name:        "anthropic/claude-3-haiku-20240307",
-					MaxTokens:   2048,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				// Google Models
-				"google/gemini-1.5-pro": {
-					Name:        "google/gemini-1.5-pro",
-					MaxTokens:   4096,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
-				"google/gemini-1.5-flash": {
-					Name:        "google/gemini-1.5-flash",
-					MaxTokens:   2048,
-					Temperature: 0.7,
-					Enabled:     true,
-				},
+			APIKey:              l.Required("AI_API_KEY", "ai.api_key"),
+			BaseURL:             l.String("AI_BASE_URL", "ai.base_url", "https://ai-gateway.vercel.sh/v1"),
+			Model:               l.String("AI_MODEL", "ai.model", "anthropic/claude-sonnet-4"),
+			MaxTokens:           l.Int("AI_MAX_TOKENS", "ai.max_tokens", 4096, 1, maxInt),
+			Temperature:         l.Float("AI_TEMPERATURE", "ai.temperature", 0.7, 0, 2),
+			Timeout:             l.Duration("AI_TIMEOUT", "ai.timeout", 30*time.Second),
+			SystemPrompt:        l.String("AI_SYSTEM_PROMPT", "ai.system_prompt", defaultSystemPrompt),
+			SearchSystemPrompt:  l.String("AI_SEARCH_SYSTEM_PROMPT", "ai.search_system_prompt", defaultSearchSystemPrompt),
+			TitleModel:          l.String("AI_TITLE_MODEL", "ai.title_model", "openai/gpt-4o-mini"),
+			SessionRetention:    l.Duration("AI_SESSION_RETENTION", "ai.session_retention", 30*24*time.Hour),
+			EmbeddingModel:      l.String("AI_EMBEDDING_MODEL", "ai.embedding_model", "openai/text-embedding-3-small"),
+			EmbeddingDimensions: l.Int("AI_EMBEDDING_DIMENSIONS", "ai.embedding_dimensions", 512, 0, 8192),
+			Vector: VectorConfig{
+				Backend:    l.OneOf("AI_VECTOR_BACKEND", "ai.vector.backend", "hnsw", "hnsw", "flat", "qdrant"),
+				URL:        l.String("AI_VECTOR_URL", "ai.vector.url", ""),
+				APIKey:     l.String("AI_VECTOR_API_KEY", "ai.vector.api_key", ""),
+				Collection: l.String("AI_VECTOR_COLLECTION", "ai.vector.collection", "chat_messages"),
 			},
+			KnowledgeTopK:     l.Int("AI_KNOWLEDGE_TOP_K", "ai.knowledge_top_k", 5, 0, 20),
+			TopP:              l.Float("AI_TOP_P", "ai.top_p", 1.0, 0, 1),
+			FrequencyPenalty:  l.Float("AI_FREQUENCY_PENALTY", "ai.frequency_penalty", 0, -2, 2),
+			PresencePenalty:   l.Float("AI_PRESENCE_PENALTY", "ai.presence_penalty", 0, -2, 2),
+			Stop:              l.List("AI_STOP_SEQUENCES", "ai.stop", []string{}),
+			Models:            l.Models(defaultModels),
+			ModelSyncInterval: l.Duration("AI_MODEL_SYNC_INTERVAL", "ai.model_sync_interval", 0),
 			Tools: ToolsConfig{
 				WebSearch: ToolConfig{
-					Enabled: getEnvOrDefault("AI_TOOLS_WEB_SEARCH_ENABLED", "true") == "true",
-					APIKey:  getEnvOrDefault("SEARCH_API_KEY", ""),
-					BaseURL: getEnvOrDefault("SEARCH_API_URL", ""),
+					Enabled: l.Bool("AI_TOOLS_WEB_SEARCH_ENABLED", "ai.tools.web_search.enabled", true),
+					APIKey:  l.String("SEARCH_API_KEY", "ai.tools.web_search.api_key", ""),
+					BaseURL: l.String("SEARCH_API_URL", "ai.tools.web_search.base_url", ""),
 				},
 				Calculator: ToolConfig{
-					Enabled: getEnvOrDefault("AI_TOOLS_CALCULATOR_ENABLED", "true") == "true",
+					Enabled: l.Bool("AI_TOOLS_CALCULATOR_ENABLED", "ai.tools.calculator.enabled", true),
 				},
 				Weather: ToolConfig{
-					Enabled: getEnvOrDefault("AI_TOOLS_WEATHER_ENABLED", "true") == "true",
-					APIKey:  getEnvOrDefault("WEATHER_API_KEY", ""),
-					BaseURL: getEnvOrDefault("WEATHER_API_URL", "https://api.openweathermap.org/data/2.5"),
+					Enabled: l.Bool("AI_TOOLS_WEATHER_ENABLED", "ai.tools.weather.enabled", true),
+					APIKey:  l.String("WEATHER_API_KEY", "ai.tools.weather.api_key", ""),
+					BaseURL: l.String("WEATHER_API_URL", "ai.tools.weather.base_url", "https://api.openweathermap.org/data/2.5"),
 				},
 				Translation: ToolConfig{
-					Enabled: getEnvOrDefault("AI_TOOLS_TRANSLATION_ENABLED", "true") == "true",
-					APIKey:  getEnvOrDefault("TRANSLATION_API_KEY", ""),
-					BaseURL: getEnvOrDefault("TRANSLATION_API_URL", ""),
+					Enabled: l.Bool("AI_TOOLS_TRANSLATION_ENABLED", "ai.tools.translation.enabled", true),
+					APIKey:  l.String("TRANSLATION_API_KEY", "ai.tools.translation.api_key", ""),
+					BaseURL: l.String("TRANSLATION_API_URL", "ai.tools.translation.base_url", ""),
 				},
 				ImageAnalysis: ToolConfig{
-					Enabled: getEnvOrDefault("AI_TOOLS_IMAGE_ANALYSIS_ENABLED", "true") == "true",
+					Enabled: l.Bool("AI_TOOLS_IMAGE_ANALYSIS_ENABLED", "ai.tools.image_analysis.enabled", true),
 				},
 			},
 			RateLimit: RateLimitConfig{
-				RequestsPerMinute: rpmLimit,
-				RequestsPerHour:   rphLimit,
-				RequestsPerDay:    rpdLimit,
+				RequestsPerMinute: l.Int("AI_RATE_LIMIT_RPM", "ai.rate_limit.per_minute", 60, 1, maxInt),
+				RequestsPerHour:   l.Int("AI_RATE_LIMIT_RPH", "ai.rate_limit.per_hour", 1000, 1, maxInt),
+				RequestsPerDay:    l.Int("AI_RATE_LIMIT_RPD", "ai.rate_limit.per_day", 10000, 1, maxInt),
 			},
 			Streaming: StreamingConfig{
-				Enabled:     streamingEnabled,
-				BufferSize:  streamingBufferSize,
-				Timeout:     streamingTimeout,
+				Enabled:    l.Bool("AI_STREAMING_ENABLED", "ai.streaming.enabled", true),
+				BufferSize: l.Int("AI_STREAMING_BUFFER_SIZE", "ai.streaming.buffer_size", 1024, 1, maxInt),
+				Timeout:    l.Duration("AI_STREAMING_TIMEOUT", "ai.streaming.timeout", 5*time.Minute),
 			},
 		},
-	}, nil
-}
+	}
+
+	// Cross-field checks
+	if cfg.Auth.OIDC.Enabled {
+		for _, setting := range []struct{ env, value string }{
+			{"OIDC_ISSUER_URL", cfg.Auth.OIDC.IssuerURL},
+			{"OIDC_CLIENT_ID", cfg.Auth.OIDC.ClientID},
+			{"OIDC_REDIRECT_URL", cfg.Auth.OIDC.RedirectURL},
+		} {
+			if setting.value == "" {
+				l.errorf("%s is required when OIDC is enabled", setting.env)
+			}
+		}
+	}
+	if cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		l.errorf("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", cfg.Database.MaxIdleConns, cfg.Database.MaxOpenConns)
+	}
+	if cfg.AI.Vector.Backend == "qdrant" && cfg.AI.Vector.URL == "" {
+		l.errorf("AI_VECTOR_URL is required when AI_VECTOR_BACKEND is qdrant")
+	}
+	if cfg.Storage.Backend == "s3" {
+		for _, setting := range []struct{ env, value string }{
+			{"STORAGE_S3_ENDPOINT", cfg.Storage.S3.Endpoint},
+			{"STORAGE_S3_BUCKET", cfg.Storage.S3.Bucket},
+			{"STORAGE_S3_ACCESS_KEY", cfg.Storage.S3.AccessKey},
+			{"STORAGE_S3_SECRET_KEY", cfg.Storage.S3.SecretKey},
+		} {
+			if setting.value == "" {
+				l.errorf("%s is required when STORAGE_BACKEND is s3", setting.env)
+			}
+		}
+	}
+	if cfg.Storage.MaxMessageSize < cfg.Storage.MaxFileSize {
+		l.errorf("STORAGE_MAX_MESSAGE_MB (%d) must not be less than STORAGE_MAX_FILE_MB (%d)",
+			cfg.Storage.MaxMessageSize>>20, cfg.Storage.MaxFileSize>>20)
+	}
+	if cfg.Storage.URLSecret == "" {
+		cfg.Storage.URLSecret = cfg.Auth.JWTSecret
+	}
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	if err := l.Err(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
-	return defaultValue
-}
\ No newline at end of file
+	return cfg, nil
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// loader resolves every setting from, in order of precedence: the
+// environment variable, a <VAR>_FILE path (for secrets mounted as files),
+// the config file and the built-in default. Parse and validation errors are
+// collected rather than returned one by one so a bad deploy shows every
+// problem at once.
+type loader struct {
+	fileName string
+	file     map[string]string      // flattened config file, "server.port" -> "8080"
+	models   map[string]interface{} // raw ai.models section
+	known    map[string]bool
+	errs     []error
+}
+
+func newLoader(path string) (*loader, error) {
+	l := &loader{
+		file:  make(map[string]string),
+		known: make(map[string]bool),
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	l.fileName = filepath.Base(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: use .yaml, .yml or .toml", l.fileName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", l.fileName, err)
+	}
+
+	// Model names contain dots and slashes, so the catalogue is kept as a
+	// tree instead of being flattened
+	if ai, ok := raw["ai"].(map[string]interface{}); ok {
+		if models, ok := ai["models"]; ok {
+			l.models, ok = models.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: ai.models must be a table of model name -> settings", l.fileName)
+			}
+			delete(ai, "models")
+		}
+	}
+
+	if err := l.flatten("", raw); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *loader) flatten(prefix string, m map[string]interface{}) error {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			if err := l.flatten(key, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		s, err := scalarString(v)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", l.fileName, key, err)
+		}
+		l.file[key] = s
+	}
+	return nil
+}
+
+// scalarString renders a decoded YAML/TOML value the way it would appear in
+// an environment variable. Lists become comma separated.
+func scalarString(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case uint64:
+		return strconv.FormatUint(t, 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, item := range t {
+			s, err := scalarString(item)
+			if err != nil {
+				return "", err
+			}
+			if _, nested := item.([]interface{}); nested {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+func (l *loader) errorf(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+// lookup returns the raw value for a setting and a description of where it
+// came from, for error messages
+func (l *loader) lookup(env, key string) (string, string, bool) {
+	l.known[key] = true
+
+	value, inEnv := os.LookupEnv(env)
+	path, inFile := os.LookupEnv(env + "_FILE")
+	if inEnv && value != "" && inFile && path != "" {
+		l.errorf("%s and %s_FILE are both set, use only one", env, env)
+	}
+	if inEnv && value != "" {
+		return value, env, true
+	}
+	if inFile && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.errorf("%s_FILE: %v", env, err)
+			return "", env + "_FILE", false
+		}
+		return strings.TrimRight(string(data), "\r\n"), env + "_FILE", true
+	}
+	if value, ok := l.file[key]; ok {
+		return value, l.fileName + ": " + key, true
+	}
+	return "", env, false
+}
+
+func (l *loader) String(env, key, def string) string {
+	if value, _, ok := l.lookup(env, key); ok {
+		return value
+	}
+	return def
+}
+
+// Required is String for settings without a default
+func (l *loader) Required(env, key string) string {
+	value, _, ok := l.lookup(env, key)
+	if !ok || value == "" {
+		l.errorf("%s is required: set %s, %s_FILE or %s in the config file", env, env, env, key)
+	}
+	return value
+}
+
+// OneOf is a case-insensitive enum
+func (l *loader) OneOf(env, key, def string, allowed ...string) string {
+	value, source, ok := l.lookup(env, key)
+	if !ok {
+		return def
+	}
+	value = strings.ToLower(value)
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	l.errorf("%s: invalid value %q, use one of %s", source, value, strings.Join(allowed, ", "))
+	return def
+}
+
+func (l *loader) Int(env, key string, def, min, max int) int {
+	value, source, ok := l.lookup(env, key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		l.errorf("%s: invalid integer %q", source, value)
+		return def
+	}
+	if n < min || n > max {
+		l.errorf("%s: must be between %d and %d, got %d", source, min, max, n)
+		return def
+	}
+	return n
+}
+
+func (l *loader) Float(env, key string, def, min, max float64) float64 {
+	value, source, ok := l.lookup(env, key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		l.errorf("%s: invalid number %q", source, value)
+		return def
+	}
+	if f < min || f > max {
+		l.errorf("%s: must be between %g and %g, got %g", source, min, max, f)
+		return def
+	}
+	return f
+}
+
+// Duration accepts Go duration strings ("15s", "5m"); negative values are
+// rejected
+func (l *loader) Duration(env, key string, def time.Duration) time.Duration {
+	value, source, ok := l.lookup(env, key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		l.errorf("%s: invalid duration %q (use e.g. 30s, 5m, 1h)", source, value)
+		return def
+	}
+	if d < 0 {
+		l.errorf("%s: must not be negative", source)
+		return def
+	}
+	return d
+}
+
+func (l *loader) Bool(env, key string, def bool) bool {
+	value, source, ok := l.lookup(env, key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		l.errorf("%s: invalid boolean %q (use true or false)", source, value)
+		return def
+	}
+	return b
+}
+
+// List splits a comma separated value, dropping empty entries
+func (l *loader) List(env, key string, def []string) []string {
+	value, _, ok := l.lookup(env, key)
+	if !ok {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	if out == nil {
+		out = []string{}
+	}
+	return out
+}
+
+// Models returns the model catalogue from the config file, or def when the
+// file does not define one. A file catalogue replaces the default entirely.
+func (l *loader) Models(def map[string]ModelConfig) map[string]ModelConfig {
+	if l.models == nil {
+		return def
+	}
+
+	models := make(map[string]ModelConfig, len(l.models))
+	for name, raw := range l.models {
+		where := fmt.Sprintf("%s: ai.models.%s", l.fileName, name)
+		fields, ok := raw.(map[string]interface{})
+		if !ok {
+			l.errorf("%s: must be a table of settings", where)
+			continue
+		}
+
+		model := ModelConfig{Name: name, MaxTokens: 4096, Temperature: 0.7, Enabled: true}
+		for field, v := range fields {
+			s, err := scalarString(v)
+			if err != nil {
+				l.errorf("%s.%s: %v", where, field, err)
+				continue
+			}
+			switch field {
+			case "max_tokens":
+				n, err := strconv.Atoi(s)
+				if err != nil || n <= 0 {
+					l.errorf("%s.max_tokens: must be a positive integer, got %q", where, s)
+				}
+				model.MaxTokens = n
+			case "temperature":
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil || f < 0 || f > 2 {
+					l.errorf("%s.temperature: must be a number between 0 and 2, got %q", where, s)
+				}
+				model.Temperature = f
+			case "enabled":
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					l.errorf("%s.enabled: invalid boolean %q", where, s)
+				}
+				model.Enabled = b
+			default:
+				l.errorf("%s: unknown field %q", where, field)
+			}
+		}
+		models[name] = model
+	}
+	return models
+}
+
+// Err reports every collected problem plus config file keys that no
+// setting consumed (typos)
+func (l *loader) Err() error {
+	var unknown []string
+	for key := range l.file {
+		if !l.known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		l.errorf("%s: unknown key %q", l.fileName, key)
+	}
+	return errors.Join(l.errs...)
+}
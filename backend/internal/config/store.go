@@ -0,0 +1,210 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store holds the live configuration. Reload swaps in a new snapshot in
+// which only the hot-reloadable parts (model catalogue and defaults, tools,
+// prompts, limits) change; everything else keeps its startup value and a
+// warning says a restart is needed. Snapshots are never mutated, so callers
+// may keep pointers into the one returned by Get for the duration of a
+// request.
+type Store struct {
+	path    string
+	current atomic.Pointer[Config]
+
+	mu      sync.Mutex // serialises reloads
+	hooks   []func(old, new *Config)
+	modTime time.Time
+	size    int64
+}
+
+// NewStore loads the configuration (see Load) and keeps it for reloads
+func NewStore() (*Store, error) {
+	s := &Store{path: os.Getenv("CONFIG_FILE")}
+	cfg, err := LoadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(cfg)
+	s.modTime, s.size = s.stat()
+	return s, nil
+}
+
+// NewStaticStore wraps an already built configuration. Reload re-reads the
+// environment only; it is meant for tests and tools.
+func NewStaticStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Get returns the current configuration snapshot
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// Path returns the config file in use, empty when environment only
+func (s *Store) Path() string {
+	return s.path
+}
+
+// OnReload registers fn to run after every successful reload
+func (s *Store) OnReload(fn func(old, new *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// Reload re-reads the environment and config file. On any error the
+// current configuration stays in place.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh, err := LoadFile(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime, s.size = s.stat()
+
+	old := s.Get()
+	next := *old
+	next.Limits = fresh.Limits
+	next.AI = fresh.AI
+	// The gateway client, stream deadlines and model sync loop are set up
+	// once at startup
+	next.AI.APIKey = old.AI.APIKey
+	next.AI.BaseURL = old.AI.BaseURL
+	next.AI.Timeout = old.AI.Timeout
+	next.AI.Streaming = old.AI.Streaming
+	next.AI.ModelSyncInterval = old.AI.ModelSyncInterval
+	// The vector index is opened and loaded for one embedding model and
+	// size at startup
+	next.AI.EmbeddingModel = old.AI.EmbeddingModel
+	next.AI.EmbeddingDimensions = old.AI.EmbeddingDimensions
+	next.AI.Vector = old.AI.Vector
+
+	if restart := restartRequired(old, fresh); len(restart) > 0 {
+		slog.Warn("config changes ignored until restart", "sections", strings.Join(restart, ","))
+	}
+
+	changed := changedSections(old, &next)
+	if len(changed) == 0 {
+		slog.Info("configuration reloaded, no changes")
+		return nil
+	}
+
+	s.current.Store(&next)
+	for _, hook := range s.hooks {
+		hook(old, &next)
+	}
+	slog.Info("configuration reloaded", "changed", strings.Join(changed, ","))
+	return nil
+}
+
+// Watch reloads whenever the config file's size or modification time
+// changes, polling every interval until ctx is done. It does nothing when
+// no config file is used.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, size := s.stat()
+			s.mu.Lock()
+			changed := !modTime.Equal(s.modTime) || size != s.size
+			s.mu.Unlock()
+			if !changed || modTime.IsZero() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				slog.Error("config reload failed, keeping previous configuration", "file", s.path, "error", err)
+				// Do not retry the same broken file every tick
+				s.mu.Lock()
+				s.modTime, s.size = modTime, size
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (s *Store) stat() (time.Time, int64) {
+	if s.path == "" {
+		return time.Time{}, 0
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+func changedSections(old, next *Config) []string {
+	var changed []string
+	if !reflect.DeepEqual(old.Limits, next.Limits) {
+		changed = append(changed, "limits")
+	}
+	if !reflect.DeepEqual(old.AI.Models, next.AI.Models) {
+		changed = append(changed, "models")
+	}
+	if !reflect.DeepEqual(old.AI.Tools, next.AI.Tools) {
+		changed = append(changed, "tools")
+	}
+	if old.AI.SystemPrompt != next.AI.SystemPrompt || old.AI.SearchSystemPrompt != next.AI.SearchSystemPrompt {
+		changed = append(changed, "prompts")
+	}
+	oldAI, nextAI := old.AI, next.AI
+	oldAI.Models, nextAI.Models = nil, nil
+	oldAI.Tools, nextAI.Tools = ToolsConfig{}, ToolsConfig{}
+	oldAI.SystemPrompt, nextAI.SystemPrompt = "", ""
+	oldAI.SearchSystemPrompt, nextAI.SearchSystemPrompt = "", ""
+	if !reflect.DeepEqual(oldAI, nextAI) {
+		changed = append(changed, "ai")
+	}
+	return changed
+}
+
+func restartRequired(old, fresh *Config) []string {
+	var sections []string
+	for _, c := range []struct {
+		name       string
+		old, fresh interface{}
+	}{
+		{"server", old.Server, fresh.Server},
+		{"database", old.Database, fresh.Database},
+		{"auth", old.Auth, fresh.Auth},
+		{"mail", old.Mail, fresh.Mail},
+		{"tracing", old.Tracing, fresh.Tracing},
+		{"storage", old.Storage, fresh.Storage},
+		{"ai.api_key", old.AI.APIKey, fresh.AI.APIKey},
+		{"ai.base_url", old.AI.BaseURL, fresh.AI.BaseURL},
+		{"ai.timeout", old.AI.Timeout, fresh.AI.Timeout},
+		{"ai.streaming", old.AI.Streaming, fresh.AI.Streaming},
+		{"ai.model_sync_interval", old.AI.ModelSyncInterval, fresh.AI.ModelSyncInterval},
+		{"ai.embedding_model", old.AI.EmbeddingModel, fresh.AI.EmbeddingModel},
+		{"ai.embedding_dimensions", old.AI.EmbeddingDimensions, fresh.AI.EmbeddingDimensions},
+		{"ai.vector", old.AI.Vector, fresh.AI.Vector},
+	} {
+		if !reflect.DeepEqual(c.old, c.fresh) {
+			sections = append(sections, c.name)
+		}
+	}
+	return sections
+}
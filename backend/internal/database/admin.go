@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UserFilter narrows down user listings for the admin API
+type UserFilter struct {
+	Query  string
+	Role   string
+	Active *bool
+	Limit  int
+	Offset int
+}
+
+// UserUsage summarises how much a user has consumed
+type UserUsage struct {
+	UserID        string     `db:"user_id" json:"user_id"`
+	Email         string     `db:"email" json:"email"`
+	Sessions      int        `db:"sessions" json:"sessions"`
+	Messages      int        `db:"messages" json:"messages"`
+	MessageTokens int        `db:"message_tokens" json:"message_tokens"`
+	Searches      int        `db:"searches" json:"searches"`
+	SearchTokens  int        `db:"search_tokens" json:"search_tokens"`
+	LastActiveAt  *time.Time `db:"last_active_at" json:"last_active_at,omitempty"`
+}
+
+// List returns users matching the filter, including inactive ones, together
+// with the total number of matches
+func (r *UserRepository) List(filter UserFilter) ([]User, int, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+
+	if filter.Query != "" {
+		where = append(where, "(email LIKE ? ESCAPE '!' OR name LIKE ? ESCAPE '!' OR id = ?)")
+		like := likePattern(filter.Query)
+		args = append(args, like, like, filter.Query)
+	}
+	if filter.Role != "" {
+		where = append(where, "role = ?")
+		args = append(args, filter.Role)
+	}
+	if filter.Active != nil {
+		where = append(where, "is_active = ?")
+		args = append(args, *filter.Active)
+	}
+
+	whereClause := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.Get(&total, "SELECT COUNT(*) FROM users WHERE "+whereClause, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	var users []User
+	query := `SELECT id, email, name, role, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
+			  FROM users WHERE ` + whereClause + ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	err := r.db.Select(&users, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// GetByIDAnyStatus is like GetByID but also returns deactivated users
+func (r *UserRepository) GetByIDAnyStatus(id string) (*User, error) {
+	var user User
+	query := `SELECT id, email, name, role, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
+			  FROM users WHERE id = ?`
+
+	err := r.db.Get(&user, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (r *UserRepository) SetActive(userID string, active bool) error {
+	query := `UPDATE users SET is_active = ?, updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, active, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) SetRole(userID, role string) error {
+	query := `UPDATE users SET role = ?, updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, role, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) AddTokens(userID string, chatTokens, searchTokens int) error {
+	query := `UPDATE users SET chat_tokens = chat_tokens + ?, search_tokens = search_tokens + ?, updated_at = NOW() 
+			  WHERE id = ?`
+
+	_, err := r.db.Exec(query, chatTokens, searchTokens, userID)
+	if err != nil {
+		return fmt.Errorf("failed to grant user tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) UpdateAccessKey(userID, accessKey string) error {
+	query := `UPDATE users SET access_key = ?, updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, accessKey, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update access key: %w", err)
+	}
+
+	return nil
+}
+
+// UsageRepository aggregates consumption data for the admin API
+type UsageRepository struct {
+	db *DB
+}
+
+func NewUsageRepository(db *DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *UsageRepository) WithContext(ctx context.Context) *UsageRepository {
+	return &UsageRepository{db: r.db.WithContext(ctx)}
+}
+
+const usageSelect = `SELECT u.id AS user_id, u.email,
+		(SELECT COUNT(*) FROM chat_sessions s WHERE s.user_id = u.id AND s.created_at >= ?) AS sessions,
+		(SELECT COUNT(*) FROM chat_messages m WHERE m.user_id = u.id AND m.created_at >= ?) AS messages,
+		(SELECT COALESCE(SUM(m.tokens), 0) FROM chat_messages m WHERE m.user_id = u.id AND m.created_at >= ?) AS message_tokens,
+		(SELECT COUNT(*) FROM search_queries q WHERE q.user_id = u.id AND q.created_at >= ?) AS searches,
+		(SELECT COALESCE(SUM(q.tokens), 0) FROM search_queries q WHERE q.user_id = u.id AND q.created_at >= ?) AS search_tokens,
+		(SELECT MAX(m.created_at) FROM chat_messages m WHERE m.user_id = u.id) AS last_active_at
+	FROM users u`
+
+func (r *UsageRepository) GetUserUsage(userID string, since time.Time) (*UserUsage, error) {
+	var usage UserUsage
+	err := r.db.Get(&usage, usageSelect+` WHERE u.id = ?`, since, since, since, since, since, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user usage: %w", err)
+	}
+
+	return &usage, nil
+}
+
+// GetTopUsage returns the heaviest users since the given time
+func (r *UsageRepository) GetTopUsage(since time.Time, limit int) ([]UserUsage, error) {
+	var usage []UserUsage
+	query := usageSelect + ` ORDER BY message_tokens DESC, messages DESC LIMIT ?`
+
+	err := r.db.Select(&usage, query, since, since, since, since, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage summary: %w", err)
+	}
+
+	return usage, nil
+}
+
+// likePattern matches term anywhere, with LIKE wildcards in it escaped by !
+func likePattern(term string) string {
+	return "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(term) + "%"
+}
@@ -0,0 +1,297 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Attachment is a file a user uploaded. The bytes are in the blob store
+// under SHA256, shared with every other upload of the same content.
+type Attachment struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"-"`
+	SHA256    string    `db:"sha256" json:"sha256"`
+	Name      string    `db:"name" json:"name"`
+	MimeType  string    `db:"mime_type" json:"mime_type"`
+	Size      int64     `db:"size" json:"size"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// MessageAttachment is an attachment a message was sent with
+type MessageAttachment struct {
+	Attachment
+	MessageID string `db:"message_id"`
+}
+
+// AttachmentRepository handles attachment and blob database operations
+type AttachmentRepository struct {
+	db *DB
+}
+
+func NewAttachmentRepository(db *DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *AttachmentRepository) WithContext(ctx context.Context) *AttachmentRepository {
+	return &AttachmentRepository{db: r.db.WithContext(ctx)}
+}
+
+const attachmentColumns = `a.id, a.user_id, a.sha256, a.name, a.mime_type, a.size, a.created_at`
+
+// QuotaExceededError is returned by Create when an upload does not fit in
+// the user's quota
+type QuotaExceededError struct {
+	Used  int64
+	Quota int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("attachment quota exceeded: %d of %d bytes used", e.Used, e.Quota)
+}
+
+// Create saves the attachment and, for content not stored yet, its blob
+// row, calling put to store the bytes before committing. The blob row
+// stays locked meanwhile, so a concurrent DeleteBlobIfUnused of the same
+// content waits instead of removing the bytes just stored.
+//
+// With a positive quota, content the user does not have yet must fit in
+// it. The check and the insert run under a lock on the user's row, so
+// concurrent uploads of one user are counted one after another.
+func (r *AttachmentRepository) Create(a *Attachment, quota int64, put func() error) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	defer tx.Rollback()
+
+	if quota > 0 {
+		if err := checkQuota(tx, a, quota); err != nil {
+			return err
+		}
+	}
+
+	// Affects 1 row when the blob is new, 0 when it is already stored
+	result, err := tx.Exec(`INSERT INTO attachment_blobs (sha256, size, mime_type, created_at) VALUES (?, ?, ?, NOW())
+			  ON DUPLICATE KEY UPDATE sha256 = sha256`, a.SHA256, a.Size, a.MimeType)
+	if err != nil {
+		return fmt.Errorf("failed to save blob: %w", err)
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save blob: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO attachments (id, user_id, sha256, name, mime_type, size, created_at) VALUES (?, ?, ?, ?, ?, ?, NOW())`,
+		a.ID, a.UserID, a.SHA256, a.Name, a.MimeType, a.Size)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	if added > 0 {
+		if err := put(); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return nil
+}
+
+// checkQuota locks the user's row and returns a *QuotaExceededError when a
+// would take the user past quota. The reads after the lock start a fresh
+// snapshot, so they see every upload committed before it.
+func checkQuota(tx *sqlx.Tx, a *Attachment, quota int64) error {
+	var userID string
+	if err := tx.Get(&userID, `SELECT id FROM users WHERE id = ? FOR UPDATE`, a.UserID); err != nil {
+		return fmt.Errorf("failed to lock user for attachment quota: %w", err)
+	}
+
+	var owned int
+	if err := tx.Get(&owned, `SELECT COUNT(*) FROM attachments WHERE user_id = ? AND sha256 = ?`, a.UserID, a.SHA256); err != nil {
+		return fmt.Errorf("failed to check attachment: %w", err)
+	}
+	if owned > 0 {
+		return nil
+	}
+
+	var used int64
+	err := tx.Get(&used, `SELECT COALESCE(SUM(b.size), 0) FROM attachment_blobs b
+			  WHERE b.sha256 IN (SELECT sha256 FROM attachments WHERE user_id = ?)`, a.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get attachment usage: %w", err)
+	}
+	if used+a.Size > quota {
+		return &QuotaExceededError{Used: used, Quota: quota}
+	}
+	return nil
+}
+
+// Get returns an attachment of any user, or nil
+func (r *AttachmentRepository) Get(id string) (*Attachment, error) {
+	var a Attachment
+	err := r.db.Get(&a, `SELECT `+attachmentColumns+` FROM attachments a WHERE a.id = ?`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// GetMany returns the user's attachments among ids, in no particular order
+func (r *AttachmentRepository) GetMany(userID string, ids []string) ([]Attachment, error) {
+	if len(ids) == 0 {
+		return []Attachment{}, nil
+	}
+	query, args, err := sqlx.In(`SELECT `+attachmentColumns+` FROM attachments a WHERE a.user_id = ? AND a.id IN (?)`, userID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build attachment query: %w", err)
+	}
+
+	var attachments []Attachment
+	if err := r.db.Select(&attachments, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+// List returns the user's attachments, newest first
+func (r *AttachmentRepository) List(userID string, limit int) ([]Attachment, error) {
+	attachments := []Attachment{}
+	query := `SELECT ` + attachmentColumns + ` FROM attachments a WHERE a.user_id = ? ORDER BY a.created_at DESC, a.id LIMIT ?`
+
+	if err := r.db.Select(&attachments, query, userID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+// Usage returns the bytes of distinct content the user has uploaded and
+// how many attachments they have
+func (r *AttachmentRepository) Usage(userID string) (int64, int, error) {
+	var usage struct {
+		Bytes int64 `db:"bytes"`
+		Files int   `db:"files"`
+	}
+	query := `SELECT COALESCE((SELECT SUM(b.size) FROM attachment_blobs b
+				WHERE b.sha256 IN (SELECT sha256 FROM attachments WHERE user_id = ?)), 0) AS bytes,
+			  (SELECT COUNT(*) FROM attachments WHERE user_id = ?) AS files`
+
+	if err := r.db.Get(&usage, query, userID, userID); err != nil {
+		return 0, 0, fmt.Errorf("failed to get attachment usage: %w", err)
+	}
+	return usage.Bytes, usage.Files, nil
+}
+
+// Delete removes the user's attachment and unlinks it from messages; it
+// reports whether the attachment existed
+func (r *AttachmentRepository) Delete(userID, id string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM attachments WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteBlobIfUnused removes the blob row when no attachment refers to it
+// and calls remove to delete the bytes before committing, holding the row
+// lock so a concurrent Create of the same content waits. It reports
+// whether the blob was removed.
+func (r *AttachmentRepository) DeleteBlobIfUnused(sha256 string, remove func() error) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	defer tx.Rollback()
+
+	var found string
+	err = tx.Get(&found, `SELECT sha256 FROM attachment_blobs WHERE sha256 = ? FOR UPDATE`, sha256)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	var refs int
+	if err := tx.Get(&refs, `SELECT COUNT(*) FROM attachments WHERE sha256 = ? LOCK IN SHARE MODE`, sha256); err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	if refs > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM attachment_blobs WHERE sha256 = ?`, sha256); err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	if err := remove(); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return true, nil
+}
+
+// UnusedBlobs returns up to limit blobs created before cutoff that no
+// attachment refers to, such as the uploads of a deleted user
+func (r *AttachmentRepository) UnusedBlobs(cutoff time.Time, limit int) ([]string, error) {
+	blobs := []string{}
+	query := `SELECT b.sha256 FROM attachment_blobs b
+			  WHERE b.created_at < ? AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.sha256 = b.sha256)
+			  LIMIT ?`
+
+	if err := r.db.Select(&blobs, query, cutoff, limit); err != nil {
+		return nil, fmt.Errorf("failed to find unused blobs: %w", err)
+	}
+	return blobs, nil
+}
+
+// LinkMessage records the attachments a message was sent with, in order
+func (r *AttachmentRepository) LinkMessage(messageID string, attachmentIDs []string) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	rows := make([]string, len(attachmentIDs))
+	args := make([]interface{}, 0, 3*len(attachmentIDs))
+	for i, id := range attachmentIDs {
+		rows[i] = "(?, ?, ?)"
+		args = append(args, messageID, id, i)
+	}
+
+	if _, err := r.db.Exec(`INSERT IGNORE INTO chat_message_attachments (message_id, attachment_id, position) VALUES `+
+		strings.Join(rows, ", "), args...); err != nil {
+		return fmt.Errorf("failed to link message attachments: %w", err)
+	}
+	return nil
+}
+
+// ForMessages returns the attachments of the given messages, in the order
+// each message was sent with them
+func (r *AttachmentRepository) ForMessages(messageIDs []string) ([]MessageAttachment, error) {
+	if len(messageIDs) == 0 {
+		return []MessageAttachment{}, nil
+	}
+	query, args, err := sqlx.In(`SELECT `+attachmentColumns+`, m.message_id
+			  FROM chat_message_attachments m JOIN attachments a ON a.id = m.attachment_id
+			  WHERE m.message_id IN (?) ORDER BY m.message_id, m.position`, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build message attachment query: %w", err)
+	}
+
+	var attachments []MessageAttachment
+	if err := r.db.Select(&attachments, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get message attachments: %w", err)
+	}
+	return attachments, nil
+}
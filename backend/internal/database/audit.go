@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEvent is a single entry in the append-only audit trail
+type AuditEvent struct {
+	ID         int64     `db:"id" json:"id"`
+	ActorID    string    `db:"actor_id" json:"actor_id"`
+	Action     string    `db:"action" json:"action"`
+	TargetType string    `db:"target_type" json:"target_type"`
+	TargetID   string    `db:"target_id" json:"target_id"`
+	IP         string    `db:"ip" json:"ip"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	Outcome    string    `db:"outcome" json:"outcome"`
+	Metadata   string    `db:"metadata" json:"metadata"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// AuditFilter narrows down audit queries. Action accepts a trailing "*" for
+// prefix matches, e.g. "auth.*".
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	IP         string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditRepository handles audit trail database operations. Rows are never
+// updated or deleted; the table rejects both at the database level.
+type AuditRepository struct {
+	db *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *AuditRepository) WithContext(ctx context.Context) *AuditRepository {
+	return &AuditRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *AuditRepository) Create(event *AuditEvent) error {
+	query := `INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, outcome, metadata, created_at) 
+			  VALUES (NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, NOW(3))`
+
+	metadata := event.Metadata
+	if metadata == "" {
+		metadata = "{}"
+	}
+
+	_, err := r.db.Exec(query, event.ActorID, event.Action, event.TargetType, event.TargetID,
+		event.IP, event.UserAgent, event.Outcome, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns events matching the filter, newest first, together with the
+// total number of matches
+func (r *AuditRepository) Query(filter AuditFilter) ([]AuditEvent, int, error) {
+	whereClause, args := auditWhere(filter)
+
+	var total int
+	if err := r.db.Get(&total, "SELECT COUNT(*) FROM audit_events WHERE "+whereClause, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	var events []AuditEvent
+	query := `SELECT id, COALESCE(actor_id, '') AS actor_id, action, target_type, target_id, ip, user_agent, outcome, 
+			  COALESCE(metadata, '{}') AS metadata, created_at 
+			  FROM audit_events WHERE ` + whereClause + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	err := r.db.Select(&events, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit events: %w", err)
+	}
+
+	return events, total, nil
+}
+
+// QueryAfter returns up to limit events matching the filter with an id above
+// afterID, oldest first. Paging by id stays stable while new events are
+// appended; Offset is ignored.
+func (r *AuditRepository) QueryAfter(filter AuditFilter, afterID int64, limit int) ([]AuditEvent, error) {
+	whereClause, args := auditWhere(filter)
+
+	var events []AuditEvent
+	query := `SELECT id, COALESCE(actor_id, '') AS actor_id, action, target_type, target_id, ip, user_agent, outcome, 
+			  COALESCE(metadata, '{}') AS metadata, created_at 
+			  FROM audit_events WHERE ` + whereClause + ` AND id > ? ORDER BY id ASC LIMIT ?`
+
+	err := r.db.Select(&events, query, append(args, afterID, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// auditWhere builds the WHERE clause shared by the audit queries
+func auditWhere(filter AuditFilter) (string, []interface{}) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+
+	if filter.ActorID != "" {
+		where = append(where, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, "*") {
+			where = append(where, "action LIKE ?")
+			args = append(args, strings.TrimSuffix(filter.Action, "*")+"%")
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, filter.Action)
+		}
+	}
+	if filter.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		where = append(where, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if filter.IP != "" {
+		where = append(where, "ip = ?")
+		args = append(args, filter.IP)
+	}
+	if filter.From != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *filter.To)
+	}
+
+	return strings.Join(where, " AND "), args
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MessageNode is a message's position in a session's message tree
+type MessageNode struct {
+	ID        string    `db:"id"`
+	ParentID  *string   `db:"parent_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// GetMessage returns a message of the session, or nil
+func (r *ChatRepository) GetMessage(sessionID, messageID string) (*ChatMessage, error) {
+	var message ChatMessage
+	query := `SELECT ` + chatMessageColumns + ` FROM chat_messages WHERE id = ? AND session_id = ?`
+
+	err := r.db.Get(&message, query, messageID, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get chat message: %w", err)
+	}
+
+	return &message, nil
+}
+
+// Path returns the messages from the root down to messageID
+func (r *ChatRepository) Path(messageID string) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	query := `WITH RECURSIVE path (id, parent_id, depth) AS (
+				  SELECT id, parent_id, 0 FROM chat_messages WHERE id = ?
+				  UNION ALL
+				  SELECT m.id, m.parent_id, p.depth + 1 FROM chat_messages m JOIN path p ON m.id = p.parent_id
+			  )
+			  SELECT m.id, m.session_id, m.parent_id, m.user_id, m.role, m.content, m.tokens, m.metadata, m.created_at
+			  FROM path p JOIN chat_messages m ON m.id = p.id
+			  ORDER BY p.depth DESC`
+
+	if err := r.db.Select(&messages, query, messageID); err != nil {
+		return nil, fmt.Errorf("failed to get message path: %w", err)
+	}
+
+	return messages, nil
+}
+
+// Siblings returns the messages sharing parentID (nil = the roots) in the
+// session, oldest first
+func (r *ChatRepository) Siblings(sessionID string, parentID *string) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	query := `SELECT ` + chatMessageColumns + ` FROM chat_messages
+			  WHERE session_id = ? AND parent_id <=> ?
+			  ORDER BY created_at ASC, id ASC`
+
+	if err := r.db.Select(&messages, query, sessionID, parentID); err != nil {
+		return nil, fmt.Errorf("failed to get sibling messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// Tree returns the position of every message in the session
+func (r *ChatRepository) Tree(sessionID string) ([]MessageNode, error) {
+	var nodes []MessageNode
+	query := `SELECT id, parent_id, created_at FROM chat_messages WHERE session_id = ? ORDER BY created_at ASC, id ASC`
+
+	if err := r.db.Select(&nodes, query, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to get message tree: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// SetActiveMessage moves the session to the branch ending at messageID
+func (r *ChatRepository) SetActiveMessage(sessionID, messageID string) error {
+	query := `UPDATE chat_sessions SET active_message_id = ?, updated_at = NOW() WHERE id = ?`
+
+	if _, err := r.db.Exec(query, messageID, sessionID); err != nil {
+		return fmt.Errorf("failed to set active message: %w", err)
+	}
+
+	return nil
+}
+
+// LastMessage returns the newest message of the session, or nil
+func (r *ChatRepository) LastMessage(sessionID string) (*ChatMessage, error) {
+	var message ChatMessage
+	query := `SELECT ` + chatMessageColumns + ` FROM chat_messages WHERE session_id = ?
+			  ORDER BY created_at DESC, id DESC LIMIT 1`
+
+	err := r.db.Get(&message, query, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get last chat message: %w", err)
+	}
+
+	return &message, nil
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MessageSearch selects one page of full-text search results over a
+// user's live sessions (archived included, trash excluded)
+type MessageSearch struct {
+	Query  string // as typed, for MATCH ... AGAINST
+	Role   string // "" = any
+	Model  string // "" = any
+	From   *time.Time
+	To     *time.Time // exclusive
+	Limit  int
+	Offset int
+}
+
+// MessageHit is a message matching a search, with its session's title
+type MessageHit struct {
+	ID           string    `db:"id" json:"message_id"`
+	SessionID    string    `db:"session_id" json:"session_id"`
+	SessionTitle string    `db:"session_title" json:"session_title"`
+	Role         string    `db:"role" json:"role"`
+	Model        string    `db:"model" json:"model,omitempty"`
+	Content      string    `db:"content" json:"-"`
+	Score        float64   `db:"score" json:"score"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// SearchMessages returns a page of the user's messages matching q, best
+// match first
+func (r *ChatRepository) SearchMessages(userID string, q MessageSearch) ([]MessageHit, error) {
+	where := []string{"s.user_id = ?", "s.deleted_at IS NULL"}
+	args := []interface{}{userID}
+
+	where = append(where, "MATCH(m.content) AGAINST (?)")
+	args = append(args, q.Query)
+	where, args = messageFilters(q, where, args)
+
+	query := `SELECT m.id, m.session_id, s.title AS session_title, m.role, m.content,
+				  ` + modelColumn + ` AS model, MATCH(m.content) AGAINST (?) AS score, m.created_at
+			  FROM chat_messages m JOIN chat_sessions s ON s.id = m.session_id
+			  WHERE ` + strings.Join(where, " AND ") + `
+			  ORDER BY score DESC, m.created_at DESC, m.id
+			  LIMIT ? OFFSET ?`
+	args = append(append([]interface{}{q.Query}, args...), q.Limit, q.Offset)
+
+	var hits []MessageHit
+	if err := r.db.Select(&hits, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to search chat messages: %w", err)
+	}
+	return hits, nil
+}
+
+// GetMessageHits returns the user's messages among ids (in live sessions)
+// that pass q's role, model and date filters, in no particular order.
+// q.Query, q.Limit and q.Offset are ignored.
+func (r *ChatRepository) GetMessageHits(userID string, ids []string, q MessageSearch) ([]MessageHit, error) {
+	if len(ids) == 0 {
+		return []MessageHit{}, nil
+	}
+
+	where, args := messageFilters(q, []string{"s.user_id = ?", "s.deleted_at IS NULL", "m.id IN (?)"}, []interface{}{userID, ids})
+	query, args, err := sqlx.In(`SELECT m.id, m.session_id, s.title AS session_title, m.role, m.content,
+				  `+modelColumn+` AS model, 0 AS score, m.created_at
+			  FROM chat_messages m JOIN chat_sessions s ON s.id = m.session_id
+			  WHERE `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build message query: %w", err)
+	}
+
+	var hits []MessageHit
+	if err := r.db.Select(&hits, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get chat messages: %w", err)
+	}
+	return hits, nil
+}
+
+// messageFilters appends q's role, model and date conditions on m
+func messageFilters(q MessageSearch, where []string, args []interface{}) ([]string, []interface{}) {
+	if q.Role != "" {
+		where = append(where, "m.role = ?")
+		args = append(args, q.Role)
+	}
+	if q.Model != "" {
+		where = append(where, modelColumn+" = ?")
+		args = append(args, q.Model)
+	}
+	if q.From != nil {
+		where = append(where, "m.created_at >= ?")
+		args = append(args, *q.From)
+	}
+	if q.To != nil {
+		where = append(where, "m.created_at < ?")
+		args = append(args, *q.To)
+	}
+	return where, args
+}
+
+// modelColumn extracts the generating model from m.metadata
+const modelColumn = "COALESCE(JSON_UNQUOTE(JSON_EXTRACT(m.metadata, '$.model')), '')"
+
+// SearchSessionTitles returns up to limit of the user's sessions whose
+// title matches q, filtered on updated_at by q.From/q.To
+func (r *ChatRepository) SearchSessionTitles(userID string, q MessageSearch, limit int) ([]ChatSession, error) {
+	where := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []interface{}{userID}
+
+	where = append(where, "MATCH(title) AGAINST (?)")
+	args = append(args, q.Query)
+	if q.From != nil {
+		where = append(where, "updated_at >= ?")
+		args = append(args, *q.From)
+	}
+	if q.To != nil {
+		where = append(where, "updated_at < ?")
+		args = append(args, *q.To)
+	}
+
+	query := `SELECT ` + chatSessionColumns + `
+			  FROM chat_sessions WHERE ` + strings.Join(where, " AND ") + `
+			  ORDER BY MATCH(title) AGAINST (?) DESC, updated_at DESC, id LIMIT ?`
+	args = append(args, q.Query, limit)
+
+	var sessions []ChatSession
+	if err := r.db.Select(&sessions, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to search chat sessions: %w", err)
+	}
+	if err := r.loadTags(sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
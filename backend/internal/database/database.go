@@ -1,29 +1,53 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"gryt-backend/internal/config"
+	"gryt-backend/internal/models"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DB wraps sqlx.DB. Repositories call Get/Select/Exec without a context;
+// a DB returned by WithContext runs those calls under the bound context so
+// they are cancelled with the request and traced as part of it.
 type DB struct {
 	*sqlx.DB
+	ctx context.Context
 }
 
 func NewConnection(cfg config.DatabaseConfig) (*DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
 
-	db, err := sqlx.Connect("mysql", dsn)
+	// Queries only produce spans inside an existing trace (an HTTP request),
+	// background and context-less queries would otherwise become root spans
+	sqlDB, err := otelsql.Open("mysql", dsn,
+		otelsql.WithAttributes(semconv.DBSystemNameMySQL, semconv.DBNamespace(cfg.Database)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+			DisableErrSkip:       true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	db := sqlx.NewDb(sqlDB, "mysql")
 
 	// Connection pool optimization
 	db.SetMaxOpenConns(cfg.MaxOpenConns)
@@ -35,8 +59,40 @@ func NewConnection(cfg config.DatabaseConfig) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connected successfully")
-	return &DB{db}, nil
+	slog.Info("database connected", "host", cfg.Host, "database", cfg.Database)
+	return &DB{DB: db}, nil
+}
+
+// WithContext returns a DB whose Get, Select and Exec run under ctx
+func (db *DB) WithContext(ctx context.Context) *DB {
+	return &DB{DB: db.DB, ctx: ctx}
+}
+
+func (db *DB) context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+// Get runs sqlx Get under the bound context
+func (db *DB) Get(dest interface{}, query string, args ...interface{}) error {
+	return db.DB.GetContext(db.context(), dest, query, args...)
+}
+
+// Select runs sqlx Select under the bound context
+func (db *DB) Select(dest interface{}, query string, args ...interface{}) error {
+	return db.DB.SelectContext(db.context(), dest, query, args...)
+}
+
+// Exec runs Exec under the bound context
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(db.context(), query, args...)
+}
+
+// Beginx starts a transaction under the bound context
+func (db *DB) Beginx() (*sqlx.Tx, error) {
+	return db.DB.BeginTxx(db.context(), nil)
 }
 
 // User represents a user in the system
@@ -44,6 +100,7 @@ type User struct {
 	ID           string         `db:"id" json:"id"`
 	Email        string         `db:"email" json:"email"`
 	Name         string         `db:"name" json:"name"`
+	Role         string         `db:"role" json:"role"`
 	PasswordHash sql.NullString `db:"password_hash" json:"-"`
 	AccessKey    string         `db:"access_key" json:"access_key"`
 	IsActive     bool           `db:"is_active" json:"is_active"`
@@ -53,27 +110,57 @@ type User struct {
 	UpdatedAt    time.Time      `db:"updated_at" json:"updated_at"`
 }
 
+// LogValue keeps credentials out of logs when a User is passed to slog
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", u.ID),
+		slog.String("role", u.Role),
+		slog.Bool("is_active", u.IsActive),
+	)
+}
+
 // ChatSession represents a chat session
 type ChatSession struct {
-	ID        string    `db:"id" json:"id"`
-	UserID    string    `db:"user_id" json:"user_id"`
-	Title     string    `db:"title" json:"title"`
-	IsActive  bool      `db:"is_active" json:"is_active"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	ID        string                  `db:"id" json:"id"`
+	UserID    string                  `db:"user_id" json:"user_id"`
+	FolderID  *string                 `db:"folder_id" json:"folder_id"`
+	Title     string                  `db:"title" json:"title"`
+	AutoTitle bool                    `db:"auto_title" json:"auto_title"` // placeholder title, replaced after the first exchange
+	Params    models.GenerationParams `db:"params" json:"params"` // defaults for new messages
+	PersonaID *string                 `db:"persona_id" json:"persona_id"`
+	// SystemPrompt overrides the persona's and the configured prompt
+	SystemPrompt *string `db:"system_prompt" json:"system_prompt,omitempty"`
+	// ActiveMessageID is the leaf of the branch the user is on
+	ActiveMessageID *string   `db:"active_message_id" json:"active_message_id"`
+	IsActive        bool      `db:"is_active" json:"is_active"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
+	// PinnedAt and ArchivedAt are nil unless pinned/archived
+	PinnedAt   *time.Time `db:"pinned_at" json:"pinned_at"`
+	ArchivedAt *time.Time `db:"archived_at" json:"archived_at"`
+	// DeletedAt is set while the session is in the trash
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	// Tags is filled by ListSessions and GetUserSession
+	Tags []string `db:"-" json:"tags"`
 }
 
+const chatSessionColumns = `id, user_id, folder_id, title, auto_title, params, persona_id, system_prompt, active_message_id, is_active, created_at, updated_at, pinned_at, archived_at, deleted_at`
+
 // ChatMessage represents a chat message
 type ChatMessage struct {
-	ID        string    `db:"id" json:"id"`
-	SessionID string    `db:"session_id" json:"session_id"`
-	UserID    string    `db:"user_id" json:"user_id"`
-	Role      string    `db:"role" json:"role"` // user, assistant, system
-	Content   string    `db:"content" json:"content"`
-	Tokens    int       `db:"tokens" json:"tokens"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ID        string                 `db:"id" json:"id"`
+	SessionID string                 `db:"session_id" json:"session_id"`
+	ParentID  *string                `db:"parent_id" json:"parent_id"` // nil for a root message
+	UserID    string                 `db:"user_id" json:"user_id"`
+	Role      string                 `db:"role" json:"role"` // user, assistant, system
+	Content   string                 `db:"content" json:"content"`
+	Tokens    int                    `db:"tokens" json:"tokens"`
+	Metadata  models.MessageMetadata `db:"metadata" json:"metadata"`
+	CreatedAt time.Time              `db:"created_at" json:"created_at"`
 }
 
+const chatMessageColumns = `id, session_id, parent_id, user_id, role, content, tokens, metadata, created_at`
+
 // SearchQuery represents a search query
 type SearchQuery struct {
 	ID        string    `db:"id" json:"id"`
@@ -93,29 +180,30 @@ func NewUserRepository(db *DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// WithContext returns a copy of the repository bound to ctx
+func (r *UserRepository) WithContext(ctx context.Context) *UserRepository {
+	return &UserRepository{db: r.db.WithContext(ctx)}
+}
+
 func (r *UserRepository) GetByAccessKey(accessKey string) (*User, error) {
 	var user User
-	query := `SELECT id, email, name, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
+	query := `SELECT id, email, name, role, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
 			  FROM users WHERE access_key = ? AND is_active = 1`
 
-	log.Printf("[DEBUG] GetByAccessKey called with accessKey: %s", accessKey)
 	err := r.db.Get(&user, query, accessKey)
 	if err != nil {
-		log.Printf("[DEBUG] GetByAccessKey error: %v", err)
 		if err == sql.ErrNoRows {
-			log.Printf("[DEBUG] No rows found for access key: %s", accessKey)
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get user by access key: %w", err)
 	}
 
-	log.Printf("[DEBUG] User found: %+v", user)
 	return &user, nil
 }
 
 func (r *UserRepository) GetByID(id string) (*User, error) {
 	var user User
-	query := `SELECT id, email, name, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
+	query := `SELECT id, email, name, role, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
 			  FROM users WHERE id = ? AND is_active = 1`
 
 	err := r.db.Get(&user, query, id)
@@ -131,24 +219,37 @@ func (r *UserRepository) GetByID(id string) (*User, error) {
 
 func (r *UserRepository) GetByEmail(email string) (*User, error) {
 	var user User
-	query := `SELECT id, email, name, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
+	query := `SELECT id, email, name, role, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at 
 			  FROM users WHERE email = ? AND is_active = 1`
 
-	log.Printf("[DEBUG] GetByEmail called with email: %s", email)
 	err := r.db.Get(&user, query, email)
 	if err != nil {
-		log.Printf("[DEBUG] GetByEmail error: %v", err)
 		if err == sql.ErrNoRows {
-			log.Printf("[DEBUG] No rows found for email: %s", email)
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
-	log.Printf("[DEBUG] User found by email: %+v", user)
 	return &user, nil
 }
 
+func (r *UserRepository) Create(user *User) error {
+	if user.Role == "" {
+		user.Role = "user"
+	}
+
+	query := `INSERT INTO users (id, email, name, role, password_hash, access_key, is_active, chat_tokens, search_tokens, created_at, updated_at) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+
+	_, err := r.db.Exec(query, user.ID, user.Email, user.Name, user.Role, user.PasswordHash,
+		user.AccessKey, user.IsActive, user.ChatTokens, user.SearchTokens)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
 func (r *UserRepository) UpdateTokens(userID string, chatTokens, searchTokens int) error {
 	query := `UPDATE users SET chat_tokens = ?, search_tokens = ?, updated_at = NOW() WHERE id = ?`
 
@@ -203,11 +304,17 @@ func NewChatRepository(db *DB) *ChatRepository {
 	return &ChatRepository{db: db}
 }
 
+// WithContext returns a copy of the repository bound to ctx
+func (r *ChatRepository) WithContext(ctx context.Context) *ChatRepository {
+	return &ChatRepository{db: r.db.WithContext(ctx)}
+}
+
 func (r *ChatRepository) CreateSession(session *ChatSession) error {
-	query := `INSERT INTO chat_sessions (id, user_id, title, is_active, created_at, updated_at) 
-			  VALUES (?, ?, ?, ?, NOW(), NOW())`
+	query := `INSERT INTO chat_sessions (id, user_id, title, auto_title, params, persona_id, system_prompt, is_active, created_at, updated_at) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
 
-	_, err := r.db.Exec(query, session.ID, session.UserID, session.Title, session.IsActive)
+	_, err := r.db.Exec(query, session.ID, session.UserID, session.Title, session.AutoTitle, session.Params,
+		session.PersonaID, session.SystemPrompt, session.IsActive)
 	if err != nil {
 		return fmt.Errorf("failed to create chat session: %w", err)
 	}
@@ -217,8 +324,8 @@ func (r *ChatRepository) CreateSession(session *ChatSession) error {
 
 func (r *ChatRepository) GetUserSessions(userID string) ([]ChatSession, error) {
 	var sessions []ChatSession
-	query := `SELECT id, user_id, title, is_active, created_at, updated_at 
-			  FROM chat_sessions WHERE user_id = ? ORDER BY updated_at DESC`
+	query := `SELECT ` + chatSessionColumns + `
+			  FROM chat_sessions WHERE user_id = ? AND deleted_at IS NULL ORDER BY updated_at DESC`
 
 	err := r.db.Select(&sessions, query, userID)
 	if err != nil {
@@ -228,12 +335,84 @@ func (r *ChatRepository) GetUserSessions(userID string) ([]ChatSession, error) {
 	return sessions, nil
 }
 
+// GetSession returns a session that is not in the trash, or nil
+func (r *ChatRepository) GetSession(sessionID string) (*ChatSession, error) {
+	var session ChatSession
+	query := `SELECT ` + chatSessionColumns + `
+			  FROM chat_sessions WHERE id = ? AND deleted_at IS NULL`
+
+	err := r.db.Get(&session, query, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get chat session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// SetSessionPersona sets the session's persona and own system prompt; nil
+// clears either
+func (r *ChatRepository) SetSessionPersona(sessionID string, personaID, systemPrompt *string) error {
+	query := `UPDATE chat_sessions SET persona_id = ?, system_prompt = ?, updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, personaID, systemPrompt, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session persona: %w", err)
+	}
+
+	return nil
+}
+
+// SetSessionParams replaces the session's default generation parameters
+func (r *ChatRepository) SetSessionParams(sessionID string, params models.GenerationParams) error {
+	query := `UPDATE chat_sessions SET params = ?, updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, params, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session params: %w", err)
+	}
+
+	return nil
+}
+
+// RenameSession sets a title chosen by the user; it is never replaced by a
+// generated one
+func (r *ChatRepository) RenameSession(sessionID, title string) error {
+	query := `UPDATE chat_sessions SET title = ?, auto_title = FALSE, updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, title, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to rename session: %w", err)
+	}
+
+	return nil
+}
+
+// SetGeneratedTitle replaces the placeholder title. It reports false when
+// the session was renamed (or titled) in the meantime.
+func (r *ChatRepository) SetGeneratedTitle(sessionID, title string) (bool, error) {
+	query := `UPDATE chat_sessions SET title = ?, auto_title = FALSE, updated_at = NOW() WHERE id = ? AND auto_title = TRUE`
+
+	result, err := r.db.Exec(query, title, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set generated title: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to set generated title: %w", err)
+	}
+	return rows > 0, nil
+}
+
 func (r *ChatRepository) CreateMessage(message *ChatMessage) error {
-	query := `INSERT INTO chat_messages (id, session_id, user_id, role, content, tokens, created_at) 
-			  VALUES (?, ?, ?, ?, ?, ?, NOW())`
+	query := `INSERT INTO chat_messages (id, session_id, parent_id, user_id, role, content, tokens, metadata, created_at) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(3))`
 
-	_, err := r.db.Exec(query, message.ID, message.SessionID, message.UserID, 
-		message.Role, message.Content, message.Tokens)
+	_, err := r.db.Exec(query, message.ID, message.SessionID, message.ParentID, message.UserID,
+		message.Role, message.Content, message.Tokens, message.Metadata)
 	if err != nil {
 		return fmt.Errorf("failed to create chat message: %w", err)
 	}
@@ -243,7 +422,7 @@ func (r *ChatRepository) CreateMessage(message *ChatMessage) error {
 
 func (r *ChatRepository) GetSessionMessages(sessionID string) ([]ChatMessage, error) {
 	var messages []ChatMessage
-	query := `SELECT id, session_id, user_id, role, content, tokens, created_at 
+	query := `SELECT ` + chatMessageColumns + `
 			  FROM chat_messages WHERE session_id = ? ORDER BY created_at ASC`
 
 	err := r.db.Select(&messages, query, sessionID)
@@ -263,6 +442,11 @@ func NewSearchRepository(db *DB) *SearchRepository {
 	return &SearchRepository{db: db}
 }
 
+// WithContext returns a copy of the repository bound to ctx
+func (r *SearchRepository) WithContext(ctx context.Context) *SearchRepository {
+	return &SearchRepository{db: r.db.WithContext(ctx)}
+}
+
 func (r *SearchRepository) CreateQuery(query *SearchQuery) error {
 	sql := `INSERT INTO search_queries (id, user_id, query, results, tokens, created_at) 
 			VALUES (?, ?, ?, ?, ?, NOW())`
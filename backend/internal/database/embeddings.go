@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Vector is an embedding, stored as little-endian float32s
+type Vector []float32
+
+// Value implements driver.Valuer
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b, nil
+}
+
+// Scan implements sql.Scanner
+func (v *Vector) Scan(src interface{}) error {
+	switch b := src.(type) {
+	case nil:
+		*v = nil
+	case []byte:
+		if len(b)%4 != 0 {
+			return fmt.Errorf("vector has %d bytes, not a multiple of 4", len(b))
+		}
+		out := make(Vector, len(b)/4)
+		for i := range out {
+			out[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+		*v = out
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+	return nil
+}
+
+// MessageEmbedding is the embedding of a chat message for one model and
+// requested dimensions (0 = the model's default). A nil Vector marks a
+// message that could not be embedded.
+type MessageEmbedding struct {
+	MessageID  string `db:"message_id"`
+	UserID     string `db:"user_id"` // the message's, not stored
+	Model      string `db:"model"`
+	Dimensions int    `db:"dimensions"`
+	Vector     Vector `db:"vector"`
+}
+
+// PendingEmbeddings returns up to limit user and assistant messages of live
+// sessions that have no embedding for model and dims yet, newest first
+func (r *ChatRepository) PendingEmbeddings(model string, dims, limit int) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	query := `SELECT m.` + strings.ReplaceAll(chatMessageColumns, ", ", ", m.") + `
+			  FROM chat_messages m JOIN chat_sessions s ON s.id = m.session_id
+			  WHERE s.deleted_at IS NULL AND m.role IN ('user', 'assistant') AND m.content <> ''
+				AND NOT EXISTS (SELECT 1 FROM chat_message_embeddings e
+								WHERE e.message_id = m.id AND e.model = ? AND e.dimensions = ?)
+			  ORDER BY m.created_at DESC, m.id
+			  LIMIT ?`
+
+	if err := r.db.Select(&messages, query, model, dims, limit); err != nil {
+		return nil, fmt.Errorf("failed to get messages to embed: %w", err)
+	}
+	return messages, nil
+}
+
+// SaveEmbeddings stores embeddings, replacing older ones of the same
+// messages
+func (r *ChatRepository) SaveEmbeddings(embeddings []MessageEmbedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	rows := make([]string, len(embeddings))
+	args := make([]interface{}, 0, 4*len(embeddings))
+	for i, e := range embeddings {
+		rows[i] = "(?, ?, ?, ?, NOW())"
+		args = append(args, e.MessageID, e.Model, e.Dimensions, e.Vector)
+	}
+	query := `INSERT INTO chat_message_embeddings (message_id, model, dimensions, vector, created_at)
+			  VALUES ` + strings.Join(rows, ", ") + `
+			  ON DUPLICATE KEY UPDATE model = VALUES(model), dimensions = VALUES(dimensions),
+				  vector = VALUES(vector), created_at = VALUES(created_at)`
+
+	if _, err := r.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	return nil
+}
+
+// Embeddings returns up to limit stored vectors for model and dims with
+// message IDs after afterID, in ID order, to load a vector index page by
+// page
+func (r *ChatRepository) Embeddings(model string, dims int, afterID string, limit int) ([]MessageEmbedding, error) {
+	var embeddings []MessageEmbedding
+	query := `SELECT e.message_id, m.user_id, e.model, e.dimensions, e.vector
+			  FROM chat_message_embeddings e JOIN chat_messages m ON m.id = e.message_id
+			  WHERE e.model = ? AND e.dimensions = ? AND e.vector IS NOT NULL AND e.message_id > ?
+			  ORDER BY e.message_id
+			  LIMIT ?`
+
+	if err := r.db.Select(&embeddings, query, model, dims, afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to load embeddings: %w", err)
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChatFolder groups a user's chat sessions; folders nest through ParentID
+type ChatFolder struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"-"`
+	ParentID  *string   `db:"parent_id" json:"parent_id"`
+	Name      string    `db:"name" json:"name"`
+	Sessions  int       `db:"sessions" json:"sessions"` // live sessions directly inside, set by List
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// FolderRepository handles chat folder database operations
+type FolderRepository struct {
+	db *DB
+}
+
+func NewFolderRepository(db *DB) *FolderRepository {
+	return &FolderRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *FolderRepository) WithContext(ctx context.Context) *FolderRepository {
+	return &FolderRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *FolderRepository) Create(folder *ChatFolder) error {
+	query := `INSERT INTO chat_folders (id, user_id, parent_id, name, created_at, updated_at) VALUES (?, ?, ?, ?, NOW(), NOW())`
+
+	if _, err := r.db.Exec(query, folder.ID, folder.UserID, folder.ParentID, folder.Name); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	return nil
+}
+
+// Get returns the user's folder, or nil
+func (r *FolderRepository) Get(userID, id string) (*ChatFolder, error) {
+	var folder ChatFolder
+	query := `SELECT id, user_id, parent_id, name, 0 AS sessions, created_at, updated_at
+			  FROM chat_folders WHERE id = ? AND user_id = ?`
+
+	err := r.db.Get(&folder, query, id, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get folder: %w", err)
+	}
+	return &folder, nil
+}
+
+// List returns all of the user's folders by name
+func (r *FolderRepository) List(userID string) ([]ChatFolder, error) {
+	var folders []ChatFolder
+	query := `SELECT f.id, f.user_id, f.parent_id, f.name,
+				  (SELECT COUNT(*) FROM chat_sessions s WHERE s.folder_id = f.id AND s.deleted_at IS NULL) AS sessions,
+				  f.created_at, f.updated_at
+			  FROM chat_folders f WHERE f.user_id = ? ORDER BY f.name, f.id`
+
+	if err := r.db.Select(&folders, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	return folders, nil
+}
+
+// Update saves the folder's name and parent
+func (r *FolderRepository) Update(folder *ChatFolder) error {
+	query := `UPDATE chat_folders SET name = ?, parent_id = ?, updated_at = NOW() WHERE id = ? AND user_id = ?`
+
+	if _, err := r.db.Exec(query, folder.Name, folder.ParentID, folder.ID, folder.UserID); err != nil {
+		return fmt.Errorf("failed to update folder: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the folder and its subfolders; their sessions become
+// unfiled
+func (r *FolderRepository) Delete(userID, id string) error {
+	if _, err := r.db.Exec(`DELETE FROM chat_folders WHERE id = ? AND user_id = ?`, id, userID); err != nil {
+		return fmt.Errorf("failed to delete folder: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Issuer    string    `db:"issuer" json:"issuer"`
+	Subject   string    `db:"subject" json:"subject"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	LastLogin time.Time `db:"last_login_at" json:"last_login_at"`
+}
+
+// IdentityRepository handles external identity database operations
+type IdentityRepository struct {
+	db *DB
+}
+
+func NewIdentityRepository(db *DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *IdentityRepository) WithContext(ctx context.Context) *IdentityRepository {
+	return &IdentityRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *IdentityRepository) GetByIssuerSubject(issuer, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	query := `SELECT id, user_id, issuer, subject, email, created_at, last_login_at 
+			  FROM user_identities WHERE issuer = ? AND subject = ?`
+
+	err := r.db.Get(&identity, query, issuer, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func (r *IdentityRepository) Create(identity *UserIdentity) error {
+	query := `INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at) 
+			  VALUES (?, ?, ?, ?, ?, NOW(), NOW())`
+
+	_, err := r.db.Exec(query, identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email)
+	if err != nil {
+		return fmt.Errorf("failed to create user identity: %w", err)
+	}
+
+	return nil
+}
+
+func (r *IdentityRepository) TouchLogin(id, email string) error {
+	query := `UPDATE user_identities SET email = ?, last_login_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, email, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user identity: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Document statuses
+const (
+	DocumentProcessing = "processing" // chunks are waiting to be embedded
+	DocumentReady      = "ready"
+)
+
+// KnowledgeBase is a user's collection of documents that sessions can
+// retrieve from
+type KnowledgeBase struct {
+	ID          string    `db:"id" json:"id"`
+	UserID      string    `db:"user_id" json:"-"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	Documents   int       `db:"documents" json:"documents"` // set by Get and List
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// KnowledgeDocument is an uploaded document of a knowledge base
+type KnowledgeDocument struct {
+	ID              string    `db:"id" json:"id"`
+	KnowledgeBaseID string    `db:"knowledge_base_id" json:"knowledge_base_id"`
+	Name            string    `db:"name" json:"name"`
+	MimeType        string    `db:"mime_type" json:"mime_type"`
+	Size            int64     `db:"size" json:"size"`
+	Pages           int       `db:"pages" json:"pages"`
+	Chunks          int       `db:"chunks" json:"chunks"`
+	Status          string    `db:"status" json:"status"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+}
+
+// KnowledgeChunk is a piece of a document's text, from a single page
+type KnowledgeChunk struct {
+	ID              string `db:"id"`
+	DocumentID      string `db:"document_id"`
+	KnowledgeBaseID string `db:"knowledge_base_id"`
+	Ordinal         int    `db:"ordinal"`
+	Page            int    `db:"page"`
+	Content         string `db:"content"`
+}
+
+// ChunkHit is a retrieved chunk with its document's name
+type ChunkHit struct {
+	KnowledgeChunk
+	DocumentName string `db:"document_name"`
+}
+
+// ChunkEmbedding is the embedding of a chunk for one model and requested
+// dimensions; a nil Vector marks a chunk that could not be embedded
+type ChunkEmbedding struct {
+	ChunkID         string `db:"chunk_id"`
+	KnowledgeBaseID string `db:"knowledge_base_id"` // the chunk's, not stored
+	Model           string `db:"model"`
+	Dimensions      int    `db:"dimensions"`
+	Vector          Vector `db:"vector"`
+}
+
+// KnowledgeRepository handles knowledge base database operations
+type KnowledgeRepository struct {
+	db *DB
+}
+
+func NewKnowledgeRepository(db *DB) *KnowledgeRepository {
+	return &KnowledgeRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *KnowledgeRepository) WithContext(ctx context.Context) *KnowledgeRepository {
+	return &KnowledgeRepository{db: r.db.WithContext(ctx)}
+}
+
+const knowledgeBaseSelect = `SELECT b.id, b.user_id, b.name, COALESCE(b.description, '') AS description,
+				  (SELECT COUNT(*) FROM knowledge_documents d WHERE d.knowledge_base_id = b.id) AS documents,
+				  b.created_at, b.updated_at
+			  FROM knowledge_bases b`
+
+func (r *KnowledgeRepository) CreateBase(kb *KnowledgeBase) error {
+	query := `INSERT INTO knowledge_bases (id, user_id, name, description, created_at, updated_at) VALUES (?, ?, ?, ?, NOW(), NOW())`
+
+	if _, err := r.db.Exec(query, kb.ID, kb.UserID, kb.Name, kb.Description); err != nil {
+		return fmt.Errorf("failed to create knowledge base: %w", err)
+	}
+	return nil
+}
+
+// GetBase returns the user's knowledge base, or nil
+func (r *KnowledgeRepository) GetBase(userID, id string) (*KnowledgeBase, error) {
+	var kb KnowledgeBase
+	err := r.db.Get(&kb, knowledgeBaseSelect+` WHERE b.id = ? AND b.user_id = ?`, id, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get knowledge base: %w", err)
+	}
+	return &kb, nil
+}
+
+// ListBases returns all of the user's knowledge bases by name
+func (r *KnowledgeRepository) ListBases(userID string) ([]KnowledgeBase, error) {
+	var bases []KnowledgeBase
+	if err := r.db.Select(&bases, knowledgeBaseSelect+` WHERE b.user_id = ? ORDER BY b.name, b.id`, userID); err != nil {
+		return nil, fmt.Errorf("failed to list knowledge bases: %w", err)
+	}
+	return bases, nil
+}
+
+// UpdateBase saves the knowledge base's name and description
+func (r *KnowledgeRepository) UpdateBase(kb *KnowledgeBase) error {
+	query := `UPDATE knowledge_bases SET name = ?, description = ?, updated_at = NOW() WHERE id = ? AND user_id = ?`
+
+	if _, err := r.db.Exec(query, kb.Name, kb.Description, kb.ID, kb.UserID); err != nil {
+		return fmt.Errorf("failed to update knowledge base: %w", err)
+	}
+	return nil
+}
+
+// DeleteBase removes the knowledge base with its documents and detaches it
+// from sessions
+func (r *KnowledgeRepository) DeleteBase(userID, id string) error {
+	if _, err := r.db.Exec(`DELETE FROM knowledge_bases WHERE id = ? AND user_id = ?`, id, userID); err != nil {
+		return fmt.Errorf("failed to delete knowledge base: %w", err)
+	}
+	return nil
+}
+
+// Documents returns the knowledge base's documents, newest first
+func (r *KnowledgeRepository) Documents(kbID string) ([]KnowledgeDocument, error) {
+	var docs []KnowledgeDocument
+	query := `SELECT id, knowledge_base_id, name, mime_type, size, pages, chunks, status, created_at
+			  FROM knowledge_documents WHERE knowledge_base_id = ? ORDER BY created_at DESC, id`
+
+	if err := r.db.Select(&docs, query, kbID); err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	return docs, nil
+}
+
+// CreateDocument inserts the document and its chunks in one transaction
+func (r *KnowledgeRepository) CreateDocument(doc *KnowledgeDocument, chunks []KnowledgeChunk) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO knowledge_documents (id, knowledge_base_id, name, mime_type, size, pages, chunks, status, created_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())`,
+		doc.ID, doc.KnowledgeBaseID, doc.Name, doc.MimeType, doc.Size, doc.Pages, doc.Chunks, doc.Status)
+	if err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+
+	// Batched to stay far below max_allowed_packet
+	const batch = 100
+	for len(chunks) > 0 {
+		n := min(batch, len(chunks))
+		rows := make([]string, n)
+		args := make([]interface{}, 0, 6*n)
+		for i, c := range chunks[:n] {
+			rows[i] = "(?, ?, ?, ?, ?, ?)"
+			args = append(args, c.ID, c.DocumentID, c.KnowledgeBaseID, c.Ordinal, c.Page, c.Content)
+		}
+		if _, err := tx.Exec(`INSERT INTO knowledge_chunks (id, document_id, knowledge_base_id, ordinal, page, content)
+				  VALUES `+strings.Join(rows, ", "), args...); err != nil {
+			return fmt.Errorf("failed to save document chunks: %w", err)
+		}
+		chunks = chunks[n:]
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+	return nil
+}
+
+// DeleteDocument removes a document of the knowledge base and reports
+// whether it existed
+func (r *KnowledgeRepository) DeleteDocument(kbID, id string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM knowledge_documents WHERE id = ? AND knowledge_base_id = ?`, id, kbID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete document: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete document: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ChunkIDs returns the IDs of a document's chunks, or of all chunks of the
+// knowledge base when documentID is empty
+func (r *KnowledgeRepository) ChunkIDs(kbID, documentID string) ([]string, error) {
+	query, args := `SELECT id FROM knowledge_chunks WHERE knowledge_base_id = ?`, []interface{}{kbID}
+	if documentID != "" {
+		query += ` AND document_id = ?`
+		args = append(args, documentID)
+	}
+
+	var ids []string
+	if err := r.db.Select(&ids, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get chunk ids: %w", err)
+	}
+	return ids, nil
+}
+
+// GetChunks returns the chunks among ids that belong to one of kbIDs, in
+// no particular order
+func (r *KnowledgeRepository) GetChunks(kbIDs, ids []string) ([]ChunkHit, error) {
+	if len(kbIDs) == 0 || len(ids) == 0 {
+		return []ChunkHit{}, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT c.id, c.document_id, c.knowledge_base_id, c.ordinal, c.page, c.content, d.name AS document_name
+			  FROM knowledge_chunks c JOIN knowledge_documents d ON d.id = c.document_id
+			  WHERE c.knowledge_base_id IN (?) AND c.id IN (?)`, kbIDs, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build chunk query: %w", err)
+	}
+
+	var hits []ChunkHit
+	if err := r.db.Select(&hits, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+	return hits, nil
+}
+
+// SessionBases returns the IDs of the knowledge bases attached to a session
+func (r *KnowledgeRepository) SessionBases(sessionID string) ([]string, error) {
+	ids := []string{}
+	query := `SELECT knowledge_base_id FROM chat_session_knowledge_bases WHERE session_id = ? ORDER BY created_at, knowledge_base_id`
+
+	if err := r.db.Select(&ids, query, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to get session knowledge bases: %w", err)
+	}
+	return ids, nil
+}
+
+// SetSessionBases replaces the knowledge bases attached to a session
+func (r *KnowledgeRepository) SetSessionBases(sessionID string, kbIDs []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to set session knowledge bases: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chat_session_knowledge_bases WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("failed to set session knowledge bases: %w", err)
+	}
+	for _, id := range kbIDs {
+		if _, err := tx.Exec(`INSERT INTO chat_session_knowledge_bases (session_id, knowledge_base_id, created_at) VALUES (?, ?, NOW())`, sessionID, id); err != nil {
+			return fmt.Errorf("failed to set session knowledge bases: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to set session knowledge bases: %w", err)
+	}
+	return nil
+}
+
+// PendingChunks returns up to limit chunks that have no embedding for
+// model and dims yet, oldest document first
+func (r *KnowledgeRepository) PendingChunks(model string, dims, limit int) ([]KnowledgeChunk, error) {
+	var chunks []KnowledgeChunk
+	query := `SELECT c.id, c.document_id, c.knowledge_base_id, c.ordinal, c.page, c.content
+			  FROM knowledge_chunks c JOIN knowledge_documents d ON d.id = c.document_id
+			  WHERE NOT EXISTS (SELECT 1 FROM knowledge_chunk_embeddings e
+								WHERE e.chunk_id = c.id AND e.model = ? AND e.dimensions = ?)
+			  ORDER BY d.created_at, c.document_id, c.ordinal
+			  LIMIT ?`
+
+	if err := r.db.Select(&chunks, query, model, dims, limit); err != nil {
+		return nil, fmt.Errorf("failed to get chunks to embed: %w", err)
+	}
+	return chunks, nil
+}
+
+// SaveEmbeddings stores chunk embeddings, replacing older ones of the same
+// chunks
+func (r *KnowledgeRepository) SaveEmbeddings(embeddings []ChunkEmbedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	rows := make([]string, len(embeddings))
+	args := make([]interface{}, 0, 4*len(embeddings))
+	for i, e := range embeddings {
+		rows[i] = "(?, ?, ?, ?, NOW())"
+		args = append(args, e.ChunkID, e.Model, e.Dimensions, e.Vector)
+	}
+	query := `INSERT INTO knowledge_chunk_embeddings (chunk_id, model, dimensions, vector, created_at)
+			  VALUES ` + strings.Join(rows, ", ") + `
+			  ON DUPLICATE KEY UPDATE model = VALUES(model), dimensions = VALUES(dimensions),
+				  vector = VALUES(vector), created_at = VALUES(created_at)`
+
+	if _, err := r.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to save chunk embeddings: %w", err)
+	}
+	return nil
+}
+
+// SyncDocumentStatus marks documents ready when all their chunks are
+// embedded with model and dims, and processing when some are not (after
+// the model changed)
+func (r *KnowledgeRepository) SyncDocumentStatus(model string, dims int) error {
+	query := `UPDATE knowledge_documents d
+			  SET d.status = IF(EXISTS (SELECT 1 FROM knowledge_chunks c
+										WHERE c.document_id = d.id AND NOT EXISTS (
+											SELECT 1 FROM knowledge_chunk_embeddings e
+											WHERE e.chunk_id = c.id AND e.model = ? AND e.dimensions = ?)),
+							   'processing', 'ready')`
+
+	if _, err := r.db.Exec(query, model, dims); err != nil {
+		return fmt.Errorf("failed to update document status: %w", err)
+	}
+	return nil
+}
+
+// Embeddings returns up to limit stored chunk vectors for model and dims
+// with chunk IDs after afterID, in ID order, to load a vector index page
+// by page
+func (r *KnowledgeRepository) Embeddings(model string, dims int, afterID string, limit int) ([]ChunkEmbedding, error) {
+	var embeddings []ChunkEmbedding
+	query := `SELECT e.chunk_id, c.knowledge_base_id, e.model, e.dimensions, e.vector
+			  FROM knowledge_chunk_embeddings e JOIN knowledge_chunks c ON c.id = e.chunk_id
+			  WHERE e.model = ? AND e.dimensions = ? AND e.vector IS NOT NULL AND e.chunk_id > ?
+			  ORDER BY e.chunk_id
+			  LIMIT ?`
+
+	if err := r.db.Select(&embeddings, query, model, dims, afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to load chunk embeddings: %w", err)
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Model sources recorded in ai_model_configs.source
+const (
+	ModelSourceSeed    = "seed"
+	ModelSourceConfig  = "config"
+	ModelSourceGateway = "gateway"
+	ModelSourceAdmin   = "admin"
+)
+
+// ModelConfig is a row of the model catalogue (ai_model_configs)
+type ModelConfig struct {
+	ID                int64        `db:"id" json:"id"`
+	Name              string       `db:"model_name" json:"model"`
+	DisplayName       string       `db:"display_name" json:"display_name"`
+	Provider          string       `db:"provider" json:"provider"`
+	Description       string       `db:"description" json:"description"`
+	ContextLength     int          `db:"context_length" json:"context_length"`
+	MaxTokens         int          `db:"max_tokens" json:"max_tokens"`
+	Temperature       float64      `db:"temperature" json:"temperature"`
+	Enabled           bool         `db:"enabled" json:"enabled"`
+	InputCostPer1K    float64      `db:"cost_per_1k_input_tokens" json:"cost_per_1k_input_tokens"`
+	OutputCostPer1K   float64      `db:"cost_per_1k_output_tokens" json:"cost_per_1k_output_tokens"`
+	SupportsStreaming bool         `db:"supports_streaming" json:"supports_streaming"`
+	SupportsTools     bool         `db:"supports_tools" json:"supports_tools"`
+	SupportsVision    bool         `db:"supports_vision" json:"supports_vision"`
+	Source            string       `db:"source" json:"source"`
+	LastSyncedAt      sql.NullTime `db:"last_synced_at" json:"-"`
+	CreatedAt         time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+const modelColumns = `id, model_name, display_name, provider, description, context_length, max_tokens,
+	temperature, enabled, cost_per_1k_input_tokens, cost_per_1k_output_tokens,
+	supports_streaming, supports_tools, supports_vision, source, last_synced_at, created_at, updated_at`
+
+// ModelRepository handles model catalogue database operations
+type ModelRepository struct {
+	db *DB
+}
+
+func NewModelRepository(db *DB) *ModelRepository {
+	return &ModelRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *ModelRepository) WithContext(ctx context.Context) *ModelRepository {
+	return &ModelRepository{db: r.db.WithContext(ctx)}
+}
+
+// List returns the catalogue ordered by provider and name
+func (r *ModelRepository) List(enabledOnly bool) ([]ModelConfig, error) {
+	query := `SELECT ` + modelColumns + ` FROM ai_model_configs`
+	if enabledOnly {
+		query += ` WHERE enabled = TRUE`
+	}
+	query += ` ORDER BY provider, model_name`
+
+	var models []ModelConfig
+	if err := r.db.Select(&models, query); err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	return models, nil
+}
+
+func (r *ModelRepository) GetByID(id int64) (*ModelConfig, error) {
+	return r.getBy("id", id)
+}
+
+func (r *ModelRepository) GetByName(name string) (*ModelConfig, error) {
+	return r.getBy("model_name", name)
+}
+
+func (r *ModelRepository) getBy(column string, value interface{}) (*ModelConfig, error) {
+	var model ModelConfig
+	query := `SELECT ` + modelColumns + ` FROM ai_model_configs WHERE ` + column + ` = ?`
+
+	err := r.db.Get(&model, query, value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+
+	return &model, nil
+}
+
+// Create inserts a model and sets its ID
+func (r *ModelRepository) Create(model *ModelConfig) error {
+	query := `INSERT INTO ai_model_configs (model_name, display_name, provider, description, context_length,
+			  max_tokens, temperature, enabled, cost_per_1k_input_tokens, cost_per_1k_output_tokens,
+			  supports_streaming, supports_tools, supports_vision, source)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.Exec(query, model.Name, model.DisplayName, model.Provider, model.Description,
+		model.ContextLength, model.MaxTokens, model.Temperature, model.Enabled, model.InputCostPer1K,
+		model.OutputCostPer1K, model.SupportsStreaming, model.SupportsTools, model.SupportsVision, model.Source)
+	if err != nil {
+		return fmt.Errorf("failed to create model: %w", err)
+	}
+
+	model.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// CreateIfMissing inserts a model unless one with the same name exists; it
+// never overwrites admin edits. Reports whether a row was inserted.
+func (r *ModelRepository) CreateIfMissing(model *ModelConfig) (bool, error) {
+	query := `INSERT IGNORE INTO ai_model_configs (model_name, display_name, provider, description, context_length,
+			  max_tokens, temperature, enabled, cost_per_1k_input_tokens, cost_per_1k_output_tokens,
+			  supports_streaming, supports_tools, supports_vision, source)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.Exec(query, model.Name, model.DisplayName, model.Provider, model.Description,
+		model.ContextLength, model.MaxTokens, model.Temperature, model.Enabled, model.InputCostPer1K,
+		model.OutputCostPer1K, model.SupportsStreaming, model.SupportsTools, model.SupportsVision, model.Source)
+	if err != nil {
+		return false, fmt.Errorf("failed to create model: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Update writes every editable column of model
+func (r *ModelRepository) Update(model *ModelConfig) error {
+	query := `UPDATE ai_model_configs SET display_name = ?, provider = ?, description = ?, context_length = ?,
+			  max_tokens = ?, temperature = ?, enabled = ?, cost_per_1k_input_tokens = ?,
+			  cost_per_1k_output_tokens = ?, supports_streaming = ?, supports_tools = ?, supports_vision = ?
+			  WHERE id = ?`
+
+	_, err := r.db.Exec(query, model.DisplayName, model.Provider, model.Description, model.ContextLength,
+		model.MaxTokens, model.Temperature, model.Enabled, model.InputCostPer1K, model.OutputCostPer1K,
+		model.SupportsStreaming, model.SupportsTools, model.SupportsVision, model.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update model: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ModelRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM ai_model_configs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete model: %w", err)
+	}
+
+	return nil
+}
+
+// FillFromGateway records that the gateway still offers a model and fills
+// context length and pricing where the catalogue has none yet
+func (r *ModelRepository) FillFromGateway(name string, contextLength int, inputPer1K, outputPer1K float64) error {
+	query := `UPDATE ai_model_configs SET last_synced_at = NOW(),
+			  context_length = IF(context_length = 0, ?, context_length),
+			  cost_per_1k_input_tokens = IF(cost_per_1k_input_tokens = 0, ?, cost_per_1k_input_tokens),
+			  cost_per_1k_output_tokens = IF(cost_per_1k_output_tokens = 0, ?, cost_per_1k_output_tokens)
+			  WHERE model_name = ?`
+
+	_, err := r.db.Exec(query, contextLength, inputPer1K, outputPer1K, name)
+	if err != nil {
+		return fmt.Errorf("failed to update model from gateway: %w", err)
+	}
+
+	return nil
+}
+
+// ProviderOf derives the provider from a gateway id ("openai/gpt-4o")
+func ProviderOf(name string) string {
+	if provider, _, ok := strings.Cut(name, "/"); ok {
+		return provider
+	}
+	return "unknown"
+}
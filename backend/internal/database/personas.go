@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gryt-backend/internal/models"
+)
+
+// StringList is a list of strings stored as a JSON array. A nil list is
+// stored as NULL.
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal([]string(l))
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]string)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]string)(l))
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+}
+
+// Persona is a named system prompt with default model, parameters and
+// allowed tools. UserID is nil for global personas.
+type Persona struct {
+	ID           string                  `db:"id" json:"id"`
+	UserID       *string                 `db:"user_id" json:"user_id"`
+	Name         string                  `db:"name" json:"name"`
+	Description  string                  `db:"description" json:"description"`
+	SystemPrompt string                  `db:"system_prompt" json:"system_prompt"`
+	Params       models.GenerationParams `db:"params" json:"params"`
+	AllowedTools StringList              `db:"allowed_tools" json:"allowed_tools"` // nil = all enabled tools
+	CreatedAt    time.Time               `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time               `db:"updated_at" json:"updated_at"`
+}
+
+// IsGlobal reports whether the persona is shared with every user
+func (p *Persona) IsGlobal() bool {
+	return p.UserID == nil
+}
+
+const personaColumns = `id, user_id, name, description, system_prompt, params, allowed_tools, created_at, updated_at`
+
+// PersonaRepository handles persona database operations
+type PersonaRepository struct {
+	db *DB
+}
+
+func NewPersonaRepository(db *DB) *PersonaRepository {
+	return &PersonaRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *PersonaRepository) WithContext(ctx context.Context) *PersonaRepository {
+	return &PersonaRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *PersonaRepository) Create(persona *Persona) error {
+	query := `INSERT INTO personas (id, user_id, name, description, system_prompt, params, allowed_tools, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+
+	_, err := r.db.Exec(query, persona.ID, persona.UserID, persona.Name, persona.Description,
+		persona.SystemPrompt, persona.Params, persona.AllowedTools)
+	if err != nil {
+		return fmt.Errorf("failed to create persona: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PersonaRepository) GetByID(id string) (*Persona, error) {
+	var persona Persona
+	query := `SELECT ` + personaColumns + ` FROM personas WHERE id = ?`
+
+	err := r.db.Get(&persona, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get persona: %w", err)
+	}
+
+	return &persona, nil
+}
+
+// ListVisible returns the user's own personas followed by the global ones
+func (r *PersonaRepository) ListVisible(userID string) ([]Persona, error) {
+	var personas []Persona
+	query := `SELECT ` + personaColumns + ` FROM personas
+			  WHERE user_id = ? OR user_id IS NULL
+			  ORDER BY user_id IS NULL, name`
+
+	if err := r.db.Select(&personas, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list personas: %w", err)
+	}
+
+	return personas, nil
+}
+
+// ListGlobal returns the personas shared with every user
+func (r *PersonaRepository) ListGlobal() ([]Persona, error) {
+	var personas []Persona
+	query := `SELECT ` + personaColumns + ` FROM personas WHERE user_id IS NULL ORDER BY name`
+
+	if err := r.db.Select(&personas, query); err != nil {
+		return nil, fmt.Errorf("failed to list personas: %w", err)
+	}
+
+	return personas, nil
+}
+
+func (r *PersonaRepository) Update(persona *Persona) error {
+	query := `UPDATE personas SET name = ?, description = ?, system_prompt = ?, params = ?, allowed_tools = ?,
+			  updated_at = NOW() WHERE id = ?`
+
+	_, err := r.db.Exec(query, persona.Name, persona.Description, persona.SystemPrompt,
+		persona.Params, persona.AllowedTools, persona.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update persona: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PersonaRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM personas WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete persona: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,459 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidCursor is returned for a pagination cursor that was not issued
+// for the same sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Session list sorts. Pinned sessions always come first.
+const (
+	SessionSortUpdated = "updated_at"
+	SessionSortCreated = "created_at"
+	SessionSortTitle   = "title"
+)
+
+// Archived filters for SessionQuery
+const (
+	ArchivedExclude = ""     // live sessions only (default)
+	ArchivedOnly    = "only" // archived sessions only
+	ArchivedAll     = "all"  // both
+)
+
+// SessionCursor marks the last session of a page: the sort it was issued
+// for, the session's sort key and its id
+type SessionCursor struct {
+	Sort   string    `json:"s"`
+	Asc    bool      `json:"a,omitempty"`
+	Pinned bool      `json:"p,omitempty"`
+	Time   time.Time `json:"t,omitempty"`
+	Title  string    `json:"k,omitempty"`
+	ID     string    `json:"i"`
+}
+
+// NewSessionCursor returns the cursor positioned at session for q's sort
+func NewSessionCursor(q SessionQuery, session ChatSession) SessionCursor {
+	if q.Sort == "" {
+		q.Sort = SessionSortUpdated
+	}
+	c := SessionCursor{Sort: q.Sort, Asc: q.Asc, Pinned: session.PinnedAt != nil, ID: session.ID}
+	switch q.Sort {
+	case SessionSortCreated:
+		c.Time = session.CreatedAt
+	case SessionSortTitle:
+		c.Title = session.Title
+	default:
+		c.Time = session.UpdatedAt
+	}
+	return c
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c SessionCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ParseSessionCursor decodes a cursor from Encode
+func ParseSessionCursor(s string) (*SessionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c SessionCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// SessionQuery selects one page of a user's sessions
+type SessionQuery struct {
+	Deleted  bool    // list the trash instead of live sessions
+	Archived string  // ArchivedExclude, ArchivedOnly or ArchivedAll
+	FolderID *string // nil = any folder, "" = unfiled only
+	Tags     []string
+	Pinned   *bool
+	Sort     string // SessionSort*; empty = updated_at
+	Asc      bool
+	After    *SessionCursor // nil = first page
+	Limit    int
+}
+
+// ListSessions returns a page of the user's sessions with their tags:
+// pinned first, then by the sort column
+func (r *ChatRepository) ListSessions(userID string, q SessionQuery) ([]ChatSession, error) {
+	if q.Sort == "" {
+		q.Sort = SessionSortUpdated
+	}
+	if q.After != nil && (q.After.Sort != q.Sort || q.After.Asc != q.Asc) {
+		return nil, ErrInvalidCursor
+	}
+
+	where := []string{"user_id = ?"}
+	args := []interface{}{userID}
+
+	if q.Deleted {
+		where = append(where, "deleted_at IS NOT NULL")
+	} else {
+		where = append(where, "deleted_at IS NULL")
+	}
+	switch q.Archived {
+	case ArchivedOnly:
+		where = append(where, "archived_at IS NOT NULL")
+	case ArchivedAll:
+	default:
+		where = append(where, "archived_at IS NULL")
+	}
+	if q.FolderID != nil {
+		if *q.FolderID == "" {
+			where = append(where, "folder_id IS NULL")
+		} else {
+			where = append(where, "folder_id = ?")
+			args = append(args, *q.FolderID)
+		}
+	}
+	for _, tag := range q.Tags {
+		where = append(where, "EXISTS (SELECT 1 FROM chat_session_tags t WHERE t.session_id = chat_sessions.id AND t.tag = ?)")
+		args = append(args, tag)
+	}
+	if q.Pinned != nil {
+		if *q.Pinned {
+			where = append(where, "pinned_at IS NOT NULL")
+		} else {
+			where = append(where, "pinned_at IS NULL")
+		}
+	}
+
+	column, dir, cmp := q.Sort, "DESC", "<"
+	if q.Asc {
+		dir, cmp = "ASC", ">"
+	}
+	if q.After != nil {
+		var key interface{} = q.After.Time
+		if q.Sort == SessionSortTitle {
+			key = q.After.Title
+		}
+		pinned := 0
+		if q.After.Pinned {
+			pinned = 1
+		}
+		where = append(where, fmt.Sprintf(`((pinned_at IS NOT NULL) < ? OR ((pinned_at IS NOT NULL) = ? AND
+			(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))))`, column, cmp))
+		args = append(args, pinned, pinned, key, key, q.After.ID)
+	}
+
+	query := `SELECT ` + chatSessionColumns + ` FROM chat_sessions WHERE ` + strings.Join(where, " AND ") +
+		fmt.Sprintf(` ORDER BY (pinned_at IS NOT NULL) DESC, %[1]s %[2]s, id %[2]s LIMIT ?`, column, dir)
+	args = append(args, q.Limit)
+
+	var sessions []ChatSession
+	if err := r.db.Select(&sessions, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list chat sessions: %w", err)
+	}
+	if err := r.loadTags(sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// GetUserSession returns the user's session with its tags, or nil when it
+// does not exist, belongs to someone else or is in the trash
+func (r *ChatRepository) GetUserSession(userID, sessionID string) (*ChatSession, error) {
+	var session ChatSession
+	query := `SELECT ` + chatSessionColumns + `
+			  FROM chat_sessions WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+	err := r.db.Get(&session, query, sessionID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get chat session: %w", err)
+	}
+
+	sessions := []ChatSession{session}
+	if err := r.loadTags(sessions); err != nil {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// loadTags fills Tags of each session
+func (r *ChatRepository) loadTags(sessions []ChatSession) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(sessions))
+	for i := range sessions {
+		ids[i] = sessions[i].ID
+		sessions[i].Tags = []string{}
+	}
+
+	query, args, err := sqlx.In(`SELECT session_id, tag FROM chat_session_tags WHERE session_id IN (?) ORDER BY tag`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get session tags: %w", err)
+	}
+	var rows []struct {
+		SessionID string `db:"session_id"`
+		Tag       string `db:"tag"`
+	}
+	if err := r.db.Select(&rows, query, args...); err != nil {
+		return fmt.Errorf("failed to get session tags: %w", err)
+	}
+
+	index := make(map[string]int, len(sessions))
+	for i := range sessions {
+		index[sessions[i].ID] = i
+	}
+	for _, row := range rows {
+		sessions[index[row.SessionID]].Tags = append(sessions[index[row.SessionID]].Tags, row.Tag)
+	}
+	return nil
+}
+
+// TagCount is a tag and how many of the user's live sessions carry it
+type TagCount struct {
+	Tag      string `db:"tag" json:"tag"`
+	Sessions int    `db:"sessions" json:"sessions"`
+}
+
+// UserTags lists the tags on the user's sessions outside the trash
+func (r *ChatRepository) UserTags(userID string) ([]TagCount, error) {
+	var tags []TagCount
+	query := `SELECT t.tag, COUNT(*) AS sessions FROM chat_session_tags t
+			  JOIN chat_sessions s ON s.id = t.session_id
+			  WHERE s.user_id = ? AND s.deleted_at IS NULL
+			  GROUP BY t.tag ORDER BY t.tag`
+
+	if err := r.db.Select(&tags, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SessionChange is an organisational change applied to several sessions.
+// Nil fields are left alone.
+type SessionChange struct {
+	FolderID   *string // "" = unfiled
+	Pinned     *bool
+	Archived   *bool
+	AddTags    []string
+	RemoveTags []string
+	SetTags    *[]string // replaces all tags
+	Delete     bool      // move to the trash
+}
+
+// UpdateSessions applies change to the user's live sessions among ids in
+// one transaction and returns how many sessions matched. None of these
+// changes count as activity, so updated_at is kept.
+func (r *ChatRepository) UpdateSessions(userID string, ids []string, change SessionChange) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to update chat sessions: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the matching sessions; later statements only touch these
+	query, args, err := sqlx.In(`SELECT id FROM chat_sessions WHERE user_id = ? AND deleted_at IS NULL AND id IN (?) FOR UPDATE`, userID, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update chat sessions: %w", err)
+	}
+	var owned []string
+	if err := tx.Select(&owned, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to update chat sessions: %w", err)
+	}
+	if len(owned) == 0 {
+		return 0, nil
+	}
+
+	var set []string
+	var setArgs []interface{}
+	if change.FolderID != nil {
+		set = append(set, "folder_id = ?")
+		setArgs = append(setArgs, nullString(*change.FolderID))
+	}
+	if change.Pinned != nil {
+		set = append(set, timestampToggle("pinned_at", *change.Pinned))
+	}
+	if change.Archived != nil {
+		set = append(set, timestampToggle("archived_at", *change.Archived))
+	}
+	if change.Delete {
+		set = append(set, "deleted_at = NOW()")
+	}
+	if len(set) > 0 {
+		set = append(set, "updated_at = updated_at")
+		if err := execIn(tx, `UPDATE chat_sessions SET `+strings.Join(set, ", ")+` WHERE id IN (?)`, setArgs, owned); err != nil {
+			return 0, fmt.Errorf("failed to update chat sessions: %w", err)
+		}
+	}
+
+	if change.SetTags != nil {
+		if err := execIn(tx, `DELETE FROM chat_session_tags WHERE session_id IN (?)`, nil, owned); err != nil {
+			return 0, fmt.Errorf("failed to update session tags: %w", err)
+		}
+		change.AddTags = *change.SetTags
+	}
+	if len(change.RemoveTags) > 0 {
+		query, args, err := sqlx.In(`DELETE FROM chat_session_tags WHERE session_id IN (?) AND tag IN (?)`, owned, change.RemoveTags)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update session tags: %w", err)
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return 0, fmt.Errorf("failed to update session tags: %w", err)
+		}
+	}
+	for _, tag := range change.AddTags {
+		err := execIn(tx, `INSERT IGNORE INTO chat_session_tags (session_id, tag, created_at) SELECT id, ?, NOW() FROM chat_sessions WHERE id IN (?)`,
+			[]interface{}{tag}, owned)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update session tags: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to update chat sessions: %w", err)
+	}
+	return len(owned), nil
+}
+
+// CountSessionTags returns the largest number of tags any of the sessions
+// would have after adding tags
+func (r *ChatRepository) CountSessionTags(ids []string, tags []string) (int, error) {
+	if len(ids) == 0 || len(tags) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In(`SELECT COALESCE(MAX(n), 0) FROM (
+				SELECT s.id, (SELECT COUNT(*) FROM chat_session_tags t WHERE t.session_id = s.id AND t.tag NOT IN (?)) AS n
+				FROM chat_sessions s WHERE s.id IN (?)
+			) counts`, tags, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count session tags: %w", err)
+	}
+
+	var n int
+	if err := r.db.Get(&n, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to count session tags: %w", err)
+	}
+	return n + len(tags), nil
+}
+
+// SoftDeleteSession moves the user's session to the trash. It reports
+// false when there was no such live session.
+func (r *ChatRepository) SoftDeleteSession(userID, sessionID string) (bool, error) {
+	// updated_at is kept so the trash lists sessions by last activity
+	query := `UPDATE chat_sessions SET deleted_at = NOW(), updated_at = updated_at
+			  WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+	return r.execAffected(query, "failed to delete chat session", sessionID, userID)
+}
+
+// RestoreSession takes the user's session out of the trash. It reports
+// false when the session is not in the trash (or already purged).
+func (r *ChatRepository) RestoreSession(userID, sessionID string) (bool, error) {
+	query := `UPDATE chat_sessions SET deleted_at = NULL, updated_at = updated_at
+			  WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL`
+
+	return r.execAffected(query, "failed to restore chat session", sessionID, userID)
+}
+
+// PurgeDeletedSessions permanently deletes up to limit sessions that were
+// moved to the trash before cutoff; their messages go with them. forget is
+// called with the ids of the embedded messages before the rows are deleted,
+// so their vectors can be dropped; when it fails nothing is deleted and the
+// batch is retried on the next purge.
+func (r *ChatRepository) PurgeDeletedSessions(cutoff time.Time, limit int, forget func(messageIDs []string) error) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge chat sessions: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the batch so a restore cannot race with the purge
+	var ids []string
+	query := `SELECT id FROM chat_sessions WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at LIMIT ? FOR UPDATE`
+	if err := tx.Select(&ids, query, cutoff, limit); err != nil {
+		return 0, fmt.Errorf("failed to purge chat sessions: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT DISTINCT e.message_id FROM chat_message_embeddings e
+			  JOIN chat_messages m ON m.id = e.message_id WHERE m.session_id IN (?)`, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge chat sessions: %w", err)
+	}
+	var messageIDs []string
+	if err := tx.Select(&messageIDs, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to list purged messages: %w", err)
+	}
+	if len(messageIDs) > 0 {
+		if err := forget(messageIDs); err != nil {
+			return 0, fmt.Errorf("failed to remove purged message vectors: %w", err)
+		}
+	}
+
+	if err := execIn(tx, `DELETE FROM chat_sessions WHERE id IN (?)`, nil, ids); err != nil {
+		return 0, fmt.Errorf("failed to purge chat sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to purge chat sessions: %w", err)
+	}
+	return int64(len(ids)), nil
+}
+
+func (r *ChatRepository) execAffected(query, errMsg string, args ...interface{}) (bool, error) {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errMsg, err)
+	}
+	return rows > 0, nil
+}
+
+// execIn runs query with args followed by ids for its single IN (?)
+func execIn(tx *sqlx.Tx, query string, args []interface{}, ids []string) error {
+	query, inArgs, err := sqlx.In(query, append(args, ids)...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, inArgs...)
+	return err
+}
+
+// timestampToggle sets column to now (on) or NULL, keeping an existing time
+func timestampToggle(column string, on bool) string {
+	if on {
+		return column + " = COALESCE(" + column + ", NOW())"
+	}
+	return column + " = NULL"
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 8, 30, 0, 123456789, time.FixedZone("WIB", 7*3600))
+	updated := created.Add(time.Hour)
+	pinned := updated
+	session := ChatSession{ID: "session-1", Title: "Résumé & 日本語 \"quotes\"", CreatedAt: created, UpdatedAt: updated}
+
+	tests := []struct {
+		name    string
+		q       SessionQuery
+		session ChatSession
+		want    SessionCursor
+	}{
+		{"default sort", SessionQuery{}, session, SessionCursor{Sort: SessionSortUpdated, Time: updated, ID: "session-1"}},
+		{"updated", SessionQuery{Sort: SessionSortUpdated, Asc: true}, session,
+			SessionCursor{Sort: SessionSortUpdated, Asc: true, Time: updated, ID: "session-1"}},
+		{"created", SessionQuery{Sort: SessionSortCreated}, session,
+			SessionCursor{Sort: SessionSortCreated, Time: created, ID: "session-1"}},
+		{"title", SessionQuery{Sort: SessionSortTitle, Asc: true}, session,
+			SessionCursor{Sort: SessionSortTitle, Asc: true, Title: session.Title, ID: "session-1"}},
+		{"pinned", SessionQuery{Sort: SessionSortCreated}, ChatSession{ID: "session-2", CreatedAt: created, PinnedAt: &pinned},
+			SessionCursor{Sort: SessionSortCreated, Pinned: true, Time: created, ID: "session-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewSessionCursor(tt.q, tt.session)
+			encoded := c.Encode()
+			if strings.ContainsAny(encoded, "+/=") {
+				t.Errorf("Encode = %q, not URL-safe", encoded)
+			}
+
+			got, err := ParseSessionCursor(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("Time = %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time, tt.want.Time = time.Time{}, time.Time{}
+			if *got != tt.want {
+				t.Errorf("cursor = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSessionCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	valid := SessionCursor{Sort: SessionSortTitle, Title: "a", ID: "session-1"}.Encode()
+
+	for name, cursor := range map[string]string{
+		"empty":             "",
+		"not base64":        "not a cursor!",
+		"padded base64":     base64.URLEncoding.EncodeToString([]byte(`{"s":"title","i":"xy"}`)),
+		"standard base64":   base64.StdEncoding.EncodeToString([]byte(`{"s":"title","k":"??>","i":"x"}`)),
+		"not JSON":          encode("session-1"),
+		"JSON array":        encode(`["title","session-1"]`),
+		"no id":             encode(`{"s":"title","k":"a"}`),
+		"wrong field types": encode(`{"s":"title","t":"yesterday","i":"x"}`),
+		"truncated":         valid[:len(valid)-4],
+	} {
+		if c, err := ParseSessionCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: ParseSessionCursor = %+v, %v; want ErrInvalidCursor", name, c, err)
+		}
+	}
+}
+
+// A cursor only continues the listing it was issued for. The check runs
+// before any query, so no database is needed.
+func TestListSessionsRejectsForeignCursor(t *testing.T) {
+	r := &ChatRepository{}
+	for _, tt := range []struct {
+		q     SessionQuery
+		after SessionCursor
+	}{
+		{SessionQuery{Sort: SessionSortTitle}, SessionCursor{Sort: SessionSortCreated, ID: "x"}},
+		{SessionQuery{Sort: SessionSortTitle}, SessionCursor{Sort: SessionSortTitle, Asc: true, ID: "x"}},
+		{SessionQuery{}, SessionCursor{ID: "x"}},
+		{SessionQuery{Asc: true}, SessionCursor{Sort: SessionSortUpdated, ID: "x"}},
+	} {
+		tt.q.After = &tt.after
+		if _, err := r.ListSessions("user-1", tt.q); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ListSessions(%+v) = %v, want ErrInvalidCursor", tt.q, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Team member roles
+const (
+	TeamRoleOwner  = "owner"
+	TeamRoleMember = "member"
+)
+
+// Team is a group of users that share prompt templates
+type Team struct {
+	ID        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedBy *string   `db:"created_by" json:"created_by"`
+	Role      string    `db:"role" json:"role,omitempty"` // the caller's role, set by ListForUser
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// TeamMember is a user in a team
+type TeamMember struct {
+	UserID    string    `db:"user_id" json:"user_id"`
+	Email     string    `db:"email" json:"email"`
+	Name      string    `db:"name" json:"name"`
+	Role      string    `db:"role" json:"role"`
+	CreatedAt time.Time `db:"created_at" json:"joined_at"`
+}
+
+// TeamRepository handles team database operations
+type TeamRepository struct {
+	db *DB
+}
+
+func NewTeamRepository(db *DB) *TeamRepository {
+	return &TeamRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *TeamRepository) WithContext(ctx context.Context) *TeamRepository {
+	return &TeamRepository{db: r.db.WithContext(ctx)}
+}
+
+// Create inserts the team with ownerID as its owner
+func (r *TeamRepository) Create(team *Team, ownerID string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to create team: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO teams (id, name, created_by, created_at, updated_at) VALUES (?, ?, ?, NOW(), NOW())`,
+		team.ID, team.Name, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to create team: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO team_members (team_id, user_id, role, created_at) VALUES (?, ?, ?, NOW())`,
+		team.ID, ownerID, TeamRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to add team owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create team: %w", err)
+	}
+	return nil
+}
+
+func (r *TeamRepository) GetByID(id string) (*Team, error) {
+	var team Team
+	query := `SELECT id, name, created_by, '' AS role, created_at, updated_at FROM teams WHERE id = ?`
+
+	err := r.db.Get(&team, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+
+	return &team, nil
+}
+
+// ListForUser returns the teams userID belongs to, with their role
+func (r *TeamRepository) ListForUser(userID string) ([]Team, error) {
+	var teams []Team
+	query := `SELECT t.id, t.name, t.created_by, m.role, t.created_at, t.updated_at
+			  FROM teams t JOIN team_members m ON m.team_id = t.id
+			  WHERE m.user_id = ? ORDER BY t.name`
+
+	if err := r.db.Select(&teams, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+
+	return teams, nil
+}
+
+// MemberRole returns userID's role in the team, or "" if not a member
+func (r *TeamRepository) MemberRole(teamID, userID string) (string, error) {
+	var role string
+	err := r.db.Get(&role, `SELECT role FROM team_members WHERE team_id = ? AND user_id = ?`, teamID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get team member: %w", err)
+	}
+
+	return role, nil
+}
+
+func (r *TeamRepository) Members(teamID string) ([]TeamMember, error) {
+	var members []TeamMember
+	query := `SELECT m.user_id, u.email, u.name, m.role, m.created_at
+			  FROM team_members m JOIN users u ON u.id = m.user_id
+			  WHERE m.team_id = ? ORDER BY m.role = 'owner' DESC, u.name`
+
+	if err := r.db.Select(&members, query, teamID); err != nil {
+		return nil, fmt.Errorf("failed to list team members: %w", err)
+	}
+
+	return members, nil
+}
+
+// SetMember adds userID to the team or changes their role
+func (r *TeamRepository) SetMember(teamID, userID, role string) error {
+	query := `INSERT INTO team_members (team_id, user_id, role, created_at) VALUES (?, ?, ?, NOW())
+			  ON DUPLICATE KEY UPDATE role = VALUES(role)`
+
+	if _, err := r.db.Exec(query, teamID, userID, role); err != nil {
+		return fmt.Errorf("failed to add team member: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TeamRepository) RemoveMember(teamID, userID string) error {
+	_, err := r.db.Exec(`DELETE FROM team_members WHERE team_id = ? AND user_id = ?`, teamID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove team member: %w", err)
+	}
+
+	return nil
+}
+
+// CountOwners returns how many owners the team has
+func (r *TeamRepository) CountOwners(teamID string) (int, error) {
+	var n int
+	err := r.db.Get(&n, `SELECT COUNT(*) FROM team_members WHERE team_id = ? AND role = ?`, teamID, TeamRoleOwner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count team owners: %w", err)
+	}
+
+	return n, nil
+}
+
+// Delete removes the team; its templates become private to their owners
+func (r *TeamRepository) Delete(id string) error {
+	if _, err := r.db.Exec(`DELETE FROM teams WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gryt-backend/internal/models"
+)
+
+// PromptTemplate is a reusable prompt with {{variable}} placeholders. Body
+// and Variables are those of CurrentVersion. TeamID nil means private to
+// the owner.
+type PromptTemplate struct {
+	ID             string                   `db:"id" json:"id"`
+	OwnerID        string                   `db:"owner_id" json:"owner_id"`
+	TeamID         *string                  `db:"team_id" json:"team_id"`
+	Name           string                   `db:"name" json:"name"`
+	Description    string                   `db:"description" json:"description"`
+	CurrentVersion int                      `db:"current_version" json:"version"`
+	Body           string                   `db:"body" json:"body"`
+	Variables      models.TemplateVariables `db:"variables" json:"variables"`
+	CreatedAt      time.Time                `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time                `db:"updated_at" json:"updated_at"`
+}
+
+// TemplateVersion is one saved revision of a template's body and variables
+type TemplateVersion struct {
+	TemplateID string                   `db:"template_id" json:"template_id"`
+	Version    int                      `db:"version" json:"version"`
+	Body       string                   `db:"body" json:"body"`
+	Variables  models.TemplateVariables `db:"variables" json:"variables"`
+	CreatedBy  *string                  `db:"created_by" json:"created_by"`
+	CreatedAt  time.Time                `db:"created_at" json:"created_at"`
+}
+
+const templateSelect = `SELECT t.id, t.owner_id, t.team_id, t.name, t.description, t.current_version,
+			  v.body, v.variables, t.created_at, t.updated_at
+			  FROM prompt_templates t
+			  JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.current_version`
+
+// TemplateRepository handles prompt template database operations
+type TemplateRepository struct {
+	db *DB
+}
+
+func NewTemplateRepository(db *DB) *TemplateRepository {
+	return &TemplateRepository{db: db}
+}
+
+// WithContext returns a copy of the repository bound to ctx
+func (r *TemplateRepository) WithContext(ctx context.Context) *TemplateRepository {
+	return &TemplateRepository{db: r.db.WithContext(ctx)}
+}
+
+// Create inserts the template and its first version
+func (r *TemplateRepository) Create(tmpl *PromptTemplate) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	defer tx.Rollback()
+
+	tmpl.CurrentVersion = 1
+	_, err = tx.Exec(`INSERT INTO prompt_templates (id, owner_id, team_id, name, description, current_version, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, 1, NOW(), NOW())`,
+		tmpl.ID, tmpl.OwnerID, tmpl.TeamID, tmpl.Name, tmpl.Description)
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO prompt_template_versions (template_id, version, body, variables, created_by, created_at)
+			  VALUES (?, 1, ?, ?, ?, NOW())`,
+		tmpl.ID, tmpl.Body, tmpl.Variables, tmpl.OwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to create template version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	return nil
+}
+
+func (r *TemplateRepository) GetByID(id string) (*PromptTemplate, error) {
+	var tmpl PromptTemplate
+	err := r.db.Get(&tmpl, templateSelect+` WHERE t.id = ?`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	return &tmpl, nil
+}
+
+// ListVisible returns the user's own templates and those shared with
+// their teams, most recently updated first
+func (r *TemplateRepository) ListVisible(userID string) ([]PromptTemplate, error) {
+	var templates []PromptTemplate
+	query := templateSelect + `
+			  WHERE t.owner_id = ?
+			     OR t.team_id IN (SELECT team_id FROM team_members WHERE user_id = ?)
+			  ORDER BY t.updated_at DESC`
+
+	if err := r.db.Select(&templates, query, userID, userID); err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	return templates, nil
+}
+
+// Update saves name, description and team. When newVersion is set the body
+// and variables are stored as the next version, which becomes current and
+// is written to tmpl.CurrentVersion.
+func (r *TemplateRepository) Update(tmpl *PromptTemplate, newVersion bool, updatedBy string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.Get(&current, `SELECT current_version FROM prompt_templates WHERE id = ? FOR UPDATE`, tmpl.ID); err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+
+	if newVersion {
+		current++
+		_, err = tx.Exec(`INSERT INTO prompt_template_versions (template_id, version, body, variables, created_by, created_at)
+				  VALUES (?, ?, ?, ?, ?, NOW())`,
+			tmpl.ID, current, tmpl.Body, tmpl.Variables, updatedBy)
+		if err != nil {
+			return fmt.Errorf("failed to create template version: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE prompt_templates SET name = ?, description = ?, team_id = ?, current_version = ?, updated_at = NOW()
+			  WHERE id = ?`,
+		tmpl.Name, tmpl.Description, tmpl.TeamID, current, tmpl.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	tmpl.CurrentVersion = current
+	return nil
+}
+
+// Versions lists every version of a template, newest first
+func (r *TemplateRepository) Versions(templateID string) ([]TemplateVersion, error) {
+	var versions []TemplateVersion
+	query := `SELECT template_id, version, body, variables, created_by, created_at
+			  FROM prompt_template_versions WHERE template_id = ? ORDER BY version DESC`
+
+	if err := r.db.Select(&versions, query, templateID); err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (r *TemplateRepository) GetVersion(templateID string, version int) (*TemplateVersion, error) {
+	var v TemplateVersion
+	query := `SELECT template_id, version, body, variables, created_by, created_at
+			  FROM prompt_template_versions WHERE template_id = ? AND version = ?`
+
+	err := r.db.Get(&v, query, templateID, version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get template version: %w", err)
+	}
+
+	return &v, nil
+}
+
+func (r *TemplateRepository) Delete(id string) error {
+	if _, err := r.db.Exec(`DELETE FROM prompt_templates WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package extract
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Chunk is a piece of a page's text
+type Chunk struct {
+	Page int
+	Text string
+}
+
+// Split cuts the document into chunks of at most size runes, each
+// starting about overlap runes before the previous one ended. Cuts prefer
+// paragraph, line, sentence and word boundaries in the last half of a
+// chunk. Chunks never span pages, so each can be cited by page.
+func Split(doc *Document, size, overlap int) []Chunk {
+	if overlap >= size/2 {
+		overlap = size / 2
+	}
+
+	var chunks []Chunk
+	for _, page := range doc.Pages {
+		text := []rune(page.Text)
+		for start := 0; start < len(text); {
+			end := len(text)
+			if end-start > size {
+				end = cut(text, start+size/2, start+size)
+			}
+			if piece := strings.TrimSpace(string(text[start:end])); piece != "" {
+				chunks = append(chunks, Chunk{Page: page.Number, Text: piece})
+			}
+			if end == len(text) {
+				break
+			}
+
+			next := max(end-overlap, start+1)
+			// Do not start in the middle of a word
+			for i := next; i < end; i++ {
+				if unicode.IsSpace(text[i-1]) {
+					next = i
+					break
+				}
+			}
+			start = next
+		}
+	}
+	return chunks
+}
+
+// cut returns where to end a chunk that may end anywhere in text[lo:hi]
+func cut(text []rune, lo, hi int) int {
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		if i := lastIndex(text[lo:hi], []rune(sep)); i >= 0 {
+			return lo + i + len([]rune(sep))
+		}
+	}
+	return hi
+}
+
+func lastIndex(text, sep []rune) int {
+	for i := len(text) - len(sep); i >= 0; i-- {
+		if string(text[i:i+len(sep)]) == string(sep) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,378 @@
+// Package extract turns uploaded documents into plain text, page by page,
+// and splits that text into chunks for embedding. PDF, DOCX and XLSX are
+// read natively, without external tools.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported document type")
+	ErrEncrypted   = errors.New("document is encrypted")
+)
+
+// maxUnpacked caps what one PDF or Office file may decompress to in total.
+// The limits per stream and per zip entry alone would let a file of many
+// small compressed parts unpack to gigabytes.
+const maxUnpacked = 256 << 20
+
+// unpackLimitError reports a stream, entry or whole document that unpacks
+// to more than its limit
+type unpackLimitError struct {
+	what  string
+	limit int64
+}
+
+func (e *unpackLimitError) Error() string {
+	return fmt.Sprintf("%s is larger than %d MB unpacked", e.what, e.limit>>20)
+}
+
+// unpackBudget counts the bytes a document has decompressed. The zero value
+// has the whole of maxUnpacked left.
+type unpackBudget struct {
+	used int64
+}
+
+// read reads r to the end. It fails when r holds more than limit bytes or
+// more than is left of the budget; whatever was read is charged either way.
+// A read error is returned along with the bytes read before it.
+func (b *unpackBudget) read(r io.Reader, limit int64, what string) ([]byte, error) {
+	n := min(limit, maxUnpacked-b.used)
+	data, err := io.ReadAll(io.LimitReader(r, n+1))
+	b.used += int64(len(data))
+	if int64(len(data)) > n {
+		if n < limit {
+			return nil, b.err()
+		}
+		return nil, &unpackLimitError{what: what, limit: limit}
+	}
+	return data, err
+}
+
+// err returns an error once the document has run out of budget
+func (b *unpackBudget) err() error {
+	if b.used > maxUnpacked {
+		return &unpackLimitError{what: "document", limit: maxUnpacked}
+	}
+	return nil
+}
+
+// Document kinds
+const (
+	KindText     = "text"
+	KindMarkdown = "markdown"
+	KindHTML     = "html"
+	KindCSV      = "csv"
+	KindJSON     = "json"
+	KindPDF      = "pdf"
+	KindDOCX     = "docx"
+	KindXLSX     = "xlsx"
+)
+
+// MIME types of the Office formats
+const (
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Page is the text of one page. Formats without pages are a single page 1;
+// plain text is paged by form feeds, DOCX by its page breaks and XLSX has a
+// page per sheet.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// Table is a table found on a page, as rows of cell texts. Its text is also
+// part of the page, one row per line with cells separated by " | ".
+type Table struct {
+	Page int
+	Rows [][]string
+}
+
+// Columns returns the width of the widest row
+func (t *Table) Columns() int {
+	n := 0
+	for _, row := range t.Rows {
+		n = max(n, len(row))
+	}
+	return n
+}
+
+// Document is the extracted text of an upload
+type Document struct {
+	Name   string
+	Kind   string
+	Pages  []Page
+	Tables []Table
+}
+
+// Text returns all pages, separated by blank lines
+func (d *Document) Text() string {
+	texts := make([]string, 0, len(d.Pages))
+	for _, p := range d.Pages {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// PagedText returns all pages, each headed by a "--- Page n ---" line when
+// there is more than one
+func (d *Document) PagedText() string {
+	if len(d.Pages) < 2 {
+		return d.Text()
+	}
+	var b strings.Builder
+	for i, p := range d.Pages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "--- Page %d ---\n%s", p.Number, p.Text)
+	}
+	return b.String()
+}
+
+// Words counts the words of all pages
+func (d *Document) Words() int {
+	n := 0
+	for _, p := range d.Pages {
+		n += CountWords(p.Text)
+	}
+	return n
+}
+
+// Language guesses the language of the document, see Language
+func (d *Document) Language() string {
+	return Language(d.Text())
+}
+
+// Kind returns the document kind for a MIME type, falling back to the file
+// name's extension when the type is missing or generic; "" when unsupported
+func Kind(name, mimeType string) string {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch mediaType {
+	case "text/plain":
+		// Browsers send text/plain for many text formats, the extension is
+		// more specific
+		if kind := kindByExt(name); kind != "" {
+			return kind
+		}
+		return KindText
+	case "text/markdown", "text/x-markdown":
+		return KindMarkdown
+	case "text/html", "application/xhtml+xml":
+		return KindHTML
+	case "text/csv", "application/csv":
+		return KindCSV
+	case "application/json":
+		return KindJSON
+	case "application/pdf":
+		return KindPDF
+	case mimeDOCX:
+		return KindDOCX
+	case mimeXLSX:
+		return KindXLSX
+	}
+	return kindByExt(name)
+}
+
+// MimeType returns the MIME type of a document kind
+func MimeType(kind string) string {
+	switch kind {
+	case KindMarkdown:
+		return "text/markdown"
+	case KindHTML:
+		return "text/html"
+	case KindCSV:
+		return "text/csv"
+	case KindJSON:
+		return "application/json"
+	case KindPDF:
+		return "application/pdf"
+	case KindDOCX:
+		return mimeDOCX
+	case KindXLSX:
+		return mimeXLSX
+	}
+	return "text/plain"
+}
+
+func kindByExt(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".txt", ".text", ".log":
+		return KindText
+	case ".md", ".markdown":
+		return KindMarkdown
+	case ".html", ".htm":
+		return KindHTML
+	case ".csv":
+		return KindCSV
+	case ".json":
+		return KindJSON
+	case ".pdf":
+		return KindPDF
+	case ".docx":
+		return KindDOCX
+	case ".xlsx":
+		return KindXLSX
+	}
+	return ""
+}
+
+// sniffKind recognises the binary formats by their content, for uploads
+// without a usable type or extension
+func sniffKind(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return KindPDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		if zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+			for _, f := range zr.File {
+				switch f.Name {
+				case "word/document.xml":
+					return KindDOCX
+				case "xl/workbook.xml":
+					return KindXLSX
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Extract reads the text of data, whose type is given by mimeType or the
+// extension of name, or else recognised from the content
+func Extract(name, mimeType string, data []byte) (doc *Document, err error) {
+	// Files come from users and the parsers are hand-written: a bug in one
+	// must fail the file, not the process
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("failed to read %s: %v", name, r)
+		}
+	}()
+	return extract(name, mimeType, data)
+}
+
+func extract(name, mimeType string, data []byte) (*Document, error) {
+	kind := Kind(name, mimeType)
+	if kind == "" {
+		kind = sniffKind(data)
+	}
+	if kind == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+
+	switch kind {
+	case KindPDF:
+		return extractPDF(name, data)
+	case KindDOCX:
+		return extractDOCX(name, data)
+	case KindXLSX:
+		return extractXLSX(name, data)
+	}
+
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%s is not valid UTF-8 text", name)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	doc := &Document{Name: name, Kind: kind}
+	switch kind {
+	case KindText:
+		for i, text := range strings.Split(string(data), "\f") {
+			doc.Pages = append(doc.Pages, Page{Number: i + 1, Text: cleanText(text)})
+		}
+	case KindMarkdown:
+		doc.Pages = []Page{{Number: 1, Text: cleanText(string(data))}}
+		doc.Tables = markdownTables(doc.Pages[0].Text)
+	case KindHTML:
+		doc.Pages = []Page{{Number: 1, Text: cleanText(htmlText(string(data)))}}
+		doc.Tables = htmlTables(string(data))
+	case KindCSV:
+		rows, err := csvRows(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		doc.Pages = []Page{{Number: 1, Text: tableText(rows)}}
+		if len(rows) > 0 {
+			doc.Tables = []Table{{Page: 1, Rows: rows}}
+		}
+	case KindJSON:
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "  "); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		doc.Pages = []Page{{Number: 1, Text: out.String()}}
+	}
+	return doc, nil
+}
+
+var (
+	htmlDropped = regexp.MustCompile(`(?is)<(script|style|noscript|template)\b.*?</(script|style|noscript|template)\s*>|<!--.*?-->`)
+	htmlBreak   = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/tr|/h[1-6]|/section|/article|/blockquote|/pre)\b[^>]*>`)
+	htmlCell    = regexp.MustCompile(`(?i)</t[dh]\s*>`)
+	htmlTag     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlText strips markup, keeping block boundaries as line breaks
+func htmlText(s string) string {
+	s = htmlDropped.ReplaceAllString(s, "")
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlCell.ReplaceAllString(s, "\t")
+	s = htmlTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+// csvRows reads the records of a CSV file, trimming every cell
+func csvRows(data []byte) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+	}
+	return records, nil
+}
+
+// tableText renders rows as lines of cells separated by " | "
+func tableText(rows [][]string) string {
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = strings.Join(row, " | ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	lineSpaces = regexp.MustCompile(`[ \t\r\v]+\n`)
+)
+
+// cleanText drops trailing spaces and collapses runs of blank lines
+func cleanText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = lineSpaces.ReplaceAllString(s, "\n")
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
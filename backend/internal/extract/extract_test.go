@@ -0,0 +1,300 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPDF builds a PDF with one page per content stream, all in Helvetica.
+// Streams are compressed when flate is set.
+func testPDF(flate bool, contents ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	b.WriteString("1 0 obj\n<</Type/Catalog/Pages 2 0 R>>\nendobj\n")
+
+	kids := make([]string, len(contents))
+	for i := range contents {
+		kids[i] = fmt.Sprintf("%d 0 R", 10+2*i)
+	}
+	fmt.Fprintf(&b, "2 0 obj\n<</Type/Pages/Kids[%s]/Count %d/Resources<</Font<</F1 3 0 R>>>>>>\nendobj\n", strings.Join(kids, " "), len(contents))
+	b.WriteString("3 0 obj\n<</Type/Font/Subtype/Type1/BaseFont/Helvetica/Encoding/WinAnsiEncoding>>\nendobj\n")
+
+	for i, content := range contents {
+		fmt.Fprintf(&b, "%d 0 obj\n<</Type/Page/Parent 2 0 R/Contents %d 0 R>>\nendobj\n", 10+2*i, 11+2*i)
+		data, filter := []byte(content), ""
+		if flate {
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			zw.Write(data)
+			zw.Close()
+			data, filter = z.Bytes(), "/Filter/FlateDecode"
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n<</Length %d%s>>\nstream\n", 11+2*i, len(data), filter)
+		b.Write(data)
+		b.WriteString("\nendstream\nendobj\n")
+	}
+	b.WriteString("trailer\n<</Root 1 0 R>>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// testZip builds a zip archive of the given files
+func testZip(files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return b.Bytes()
+}
+
+func testDOCX(body string) []byte {
+	return testZip(map[string]string{
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body + `</w:body></w:document>`,
+	})
+}
+
+func testXLSX() []byte {
+	return testZip(map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Sales" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Region</t></si><si><t>Total</t></si><si><r><t>No</t></r><r><t>rth</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>42</v></c></row>` +
+			`<row r="3"><c r="A3" t="inlineStr"><is><t>South</t></is></c><c r="B3" t="b"><v>1</v></c></row>` +
+			`</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData/></worksheet>`,
+	})
+}
+
+func pageTexts(doc *Document) []string {
+	texts := make([]string, len(doc.Pages))
+	for i, p := range doc.Pages {
+		texts[i] = p.Text
+	}
+	return texts
+}
+
+func TestExtractPDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "lines and pages",
+			data: testPDF(false,
+				"BT /F1 12 Tf 72 720 Td (Hello PDF) Tj 0 -14 Td (Second line) Tj ET",
+				"BT /F1 12 Tf 72 720 Td (Page two) Tj ET"),
+			want: []string{"Hello PDF\nSecond line", "Page two"},
+		},
+		{
+			name: "flate stream",
+			data: testPDF(true, "BT /F1 12 Tf 72 720 Td (Compressed) Tj ET"),
+			want: []string{"Compressed"},
+		},
+		{
+			name: "TJ kerning and gaps",
+			data: testPDF(false, "BT /F1 10 Tf 72 720 Td [(Ker) 20 (ned) -600 (word)] TJ ET"),
+			want: []string{"Kerned word"},
+		},
+		{
+			name: "escapes and hex strings",
+			data: testPDF(false, `BT /F1 10 Tf 72 720 Td (a\(b\) \101) Tj 0 -20 Td <43616665> Tj ET`),
+			want: []string{"a(b) A\nCafe"},
+		},
+		{
+			name: "fake bold drawn twice",
+			data: testPDF(false, "BT /F1 12 Tf 72 720 Td (Bold) Tj ET BT /F1 12 Tf 72.3 720 Td (Bold) Tj ET"),
+			want: []string{"Bold"},
+		},
+		{
+			name: "page without text",
+			data: testPDF(false, "0 0 100 100 re f"),
+			want: []string{""},
+		},
+		{
+			name:    "encrypted",
+			data:    []byte("%PDF-1.7\n1 0 obj\n<</Type/Catalog>>\nendobj\ntrailer\n<</Root 1 0 R/Encrypt 5 0 R>>\n"),
+			wantErr: ErrEncrypted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Extract("test.pdf", "application/pdf", tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pageTexts(doc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Truncated and damaged PDFs fail or come out empty, they must not panic
+func TestExtractPDFDamaged(t *testing.T) {
+	full := testPDF(false, "BT /F1 12 Tf 72 720 Td (Hello) Tj ET")
+	inputs := []string{
+		"%PDF-1.7\n1 0 obj<</Length 5>>",
+		"%PDF-1.7\n1 0 obj<</Length 5>> stream",
+		"%PDF-1.7\n1 0 obj<</Length 1e300>> stream\nabc",
+		"%PDF-1.7\n1 0 obj <",
+		"%PDF-1.7\n1 0 obj <</A <4142",
+		"%PDF-1.7\n1 0 obj (unterminated \\",
+		"%PDF-1.7\n1 0 obj <</Type/ObjStm/N 1e300/First 1e300/Length 3>> stream\nabc\nendstream",
+		"%PDF-1.7\n1 0 obj <</Type/Page/Contents 2 0 R>> endobj 2 0 obj <</Length 6>> stream\nID EI\nendstream",
+		"%PDF-1.7\n" + strings.Repeat("[", 10000),
+	}
+	for i := 1; i < len(full); i += 7 {
+		inputs = append(inputs, string(full[:i]))
+	}
+
+	for _, in := range inputs {
+		// extract, not Extract: a panic must fail the test, not be recovered
+		extract("damaged.pdf", "application/pdf", []byte(in))
+	}
+}
+
+func TestExtractDOCX(t *testing.T) {
+	data := testDOCX(
+		`<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:t xml:space="preserve"> world</w:t></w:r></w:p>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Qty</w:t></w:r></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>Apple</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>3</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+			`<w:p><w:r><w:br w:type="page"/><w:t>Next page</w:t></w:r></w:p>`)
+
+	doc, err := Extract("test.docx", mimeDOCX, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Hello world\n\nName | Qty\nApple | 3", "Next page"}; !reflect.DeepEqual(pageTexts(doc), want) {
+		t.Errorf("pages = %q, want %q", pageTexts(doc), want)
+	}
+	wantTables := []Table{{Page: 1, Rows: [][]string{{"Name", "Qty"}, {"Apple", "3"}}}}
+	if !reflect.DeepEqual(doc.Tables, wantTables) {
+		t.Errorf("tables = %q, want %q", doc.Tables, wantTables)
+	}
+}
+
+func TestExtractXLSX(t *testing.T) {
+	doc, err := Extract("test.xlsx", "", testXLSX())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Kind != KindXLSX {
+		t.Errorf("kind = %q, want %q", doc.Kind, KindXLSX)
+	}
+	want := []string{"Sheet: Sales\nRegion | Total\nNorth |  | 42\nSouth | TRUE", "Sheet: Empty"}
+	if got := pageTexts(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %q, want %q", got, want)
+	}
+	wantTables := []Table{{Page: 1, Rows: [][]string{{"Region", "Total"}, {"North", "", "42"}, {"South", "TRUE"}}}}
+	if !reflect.DeepEqual(doc.Tables, wantTables) {
+		t.Errorf("tables = %q, want %q", doc.Tables, wantTables)
+	}
+}
+
+func TestExtractOfficeDamaged(t *testing.T) {
+	for _, data := range [][]byte{testDOCX(""), testXLSX()} {
+		for i := 1; i < len(data); i += 11 {
+			extract("damaged.xlsx", mimeXLSX, data[:i])
+		}
+	}
+}
+
+// Each stream and zip entry is within its own limit, but together they
+// unpack to more than one document may
+func TestUnpackBudget(t *testing.T) {
+	padding := strings.Repeat(" ", maxPDFStream-1)
+	repeats := maxUnpacked/len(padding) + 1
+
+	t.Run("pdf", func(t *testing.T) {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write([]byte(padding))
+		zw.Close()
+
+		var b bytes.Buffer
+		b.WriteString("%PDF-1.7\n1 0 obj\n<</Type/Catalog/Pages 2 0 R>>\nendobj\n")
+		b.WriteString("2 0 obj\n<</Type/Pages/Kids[3 0 R]/Count 1>>\nendobj\n")
+		b.WriteString("3 0 obj\n<</Type/Page/Parent 2 0 R>>\nendobj\n")
+		// Empty object streams, inflated but not parsed
+		for i := range repeats {
+			fmt.Fprintf(&b, "%d 0 obj\n<</Type/ObjStm/N 0/First 0/Length %d/Filter/FlateDecode>>\nstream\n", 10+i, z.Len())
+			b.Write(z.Bytes())
+			b.WriteString("\nendstream\nendobj\n")
+		}
+		b.WriteString("trailer\n<</Root 1 0 R>>\n%%EOF\n")
+
+		_, err := Extract("many.pdf", "", b.Bytes())
+		var limitErr *unpackLimitError
+		if !errors.As(err, &limitErr) || limitErr.what != "document" {
+			t.Errorf("err = %v, want the document limit", err)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		files := map[string]string{}
+		for i := range repeats {
+			files[fmt.Sprintf("part%d.xml", i)] = padding
+		}
+		archive, err := openZip("many.xlsx", testZip(files))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range repeats {
+			_, err = archive.read(fmt.Sprintf("part%d.xml", i))
+			if err != nil {
+				break
+			}
+		}
+		var limitErr *unpackLimitError
+		if !errors.As(err, &limitErr) || limitErr.what != "document" {
+			t.Errorf("err = %v, want the document limit", err)
+		}
+	})
+}
+
+func FuzzExtract(f *testing.F) {
+	f.Add("doc.pdf", testPDF(false, "BT /F1 12 Tf 72 720 Td (Hello) Tj 0 -14 Td [(A) 200 (B)] TJ ET"))
+	f.Add("doc.pdf", testPDF(true, "BT /F1 12 Tf 1 0 0 1 72 700 Tm (Compressed) Tj ET"))
+	f.Add("doc.pdf", []byte("%PDF-1.7\n1 0 obj<</Length 5>>"))
+	f.Add("doc.docx", testDOCX(`<w:p><w:r><w:t>Hello</w:t></w:r></w:p>`))
+	f.Add("doc.xlsx", testXLSX())
+	f.Add("doc.csv", []byte("a,b\n1,2\n"))
+	f.Add("doc.html", []byte("<table><tr><td>a</td></tr></table>"))
+
+	f.Fuzz(func(t *testing.T, name string, data []byte) {
+		start := time.Now()
+		doc, err := extract(name, "", data)
+		if err != nil {
+			return
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("took %v on %d bytes", elapsed, len(data))
+		}
+		Split(doc, 200, 20)
+	})
+}
@@ -0,0 +1,159 @@
+package extract
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageSample is how much text Language looks at
+const languageSample = 20000
+
+// scriptLanguages are the languages told apart by their script alone
+var scriptLanguages = []struct {
+	code  string
+	table *unicode.RangeTable
+}{
+	{"ko", unicode.Hangul},
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"el", unicode.Greek},
+	{"th", unicode.Thai},
+	{"hi", unicode.Devanagari},
+}
+
+// stopwords are frequent short words of the languages written in Latin
+// script; a language is recognised by how many of its words the text uses
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "as", "was", "on", "are", "this", "be", "by", "have", "from", "not"},
+	"id": {"yang", "dan", "di", "ini", "itu", "dengan", "untuk", "dari", "tidak", "dalam", "akan", "pada", "adalah", "ke", "juga", "kami", "bisa", "ada", "atau", "saya"},
+	"es": {"el", "la", "de", "que", "y", "los", "las", "en", "es", "por", "con", "para", "una", "del", "se", "no", "lo", "como", "más", "pero"},
+	"fr": {"le", "la", "les", "de", "et", "des", "est", "un", "une", "du", "que", "en", "pour", "pas", "dans", "qui", "sur", "au", "avec", "ce"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von", "sich", "des", "auf", "für", "im", "dem", "auch", "es"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "no", "na", "por", "é", "se"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "in", "è", "sono", "del", "della", "con", "si", "le", "lo", "gli", "ma"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "die", "er", "ook", "aan", "maar", "om", "als"},
+}
+
+var languageNames = map[string]string{
+	"en": "English", "id": "Indonesian", "es": "Spanish", "fr": "French", "de": "German",
+	"pt": "Portuguese", "it": "Italian", "nl": "Dutch", "zh": "Chinese", "ja": "Japanese",
+	"ko": "Korean", "ru": "Russian", "ar": "Arabic", "he": "Hebrew", "el": "Greek",
+	"th": "Thai", "hi": "Hindi",
+}
+
+// stopwordLanguages indexes stopwords by word
+var stopwordLanguages = func() map[string][]string {
+	index := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			index[w] = append(index[w], lang)
+		}
+	}
+	return index
+}()
+
+// Language guesses the language of text as an ISO 639-1 code: by script
+// when most letters are not Latin, else by the common words it uses. It
+// returns "" when there is too little text to tell.
+func Language(text string) string {
+	if len(text) > languageSample {
+		text = strings.ToValidUTF8(text[:languageSample], "")
+	}
+
+	var letters, latin, han, kana int
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.table, r) {
+					scripts[s.code]++
+					break
+				}
+			}
+		}
+	}
+	if letters < 20 {
+		return ""
+	}
+
+	if latin*2 < letters {
+		if kana > 0 && kana*10 >= han {
+			return "ja"
+		}
+		best, count := "", han
+		if han > 0 {
+			best = "zh"
+		}
+		for _, s := range scriptLanguages {
+			if scripts[s.code] > count {
+				best, count = s.code, scripts[s.code]
+			}
+		}
+		return best
+	}
+
+	hits := make(map[string]int)
+	words := 0
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		words++
+		for _, lang := range stopwordLanguages[w] {
+			hits[lang]++
+		}
+	}
+
+	best, count := "", 0
+	for _, lang := range []string{"en", "id", "es", "fr", "de", "pt", "it", "nl"} {
+		if hits[lang] > count {
+			best, count = lang, hits[lang]
+		}
+	}
+	// A few hits in a long text are names or loanwords, not the language
+	if count < 3 || count*20 < words {
+		return ""
+	}
+	return best
+}
+
+// LanguageName returns the English name of a language code from Language,
+// or the code itself
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// CountWords counts the words of text. Chinese and Japanese are written
+// without spaces, so each of their characters counts as a word.
+func CountWords(text string) int {
+	n := 0
+	for _, field := range strings.Fields(text) {
+		word := false
+		for _, r := range field {
+			switch {
+			case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+				n++
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				word = true
+			}
+		}
+		if word {
+			n++
+		}
+	}
+	return n
+}
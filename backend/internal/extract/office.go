@@ -0,0 +1,488 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Limits on Office files, which are zip archives and could unpack to far
+// more than their upload size
+const (
+	maxZipEntry    = 64 << 20
+	maxSheetColumn = 1024
+)
+
+// zipArchive is an open Office file. Its entries share one unpack budget,
+// so a file of many entries cannot add up to more than maxUnpacked.
+type zipArchive struct {
+	files    map[string]*zip.File
+	unpacked unpackBudget
+}
+
+// openZip opens an Office file and indexes its entries by name
+func openZip(name string, data []byte) (*zipArchive, error) {
+	// Password protected Office files are compound files, as are the old
+	// binary .doc and .xls
+	if bytes.HasPrefix(data, []byte("\xd0\xcf\x11\xe0")) {
+		return nil, fmt.Errorf("%w: %s is password protected or an old binary Office file", ErrUnsupported, name)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return &zipArchive{files: files}, nil
+}
+
+// read returns an entry's bytes, or nil when the entry does not exist
+func (a *zipArchive) read(name string) ([]byte, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer r.Close()
+
+	data, err := a.unpacked.read(r, maxZipEntry, name)
+	var limitErr *unpackLimitError
+	if errors.As(err, &limitErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// extractDOCX reads the body of a Word document. Pages end at explicit page
+// breaks and where Word last broke pages when it saved the file; tables are
+// kept as rows of cells.
+func extractDOCX(name string, data []byte) (*Document, error) {
+	archive, err := openZip(name, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := archive.read("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("%s has no word/document.xml", name)
+	}
+
+	w := &docxWriter{doc: &Document{Name: name, Kind: KindDOCX}, page: 1}
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			w.start(t)
+		case xml.EndElement:
+			w.end(t.Name.Local)
+		case xml.CharData:
+			if w.inText {
+				w.write(string(t))
+			}
+		}
+	}
+	w.breakPage()
+	if len(w.doc.Pages) == 0 {
+		w.doc.Pages = []Page{{Number: 1}}
+	}
+	return w.doc, nil
+}
+
+// docxWriter collects the text of a document.xml as it is decoded
+type docxWriter struct {
+	doc    *Document
+	page   int
+	text   strings.Builder // the current page
+	tables []*docxTable    // open tables, innermost last
+	inText bool            // inside <w:t>
+}
+
+// docxTable is a table being read: finished rows and the current row and
+// cell
+type docxTable struct {
+	rows [][]string
+	row  []string
+	cell strings.Builder
+}
+
+func (w *docxWriter) write(s string) {
+	if n := len(w.tables); n > 0 {
+		w.tables[n-1].cell.WriteString(s)
+		return
+	}
+	w.text.WriteString(s)
+}
+
+func (w *docxWriter) start(t xml.StartElement) {
+	switch t.Name.Local {
+	case "t":
+		w.inText = true
+	case "tab":
+		// Tab stops in paragraph properties have a position, tabs in runs
+		// do not
+		if attr(t, "pos") == "" {
+			w.write("\t")
+		}
+	case "br", "cr":
+		if attr(t, "type") == "page" {
+			w.breakPage()
+		} else {
+			w.write("\n")
+		}
+	case "lastRenderedPageBreak":
+		w.breakPage()
+	case "tbl":
+		w.tables = append(w.tables, &docxTable{})
+	case "tr":
+		if n := len(w.tables); n > 0 {
+			w.tables[n-1].row = nil
+		}
+	case "tc":
+		if n := len(w.tables); n > 0 {
+			w.tables[n-1].cell.Reset()
+		}
+	}
+}
+
+func (w *docxWriter) end(name string) {
+	n := len(w.tables)
+	switch name {
+	case "t":
+		w.inText = false
+	case "p":
+		if n > 0 {
+			w.tables[n-1].cell.WriteString(" ")
+		} else {
+			w.text.WriteString("\n")
+		}
+	case "tc":
+		if n > 0 {
+			t := w.tables[n-1]
+			t.row = append(t.row, strings.Join(strings.Fields(t.cell.String()), " "))
+		}
+	case "tr":
+		if n > 0 {
+			t := w.tables[n-1]
+			t.rows = append(t.rows, t.row)
+		}
+	case "tbl":
+		if n == 0 {
+			return
+		}
+		t := w.tables[n-1]
+		w.tables = w.tables[:n-1]
+		if len(t.rows) == 0 {
+			return
+		}
+		if len(w.tables) > 0 {
+			// A nested table becomes text of the outer table's cell
+			w.write(" " + strings.ReplaceAll(tableText(t.rows), "\n", " / ") + " ")
+			return
+		}
+		w.doc.Tables = append(w.doc.Tables, Table{Page: w.page, Rows: t.rows})
+		w.text.WriteString("\n" + tableText(t.rows) + "\n\n")
+	}
+}
+
+// breakPage ends the current page. Empty pages are not kept, so a break
+// right after another one does not add a page.
+func (w *docxWriter) breakPage() {
+	if text := cleanText(w.text.String()); text != "" {
+		w.doc.Pages = append(w.doc.Pages, Page{Number: w.page, Text: text})
+		w.page++
+	}
+	w.text.Reset()
+}
+
+// attr returns the value of the attribute called local, in any namespace
+func attr(t xml.StartElement, local string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// extractXLSX reads every worksheet of a workbook as a page and a table.
+// Cells show their stored values: formulas their last result, dates the
+// serial number.
+func extractXLSX(name string, data []byte) (*Document, error) {
+	archive, err := openZip(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sheets, err := xlsxSheets(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	shared, err := xlsxSharedStrings(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	doc := &Document{Name: name, Kind: KindXLSX}
+	for i, sheet := range sheets {
+		rows, err := xlsxRows(archive, sheet.path, shared)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		text := "Sheet: " + sheet.name
+		if len(rows) > 0 {
+			text += "\n" + tableText(rows)
+			doc.Tables = append(doc.Tables, Table{Page: i + 1, Rows: rows})
+		}
+		doc.Pages = append(doc.Pages, Page{Number: i + 1, Text: text})
+	}
+	if len(doc.Pages) == 0 {
+		return nil, fmt.Errorf("%s has no worksheets", name)
+	}
+	return doc, nil
+}
+
+type xlsxSheet struct {
+	name string
+	path string
+}
+
+// xlsxSheets lists the worksheets in workbook order with their part names
+func xlsxSheets(archive *zipArchive) ([]xlsxSheet, error) {
+	workbook, err := archive.read("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	if workbook == nil {
+		return nil, errors.New("no xl/workbook.xml")
+	}
+	var wb struct {
+		Sheets []struct {
+			Name string     `xml:"name,attr"`
+			Attr []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(workbook, &wb); err != nil {
+		return nil, err
+	}
+
+	rels, err := archive.read("xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if rels != nil {
+		if err := xml.Unmarshal(rels, &r); err != nil {
+			return nil, err
+		}
+	}
+	targets := make(map[string]string, len(r.Relationships))
+	for _, rel := range r.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+
+	sheets := make([]xlsxSheet, 0, len(wb.Sheets))
+	for i, s := range wb.Sheets {
+		var target string
+		for _, a := range s.Attr {
+			if a.Name.Local == "id" {
+				target = targets[a.Value]
+			}
+		}
+		if target == "" {
+			// No relationships: assume the default part names
+			target = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		sheets = append(sheets, xlsxSheet{name: s.Name, path: target})
+	}
+	return sheets, nil
+}
+
+// xlsxSharedStrings returns the workbook's shared strings table
+func xlsxSharedStrings(archive *zipArchive) ([]string, error) {
+	data, err := archive.read("xl/sharedStrings.xml")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var shared []string
+	var item strings.Builder
+	inText, inPhonetic := false, false
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return shared, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				// Phonetic guides repeat the text in kana
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				shared = append(shared, item.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				item.Write(t)
+			}
+		}
+	}
+}
+
+// xlsxCell is a <c> element of a worksheet
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string   `xml:"t"`
+		Runs []string `xml:"r>t"`
+	} `xml:"is"`
+}
+
+// xlsxRows reads the cells of a worksheet as rows, placing each cell in its
+// column and dropping trailing empty rows and cells
+func xlsxRows(archive *zipArchive, part string, shared []string) ([][]string, error) {
+	data, err := archive.read(part)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	var row []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				var c xlsxCell
+				if err := dec.DecodeElement(&c, &t); err != nil {
+					return nil, err
+				}
+				col := len(row)
+				if c.Ref != "" {
+					col = columnIndex(c.Ref)
+				}
+				if col < 0 || col >= maxSheetColumn {
+					continue
+				}
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = cellValue(c, shared)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				rows = append(rows, trimRow(row))
+			}
+		}
+	}
+
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+func cellValue(c xlsxCell, shared []string) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(c.Value))
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return strings.TrimSpace(shared[i])
+	case "inlineStr":
+		return strings.TrimSpace(c.Inline.Text + strings.Join(c.Inline.Runs, ""))
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return strings.TrimSpace(c.Value)
+}
+
+// columnIndex returns the zero-based column of a cell reference like "AB12",
+// or -1
+func columnIndex(ref string) int {
+	col := 0
+	for i, r := range ref {
+		if r < 'A' || r > 'Z' {
+			if i == 0 {
+				return -1
+			}
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		if col > maxSheetColumn {
+			return -1
+		}
+	}
+	return col - 1
+}
+
+func trimRow(row []string) []string {
+	for len(row) > 0 && row[len(row)-1] == "" {
+		row = row[:len(row)-1]
+	}
+	return row
+}
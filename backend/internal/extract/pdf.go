@@ -0,0 +1,1253 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Limits on PDFs: decoded streams, pages, how deep objects and form
+// XObjects may nest, filters per stream and codes mapped per font
+const (
+	maxPDFStream  = 64 << 20
+	maxPDFPages   = 2000
+	maxPDFDepth   = 64
+	maxFormDepth  = 8
+	maxPDFFilters = 8
+	maxFontCodes  = 1 << 17
+)
+
+// PDF objects. Numbers are float64, booleans bool and null nil.
+type (
+	pdfName   string
+	pdfString string
+	pdfArray  []any
+	pdfDict   map[pdfName]any
+	pdfOp     string // a keyword: an operator in content streams
+	pdfRef    struct{ num int }
+	pdfStream struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// pdfLexer reads PDF objects from data
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// rest returns the data from the current position on, empty past the end
+func (l *pdfLexer) rest() []byte {
+	if l.pos >= len(l.data) {
+		return nil
+	}
+	return l.data[l.pos:]
+}
+
+// skipSpace skips white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next number, name, string or keyword; brackets and
+// dictionary delimiters are keywords too. ok is false at the end.
+func (l *pdfLexer) token() (tok any, ok bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+
+	c := l.data[l.pos]
+	l.pos++
+	switch c {
+	case '(':
+		return l.literal(), true
+	case '<':
+		if l.pos < len(l.data) && l.data[l.pos] == '<' {
+			l.pos++
+			return pdfOp("<<"), true
+		}
+		return l.hexString(), true
+	case '>':
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfOp(">>"), true
+		}
+		return pdfOp(">"), true
+	case '/':
+		return l.name(), true
+	case '[', ']', '{', '}', ')':
+		return pdfOp(c), true
+	}
+
+	start := l.pos - 1
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if strings.IndexByte("+-.0123456789", word[0]) >= 0 {
+		if n, err := strconv.ParseFloat(word, 64); err == nil {
+			return n, true
+		}
+	}
+	return pdfOp(word), true
+}
+
+// literal reads a (string) after its opening parenthesis
+func (l *pdfLexer) literal() pdfString {
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(b)
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A line continuation
+				if c == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+// hexString reads a <hex string> after its opening bracket
+func (l *pdfLexer) hexString() pdfString {
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos < len(l.data) {
+		l.pos++ // the closing bracket
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(b, digits)
+	return pdfString(b[:n])
+}
+
+// name reads a /Name after its slash, decoding #xx escapes
+func (l *pdfLexer) name() pdfName {
+	var b []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '#' && l.pos+1 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos:l.pos+2]), 16, 8); err == nil {
+				c = byte(v)
+				l.pos += 2
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfName(b)
+}
+
+// object reads the next object: arrays and dictionaries whole, "n g R" as a
+// reference. Keywords other than true, false and null are returned as
+// pdfOp. The error is io.EOF at the end.
+func (l *pdfLexer) object() (any, error) {
+	return l.objectAt(0)
+}
+
+func (l *pdfLexer) objectAt(depth int) (any, error) {
+	if depth > maxPDFDepth {
+		return nil, fmt.Errorf("objects nested too deep")
+	}
+	tok, ok := l.token()
+	if !ok {
+		return nil, io.EOF
+	}
+
+	switch t := tok.(type) {
+	case pdfOp:
+		switch t {
+		case "[":
+			arr := pdfArray{}
+			for {
+				l.skipSpace()
+				if l.pos >= len(l.data) {
+					return arr, nil
+				}
+				if l.data[l.pos] == ']' {
+					l.pos++
+					return arr, nil
+				}
+				v, err := l.objectAt(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				l.skipSpace()
+				if l.pos >= len(l.data) {
+					return dict, nil
+				}
+				if bytes.HasPrefix(l.rest(), []byte(">>")) {
+					l.pos += 2
+					return dict, nil
+				}
+				key, err := l.objectAt(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				value, err := l.objectAt(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				if name, ok := key.(pdfName); ok {
+					dict[name] = value
+				}
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t, nil
+	case float64:
+		// An object number and generation followed by R is a reference
+		if t >= 0 && t == math.Trunc(t) {
+			save := l.pos
+			if gen, ok := l.token(); ok {
+				if _, isNum := gen.(float64); isNum {
+					if r, ok := l.token(); ok && r == pdfOp("R") {
+						return pdfRef{num: int(t)}, nil
+					}
+				}
+			}
+			l.pos = save
+		}
+		return t, nil
+	}
+	return tok, nil
+}
+
+// stream reads the data of a stream whose dictionary was just read, if the
+// stream keyword follows
+func (l *pdfLexer) stream(dict pdfDict) (*pdfStream, bool) {
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.rest(), []byte("stream")) {
+		l.pos = save
+		return nil, false
+	}
+	l.pos += len("stream")
+	if bytes.HasPrefix(l.rest(), []byte("\r\n")) {
+		l.pos += 2
+	} else if l.pos < len(l.data) && (l.data[l.pos] == '\n' || l.data[l.pos] == '\r') {
+		l.pos++
+	}
+	start := l.pos
+
+	// Trust a direct /Length only when endstream follows it
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && n <= float64(len(l.data)-start) {
+		end := start + int(n)
+		after := &pdfLexer{data: l.data, pos: end}
+		after.skipSpace()
+		if bytes.HasPrefix(after.rest(), []byte("endstream")) {
+			l.pos = after.pos + len("endstream")
+			return &pdfStream{dict: dict, raw: l.data[start:end]}, true
+		}
+	}
+
+	i := bytes.Index(l.rest(), []byte("endstream"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, raw: l.data[start:]}, true
+	}
+	end := start + i
+	l.pos = end + len("endstream")
+	if end > start && l.data[end-1] == '\n' {
+		end--
+	}
+	if end > start && l.data[end-1] == '\r' {
+		end--
+	}
+	return &pdfStream{dict: dict, raw: l.data[start:end]}, true
+}
+
+// pdfFile is a parsed PDF: its objects by number and the trailer
+type pdfFile struct {
+	objects map[int]any
+	trailer pdfDict
+	fonts   map[int]*pdfFont // fonts by object number
+
+	unpacked unpackBudget
+}
+
+var pdfObject = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// parsePDF reads every "n g obj" in file order, so later revisions of an
+// object replace earlier ones, and the objects packed in object streams.
+// The cross-reference table is not needed and may be damaged.
+func parsePDF(data []byte) *pdfFile {
+	f := &pdfFile{objects: map[int]any{}, fonts: map[int]*pdfFont{}}
+	trailerAt := -1
+
+	for pos := 0; pos < len(data); {
+		loc := pdfObject.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		l := &pdfLexer{data: data, pos: pos + loc[1]}
+		obj, err := l.object()
+		if err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				if s, ok := l.stream(dict); ok {
+					obj = s
+					switch dict["Type"] {
+					case pdfName("ObjStm"):
+						f.loadObjectStream(s)
+					case pdfName("XRef"):
+						f.trailer, trailerAt = dict, pos
+					}
+				}
+			}
+			f.objects[num] = obj
+		}
+		pos = max(l.pos, pos+loc[1])
+	}
+
+	// A classic trailer after the last cross-reference stream wins
+	if i := bytes.LastIndex(data, []byte("trailer")); i > trailerAt {
+		l := &pdfLexer{data: data, pos: i + len("trailer")}
+		if dict, err := l.object(); err == nil {
+			if d, ok := dict.(pdfDict); ok {
+				f.trailer = d
+			}
+		}
+	}
+	return f
+}
+
+// loadObjectStream adds the objects packed in an object stream
+func (f *pdfFile) loadObjectStream(s *pdfStream) {
+	data, err := f.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := s.dict["N"].(float64)
+	first, _ := s.dict["First"].(float64)
+	// Compare as floats: huge values do not convert to int
+	if first < 0 || first > float64(len(data)) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, ok1 := header.token()
+		offset, ok2 := header.token()
+		if !ok1 || !ok2 {
+			return
+		}
+		numF, isNum := num.(float64)
+		offsetF, isOffset := offset.(float64)
+		if !isNum || !isOffset || offsetF < 0 || first+offsetF >= float64(len(data)) {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: int(first) + int(offsetF)}
+		if obj, err := l.object(); err == nil {
+			f.objects[int(numF)] = obj
+		}
+	}
+}
+
+// resolve follows references
+func (f *pdfFile) resolve(v any) any {
+	for i := 0; i < maxPDFDepth; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves v to a dictionary, or a stream's dictionary
+func (f *pdfFile) dict(v any) pdfDict {
+	switch d := f.resolve(v).(type) {
+	case pdfDict:
+		return d
+	case *pdfStream:
+		return d.dict
+	}
+	return nil
+}
+
+// decode applies a stream's filters. Flate, ASCIIHex and ASCII85 are
+// supported, which covers text content; image filters are not.
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	var filters []pdfName
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{v}
+	case pdfArray:
+		for _, item := range v {
+			if name, ok := f.resolve(item).(pdfName); ok {
+				filters = append(filters, name)
+			}
+		}
+	}
+
+	if len(filters) > maxPDFFilters {
+		return nil, fmt.Errorf("stream has more than %d filters", maxPDFFilters)
+	}
+
+	data := s.raw
+	for _, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = f.inflate(data)
+		case "ASCIIHexDecode", "AHx":
+			l := &pdfLexer{data: data}
+			data = []byte(l.hexString())
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported filter %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping what could be read of a damaged
+// stream. Every stream inflated counts against the file's budget, including
+// form XObjects inflated again each time they are drawn.
+func (f *pdfFile) inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		defer zr.Close()
+		r = zr
+	} else {
+		// Some writers leave out the zlib header
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+
+	out, err := f.unpacked.read(r, maxPDFStream, "stream")
+	var limitErr *unpackLimitError
+	if errors.As(err, &limitErr) {
+		return nil, err
+	}
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("failed to inflate stream: %w", err)
+	}
+	return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.Map(func(r rune) rune {
+		if r < 256 && isPDFSpace(byte(r)) {
+			return -1
+		}
+		return r
+	}, data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	return io.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+}
+
+// pdfPage is a page dictionary with the resources it has or inherits
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in order, from the page tree of the catalogue or,
+// when there is none, every page object by number
+func (f *pdfFile) pages() []pdfPage {
+	catalog := f.dict(f.trailer["Root"])
+	if catalog == nil {
+		for _, obj := range f.objects {
+			if d, ok := obj.(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+				catalog = d
+				break
+			}
+		}
+	}
+
+	var pages []pdfPage
+	if catalog != nil {
+		f.walkPages(catalog["Pages"], nil, map[int]bool{}, 0, &pages)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	nums := make([]int, 0, len(f.objects))
+	for num, obj := range f.objects {
+		if d, ok := obj.(pdfDict); ok && d["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		d := f.objects[num].(pdfDict)
+		pages = append(pages, pdfPage{dict: d, resources: f.dict(d["Resources"])})
+	}
+	return pages
+}
+
+func (f *pdfFile) walkPages(node any, resources pdfDict, seen map[int]bool, depth int, pages *[]pdfPage) {
+	if ref, ok := node.(pdfRef); ok {
+		if seen[ref.num] {
+			return
+		}
+		seen[ref.num] = true
+	}
+	d := f.dict(node)
+	if d == nil || depth > maxPDFDepth || len(*pages) >= maxPDFPages {
+		return
+	}
+	if res := f.dict(d["Resources"]); res != nil {
+		resources = res
+	}
+
+	if kids, ok := f.resolve(d["Kids"]).(pdfArray); ok && d["Type"] != pdfName("Page") {
+		for _, kid := range kids {
+			f.walkPages(kid, resources, seen, depth+1, pages)
+		}
+		return
+	}
+	*pages = append(*pages, pdfPage{dict: d, resources: resources})
+}
+
+// extractPDF reads the text of every page. Text is taken from the content
+// streams in drawing order, with line breaks where the baseline moves;
+// scanned pages without a text layer come out empty.
+func extractPDF(name string, data []byte) (*Document, error) {
+	f := parsePDF(data)
+	if f.trailer["Encrypt"] != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEncrypted, name)
+	}
+	pages := f.pages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("failed to read %s: no pages found", name)
+	}
+
+	doc := &Document{Name: name, Kind: KindPDF}
+	for i, page := range pages {
+		w := &pdfTextWriter{f: f}
+		var content []byte
+		switch c := f.resolve(page.dict["Contents"]).(type) {
+		case *pdfStream:
+			content, _ = f.decode(c)
+		case pdfArray:
+			for _, part := range c {
+				if s, ok := f.resolve(part).(*pdfStream); ok {
+					if data, err := f.decode(s); err == nil {
+						content = append(append(content, data...), '\n')
+					}
+				}
+			}
+		}
+		w.run(content, page.resources, identity, 0)
+		if err := f.unpacked.err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		doc.Pages = append(doc.Pages, Page{Number: i + 1, Text: cleanText(w.text.String())})
+	}
+	return doc, nil
+}
+
+// matrix is a PDF transformation matrix [a b c d e f]
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m×n: m applied first, then n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func toMatrix(operands []any) (matrix, bool) {
+	var m matrix
+	if len(operands) < 6 {
+		return m, false
+	}
+	for i, v := range operands[len(operands)-6:] {
+		n, ok := v.(float64)
+		if !ok {
+			return m, false
+		}
+		m[i] = n
+	}
+	return m, true
+}
+
+// pdfTextWriter runs content streams, writing the text they show
+type pdfTextWriter struct {
+	f    *pdfFile
+	text strings.Builder
+
+	ctm     matrix   // current transformation matrix
+	saved   []matrix // q/Q stack
+	tm, tlm matrix   // text and text line matrix
+	font    *pdfFont
+	size    float64
+	leading float64
+
+	wrote        bool
+	lastX, lastY float64 // device position where the last text ended
+	recent       []shownText
+}
+
+// shownText is a string drawn on the page and where it started
+type shownText struct {
+	text string
+	x, y float64
+}
+
+// maxRecent is how many shown strings are kept to catch overprinting
+const maxRecent = 64
+
+// run interprets a content stream drawn with resources under ctm
+func (w *pdfTextWriter) run(content []byte, resources pdfDict, ctm matrix, depth int) {
+	w.ctm, w.saved = ctm, nil
+	fonts := w.f.dict(resources["Font"])
+
+	l := &pdfLexer{data: content}
+	var operands []any
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfOp)
+		if !ok {
+			if len(operands) < 64 {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+
+		switch op {
+		case "q":
+			if len(w.saved) < 64 {
+				w.saved = append(w.saved, w.ctm)
+			}
+		case "Q":
+			if n := len(w.saved); n > 0 {
+				w.ctm, w.saved = w.saved[n-1], w.saved[:n-1]
+			}
+		case "cm":
+			if m, ok := toMatrix(operands); ok {
+				w.ctm = m.mul(w.ctm)
+			}
+		case "BT":
+			w.tm, w.tlm = identity, identity
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[len(operands)-2].(pdfName)
+				w.font = w.f.font(fonts[name])
+				w.size, _ = operands[len(operands)-1].(float64)
+			}
+		case "TL":
+			if len(operands) >= 1 {
+				w.leading, _ = operands[len(operands)-1].(float64)
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[len(operands)-2].(float64)
+				ty, _ := operands[len(operands)-1].(float64)
+				if op == "TD" {
+					w.leading = -ty
+				}
+				w.moveLine(tx, ty)
+			}
+		case "Tm":
+			if m, ok := toMatrix(operands); ok {
+				w.tm, w.tlm = m, m
+			}
+		case "T*":
+			w.moveLine(0, -w.leading)
+		case "Tj":
+			if len(operands) >= 1 {
+				w.show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			w.moveLine(0, -w.leading)
+			if len(operands) >= 1 {
+				w.show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if arr, ok := operands[len(operands)-1].(pdfArray); ok {
+					for _, item := range arr {
+						if n, ok := item.(float64); ok {
+							// Adjustments are thousandths of the font size,
+							// subtracted from the position
+							w.tm = matrix{1, 0, 0, 1, -n / 1000 * w.size, 0}.mul(w.tm)
+							continue
+						}
+						w.show(item)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && depth < maxFormDepth {
+				name, _ := operands[len(operands)-1].(pdfName)
+				w.form(w.f.dict(resources["XObject"])[name], resources, depth)
+			}
+		case "ID":
+			// Skip the data of an inline image, up to EI
+			for l.pos < len(content) {
+				i := bytes.Index(content[l.pos:], []byte("EI"))
+				if i < 0 {
+					l.pos = len(content)
+					break
+				}
+				l.pos += i + 2
+				if l.pos >= 3 && isPDFSpace(content[l.pos-3]) && (l.pos == len(content) || isPDFSpace(content[l.pos])) {
+					break
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// form draws a form XObject with its own resources and matrix
+func (w *pdfTextWriter) form(xobject any, resources pdfDict, depth int) {
+	s, ok := w.f.resolve(xobject).(*pdfStream)
+	if !ok || s.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	content, err := w.f.decode(s)
+	if err != nil {
+		return
+	}
+	if res := w.f.dict(s.dict["Resources"]); res != nil {
+		resources = res
+	}
+	m := identity
+	if arr, ok := w.f.resolve(s.dict["Matrix"]).(pdfArray); ok {
+		if fm, ok := toMatrix(arr); ok {
+			m = fm
+		}
+	}
+
+	ctm, saved, tm, tlm, font, size := w.ctm, w.saved, w.tm, w.tlm, w.font, w.size
+	w.run(content, resources, m.mul(ctm), depth+1)
+	w.ctm, w.saved, w.tm, w.tlm, w.font, w.size = ctm, saved, tm, tlm, font, size
+}
+
+func (w *pdfTextWriter) moveLine(tx, ty float64) {
+	w.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(w.tlm)
+	w.tm = w.tlm
+}
+
+// show writes a string, separating it from the text before by a line
+// break when the baseline moved and by a space when there is a gap
+func (w *pdfTextWriter) show(v any) {
+	s, ok := v.(pdfString)
+	if !ok {
+		return
+	}
+	font := w.font
+	if font == nil {
+		font = defaultFont
+	}
+	text, width := font.decode(string(s))
+
+	trm := w.tm.mul(w.ctm)
+	x, y := trm[4], trm[5]
+	size := w.size * math.Hypot(trm[2], trm[3])
+	if size <= 0 {
+		size = 10
+	}
+
+	if text != "" && w.overprinted(text, x, y, size) {
+		text = ""
+	}
+	if text != "" {
+		if w.wrote {
+			dy := math.Abs(y - w.lastY)
+			gap := x - w.lastX
+			switch {
+			case dy > size*2:
+				w.text.WriteString("\n\n")
+			case dy > size/2:
+				w.text.WriteString("\n")
+			case gap > size*0.15 || gap < -size:
+				if !strings.HasPrefix(text, " ") && !strings.HasSuffix(w.text.String(), " ") {
+					w.text.WriteString(" ")
+				}
+			}
+		}
+		w.text.WriteString(text)
+		w.wrote = true
+	}
+
+	w.tm = matrix{1, 0, 0, 1, width / 1000 * w.size, 0}.mul(w.tm)
+	end := w.tm.mul(w.ctm)
+	w.lastX, w.lastY = end[4], y
+}
+
+// overprinted reports whether text was just drawn at nearly the same spot:
+// some producers fake bold by drawing a run twice, slightly shifted
+func (w *pdfTextWriter) overprinted(text string, x, y, size float64) bool {
+	for _, r := range w.recent {
+		if r.text == text && math.Abs(r.x-x) < size*0.1 && math.Abs(r.y-y) < size*0.1 {
+			return true
+		}
+	}
+	if len(w.recent) == maxRecent {
+		w.recent = w.recent[1:]
+	}
+	w.recent = append(w.recent, shownText{text, x, y})
+	return false
+}
+
+// pdfFont decodes the character codes of shown strings
+type pdfFont struct {
+	codeBytes    int             // 2 for composite (Type0) fonts
+	toUnicode    map[int]string  // from the ToUnicode CMap
+	encoding     *[256]string    // simple fonts without a ToUnicode entry
+	widths       map[int]float64 // glyph widths in thousandths of an em
+	defaultWidth float64
+}
+
+var defaultFont = &pdfFont{codeBytes: 1, encoding: &winAnsi, defaultWidth: 500}
+
+// font returns the font of a resource dictionary entry
+func (f *pdfFile) font(v any) *pdfFont {
+	ref, isRef := v.(pdfRef)
+	if isRef {
+		if font, ok := f.fonts[ref.num]; ok {
+			return font
+		}
+	}
+	d := f.dict(v)
+	if d == nil {
+		return nil
+	}
+
+	font := &pdfFont{codeBytes: 1, widths: map[int]float64{}, defaultWidth: 500}
+	if d["Subtype"] == pdfName("Type0") {
+		font.codeBytes = 2
+		font.defaultWidth = 1000
+		if descendants, ok := f.resolve(d["DescendantFonts"]).(pdfArray); ok && len(descendants) > 0 {
+			f.cidWidths(font, f.dict(descendants[0]))
+		}
+	} else {
+		first, _ := f.resolve(d["FirstChar"]).(float64)
+		if widths, ok := f.resolve(d["Widths"]).(pdfArray); ok {
+			for i, wv := range widths {
+				if width, ok := f.resolve(wv).(float64); ok {
+					font.widths[int(first)+i] = width
+				}
+			}
+		}
+		if desc := f.dict(d["FontDescriptor"]); desc != nil {
+			if missing, ok := f.resolve(desc["MissingWidth"]).(float64); ok && missing > 0 {
+				font.defaultWidth = missing
+			}
+		}
+		font.encoding = f.simpleEncoding(d["Encoding"])
+	}
+
+	if s, ok := f.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decode(s); err == nil {
+			var codeBytes int
+			font.toUnicode, codeBytes = parseCMap(data)
+			if font.codeBytes == 2 && codeBytes == 1 {
+				font.codeBytes = 1
+			}
+		}
+	}
+
+	if isRef {
+		f.fonts[ref.num] = font
+	}
+	return font
+}
+
+// cidWidths reads the W array of a CID font: "c [w1 w2 ...]" gives the
+// widths from c on, "c1 c2 w" one width for a range
+func (f *pdfFile) cidWidths(font *pdfFont, cid pdfDict) {
+	if cid == nil {
+		return
+	}
+	if dw, ok := f.resolve(cid["DW"]).(float64); ok {
+		font.defaultWidth = dw
+	}
+	w, _ := f.resolve(cid["W"]).(pdfArray)
+	for i := 0; i+1 < len(w) && len(font.widths) < maxFontCodes; {
+		start, ok := f.resolve(w[i]).(float64)
+		if !ok {
+			return
+		}
+		switch next := f.resolve(w[i+1]).(type) {
+		case pdfArray:
+			for j, wv := range next {
+				if width, ok := f.resolve(wv).(float64); ok {
+					font.widths[int(start)+j] = width
+				}
+			}
+			i += 2
+		case float64:
+			if i+2 >= len(w) {
+				return
+			}
+			width, _ := f.resolve(w[i+2]).(float64)
+			for c := int(start); c <= int(next) && c-int(start) < 65536; c++ {
+				font.widths[c] = width
+			}
+			i += 3
+		default:
+			return
+		}
+	}
+}
+
+// decode returns the text of a shown string and its width in thousandths
+// of the font size
+func (font *pdfFont) decode(s string) (string, float64) {
+	var b strings.Builder
+	width := 0.0
+	for i := 0; i+font.codeBytes <= len(s); i += font.codeBytes {
+		code := int(s[i])
+		if font.codeBytes == 2 {
+			code = code<<8 | int(s[i+1])
+		}
+		if w, ok := font.widths[code]; ok {
+			width += w
+		} else {
+			width += font.defaultWidth
+		}
+
+		text, ok := font.toUnicode[code]
+		if !ok && font.encoding != nil && code < 256 {
+			text = font.encoding[code]
+		}
+		for _, r := range text {
+			if r >= ' ' || r == '\t' {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String(), width
+}
+
+// simpleEncoding returns the code to text table of a simple font:
+// WinAnsi unless MacRoman is named, with the Differences applied
+func (f *pdfFile) simpleEncoding(v any) *[256]string {
+	base := &winAnsi
+	var differences pdfArray
+	switch e := f.resolve(v).(type) {
+	case pdfName:
+		if e == "MacRomanEncoding" {
+			base = &macRoman
+		}
+	case pdfDict:
+		if e["BaseEncoding"] == pdfName("MacRomanEncoding") {
+			base = &macRoman
+		}
+		differences, _ = f.resolve(e["Differences"]).(pdfArray)
+	}
+	if len(differences) == 0 {
+		return base
+	}
+
+	enc := *base
+	code := 0
+	for _, item := range differences {
+		switch d := f.resolve(item).(type) {
+		case float64:
+			code = int(d)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				enc[code] = glyphText(string(d))
+			}
+			code++
+		}
+	}
+	return &enc
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap and
+// the code length of its codespace ranges (0 when not given)
+func parseCMap(data []byte) (map[int]string, int) {
+	mapping := map[int]string{}
+	codeBytes := 0
+
+	l := &pdfLexer{data: data}
+	var operands []any
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return mapping, codeBytes
+		}
+		op, ok := obj.(pdfOp)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if s, ok := operands[0].(pdfString); ok {
+					codeBytes = len(s)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfString)
+				if !ok {
+					continue
+				}
+				switch dst := operands[i+1].(type) {
+				case pdfString:
+					mapping[cmapCode(src)] = utf16Text(dst)
+				case pdfName:
+					mapping[cmapCode(src)] = glyphText(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands) && len(mapping) < maxFontCodes; i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				from, to := cmapCode(lo), cmapCode(hi)
+				if to < from || to-from > 65535 {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					// The last UTF-16 unit counts up along the range
+					units := utf16Units(dst)
+					if len(units) == 0 {
+						continue
+					}
+					for c := from; c <= to; c++ {
+						units[len(units)-1] = utf16Units(dst)[len(units)-1] + uint16(c-from)
+						mapping[c] = string(utf16.Decode(units))
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && from+j <= to {
+							mapping[from+j] = utf16Text(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func cmapCode(s pdfString) int {
+	code := 0
+	for i := 0; i < len(s) && i < 4; i++ {
+		code = code<<8 | int(s[i])
+	}
+	return code
+}
+
+func utf16Units(s pdfString) []uint16 {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return units
+}
+
+func utf16Text(s pdfString) string {
+	if len(s) == 1 {
+		return string(rune(s[0]))
+	}
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// glyphText returns the text of a glyph name: one-letter names, uniXXXX
+// and uXXXX[XX] names, and the common names of the standard encodings
+func glyphText(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i] // "a.sc" is a small capital a
+	}
+	if len(name) == 1 {
+		return name
+	}
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if v, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+var glyphNames = func() map[string]string {
+	names := map[string]string{
+		"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+		"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+		"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/", "zero": "0", "one": "1",
+		"two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8",
+		"nine": "9", "colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">",
+		"question": "?", "at": "@", "bracketleft": "[", "backslash": "\\", "bracketright": "]",
+		"asciicircum": "^", "underscore": "_", "grave": "`", "braceleft": "{", "bar": "|",
+		"braceright": "}", "asciitilde": "~", "quoteleft": "‘", "quoteright": "’", "quotedblleft": "“",
+		"quotedblright": "”", "quotesinglbase": "‚", "quotedblbase": "„", "endash": "–", "emdash": "—",
+		"bullet": "•", "ellipsis": "…", "dagger": "†", "daggerdbl": "‡", "trademark": "™",
+		"copyright": "©", "registered": "®", "degree": "°", "section": "§", "paragraph": "¶",
+		"Euro": "€", "minus": "−", "periodcentered": "·", "guillemotleft": "«", "guillemotright": "»",
+		"guilsinglleft": "‹", "guilsinglright": "›", "fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi",
+		"ffl": "ffl", "nbspace": " ", "sfthyphen": "-", "cent": "¢", "sterling": "£", "yen": "¥",
+		"currency": "¤", "brokenbar": "¦", "dieresis": "¨", "ordfeminine": "ª", "ordmasculine": "º",
+		"logicalnot": "¬", "macron": "¯", "plusminus": "±", "twosuperior": "²", "threesuperior": "³",
+		"acute": "´", "mu": "µ", "onesuperior": "¹", "onequarter": "¼", "onehalf": "½",
+		"threequarters": "¾", "exclamdown": "¡", "questiondown": "¿", "florin": "ƒ", "perthousand": "‰",
+		"circumflex": "ˆ", "tilde": "˜", "OE": "Œ", "oe": "œ", "Scaron": "Š", "scaron": "š",
+		"Zcaron": "Ž", "zcaron": "ž", "Ydieresis": "Ÿ", "dotlessi": "ı", "Lslash": "Ł", "lslash": "ł",
+	}
+	// Latin-1 letters from À (U+00C0) on
+	latin1 := strings.Fields(`Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla
+		Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+		Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply
+		Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls
+		agrave aacute acircumflex atilde adieresis aring ae ccedilla
+		egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis
+		eth ntilde ograve oacute ocircumflex otilde odieresis divide
+		oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+	for i, name := range latin1 {
+		names[name] = string(rune(0xC0 + i))
+	}
+	return names
+}()
+
+// winAnsi is the WinAnsiEncoding (Windows-1252), also used for fonts that
+// name no encoding
+var winAnsi = func() [256]string {
+	var enc [256]string
+	for c := 0x20; c < 256; c++ {
+		enc[c] = string(rune(c))
+	}
+	enc[0x7F] = ""
+	enc[0xA0] = " "
+	enc[0xAD] = "-"
+	// 0x80 to 0x9F differ from Latin-1; 0 marks the unused codes
+	for i, r := range []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ") {
+		if r == 0 {
+			enc[0x80+i] = ""
+		} else {
+			enc[0x80+i] = string(r)
+		}
+	}
+	return enc
+}()
+
+// macRoman is the MacRomanEncoding
+var macRoman = func() [256]string {
+	var enc [256]string
+	for c := 0x20; c < 0x7F; c++ {
+		enc[c] = string(rune(c))
+	}
+	for i, r := range []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔ\uf8ffÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ") {
+		enc[0x80+i] = string(r)
+	}
+	return enc
+}()
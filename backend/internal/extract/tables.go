@@ -0,0 +1,80 @@
+package extract
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mdDelimiter is the row under a Markdown table's header, e.g. |---|:--:|
+var mdDelimiter = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+
+// markdownTables finds pipe tables: a header row, a delimiter row and the
+// rows up to the first line without a pipe
+func markdownTables(text string) []Table {
+	lines := strings.Split(text, "\n")
+
+	var tables []Table
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.Contains(lines[i], "|") || !mdDelimiter.MatchString(lines[i+1]) {
+			continue
+		}
+		rows := [][]string{markdownCells(lines[i])}
+		j := i + 2
+		for ; j < len(lines) && strings.Contains(lines[j], "|"); j++ {
+			rows = append(rows, markdownCells(lines[j]))
+		}
+		tables = append(tables, Table{Page: 1, Rows: rows})
+		i = j - 1
+	}
+	return tables
+}
+
+func markdownCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if !strings.HasSuffix(line, `\|`) {
+		line = strings.TrimSuffix(line, "|")
+	}
+
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+var (
+	htmlTable = regexp.MustCompile(`(?is)<table\b.*?</table\s*>`)
+	htmlRow   = regexp.MustCompile(`(?i)<tr\b`)
+	htmlData  = regexp.MustCompile(`(?i)<t[dh]\b`)
+	spaces    = regexp.MustCompile(`\s+`)
+)
+
+// htmlTables finds the rows and cells of <table> elements. Rows and cells
+// run to the next one, as closing tags are optional in HTML. A table nested
+// in another ends the outer one early; its text is still on the page.
+func htmlTables(s string) []Table {
+	s = htmlDropped.ReplaceAllString(s, "")
+
+	var tables []Table
+	for _, table := range htmlTable.FindAllString(s, -1) {
+		var rows [][]string
+		for _, row := range htmlRow.Split(table, -1)[1:] {
+			var cells []string
+			for _, cell := range htmlData.Split(row, -1)[1:] {
+				// Drop the rest of the opening tag
+				if i := strings.IndexByte(cell, '>'); i >= 0 {
+					cell = cell[i+1:]
+				}
+				cells = append(cells, strings.TrimSpace(spaces.ReplaceAllString(htmlText(cell), " ")))
+			}
+			if len(cells) > 0 {
+				rows = append(rows, cells)
+			}
+		}
+		if len(rows) > 0 {
+			tables = append(tables, Table{Page: 1, Rows: rows})
+		}
+	}
+	return tables
+}
@@ -0,0 +1,635 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/middleware"
+	"gryt-backend/internal/services"
+)
+
+// AdminHandler handles administrative HTTP requests
+type AdminHandler struct {
+	adminService   *services.AdminService
+	auditService   *services.AuditService
+	authService    *services.AuthService
+	modelService   *services.ModelService
+	personaService *services.PersonaService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(adminService *services.AdminService, auditService *services.AuditService, authService *services.AuthService, modelService *services.ModelService, personaService *services.PersonaService) *AdminHandler {
+	return &AdminHandler{
+		adminService:   adminService,
+		auditService:   auditService,
+		authService:    authService,
+		modelService:   modelService,
+		personaService: personaService,
+	}
+}
+
+// RegisterRoutes registers admin routes, each guarded by its own permission
+func (h *AdminHandler) RegisterRoutes(r *gin.RouterGroup) {
+	perm := func(p services.Permission) gin.HandlerFunc {
+		return middleware.RequirePermission(h.authService, p)
+	}
+
+	users := r.Group("/users")
+	{
+		users.GET("", perm(services.PermUsersRead), h.ListUsers)
+		users.GET("/:user_id", perm(services.PermUsersRead), h.GetUser)
+		users.POST("/:user_id/activate", perm(services.PermUsersWrite), h.ActivateUser)
+		users.POST("/:user_id/deactivate", perm(services.PermUsersWrite), h.DeactivateUser)
+		users.PUT("/:user_id/role", perm(services.PermRolesWrite), h.SetUserRole)
+		users.POST("/:user_id/tokens/grant", perm(services.PermTokensWrite), h.GrantTokens)
+		users.POST("/:user_id/tokens/reset", perm(services.PermTokensWrite), h.ResetTokens)
+		users.GET("/:user_id/usage", perm(services.PermUsageRead), h.GetUserUsage)
+		users.POST("/:user_id/access-key/rotate", perm(services.PermKeysWrite), h.RotateAccessKey)
+		users.POST("/:user_id/access-key/revoke", perm(services.PermKeysWrite), h.RevokeAccessKey)
+		users.POST("/:user_id/unlock", perm(services.PermLockouts), h.UnlockUser)
+	}
+
+	lockouts := r.Group("/lockouts")
+	{
+		lockouts.GET("", perm(services.PermUsersRead), h.ListLockouts)
+		lockouts.POST("/unlock", perm(services.PermLockouts), h.Unlock)
+	}
+
+	r.GET("/usage", perm(services.PermUsageRead), h.GetUsageSummary)
+
+	audit := r.Group("/audit")
+	{
+		audit.GET("", perm(services.PermAuditRead), h.ListAuditEvents)
+		audit.GET("/export", perm(services.PermAuditRead), h.ExportAuditEvents)
+	}
+
+	models := r.Group("/models")
+	{
+		models.GET("", perm(services.PermModelsWrite), h.ListModels)
+		models.POST("", perm(services.PermModelsWrite), h.CreateModel)
+		models.POST("/sync", perm(services.PermModelsWrite), h.SyncModels)
+		models.PUT("/:model_id", perm(services.PermModelsWrite), h.UpdateModel)
+		models.DELETE("/:model_id", perm(services.PermModelsWrite), h.DeleteModel)
+	}
+
+	personas := r.Group("/personas")
+	{
+		personas.GET("", perm(services.PermPersonasWrite), h.ListPersonas)
+		personas.POST("", perm(services.PermPersonasWrite), h.CreatePersona)
+		personas.PUT("/:persona_id", perm(services.PermPersonasWrite), h.UpdatePersona)
+		personas.DELETE("/:persona_id", perm(services.PermPersonasWrite), h.DeletePersona)
+	}
+}
+
+// ListUsers lists and searches users
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	filter := database.UserFilter{
+		Query: c.Query("q"),
+		Role:  c.Query("role"),
+	}
+
+	if active := c.Query("active"); active != "" {
+		if v, err := strconv.ParseBool(active); err == nil {
+			filter.Active = &v
+		}
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			filter.Limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil {
+			filter.Offset = o
+		}
+	}
+
+	users, total, err := h.adminService.ListUsers(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	result := make([]gin.H, len(users))
+	for i := range users {
+		result[i] = adminUserView(&users[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": result, "total": total})
+}
+
+// GetUser gets a single user including inactive ones
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, err := h.adminService.GetUser(c.Param("user_id"))
+	if err != nil {
+		h.respondError(c, err, "Failed to get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": adminUserView(user)})
+}
+
+// ActivateUser re-enables a deactivated user
+func (h *AdminHandler) ActivateUser(c *gin.Context) {
+	h.setUserActive(c, true)
+}
+
+// DeactivateUser disables a user; their access key, access tokens and
+// refresh tokens are rejected from the next request on
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	h.setUserActive(c, false)
+}
+
+func (h *AdminHandler) setUserActive(c *gin.Context, active bool) {
+	user, err := h.adminService.SetUserActive(middleware.GetAuditActor(c), c.Param("user_id"), active)
+	if err != nil {
+		h.respondError(c, err, "Failed to update user status")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": adminUserView(user)})
+}
+
+// SetUserRoleRequest represents a role change
+type SetUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SetUserRole changes a user's role
+func (h *AdminHandler) SetUserRole(c *gin.Context) {
+	var req SetUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	user, err := h.adminService.SetUserRole(middleware.GetAuditActor(c), c.Param("user_id"), req.Role)
+	if err != nil {
+		h.respondError(c, err, "Failed to update user role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": adminUserView(user)})
+}
+
+// TokenAmountsRequest represents a token grant or reset
+type TokenAmountsRequest struct {
+	ChatTokens   *int `json:"chat_tokens"`
+	SearchTokens *int `json:"search_tokens"`
+}
+
+// GrantTokens adds tokens to a user's balance
+func (h *AdminHandler) GrantTokens(c *gin.Context) {
+	var req TokenAmountsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	chat, search := 0, 0
+	if req.ChatTokens != nil {
+		chat = *req.ChatTokens
+	}
+	if req.SearchTokens != nil {
+		search = *req.SearchTokens
+	}
+	if chat == 0 && search == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chat_tokens or search_tokens is required"})
+		return
+	}
+
+	user, err := h.adminService.GrantTokens(middleware.GetAuditActor(c), c.Param("user_id"), chat, search)
+	if err != nil {
+		h.respondError(c, err, "Failed to grant tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": adminUserView(user)})
+}
+
+// ResetTokens sets a user's balance, defaulting to the configured limits
+func (h *AdminHandler) ResetTokens(c *gin.Context) {
+	var req TokenAmountsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	user, err := h.adminService.ResetTokens(middleware.GetAuditActor(c), c.Param("user_id"), req.ChatTokens, req.SearchTokens)
+	if err != nil {
+		h.respondError(c, err, "Failed to reset tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": adminUserView(user)})
+}
+
+// GetUserUsage gets consumption for a single user
+func (h *AdminHandler) GetUserUsage(c *gin.Context) {
+	usage, err := h.adminService.GetUserUsage(c.Param("user_id"), usageSince(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to get usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// GetUsageSummary gets the heaviest users in the selected period
+func (h *AdminHandler) GetUsageSummary(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	usage, err := h.adminService.GetUsageSummary(usageSince(c), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// RotateAccessKey issues a new access key; it is only shown in this response
+func (h *AdminHandler) RotateAccessKey(c *gin.Context) {
+	accessKey, err := h.adminService.RotateAccessKey(middleware.GetAuditActor(c), c.Param("user_id"))
+	if err != nil {
+		h.respondError(c, err, "Failed to rotate access key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Access key rotated successfully",
+		"access_key": accessKey,
+	})
+}
+
+// RevokeAccessKey invalidates a user's access key without issuing a new one
+func (h *AdminHandler) RevokeAccessKey(c *gin.Context) {
+	if err := h.adminService.RevokeAccessKey(middleware.GetAuditActor(c), c.Param("user_id")); err != nil {
+		h.respondError(c, err, "Failed to revoke access key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access key revoked successfully"})
+}
+
+// ListLockouts lists active login lockouts
+func (h *AdminHandler) ListLockouts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"lockouts": h.authService.Lockouts()})
+}
+
+// UnlockUser lifts the login lockout on a user's account
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	user, err := h.adminService.GetUser(c.Param("user_id"))
+	if err != nil {
+		h.respondError(c, err, "Failed to unlock user")
+		return
+	}
+
+	unlocked, err := h.authService.AdminUnlock(middleware.GetAuditActor(c), "account", user.Email)
+	if err != nil {
+		h.respondError(c, err, "Failed to unlock user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully", "was_locked": unlocked})
+}
+
+// Unlock lifts a lockout by email or IP
+func (h *AdminHandler) Unlock(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Email == "") == (req.IP == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide exactly one of email or ip"})
+		return
+	}
+
+	kind, value := "account", req.Email
+	if req.IP != "" {
+		kind, value = "ip", req.IP
+	}
+
+	unlocked, err := h.authService.AdminUnlock(middleware.GetAuditActor(c), kind, value)
+	if err != nil {
+		h.respondError(c, err, "Failed to unlock")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked successfully", "was_locked": unlocked})
+}
+
+// ListAuditEvents queries the audit trail
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		h.ExportAuditEvents(c)
+		return
+	}
+
+	events, total, err := h.auditService.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events, "total": total})
+}
+
+// auditExportMaxRows caps a single CSV export
+const auditExportMaxRows = 50000
+
+// ExportAuditEvents streams the filtered audit trail as CSV, oldest first
+func (h *AdminHandler) ExportAuditEvents(c *gin.Context) {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.auditService.Record(services.AuditEntry{
+		Actor:      middleware.GetAuditActor(c),
+		Action:     services.AuditAuditExport,
+		TargetType: "audit",
+		Metadata:   map[string]interface{}{"query": c.Request.URL.RawQuery},
+	})
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv", time.Now().Format("20060102-150405")))
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "outcome", "metadata"})
+
+	// Pages follow the id, not an offset: the table keeps growing during a
+	// long export and offsets would shift under it
+	const pageSize = 500
+	var lastID int64
+	for written := 0; written < auditExportMaxRows; {
+		events, err := h.auditService.QueryAfter(filter, lastID, pageSize)
+		if err != nil {
+			// Headers are already sent; the truncated file is the only signal left
+			break
+		}
+
+		for _, e := range events {
+			w.Write([]string{
+				strconv.FormatInt(e.ID, 10),
+				e.CreatedAt.UTC().Format(time.RFC3339Nano),
+				csvCell(e.ActorID),
+				csvCell(e.Action),
+				csvCell(e.TargetType),
+				csvCell(e.TargetID),
+				csvCell(e.IP),
+				csvCell(e.UserAgent),
+				csvCell(e.Outcome),
+				csvCell(e.Metadata),
+			})
+		}
+		w.Flush()
+
+		if len(events) < pageSize {
+			break
+		}
+		written += len(events)
+		lastID = events[len(events)-1].ID
+	}
+}
+
+// csvCell neutralises values a spreadsheet would run as a formula. User
+// agents, emails and metadata come from the client, so a leading =, +, -,
+// @, tab or carriage return is escaped with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// auditFilterFromQuery builds an audit filter from query parameters. from/to
+// accept RFC3339 timestamps or YYYY-MM-DD dates.
+func auditFilterFromQuery(c *gin.Context) (database.AuditFilter, error) {
+	filter := database.AuditFilter{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Outcome:    c.Query("outcome"),
+		IP:         c.Query("ip"),
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(p.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: use RFC3339 or YYYY-MM-DD", p.name)
+		}
+		*p.dst = &t
+	}
+
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil {
+		filter.Limit = l
+	}
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil {
+		filter.Offset = o
+	}
+
+	return filter, nil
+}
+
+// ListModels lists the whole model catalogue, including disabled models
+func (h *AdminHandler) ListModels(c *gin.Context) {
+	models, err := h.modelService.List(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list models"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": models, "total": len(models)})
+}
+
+// CreateModel adds a model to the catalogue
+func (h *AdminHandler) CreateModel(c *gin.Context) {
+	var req services.ModelInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	model, err := h.modelService.Create(middleware.GetAuditActor(c), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to create model")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"model": model})
+}
+
+// UpdateModel changes a catalogue entry; omitted fields are kept
+func (h *AdminHandler) UpdateModel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("model_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+		return
+	}
+
+	var req services.ModelInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	model, err := h.modelService.Update(middleware.GetAuditActor(c), id, req)
+	if err != nil {
+		h.respondError(c, err, "Failed to update model")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"model": model})
+}
+
+// DeleteModel removes a model from the catalogue
+func (h *AdminHandler) DeleteModel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("model_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+		return
+	}
+
+	if err := h.modelService.Delete(middleware.GetAuditActor(c), id); err != nil {
+		h.respondError(c, err, "Failed to delete model")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Model deleted successfully"})
+}
+
+// SyncModels pulls the gateway's model list; new models are added disabled
+func (h *AdminHandler) SyncModels(c *gin.Context) {
+	result, err := h.modelService.Sync(c.Request.Context(), middleware.GetAuditActor(c))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sync models from the AI gateway", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Models synced successfully", "result": result})
+}
+
+// ListPersonas lists the global personas
+func (h *AdminHandler) ListPersonas(c *gin.Context) {
+	personas, err := h.personaService.ListGlobal()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list personas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"personas": personas, "total": len(personas)})
+}
+
+// CreatePersona creates a global persona visible to every user
+func (h *AdminHandler) CreatePersona(c *gin.Context) {
+	var req services.PersonaInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	persona, err := h.personaService.CreateGlobal(c.Request.Context(), middleware.GetAuditActor(c), req)
+	if err != nil {
+		respondPersonaError(c, err, "Failed to create persona")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"persona": persona})
+}
+
+// UpdatePersona replaces a global persona
+func (h *AdminHandler) UpdatePersona(c *gin.Context) {
+	var req services.PersonaInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	persona, err := h.personaService.UpdateGlobal(c.Request.Context(), middleware.GetAuditActor(c), c.Param("persona_id"), req)
+	if err != nil {
+		respondPersonaError(c, err, "Failed to update persona")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"persona": persona})
+}
+
+// DeletePersona deletes a global persona; sessions using it fall back to
+// their own or the configured system prompt
+func (h *AdminHandler) DeletePersona(c *gin.Context) {
+	if err := h.personaService.DeleteGlobal(middleware.GetAuditActor(c), c.Param("persona_id")); err != nil {
+		respondPersonaError(c, err, "Failed to delete persona")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Persona deleted successfully"})
+}
+
+func (h *AdminHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrModelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrInvalidAmount), errors.Is(err, services.ErrInvalidModel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSelfLockout), errors.Is(err, services.ErrModelExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// usageSince parses ?days= (default 30) into a start time
+func usageSince(c *gin.Context) time.Time {
+	days := 30
+	if d, err := strconv.Atoi(c.Query("days")); err == nil && d > 0 && d <= 365 {
+		days = d
+	}
+	return time.Now().AddDate(0, 0, -days)
+}
+
+// adminUserView is the admin representation of a user; it never includes the access key
+func adminUserView(user *database.User) gin.H {
+	return gin.H{
+		"id":            user.ID,
+		"email":         user.Email,
+		"name":          user.Name,
+		"role":          user.Role,
+		"is_active":     user.IsActive,
+		"chat_tokens":   user.ChatTokens,
+		"search_tokens": user.SearchTokens,
+		"has_password":  user.PasswordHash.Valid && user.PasswordHash.String != "",
+		"created_at":    user.CreatedAt,
+		"updated_at":    user.UpdatedAt,
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -11,23 +12,32 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 
 	"gryt-backend/internal/ai"
 	"gryt-backend/internal/database"
+	"gryt-backend/internal/metrics"
 	"gryt-backend/internal/middleware"
+	"gryt-backend/internal/models"
+	"gryt-backend/internal/services"
 )
 
 // AIHandler handles AI-related HTTP requests
 type AIHandler struct {
-	aiService *ai.Service
-	db        *database.DB
+	aiService         *ai.Service
+	attachmentService *services.AttachmentService
+	db                *database.DB
+	streamTimeout     time.Duration
 }
 
-// NewAIHandler creates a new AI handler
-func NewAIHandler(aiService *ai.Service, db *database.DB) *AIHandler {
+// NewAIHandler creates a new AI handler. streamTimeout is the write
+// deadline for SSE routes (0 = none), replacing the server-wide one.
+func NewAIHandler(aiService *ai.Service, attachmentService *services.AttachmentService, db *database.DB, streamTimeout time.Duration) *AIHandler {
 	return &AIHandler{
-		aiService: aiService,
-		db:        db,
+		aiService:         aiService,
+		attachmentService: attachmentService,
+		db:                db,
+		streamTimeout:     streamTimeout,
 	}
 }
 
@@ -40,9 +50,16 @@ func (h *AIHandler) RegisterRoutes(r *gin.RouterGroup) {
 		chat.GET("/sessions", h.GetChatSessions)
 		chat.GET("/sessions/:session_id", h.GetChatSession)
 		chat.DELETE("/sessions/:session_id", h.DeleteChatSession)
+		chat.POST("/sessions/:session_id/restore", h.RestoreChatSession)
+		chat.PUT("/sessions/:session_id/params", h.SetChatSessionParams)
+		chat.PUT("/sessions/:session_id/persona", h.SetChatSessionPersona)
 		chat.POST("/sessions/:session_id/messages", h.SendChatMessage)
 		chat.GET("/sessions/:session_id/messages", h.GetChatMessages)
-		chat.POST("/sessions/:session_id/stream", h.StreamChatMessage)
+		chat.POST("/sessions/:session_id/stream", middleware.StreamTimeout(h.streamTimeout), h.StreamChatMessage)
+		chat.POST("/sessions/:session_id/messages/:message_id/edit", middleware.StreamTimeout(h.streamTimeout), h.EditChatMessage)
+		chat.POST("/sessions/:session_id/messages/:message_id/regenerate", middleware.StreamTimeout(h.streamTimeout), h.RegenerateChatMessage)
+		chat.GET("/sessions/:session_id/messages/:message_id/siblings", h.GetMessageSiblings)
+		chat.PUT("/sessions/:session_id/active-branch", h.SetActiveBranch)
 	}
 
 	// Search endpoints
@@ -62,16 +79,30 @@ func (h *AIHandler) RegisterRoutes(r *gin.RouterGroup) {
 
 // Chat Session Handlers
 
-// CreateChatSessionRequest represents request to create a chat session
+// CreateChatSessionRequest represents request to create a chat session.
+// The generation params (model, temperature, max_tokens, top_p) become the
+// session defaults.
 type CreateChatSessionRequest struct {
 	Title string `json:"title,omitempty"`
+	models.GenerationParams
+	SessionPersonaRequest
+}
+
+// SessionPersonaRequest picks the session's persona and/or its own system
+// prompt. The session's prompt wins over the persona's.
+type SessionPersonaRequest struct {
+	PersonaID    *string `json:"persona_id,omitempty"`
+	SystemPrompt *string `json:"system_prompt,omitempty"`
 }
 
 // CreateChatSessionResponse represents response for creating a chat session
 type CreateChatSessionResponse struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           string                  `json:"id"`
+	Title        string                  `json:"title"`
+	Params       models.GenerationParams `json:"params"`
+	PersonaID    *string                 `json:"persona_id,omitempty"`
+	SystemPrompt *string                 `json:"system_prompt,omitempty"`
+	CreatedAt    time.Time               `json:"created_at"`
 }
 
 // CreateChatSession creates a new chat session
@@ -88,27 +119,41 @@ func (h *AIHandler) CreateChatSession(c *gin.Context) {
 		return
 	}
 
+	if err := h.aiService.ValidateParams(c.Request.Context(), req.GenerationParams); err != nil {
+		respondInvalidParams(c, err)
+		return
+	}
+	persona := req.SessionPersonaRequest
+	if !h.checkSessionPersona(c, userID, &persona) {
+		return
+	}
+
 	// Generate session ID
 	sessionID := fmt.Sprintf("session-%d", time.Now().UnixNano())
 	title := req.Title
 	if title == "" {
+		// Placeholder until a title is generated after the first exchange
 		title = fmt.Sprintf("Chat Session %s", time.Now().Format("2006-01-02 15:04"))
 	}
 
 	// Save session to database
-	if err := h.createChatSessionInDB(c.Request.Context(), userID, sessionID, title); err != nil {
+	if err := h.createChatSessionInDB(c.Request.Context(), userID, sessionID, title, req.Title == "", req.GenerationParams, persona); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat session"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, CreateChatSessionResponse{
-		ID:        sessionID,
-		Title:     title,
-		CreatedAt: time.Now(),
+		ID:           sessionID,
+		Title:        title,
+		Params:       req.GenerationParams,
+		PersonaID:    persona.PersonaID,
+		SystemPrompt: persona.SystemPrompt,
+		CreatedAt:    time.Now(),
 	})
 }
 
-// GetChatSessions gets all chat sessions for the user
+// GetChatSessions lists the user's chat sessions a page at a time, with
+// filters and sorts from parseSessionQuery
 func (h *AIHandler) GetChatSessions(c *gin.Context) {
 	userID, exists := middleware.GetUserIDFromContext(c)
 		if !exists {
@@ -120,14 +165,103 @@ func (h *AIHandler) GetChatSessions(c *gin.Context) {
 		return
 	}
 
+	query, err := parseSessionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "message": err.Error()})
+		return
+	}
+
 	// Get sessions from database
-	sessions, err := h.getChatSessionsFromDB(c.Request.Context(), userID)
+	sessions, next, err := h.getChatSessionsFromDB(c.Request.Context(), userID, query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "message": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat sessions"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions, "next_cursor": next})
+}
+
+// parseSessionQuery reads the list filters:
+//
+//	limit     1-100 (default 50); cursor is next_cursor of the previous page
+//	deleted   true = the trash
+//	archived  true (only archived) or all; archived sessions are hidden by default
+//	folder_id a folder, or "none" for sessions outside any folder
+//	tag       repeatable; sessions must carry every tag
+//	pinned    true or false
+//	sort      updated_at (default), created_at or title; order asc or desc
+//
+// Pinned sessions always come first.
+func parseSessionQuery(c *gin.Context) (database.SessionQuery, error) {
+	query := database.SessionQuery{Limit: 50, Deleted: c.Query("deleted") == "true"}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			query.Limit = l
+		}
+	}
+
+	switch archived := c.Query("archived"); archived {
+	case "", "false":
+	case "true", "only":
+		query.Archived = database.ArchivedOnly
+	case "all":
+		query.Archived = database.ArchivedAll
+	default:
+		return query, fmt.Errorf("archived must be true, false or all")
+	}
+
+	if folderID, ok := c.GetQuery("folder_id"); ok {
+		if folderID == "none" {
+			folderID = ""
+		}
+		query.FolderID = &folderID
+	}
+
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.ToLower(strings.Join(strings.Fields(tag), " ")); tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
+	}
+
+	if pinned := c.Query("pinned"); pinned != "" {
+		p, err := strconv.ParseBool(pinned)
+		if err != nil {
+			return query, fmt.Errorf("pinned must be true or false")
+		}
+		query.Pinned = &p
+	}
+
+	switch query.Sort = c.DefaultQuery("sort", database.SessionSortUpdated); query.Sort {
+	case database.SessionSortUpdated, database.SessionSortCreated:
+	case database.SessionSortTitle:
+		query.Asc = true
+	default:
+		return query, fmt.Errorf("sort must be updated_at, created_at or title")
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		query.Asc = true
+	case "desc":
+		query.Asc = false
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := database.ParseSessionCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	return query, nil
 }
 
 // GetChatSession gets a specific chat session
@@ -151,6 +285,10 @@ func (h *AIHandler) GetChatSession(c *gin.Context) {
 	// Get session from database
 	session, err := h.getChatSessionFromDB(c.Request.Context(), userID, sessionID)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat session"})
+		return
+	}
+	if session == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
 		return
 	}
@@ -176,23 +314,190 @@ func (h *AIHandler) DeleteChatSession(c *gin.Context) {
 		return
 	}
 
-	// Delete session from database
-	if err := h.deleteChatSessionFromDB(c.Request.Context(), userID, sessionID); err != nil {
+	// Move session to the trash
+	deleted, err := h.deleteChatSessionFromDB(c.Request.Context(), userID, sessionID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chat session"})
 		return
 	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Chat session deleted successfully"})
 }
 
+// RestoreChatSession takes a deleted session out of the trash. Sessions
+// are purged for good after the retention period.
+func (h *AIHandler) RestoreChatSession(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	chatRepo := database.NewChatRepository(h.db.WithContext(c.Request.Context()))
+	restored, err := chatRepo.RestoreSession(userID, c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore chat session"})
+		return
+	}
+	if !restored {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted chat session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Chat session restored successfully"})
+}
+
+// SetChatSessionParams replaces the session's default model and parameters.
+// An empty body clears them.
+func (h *AIHandler) SetChatSessionParams(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var params models.GenerationParams
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	chatRepo := database.NewChatRepository(h.db.WithContext(ctx))
+	session, err := chatRepo.GetSession(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat session"})
+		return
+	}
+	if session == nil || session.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
+
+	if err := h.aiService.ValidateParams(ctx, params); err != nil {
+		respondInvalidParams(c, err)
+		return
+	}
+
+	if err := chatRepo.SetSessionParams(session.ID, params); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": session.ID, "params": params})
+}
+
+// SetChatSessionPersona replaces the session's persona and own system
+// prompt. Omitted or empty fields clear them, so an empty body returns the
+// session to the configured system prompt.
+func (h *AIHandler) SetChatSessionPersona(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req SessionPersonaRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	chatRepo := database.NewChatRepository(h.db.WithContext(ctx))
+	session, err := chatRepo.GetSession(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat session"})
+		return
+	}
+	if session == nil || session.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
+
+	if !h.checkSessionPersona(c, userID, &req) {
+		return
+	}
+
+	if err := chatRepo.SetSessionPersona(session.ID, req.PersonaID, req.SystemPrompt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": session.ID, "persona_id": req.PersonaID, "system_prompt": req.SystemPrompt})
+}
+
+// checkSessionPersona normalises req (blank values become nil) and checks
+// the persona is visible to the user. It writes the error response and
+// returns false when the request is rejected.
+func (h *AIHandler) checkSessionPersona(c *gin.Context, userID string, req *SessionPersonaRequest) bool {
+	if req.SystemPrompt != nil {
+		prompt := strings.TrimSpace(*req.SystemPrompt)
+		if len(prompt) > ai.MaxSystemPrompt {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid system prompt",
+				"message": fmt.Sprintf("system_prompt must be at most %d characters", ai.MaxSystemPrompt),
+			})
+			return false
+		}
+		req.SystemPrompt = &prompt
+		if prompt == "" {
+			req.SystemPrompt = nil
+		}
+	}
+
+	if req.PersonaID != nil && *req.PersonaID == "" {
+		req.PersonaID = nil
+	}
+	if req.PersonaID == nil {
+		return true
+	}
+
+	persona, err := h.aiService.Persona(c.Request.Context(), userID, *req.PersonaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load persona"})
+		return false
+	}
+	if persona == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Persona not found"})
+		return false
+	}
+	return true
+}
+
 // Chat Message Handlers
 
-// SendChatMessageRequest represents request to send a chat message
+// SendChatMessageRequest represents request to send a chat message, as
+// JSON or as multipart/form-data fields. The generation params override the
+// session defaults for this message only.
 type SendChatMessageRequest struct {
-	Message string `json:"message" binding:"required"`
-	Stream  bool   `json:"stream,omitempty"`
+	Message string `json:"message" form:"message" binding:"required"`
+	Stream  bool   `json:"stream,omitempty" form:"stream"`
+	// AttachmentIDs are earlier uploads (POST /attachments) to send along
+	AttachmentIDs []string `json:"attachment_ids,omitempty" form:"attachment_ids"`
+	models.GenerationParams
+}
+
+// chatInput is a bound chat message with the attachments it references and
+// the files uploaded with it. The uploads are stored only once the model is
+// known to read them.
+type chatInput struct {
+	SendChatMessageRequest
+	attachments []database.Attachment
+	uploads     []*services.Upload
 }
 
+// formOverhead allows for the fields and part headers of a multipart chat
+// message on top of its files
+const formOverhead = 1 << 20
+
 // SendChatMessage sends a chat message and gets AI response
 func (h *AIHandler) SendChatMessage(c *gin.Context) {
 	userID, exists := middleware.GetUserIDFromContext(c)
@@ -217,29 +522,146 @@ func (h *AIHandler) SendChatMessage(c *gin.Context) {
 		return
 	}
 
-	var req SendChatMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	req, ok := h.bindChatMessage(c, userID)
+	if !ok {
 		return
 	}
 
-	// Parse multipart form for file uploads
-	form, err := c.MultipartForm()
+	// Create service request
+	serviceReq := &ai.ServiceChatRequest{
+		SessionID:   sessionID,
+		Message:     req.Message,
+		Attachments: req.attachments,
+		Stream:      req.Stream,
+		Params:      req.GenerationParams,
+	}
+	if !h.storeUploads(c, userID, serviceReq, req.uploads) {
+		return
+	}
+
+	h.sendMessage(c, userID, serviceReq)
+}
+
+// bindChatMessage reads a chat message sent as JSON or as
+// multipart/form-data. Multipart carries the same fields as form values and
+// the files under "files" (or "files[]"); all files together may be at most
+// the storage max_message_mb. Either may reference earlier uploads by
+// attachment_ids. On failure the error response is written and ok is false.
+func (h *AIHandler) bindChatMessage(c *gin.Context, userID string) (*chatInput, bool) {
+	var in chatInput
 	var files []*multipart.FileHeader
-	if err == nil && form != nil {
-		files = form.File["files"]
+
+	if c.ContentType() == binding.MIMEMultipartPOSTForm {
+		limit := h.attachmentService.MaxMessageSize()
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+formOverhead)
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request too large", "message": fmt.Sprintf("files sent with a message may total at most %d MB", limit>>20)})
+				return nil, false
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+			return nil, false
+		}
+		if err := c.ShouldBindWith(&in.SendChatMessageRequest, binding.FormMultipart); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+			return nil, false
+		}
+
+		files = append(append(files, form.File["files"]...), form.File["files[]"]...)
+		var total int64
+		for _, file := range files {
+			total += file.Size
+		}
+		if total > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request too large", "message": fmt.Sprintf("files sent with a message may total at most %d MB", limit>>20)})
+			return nil, false
+		}
+	} else if err := c.ShouldBindJSON(&in.SendChatMessageRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return nil, false
 	}
 
-	// Create service request
-	serviceReq := &ai.ServiceChatRequest{
-		SessionID: sessionID,
-		Message:   req.Message,
-		Files:     files,
-		Stream:    req.Stream,
+	if len(in.AttachmentIDs)+len(files) > services.MaxMessageAttachments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment", "message": fmt.Sprintf("at most %d attachments per message", services.MaxMessageAttachments)})
+		return nil, false
+	}
+
+	if len(in.AttachmentIDs) > 0 {
+		attachments, err := h.attachmentService.Resolve(c.Request.Context(), userID, in.AttachmentIDs)
+		if err != nil {
+			respondAttachmentError(c, err, "Failed to get attachments")
+			return nil, false
+		}
+		in.attachments = attachments
+	}
+
+	for _, file := range files {
+		upload, err := h.attachmentService.ReadFile(file)
+		if err != nil {
+			respondAttachmentError(c, err, "Failed to read attachment")
+			return nil, false
+		}
+		in.uploads = append(in.uploads, upload)
+	}
+	return &in, true
+}
+
+// storeUploads checks req with the uploads appended as its last
+// attachments, then stores them as the user's attachments, so files the
+// model cannot read are refused without being kept. On failure the error
+// response is written and false returned.
+func (h *AIHandler) storeUploads(c *gin.Context, userID string, req *ai.ServiceChatRequest, uploads []*services.Upload) bool {
+	if len(uploads) == 0 {
+		return true
+	}
+	first := len(req.Attachments)
+	for _, u := range uploads {
+		req.Attachments = append(req.Attachments, u.Attachment())
+	}
+
+	var err error
+	req.Generation, err = h.aiService.ResolveGeneration(c.Request.Context(), userID, req)
+	if err != nil {
+		respondInvalidParams(c, err)
+		return false
+	}
+
+	for i, u := range uploads {
+		a, err := h.attachmentService.Store(c.Request.Context(), userID, u)
+		if err != nil {
+			respondAttachmentError(c, err, "Failed to store attachment")
+			return false
+		}
+		req.Attachments[first+i] = a.Attachment
+	}
+	return true
+}
+
+// sendMessage resolves the generation for req, runs it and deducts a chat
+// token on success. The caller has already checked the user's chat tokens.
+func (h *AIHandler) sendMessage(c *gin.Context, userID string, req *ai.ServiceChatRequest) {
+	var err error
+	if req.Generation == nil {
+		req.Generation, err = h.aiService.ResolveGeneration(c.Request.Context(), userID, req)
+		if err != nil {
+			respondInvalidParams(c, err)
+			return
+		}
 	}
 
 	// Process chat message
-	response, err := h.aiService.ProcessChatMessage(c.Request.Context(), userID, serviceReq)
+	response, err := h.aiService.ProcessChatMessage(c.Request.Context(), userID, req)
+	if errors.Is(err, ai.ErrShuttingDown) {
+		respondShuttingDown(c)
+		return
+	}
+	if errors.Is(err, ai.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process message: %v", err)})
 		return
@@ -275,25 +697,46 @@ func (h *AIHandler) StreamChatMessage(c *gin.Context) {
 		return
 	}
 
-	var req SendChatMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	req, ok := h.bindChatMessage(c, userID)
+	if !ok {
 		return
 	}
 
-	// Parse multipart form for file uploads
-	form, err := c.MultipartForm()
-	var files []*multipart.FileHeader
-	if err == nil && form != nil {
-		files = form.File["files"]
-	}
-
 	// Create service request
 	serviceReq := &ai.ServiceChatRequest{
-		SessionID: sessionID,
-		Message:   req.Message,
-		Files:     files,
-		Stream:    true,
+		SessionID:   sessionID,
+		Message:     req.Message,
+		Attachments: req.attachments,
+		Stream:      true,
+		Params:      req.GenerationParams,
+	}
+	if !h.storeUploads(c, userID, serviceReq, req.uploads) {
+		return
+	}
+
+	h.streamMessage(c, userID, serviceReq)
+}
+
+// streamMessage resolves the generation for req and streams the reply as
+// server-sent events. The done event carries the saved reply's id, the
+// user message it answers and any knowledge base citations. The caller has
+// already checked the user's chat tokens.
+func (h *AIHandler) streamMessage(c *gin.Context, userID string, serviceReq *ai.ServiceChatRequest) {
+	var err error
+
+	// Validate before the SSE headers so the client gets a plain 400
+	if serviceReq.Generation == nil {
+		serviceReq.Generation, err = h.aiService.ResolveGeneration(c.Request.Context(), userID, serviceReq)
+		if err != nil {
+			respondInvalidParams(c, err)
+			return
+		}
+	}
+
+	// Refuse before the SSE headers go out so the client gets a plain 503
+	if h.aiService.Generations().Draining() {
+		respondShuttingDown(c)
+		return
 	}
 
 	// Set headers for SSE
@@ -302,6 +745,8 @@ func (h *AIHandler) StreamChatMessage(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
+	defer metrics.StreamStarted()()
+
 	// Process streaming chat message
 	responseChan, errorChan := h.aiService.ProcessChatMessageStream(c.Request.Context(), userID, serviceReq)
 
@@ -314,7 +759,15 @@ func (h *AIHandler) StreamChatMessage(c *gin.Context) {
 		case chunk, ok := <-responseChan:
 			if !ok {
 				// Stream finished
-				c.SSEvent("done", "")
+				if reply := serviceReq.Reply; reply != nil {
+					done := gin.H{"message_id": reply.ID, "parent_id": reply.ParentID}
+					if citations := reply.Metadata.Citations; len(citations) > 0 {
+						done["citations"] = citations
+					}
+					c.SSEvent("done", done)
+				} else {
+					c.SSEvent("done", "")
+				}
 				return
 			}
 			c.SSEvent("message", chunk)
@@ -332,6 +785,34 @@ func (h *AIHandler) StreamChatMessage(c *gin.Context) {
 	}
 }
 
+// respondInvalidParams answers 404 for a session the user does not own, 400
+// for a model or parameter the catalogue does not allow, 415 for
+// attachments the model cannot read, 500 for anything else
+func respondInvalidParams(c *gin.Context, err error) {
+	if errors.Is(err, ai.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
+	if errors.Is(err, ai.ErrInvalidParams) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parameters", "message": err.Error()})
+		return
+	}
+	if errors.Is(err, ai.ErrUnsupportedAttachment) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported attachment", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve model parameters"})
+}
+
+// respondShuttingDown tells the client to retry against another instance
+func respondShuttingDown(c *gin.Context) {
+	c.Header("Retry-After", "5")
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":   "Service unavailable",
+		"message": "Server is shutting down, please retry",
+	})
+}
+
 // GetChatMessages gets messages for a chat session
 func (h *AIHandler) GetChatMessages(c *gin.Context) {
 	userID, exists := middleware.GetUserIDFromContext(c)
@@ -368,6 +849,10 @@ func (h *AIHandler) GetChatMessages(c *gin.Context) {
 
 	// Get messages from database
 	messages, err := h.getChatMessagesFromDB(c.Request.Context(), userID, sessionID, limit, offset)
+	if errors.Is(err, ai.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat messages"})
 		return
@@ -495,106 +980,140 @@ func (h *AIHandler) GetSearchResult(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
-// GetAvailableModels gets available AI models
+// GetAvailableModels lists the enabled models from the model catalogue
 func (h *AIHandler) GetAvailableModels(c *gin.Context) {
-	// This would typically call the AI service to get available models
-	models := []map[string]interface{}{
-		{
-			"id":          "gpt-4o",
-			"name":        "GPT-4o",
-			"description": "Most capable GPT-4 model",
-			"context":     128000,
-		},
-		{
-			"id":          "gpt-4o-mini",
-			"name":        "GPT-4o Mini",
-			"description": "Faster and more affordable GPT-4 model",
-			"context":     128000,
-		},
-		{
-			"id":          "claude-3-5-sonnet-20241022",
-			"name":        "Claude 3.5 Sonnet",
-			"description": "Anthropic's most capable model",
-			"context":     200000,
-		},
-	}
-
-	c.JSON(http.StatusOK, gin.H{"models": models})
+	ctx := c.Request.Context()
+	catalog, err := h.aiService.Catalog().Enabled(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get models"})
+		return
+	}
+
+	defaultModel := h.aiService.DefaultModel(ctx).Name
+	models := make([]gin.H, len(catalog))
+	for i, m := range catalog {
+		models[i] = gin.H{
+			"id":             m.Name,
+			"name":           m.DisplayName,
+			"provider":       m.Provider,
+			"description":    m.Description,
+			"context":        m.ContextLength, // kept for older clients
+			"context_length": m.ContextLength,
+			"max_tokens":     m.MaxTokens,
+			"capabilities": gin.H{
+				"vision":    m.SupportsVision,
+				"tools":     m.SupportsTools,
+				"streaming": m.SupportsStreaming,
+				// attachment kinds the model reads: text, image, document
+				"attachments": ai.AllowedAttachmentTypes(&catalog[i]),
+			},
+			"pricing": gin.H{
+				"input_per_1k":  m.InputCostPer1K,
+				"output_per_1k": m.OutputCostPer1K,
+			},
+			"default": m.Name == defaultModel,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": models, "default": defaultModel})
 }
 
 // Helper methods for database operations
 
-func (h *AIHandler) createChatSessionInDB(ctx context.Context, userID, sessionID, title string) error {
+func (h *AIHandler) createChatSessionInDB(ctx context.Context, userID, sessionID, title string, autoTitle bool, params models.GenerationParams, persona SessionPersonaRequest) error {
 	// Use database repository to create chat session
-	chatRepo := database.NewChatRepository(h.db)
+	chatRepo := database.NewChatRepository(h.db.WithContext(ctx))
 	session := &database.ChatSession{
-		ID:        sessionID,
-		UserID:    userID,
-		Title:     title,
-		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:           sessionID,
+		UserID:       userID,
+		Title:        title,
+		AutoTitle:    autoTitle,
+		Params:       params,
+		PersonaID:    persona.PersonaID,
+		SystemPrompt: persona.SystemPrompt,
+		IsActive:     true,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 	return chatRepo.CreateSession(session)
 }
 
-func (h *AIHandler) getChatSessionsFromDB(ctx context.Context, userID string) ([]interface{}, error) {
-	// Use database repository to get chat sessions
-	chatRepo := database.NewChatRepository(h.db)
-	sessions, err := chatRepo.GetUserSessions(userID)
+// getChatSessionsFromDB returns one page of sessions and the cursor of the
+// next page ("" on the last page)
+func (h *AIHandler) getChatSessionsFromDB(ctx context.Context, userID string, query database.SessionQuery) ([]database.ChatSession, string, error) {
+	chatRepo := database.NewChatRepository(h.db.WithContext(ctx))
+
+	// One extra row tells whether there is a next page
+	limit := query.Limit
+	query.Limit++
+	sessions, err := chatRepo.ListSessions(userID, query)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	
-	// Convert to interface slice
-	result := make([]interface{}, len(sessions))
-	for i, session := range sessions {
-		result[i] = session
+
+	next := ""
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+		last := sessions[limit-1]
+		next = database.NewSessionCursor(query, last).Encode()
 	}
-	return result, nil
+	return sessions, next, nil
 }
 
-func (h *AIHandler) getChatSessionFromDB(ctx context.Context, userID, sessionID string) (interface{}, error) {
-	// Implementation would query specific chat session
-	return map[string]interface{}{}, nil
+// getChatSessionFromDB returns the user's session, or nil
+func (h *AIHandler) getChatSessionFromDB(ctx context.Context, userID, sessionID string) (*database.ChatSession, error) {
+	chatRepo := database.NewChatRepository(h.db.WithContext(ctx))
+	return chatRepo.GetUserSession(userID, sessionID)
 }
 
-func (h *AIHandler) deleteChatSessionFromDB(ctx context.Context, userID, sessionID string) error {
-	// Implementation would soft delete chat session
-	return nil
+// deleteChatSessionFromDB moves the user's session to the trash; false
+// when there is no such session
+func (h *AIHandler) deleteChatSessionFromDB(ctx context.Context, userID, sessionID string) (bool, error) {
+	chatRepo := database.NewChatRepository(h.db.WithContext(ctx))
+	return chatRepo.SoftDeleteSession(userID, sessionID)
+}
+
+// chatMessageView is a message with its attachments' download links
+type chatMessageView struct {
+	database.ChatMessage
+	Attachments []services.AttachmentLink `json:"attachments,omitempty"`
 }
 
 func (h *AIHandler) getChatMessagesFromDB(ctx context.Context, userID, sessionID string, limit, offset int) ([]interface{}, error) {
-	// Use database repository to get chat messages
-	chatRepo := database.NewChatRepository(h.db)
-	
-	// First verify the session belongs to the user
-	sessions, err := chatRepo.GetUserSessions(userID)
+	// Only the active branch; other versions are listed per message
+	path, err := h.aiService.ActivePath(ctx, userID, sessionID)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Check if session exists and belongs to user
-	sessionExists := false
-	for _, session := range sessions {
-		if session.ID == sessionID {
-			sessionExists = true
-			break
-		}
+
+	if offset > len(path) {
+		offset = len(path)
 	}
-	
-	if !sessionExists {
-		return nil, fmt.Errorf("session not found or access denied")
+	path = path[offset:]
+	if len(path) > limit {
+		path = path[:limit]
 	}
-	
-	// For now, return empty messages since we don't have GetMessages method
-	// This would need to be implemented in ChatRepository
-	return []interface{}{}, nil
+
+	ids := make([]string, len(path))
+	for i, msg := range path {
+		ids[i] = msg.ID
+	}
+	links, err := h.attachmentService.MessageLinks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to interface slice
+	result := make([]interface{}, len(path))
+	for i, msg := range path {
+		result[i] = chatMessageView{ChatMessage: msg, Attachments: links[msg.ID]}
+	}
+	return result, nil
 }
 
 func (h *AIHandler) getSearchHistoryFromDB(ctx context.Context, userID string, limit, offset int) ([]interface{}, error) {
 	// Use database repository to get search history
-	searchRepo := database.NewSearchRepository(h.db)
+	searchRepo := database.NewSearchRepository(h.db.WithContext(ctx))
 	queries, err := searchRepo.GetUserQueries(userID, limit)
 	if err != nil {
 		return nil, err
@@ -610,7 +1129,7 @@ func (h *AIHandler) getSearchHistoryFromDB(ctx context.Context, userID string, l
 
 func (h *AIHandler) getSearchResultFromDB(ctx context.Context, userID, searchID string) (interface{}, error) {
 	// Use database repository to get specific search result
-	searchRepo := database.NewSearchRepository(h.db)
+	searchRepo := database.NewSearchRepository(h.db.WithContext(ctx))
 	queries, err := searchRepo.GetUserQueries(userID, 100) // Get more to find specific one
 	if err != nil {
 		return nil, err
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/services"
+)
+
+// AttachmentHandler uploads and manages chat attachments and serves them
+// through signed download links
+type AttachmentHandler struct {
+	attachmentService *services.AttachmentService
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(attachmentService *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{attachmentService: attachmentService}
+}
+
+// RegisterRoutes registers the attachment routes of the authenticated API
+func (h *AttachmentHandler) RegisterRoutes(r *gin.RouterGroup) {
+	attachments := r.Group("/attachments")
+	{
+		attachments.GET("", h.ListAttachments)
+		attachments.POST("", h.UploadAttachments)
+		attachments.GET("/usage", h.GetUsage)
+		attachments.GET("/:attachment_id", h.GetAttachment)
+		attachments.DELETE("/:attachment_id", h.DeleteAttachment)
+	}
+}
+
+// RegisterDownloadRoutes registers the download route. It takes no
+// credentials: the signature in the link is the authorization, so links
+// work in <img> tags and plain downloads.
+func (h *AttachmentHandler) RegisterDownloadRoutes(r *gin.RouterGroup) {
+	r.GET("/files/:attachment_id", h.DownloadAttachment)
+}
+
+// ListAttachments lists the user's newest attachments
+func (h *AttachmentHandler) ListAttachments(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.attachmentService.List(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list attachments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+// AttachmentFailure is an uploaded file that was not stored
+type AttachmentFailure struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// UploadAttachments stores the multipart "files". Each file is stored on
+// its own: the response lists the stored attachments and the files that
+// were rejected. All files together may be at most the storage
+// max_message_mb, like the files sent with a message.
+func (h *AttachmentHandler) UploadAttachments(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	limit := h.attachmentService.MaxMessageSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+formOverhead)
+
+	form, err := c.MultipartForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request too large", "message": fmt.Sprintf("files uploaded together may total at most %d MB", limit>>20)})
+		return
+	}
+	if err != nil || form == nil || len(form.File["files"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": "upload one or more files as multipart field \"files\""})
+		return
+	}
+
+	stored := []*services.AttachmentLink{}
+	failed := []AttachmentFailure{}
+	for _, file := range form.File["files"] {
+		upload, err := h.attachmentService.ReadFile(file)
+		var a *services.AttachmentLink
+		if err == nil {
+			a, err = h.attachmentService.Store(c.Request.Context(), userID, upload)
+		}
+		if err == nil {
+			stored = append(stored, a)
+			continue
+		}
+		if !errors.Is(err, services.ErrInvalidAttachment) && !errors.Is(err, services.ErrQuotaExceeded) {
+			respondAttachmentError(c, err, "Failed to upload attachments")
+			return
+		}
+		failed = append(failed, AttachmentFailure{Name: file.Filename, Message: err.Error()})
+	}
+
+	status := http.StatusCreated
+	if len(stored) == 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"attachments": stored, "failed": failed})
+}
+
+// GetUsage returns the user's storage use and quota
+func (h *AttachmentHandler) GetUsage(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.attachmentService.Usage(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// GetAttachment returns an attachment with a fresh download link
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	a, err := h.attachmentService.Get(c.Request.Context(), userID, c.Param("attachment_id"))
+	if err != nil {
+		respondAttachmentError(c, err, "Failed to get attachment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachment": a})
+}
+
+// DeleteAttachment deletes an attachment; messages sent with it no longer
+// list it
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.attachmentService.Delete(c.Request.Context(), userID, c.Param("attachment_id")); err != nil {
+		respondAttachmentError(c, err, "Failed to delete attachment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// DownloadAttachment serves an attachment through a signed link. Only
+// images and PDFs are shown inline; everything else is a download, and
+// the sandbox policy keeps served HTML or SVG from running scripts.
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	expires := c.Query("expires")
+	a, r, err := h.attachmentService.Open(c.Request.Context(), c.Param("attachment_id"), expires, c.Query("signature"))
+	if err != nil {
+		respondAttachmentError(c, err, "Failed to download attachment")
+		return
+	}
+	defer r.Close()
+
+	disposition := "attachment"
+	switch a.MimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf":
+		disposition = "inline"
+	}
+
+	maxAge := 0
+	if exp, err := strconv.ParseInt(expires, 10, 64); err == nil {
+		maxAge = max(int(time.Until(time.Unix(exp, 0)).Seconds()), 0)
+	}
+
+	c.DataFromReader(http.StatusOK, a.Size, a.MimeType, r, map[string]string{
+		"Content-Disposition":     mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}),
+		"Cache-Control":           "private, max-age=" + strconv.Itoa(maxAge),
+		"ETag":                    `"` + a.SHA256 + `"`,
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; sandbox",
+	})
+}
+
+func respondAttachmentError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+	case errors.Is(err, services.ErrInvalidDownloadURL):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download link", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidAttachment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment", "message": err.Error()})
+	case errors.Is(err, services.ErrQuotaExceeded):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Storage quota exceeded", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/ai"
+	"gryt-backend/internal/models"
+)
+
+// EditMessageRequest sends a new version of a user message. The original
+// and its replies stay as a sibling branch.
+type EditMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+	Stream  bool   `json:"stream,omitempty"`
+	models.GenerationParams
+}
+
+// RegenerateMessageRequest asks for another reply; the generation params
+// apply to the new reply only
+type RegenerateMessageRequest struct {
+	Stream bool `json:"stream,omitempty"`
+	models.GenerationParams
+}
+
+// SetActiveBranchRequest picks the branch to continue on
+type SetActiveBranchRequest struct {
+	MessageID string `json:"message_id" binding:"required"`
+}
+
+// EditChatMessage sends an edited user message as a new branch from the
+// same point in the conversation
+func (h *AIHandler) EditChatMessage(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	sessionID := c.Param("session_id")
+	branch, err := h.aiService.PrepareEdit(ctx, userID, sessionID, c.Param("message_id"))
+	if err != nil {
+		respondBranchError(c, err, "Failed to edit message")
+		return
+	}
+
+	if !h.checkChatTokens(ctx, userID) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Insufficient chat tokens"})
+		return
+	}
+
+	serviceReq := &ai.ServiceChatRequest{
+		SessionID: sessionID,
+		Message:   req.Message,
+		Stream:    req.Stream,
+		Params:    req.GenerationParams,
+		Branch:    branch,
+	}
+	if req.Stream {
+		h.streamMessage(c, userID, serviceReq)
+		return
+	}
+	h.sendMessage(c, userID, serviceReq)
+}
+
+// RegenerateChatMessage asks for an alternative reply. For an assistant
+// message the user message it answered is sent again; for a user message
+// that message is.
+func (h *AIHandler) RegenerateChatMessage(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RegenerateMessageRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	sessionID := c.Param("session_id")
+	branch, prompt, err := h.aiService.PrepareRegenerate(ctx, userID, sessionID, c.Param("message_id"))
+	if err != nil {
+		respondBranchError(c, err, "Failed to regenerate message")
+		return
+	}
+
+	if !h.checkChatTokens(ctx, userID) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Insufficient chat tokens"})
+		return
+	}
+
+	serviceReq := &ai.ServiceChatRequest{
+		SessionID: sessionID,
+		Message:   prompt,
+		Stream:    req.Stream,
+		Params:    req.GenerationParams,
+		Branch:    branch,
+	}
+	if req.Stream {
+		h.streamMessage(c, userID, serviceReq)
+		return
+	}
+	h.sendMessage(c, userID, serviceReq)
+}
+
+// GetMessageSiblings lists the versions of a message (edits or
+// regenerated replies), oldest first, and which one is on the active branch
+func (h *AIHandler) GetMessageSiblings(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	sessionID, messageID := c.Param("session_id"), c.Param("message_id")
+	siblings, err := h.aiService.Siblings(ctx, userID, sessionID, messageID)
+	if err != nil {
+		respondBranchError(c, err, "Failed to get message versions")
+		return
+	}
+
+	path, err := h.aiService.ActivePath(ctx, userID, sessionID)
+	if err != nil {
+		respondBranchError(c, err, "Failed to get message versions")
+		return
+	}
+	onPath := make(map[string]bool, len(path))
+	for _, msg := range path {
+		onPath[msg.ID] = true
+	}
+
+	index, active := 0, ""
+	for i, msg := range siblings {
+		if msg.ID == messageID {
+			index = i
+		}
+		if onPath[msg.ID] {
+			active = msg.ID
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"siblings":  siblings,
+		"total":     len(siblings),
+		"index":     index,
+		"active_id": active,
+	})
+}
+
+// SetActiveBranch switches the session to the branch through a message.
+// Later messages continue on that branch.
+func (h *AIHandler) SetActiveBranch(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req SetActiveBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	leaf, err := h.aiService.SetActiveBranch(c.Request.Context(), userID, c.Param("session_id"), req.MessageID)
+	if err != nil {
+		respondBranchError(c, err, "Failed to set active branch")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Active branch updated", "active_message_id": leaf})
+}
+
+func respondBranchError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ai.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+	case errors.Is(err, ai.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat message not found"})
+	case errors.Is(err, ai.ErrInvalidBranch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
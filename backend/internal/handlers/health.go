@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/buildinfo"
+	"gryt-backend/internal/health"
+)
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// RegisterRoutes registers the probe routes on the root router
+func (h *HealthHandler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/livez", h.Livez)
+	r.GET("/readyz", h.Readyz)
+	// Legacy alias, dipakai oleh konfigurasi deploy lama
+	r.GET("/health", h.Livez)
+}
+
+// Livez reports that the process is up. It never touches dependencies so a
+// slow database does not get the container restarted.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": health.StatusOK,
+		"build":  buildinfo.Get(),
+		"uptime": h.checker.Uptime().String(),
+	})
+}
+
+// Readyz runs the dependency checks. Degraded still answers 200 so the
+// instance keeps receiving traffic; down answers 503.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/services"
+)
+
+// KnowledgeHandler manages knowledge bases, their documents and the
+// knowledge bases attached to chat sessions
+type KnowledgeHandler struct {
+	knowledgeService *services.KnowledgeService
+}
+
+// NewKnowledgeHandler creates a new knowledge base handler
+func NewKnowledgeHandler(knowledgeService *services.KnowledgeService) *KnowledgeHandler {
+	return &KnowledgeHandler{knowledgeService: knowledgeService}
+}
+
+// RegisterRoutes registers knowledge base routes
+func (h *KnowledgeHandler) RegisterRoutes(r *gin.RouterGroup) {
+	kb := r.Group("/knowledge-bases")
+	{
+		kb.GET("", h.ListKnowledgeBases)
+		kb.POST("", h.CreateKnowledgeBase)
+		kb.GET("/:kb_id", h.GetKnowledgeBase)
+		kb.PATCH("/:kb_id", h.UpdateKnowledgeBase)
+		kb.DELETE("/:kb_id", h.DeleteKnowledgeBase)
+		kb.POST("/:kb_id/documents", h.UploadDocuments)
+		kb.DELETE("/:kb_id/documents/:document_id", h.DeleteDocument)
+	}
+
+	chat := r.Group("/chat")
+	{
+		chat.GET("/sessions/:session_id/knowledge-bases", h.GetSessionKnowledgeBases)
+		chat.PUT("/sessions/:session_id/knowledge-bases", h.SetSessionKnowledgeBases)
+	}
+}
+
+// ListKnowledgeBases lists the user's knowledge bases by name
+func (h *KnowledgeHandler) ListKnowledgeBases(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	bases, err := h.knowledgeService.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list knowledge bases"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_bases": bases})
+}
+
+// CreateKnowledgeBase creates an empty knowledge base
+func (h *KnowledgeHandler) CreateKnowledgeBase(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.KnowledgeBaseInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	kb, err := h.knowledgeService.Create(userID, req)
+	if err != nil {
+		respondKnowledgeError(c, err, "Failed to create knowledge base")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"knowledge_base": kb})
+}
+
+// GetKnowledgeBase returns a knowledge base with its documents
+func (h *KnowledgeHandler) GetKnowledgeBase(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	kb, err := h.knowledgeService.Get(userID, c.Param("kb_id"))
+	if err != nil {
+		respondKnowledgeError(c, err, "Failed to get knowledge base")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_base": kb})
+}
+
+// UpdateKnowledgeBase renames a knowledge base or changes its description
+func (h *KnowledgeHandler) UpdateKnowledgeBase(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.KnowledgeBaseInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	kb, err := h.knowledgeService.Update(userID, c.Param("kb_id"), req)
+	if err != nil {
+		respondKnowledgeError(c, err, "Failed to update knowledge base")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_base": kb})
+}
+
+// DeleteKnowledgeBase deletes a knowledge base with all its documents
+func (h *KnowledgeHandler) DeleteKnowledgeBase(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.knowledgeService.Delete(c.Request.Context(), userID, c.Param("kb_id")); err != nil {
+		respondKnowledgeError(c, err, "Failed to delete knowledge base")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Knowledge base deleted successfully"})
+}
+
+// DocumentFailure is an uploaded file that was not added
+type DocumentFailure struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// UploadDocuments adds the multipart "files" to a knowledge base. Each
+// file is added on its own: the response lists the added documents and
+// the files that were rejected.
+func (h *KnowledgeHandler) UploadDocuments(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || form == nil || len(form.File["files"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": "upload one or more files as multipart field \"files\""})
+		return
+	}
+
+	kbID := c.Param("kb_id")
+	added := []*database.KnowledgeDocument{}
+	failed := []DocumentFailure{}
+	for _, file := range form.File["files"] {
+		doc, err := h.addDocument(userID, kbID, file)
+		if err == nil {
+			added = append(added, doc)
+			continue
+		}
+		if !errors.Is(err, services.ErrInvalidDocument) {
+			// Not about this file: the knowledge base is missing,
+			// retrieval is off or the database failed
+			respondKnowledgeError(c, err, "Failed to add documents")
+			return
+		}
+		failed = append(failed, DocumentFailure{Name: file.Filename, Message: err.Error()})
+	}
+
+	status := http.StatusCreated
+	if len(added) == 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"documents": added, "failed": failed})
+}
+
+// addDocument reads an uploaded file, refusing it when over the size
+// limit, and adds it to the knowledge base
+func (h *KnowledgeHandler) addDocument(userID, kbID string, file *multipart.FileHeader) (*database.KnowledgeDocument, error) {
+	const limit = services.MaxDocumentSize
+	if file.Size > limit {
+		return nil, fmt.Errorf("%w: %s is larger than %d MB", services.ErrInvalidDocument, file.Filename, limit>>20)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", services.ErrInvalidDocument, file.Filename)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", services.ErrInvalidDocument, file.Filename)
+	}
+	return h.knowledgeService.AddDocument(userID, kbID, file.Filename, file.Header.Get("Content-Type"), data)
+}
+
+// DeleteDocument removes a document from a knowledge base
+func (h *KnowledgeHandler) DeleteDocument(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.knowledgeService.DeleteDocument(c.Request.Context(), userID, c.Param("kb_id"), c.Param("document_id"))
+	if err != nil {
+		respondKnowledgeError(c, err, "Failed to delete document")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
+}
+
+// GetSessionKnowledgeBases lists the knowledge bases a session retrieves
+// from
+func (h *KnowledgeHandler) GetSessionKnowledgeBases(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	bases, err := h.knowledgeService.SessionBases(userID, c.Param("session_id"))
+	if err != nil {
+		respondKnowledgeError(c, err, "Failed to get session knowledge bases")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_bases": bases})
+}
+
+// SessionKnowledgeBasesRequest replaces a session's knowledge bases
+type SessionKnowledgeBasesRequest struct {
+	KnowledgeBaseIDs []string `json:"knowledge_base_ids"`
+}
+
+// SetSessionKnowledgeBases attaches knowledge bases to a session, replacing
+// the ones attached before; an empty list detaches all
+func (h *KnowledgeHandler) SetSessionKnowledgeBases(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req SessionKnowledgeBasesRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.KnowledgeBaseIDs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	bases, err := h.knowledgeService.SetSessionBases(userID, c.Param("session_id"), req.KnowledgeBaseIDs)
+	if err != nil {
+		respondKnowledgeError(c, err, "Failed to set session knowledge bases")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_bases": bases})
+}
+
+func respondKnowledgeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrKnowledgeBaseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Knowledge base not found"})
+	case errors.Is(err, services.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+	case errors.Is(err, services.ErrInvalidKnowledgeBase):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid knowledge base", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidDocument):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document", "message": err.Error()})
+	case errors.Is(err, services.ErrKnowledgeDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Knowledge bases unavailable", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
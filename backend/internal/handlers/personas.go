@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/middleware"
+	"gryt-backend/internal/services"
+)
+
+// PersonaHandler handles a user's personas. Global personas are listed
+// alongside the user's own but are managed through the admin API.
+type PersonaHandler struct {
+	personaService *services.PersonaService
+}
+
+// NewPersonaHandler creates a new persona handler
+func NewPersonaHandler(personaService *services.PersonaService) *PersonaHandler {
+	return &PersonaHandler{personaService: personaService}
+}
+
+// RegisterRoutes registers persona routes
+func (h *PersonaHandler) RegisterRoutes(r *gin.RouterGroup) {
+	personas := r.Group("/personas")
+	{
+		personas.GET("", h.ListPersonas)
+		personas.POST("", h.CreatePersona)
+		personas.GET("/:persona_id", h.GetPersona)
+		personas.PUT("/:persona_id", h.UpdatePersona)
+		personas.DELETE("/:persona_id", h.DeletePersona)
+	}
+}
+
+// ListPersonas lists the user's personas and the global ones
+func (h *PersonaHandler) ListPersonas(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	personas, err := h.personaService.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list personas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"personas": personas, "total": len(personas)})
+}
+
+// GetPersona gets one of the user's personas or a global one
+func (h *PersonaHandler) GetPersona(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	persona, err := h.personaService.Get(c.Request.Context(), userID, c.Param("persona_id"))
+	if err != nil {
+		respondPersonaError(c, err, "Failed to get persona")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"persona": persona})
+}
+
+// CreatePersona creates a persona owned by the user
+func (h *PersonaHandler) CreatePersona(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req services.PersonaInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	persona, err := h.personaService.Create(c.Request.Context(), userID, req)
+	if err != nil {
+		respondPersonaError(c, err, "Failed to create persona")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"persona": persona})
+}
+
+// UpdatePersona replaces one of the user's personas
+func (h *PersonaHandler) UpdatePersona(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req services.PersonaInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	persona, err := h.personaService.Update(c.Request.Context(), userID, c.Param("persona_id"), req)
+	if err != nil {
+		respondPersonaError(c, err, "Failed to update persona")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"persona": persona})
+}
+
+// DeletePersona deletes one of the user's personas
+func (h *PersonaHandler) DeletePersona(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.personaService.Delete(c.Request.Context(), userID, c.Param("persona_id")); err != nil {
+		respondPersonaError(c, err, "Failed to delete persona")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Persona deleted successfully"})
+}
+
+func respondPersonaError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrPersonaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Persona not found"})
+	case errors.Is(err, services.ErrPersonaReadOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidPersona):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid persona", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/services"
+)
+
+// SessionHandler organises and searches chat sessions: title, folders,
+// tags, pinning and archiving. Listing and filtering stay on the AI handler.
+type SessionHandler struct {
+	sessionService *services.SessionService
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionService *services.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService}
+}
+
+// RegisterRoutes registers session organisation routes
+func (h *SessionHandler) RegisterRoutes(r *gin.RouterGroup) {
+	chat := r.Group("/chat")
+	{
+		chat.PATCH("/sessions/:session_id", h.UpdateChatSession)
+		chat.POST("/sessions/bulk", h.BulkUpdateChatSessions)
+		chat.GET("/search", h.SearchChats)
+		chat.GET("/tags", h.ListTags)
+		chat.GET("/folders", h.ListFolders)
+		chat.POST("/folders", h.CreateFolder)
+		chat.PATCH("/folders/:folder_id", h.UpdateFolder)
+		chat.DELETE("/folders/:folder_id", h.DeleteFolder)
+	}
+}
+
+// UpdateChatSession renames, moves, tags, pins or archives a session.
+// Only the fields sent are changed; a renamed session is no longer titled
+// automatically.
+func (h *SessionHandler) UpdateChatSession(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.SessionUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	session, err := h.sessionService.Update(userID, c.Param("session_id"), req)
+	if err != nil {
+		respondSessionError(c, err, "Failed to update chat session")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// BulkUpdateChatSessions applies one action to up to 100 sessions
+func (h *SessionHandler) BulkUpdateChatSessions(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.BulkInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	updated, err := h.sessionService.Bulk(userID, req)
+	if err != nil {
+		respondSessionError(c, err, "Failed to update chat sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"action": req.Action, "updated": updated})
+}
+
+// SearchChats searches the user's message content and session titles
+func (h *SessionHandler) SearchChats(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	input, err := parseSearchInput(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search", "message": err.Error()})
+		return
+	}
+
+	result, err := h.sessionService.Search(c.Request.Context(), userID, input)
+	if err != nil {
+		respondSessionError(c, err, "Failed to search chats")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// parseSearchInput reads q, semantic, role, model, from, to (YYYY-MM-DD,
+// inclusive, or RFC3339), limit and offset
+func parseSearchInput(c *gin.Context) (services.SearchInput, error) {
+	input := services.SearchInput{Query: c.Query("q"), Role: c.Query("role"), Model: c.Query("model")}
+
+	if semantic := c.Query("semantic"); semantic != "" {
+		s, err := strconv.ParseBool(semantic)
+		if err != nil {
+			return input, fmt.Errorf("semantic must be true or false")
+		}
+		input.Semantic = s
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			input.Limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil {
+			input.Offset = o
+		}
+	}
+
+	var err error
+	if input.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		return input, fmt.Errorf("from: %w", err)
+	}
+	if input.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		return input, fmt.Errorf("to: %w", err)
+	}
+	return input, nil
+}
+
+// parseSearchTime parses a date or RFC3339 time. A date used as the end of
+// a range includes that whole day.
+func parseSearchTime(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("must be YYYY-MM-DD or RFC3339")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// ListTags lists the user's tags with how many sessions carry each
+func (h *SessionHandler) ListTags(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.sessionService.Tags(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags, "total": len(tags)})
+}
+
+// ListFolders lists the user's folders as a flat list with parent_id
+func (h *SessionHandler) ListFolders(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	folders, err := h.sessionService.Folders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list folders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folders": folders, "total": len(folders)})
+}
+
+// CreateFolder creates a folder, optionally inside another one
+func (h *SessionHandler) CreateFolder(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.FolderInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	folder, err := h.sessionService.CreateFolder(userID, req)
+	if err != nil {
+		respondSessionError(c, err, "Failed to create folder")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"folder": folder})
+}
+
+// UpdateFolder renames a folder or moves it ("parent_id": "" = top level)
+func (h *SessionHandler) UpdateFolder(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.FolderInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	folder, err := h.sessionService.UpdateFolder(userID, c.Param("folder_id"), req)
+	if err != nil {
+		respondSessionError(c, err, "Failed to update folder")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folder": folder})
+}
+
+// DeleteFolder deletes a folder and its subfolders; their sessions are
+// kept outside any folder
+func (h *SessionHandler) DeleteFolder(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.DeleteFolder(userID, c.Param("folder_id")); err != nil {
+		respondSessionError(c, err, "Failed to delete folder")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+}
+
+func respondSessionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+	case errors.Is(err, services.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+	case errors.Is(err, services.ErrInvalidSession):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session update", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidFolder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidSearch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/services"
+)
+
+// TeamHandler handles teams used to share prompt templates
+type TeamHandler struct {
+	teamService *services.TeamService
+}
+
+// NewTeamHandler creates a new team handler
+func NewTeamHandler(teamService *services.TeamService) *TeamHandler {
+	return &TeamHandler{teamService: teamService}
+}
+
+// RegisterRoutes registers team routes
+func (h *TeamHandler) RegisterRoutes(r *gin.RouterGroup) {
+	teams := r.Group("/teams")
+	{
+		teams.GET("", h.ListTeams)
+		teams.POST("", h.CreateTeam)
+		teams.GET("/:team_id", h.GetTeam)
+		teams.DELETE("/:team_id", h.DeleteTeam)
+		teams.POST("/:team_id/members", h.AddTeamMember)
+		teams.DELETE("/:team_id/members/:user_id", h.RemoveTeamMember)
+	}
+}
+
+// CreateTeamRequest represents request to create a team
+type CreateTeamRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// AddTeamMemberRequest adds a user by email; role is member (default) or owner
+type AddTeamMemberRequest struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role,omitempty"`
+}
+
+// ListTeams lists the teams the user belongs to
+func (h *TeamHandler) ListTeams(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	teams, err := h.teamService.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list teams"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"teams": teams, "total": len(teams)})
+}
+
+// CreateTeam creates a team with the user as owner
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	team, err := h.teamService.Create(userID, req.Name)
+	if err != nil {
+		respondTeamError(c, err, "Failed to create team")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"team": team})
+}
+
+// GetTeam gets a team and its members
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	team, members, err := h.teamService.Get(userID, c.Param("team_id"))
+	if err != nil {
+		respondTeamError(c, err, "Failed to get team")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"team": team, "members": members})
+}
+
+// DeleteTeam deletes a team; its templates become private to their owners
+func (h *TeamHandler) DeleteTeam(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.teamService.Delete(userID, c.Param("team_id")); err != nil {
+		respondTeamError(c, err, "Failed to delete team")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+// AddTeamMember adds a user to the team or changes their role
+func (h *TeamHandler) AddTeamMember(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req AddTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	member, err := h.teamService.AddMember(userID, c.Param("team_id"), req.Email, req.Role)
+	if err != nil {
+		respondTeamError(c, err, "Failed to add team member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team member saved", "user_id": member.ID})
+}
+
+// RemoveTeamMember removes a member; members may remove themselves
+func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.teamService.RemoveMember(userID, c.Param("team_id"), c.Param("user_id")); err != nil {
+		respondTeamError(c, err, "Failed to remove team member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team member removed"})
+}
+
+func respondTeamError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrTeamNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrTeamForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTeam):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
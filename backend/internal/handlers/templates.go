@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"gryt-backend/internal/ai"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/middleware"
+	"gryt-backend/internal/models"
+	"gryt-backend/internal/prompts"
+	"gryt-backend/internal/services"
+)
+
+// TemplateHandler handles prompt templates. Sending a rendered template
+// goes through the regular chat path of the AI handler.
+type TemplateHandler struct {
+	templateService *services.TemplateService
+	chat            *AIHandler
+}
+
+// NewTemplateHandler creates a new template handler
+func NewTemplateHandler(templateService *services.TemplateService, chat *AIHandler) *TemplateHandler {
+	return &TemplateHandler{templateService: templateService, chat: chat}
+}
+
+// RegisterRoutes registers template routes
+func (h *TemplateHandler) RegisterRoutes(r *gin.RouterGroup) {
+	templates := r.Group("/templates")
+	{
+		templates.GET("", h.ListTemplates)
+		templates.POST("", h.CreateTemplate)
+		templates.GET("/:template_id", h.GetTemplate)
+		templates.PUT("/:template_id", h.UpdateTemplate)
+		templates.DELETE("/:template_id", h.DeleteTemplate)
+		templates.GET("/:template_id/versions", h.ListTemplateVersions)
+		templates.GET("/:template_id/versions/:version", h.GetTemplateVersion)
+		templates.POST("/:template_id/render", h.RenderTemplate)
+		templates.POST("/:template_id/send", h.SendTemplate)
+	}
+}
+
+// RenderTemplateRequest supplies values for a template's variables.
+// Version 0 (or omitted) uses the current version.
+type RenderTemplateRequest struct {
+	Values  map[string]interface{} `json:"values"`
+	Version int                    `json:"version,omitempty"`
+}
+
+// SendTemplateRequest renders a template and sends it to a chat session.
+// The generation params apply to this message only.
+type SendTemplateRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+	RenderTemplateRequest
+	models.GenerationParams
+}
+
+// ListTemplates lists the user's templates and those shared with their teams
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.templateService.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates, "total": len(templates)})
+}
+
+// GetTemplate gets a template with its current version
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tmpl, err := h.templateService.Get(userID, c.Param("template_id"))
+	if err != nil {
+		respondTemplateError(c, err, "Failed to get template")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": tmpl})
+}
+
+// CreateTemplate creates a template owned by the user
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.TemplateInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	tmpl, err := h.templateService.Create(userID, req)
+	if err != nil {
+		respondTemplateError(c, err, "Failed to create template")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"template": tmpl})
+}
+
+// UpdateTemplate changes a template; a new body or variables add a version
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.TemplateInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	tmpl, err := h.templateService.Update(userID, c.Param("template_id"), req)
+	if err != nil {
+		respondTemplateError(c, err, "Failed to update template")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": tmpl})
+}
+
+// DeleteTemplate deletes a template and its history
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.templateService.Delete(userID, c.Param("template_id")); err != nil {
+		respondTemplateError(c, err, "Failed to delete template")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// ListTemplateVersions lists a template's versions, newest first
+func (h *TemplateHandler) ListTemplateVersions(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.templateService.Versions(userID, c.Param("template_id"))
+	if err != nil {
+		respondTemplateError(c, err, "Failed to list template versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "total": len(versions)})
+}
+
+// GetTemplateVersion gets one version of a template
+func (h *TemplateHandler) GetTemplateVersion(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	v, err := h.templateService.Version(userID, c.Param("template_id"), version)
+	if err != nil {
+		respondTemplateError(c, err, "Failed to get template version")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": v})
+}
+
+// RenderTemplate fills a template with values without sending it
+func (h *TemplateHandler) RenderTemplate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RenderTemplateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	text, v, err := h.templateService.Render(userID, c.Param("template_id"), req.Version, req.Values)
+	if err != nil {
+		respondTemplateError(c, err, "Failed to render template")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template_id": v.TemplateID, "version": v.Version, "text": text})
+}
+
+// SendTemplate renders a template and sends the result as a chat message
+// in the given session. It costs a chat token like any other message.
+func (h *TemplateHandler) SendTemplate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req SendTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, err := database.NewChatRepository(h.chat.db.WithContext(ctx)).GetSession(req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat session"})
+		return
+	}
+	if session == nil || session.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
+
+	text, _, err := h.templateService.Render(userID, c.Param("template_id"), req.Version, req.Values)
+	if err != nil {
+		respondTemplateError(c, err, "Failed to render template")
+		return
+	}
+
+	if !h.chat.checkChatTokens(ctx, userID) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Insufficient chat tokens"})
+		return
+	}
+
+	h.chat.sendMessage(c, userID, &ai.ServiceChatRequest{
+		SessionID: session.ID,
+		Message:   text,
+		Params:    req.GenerationParams,
+	})
+}
+
+// requireUserID returns the authenticated user or writes a 401
+func requireUserID(c *gin.Context) (string, bool) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return "", false
+	}
+	return userID, true
+}
+
+func respondTemplateError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+	case errors.Is(err, services.ErrTeamNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+	case errors.Is(err, services.ErrTemplateForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTemplate), errors.Is(err, prompts.ErrInvalidTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template", "message": err.Error()})
+	case errors.Is(err, prompts.ErrInvalidValues):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template values", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"gryt-backend/internal/ai"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/services"
+)
+
+// Database pings the connection pool and reports its usage
+func Database(db *database.DB) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return nil, fmt.Errorf("ping failed: %w", err)
+		}
+		stats := db.Stats()
+		return map[string]interface{}{
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+		}, nil
+	}
+}
+
+// Migrations compares the newest version recorded in schema_migrations with
+// the newest migration file shipped with the binary
+func Migrations(db *database.DB, expected int) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		var applied int
+		err := db.GetContext(ctx, &applied, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+		details := map[string]interface{}{
+			"applied":  applied,
+			"expected": expected,
+		}
+		if err != nil {
+			return details, fmt.Errorf("failed to read schema version: %w", err)
+		}
+		if applied < expected {
+			return details, fmt.Errorf("schema is at version %d, binary expects %d", applied, expected)
+		}
+		return details, nil
+	}
+}
+
+// LatestMigration returns the highest numeric prefix among the *.sql files
+// in fsys (e.g. 009 for 009_create_schema_migrations_table.sql)
+func LatestMigration(fsys fs.FS, dir string) (int, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	latest := 0
+	for _, e := range entries {
+		name := path.Base(e.Name())
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// AIGateway lists the gateway models. Wrap it with Cached; every probe is a
+// real upstream request.
+func AIGateway(client *ai.Client) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		models, err := client.GetModels(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"models": len(models)}, nil
+	}
+}
+
+// RateLimitStore reports the size of the in-memory limiter store
+func RateLimitStore(rl *services.RateLimitService) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if rl == nil {
+			return nil, fmt.Errorf("rate limit store not initialised")
+		}
+		return map[string]interface{}{
+			"backend": "memory",
+			"keys":    rl.Size(),
+		}, nil
+	}
+}
@@ -0,0 +1,168 @@
+// Package health implements the liveness and readiness reports served on
+// /livez and /readyz.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gryt-backend/internal/buildinfo"
+)
+
+// Status of a single dependency or of the whole report
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// CheckFunc probes one dependency. Details are included in the report even
+// when the check fails.
+type CheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// Result is the outcome of one check
+type Result struct {
+	Status    Status                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	LatencyMS float64                `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the readiness response body
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+	Build  buildinfo.Info    `json:"build"`
+	Uptime string            `json:"uptime"`
+}
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Checker runs the registered checks concurrently. A failing critical check
+// marks the service down (not ready); a failing non-critical check only
+// degrades it, so an upstream outage does not pull every instance out of
+// the load balancer at once.
+type Checker struct {
+	checks   []check
+	timeout  time.Duration
+	started  time.Time
+	draining atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		started: time.Now(),
+	}
+}
+
+// Add registers a check
+func (c *Checker) Add(name string, critical bool, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// SetDraining makes every following readiness report "down" so load
+// balancers stop routing new traffic during shutdown
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Uptime returns how long the process has been running
+func (c *Checker) Uptime() time.Duration {
+	return time.Since(c.started).Round(time.Second)
+}
+
+// Run executes all checks and aggregates the result
+func (c *Checker) Run(ctx context.Context) Report {
+	results := make(map[string]Result, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func(chk check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			details, err := chk.fn(checkCtx)
+			result := Result{
+				Status:    StatusOK,
+				Critical:  chk.critical,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[chk.name] = result
+			mu.Unlock()
+		}(chk)
+	}
+	wg.Wait()
+
+	if c.draining.Load() {
+		results["shutdown"] = Result{Status: StatusDown, Critical: true, Error: "server is draining"}
+	}
+
+	status := StatusOK
+	for _, r := range results {
+		if r.Status != StatusDown {
+			continue
+		}
+		if r.Critical {
+			status = StatusDown
+			break
+		}
+		status = StatusDegraded
+	}
+
+	return Report{
+		Status: status,
+		Checks: results,
+		Build:  buildinfo.Get(),
+		Uptime: c.Uptime().String(),
+	}
+}
+
+// Cached wraps fn so it runs at most once per ttl; callers in between get
+// the previous outcome. Used for probes that cost money or quota.
+func Cached(ttl time.Duration, fn CheckFunc) CheckFunc {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		details   map[string]interface{}
+		lastErr   error
+	)
+
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if checkedAt.IsZero() || time.Since(checkedAt) >= ttl {
+			details, lastErr = fn(ctx)
+			checkedAt = time.Now()
+		}
+
+		out := make(map[string]interface{}, len(details)+1)
+		for k, v := range details {
+			out[k] = v
+		}
+		out["checked_at"] = checkedAt.UTC().Format(time.RFC3339)
+		return out, lastErr
+	}
+}
@@ -0,0 +1,141 @@
+// Package logging configures the process-wide slog logger: JSON (or text)
+// output, a level taken from config.ServerConfig, secret redaction, and
+// per-request fields (request_id, user_id, route, trace_id) carried in the
+// context.
+package logging
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+
+	"gryt-backend/internal/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup builds the logger described by cfg, installs it as the slog default
+// and routes the standard library logger through it
+func Setup(cfg config.ServerConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       ParseLevel(cfg.LogLevel),
+		ReplaceAttr: redactAttr,
+	}
+
+	var handler slog.Handler
+	if cfg.LogFormat == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
+	logger := slog.New(&contextHandler{Handler: handler})
+	slog.SetDefault(logger)
+
+	// Anything still using the log package ends up as an info record
+	log.SetFlags(0)
+	return logger
+}
+
+// ParseLevel maps a config level name to a slog level, defaulting to info
+func ParseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// requestFields holds the per-request values added to every record logged
+// with the request context. It is mutable because the user is only known
+// after the auth middleware has run, while the access log line is written
+// by a middleware that started before it.
+type requestFields struct {
+	mu        sync.RWMutex
+	requestID string
+	userID    string
+	route     string
+}
+
+type fieldsKey struct{}
+
+// NewContext returns a context carrying a request ID for log records
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &requestFields{requestID: requestID})
+}
+
+func fieldsFrom(ctx context.Context) *requestFields {
+	if ctx == nil {
+		return nil
+	}
+	f, _ := ctx.Value(fieldsKey{}).(*requestFields)
+	return f
+}
+
+// RequestID returns the request ID stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	if f := fieldsFrom(ctx); f != nil {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+		return f.requestID
+	}
+	return ""
+}
+
+// SetUserID attaches the authenticated user to the request's log fields
+func SetUserID(ctx context.Context, userID string) {
+	if f := fieldsFrom(ctx); f != nil {
+		f.mu.Lock()
+		f.userID = userID
+		f.mu.Unlock()
+	}
+}
+
+// SetRoute attaches the matched route pattern to the request's log fields
+func SetRoute(ctx context.Context, route string) {
+	if f := fieldsFrom(ctx); f != nil {
+		f.mu.Lock()
+		f.route = route
+		f.mu.Unlock()
+	}
+}
+
+// contextHandler adds request fields from the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	if f := fieldsFrom(ctx); f != nil {
+		f.mu.RLock()
+		if f.requestID != "" {
+			r.AddAttrs(slog.String("request_id", f.requestID))
+		}
+		if f.userID != "" {
+			r.AddAttrs(slog.String("user_id", f.userID))
+		}
+		if f.route != "" {
+			r.AddAttrs(slog.String("route", f.route))
+		}
+		f.mu.RUnlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
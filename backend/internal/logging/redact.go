@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names whose values are never logged. Keys are
+// compared lower-cased with '-' folded to '_'.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"passwordhash":  true,
+	"secret":        true,
+	"client_secret": true,
+	"jwt_secret":    true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"access_key":    true,
+	"accesskey":     true,
+	"api_key":       true,
+	"apikey":        true,
+	"x_access_key":  true,
+	"authorization": true,
+	"cookie":        true,
+	"set_cookie":    true,
+	"code_verifier": true,
+}
+
+// IsSensitiveKey reports whether an attribute, header or field name holds
+// a credential
+func IsSensitiveKey(key string) bool {
+	k := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	if sensitiveKeys[k] {
+		return true
+	}
+	return strings.HasSuffix(k, "_password") || strings.HasSuffix(k, "_secret") ||
+		strings.HasSuffix(k, "_token") || strings.HasSuffix(k, "_api_key")
+}
+
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Authorization header values
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + redacted},
+	// JWTs and other three-part base64url tokens
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), redacted},
+	// key=value / key: value pairs in free text and query strings, and
+	// "key": value in JSON
+	{regexp.MustCompile(`(?i)\b((?:access[_-]?key|api[_-]?key|password|secret|token|refresh_token|client_secret)"?\s*[=:]\s*)("[^"]*"|[^\s&,;"]+)`), "${1}" + redacted},
+}
+
+// RedactString masks credentials embedded in free text such as error
+// messages
+func RedactString(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// redactAttr is the slog ReplaceAttr hook: it blanks sensitive attributes by
+// name and scrubs credential-looking substrings from string values
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); s != "" {
+			if clean := RedactString(s); clean != s {
+				return slog.String(a.Key, clean)
+			}
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+
+	return a
+}
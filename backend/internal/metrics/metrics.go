@@ -0,0 +1,171 @@
+// Package metrics defines the Prometheus collectors exposed on /metrics.
+// Collectors live on a private registry so only what is registered here is
+// scraped.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gryt"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	aiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "ai",
+		Name:      "request_duration_seconds",
+		Help:      "Upstream AI gateway call latency, until the last byte for streams.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30, 60, 120},
+	}, []string{"model", "stream", "outcome"})
+
+	aiTimeToFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "ai",
+		Name:      "time_to_first_token_seconds",
+		Help:      "Time from sending a streaming request to the first content chunk.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15},
+	}, []string{"model"})
+
+	aiTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ai",
+		Name:      "tokens_total",
+		Help:      "Tokens reported by the AI gateway, by model and type (prompt/completion).",
+	}, []string{"model", "type"})
+
+	toolExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "tool",
+		Name:      "executions_total",
+		Help:      "Tool executions by tool name and outcome.",
+	}, []string{"tool", "outcome"})
+
+	toolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "tool",
+		Name:      "duration_seconds",
+		Help:      "Tool execution latency by tool name.",
+		Buckets:   []float64{0.005, 0.025, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"tool"})
+
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by a rate limiter (global, ai, login).",
+	}, []string{"limiter"})
+
+	activeStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "sse",
+		Name:      "active_streams",
+		Help:      "Server-sent event streams currently open.",
+	})
+
+	activeGenerations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ai",
+		Name:      "active_generations",
+		Help:      "Chat generations in flight, streaming or not.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		aiRequestDuration,
+		aiTimeToFirstToken,
+		aiTokens,
+		toolExecutions,
+		toolDuration,
+		rateLimitRejections,
+		activeStreams,
+		activeGenerations,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDBStats exports connection pool statistics for db
+func RegisterDBStats(db *sql.DB, name string) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveHTTPRequest records one served HTTP request. route must be the
+// route pattern, not the raw path, to keep label cardinality bounded.
+func ObserveHTTPRequest(route, method string, status int, duration time.Duration) {
+	httpRequestDuration.WithLabelValues(route, method, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveAIRequest records an upstream AI call
+func ObserveAIRequest(model string, stream bool, err error, duration time.Duration) {
+	aiRequestDuration.WithLabelValues(model, strconv.FormatBool(stream), outcome(err)).Observe(duration.Seconds())
+}
+
+// ObserveTimeToFirstToken records streaming time-to-first-token
+func ObserveTimeToFirstToken(model string, duration time.Duration) {
+	aiTimeToFirstToken.WithLabelValues(model).Observe(duration.Seconds())
+}
+
+// AddTokens counts prompt and completion tokens used by model
+func AddTokens(model string, prompt, completion int) {
+	if prompt > 0 {
+		aiTokens.WithLabelValues(model, "prompt").Add(float64(prompt))
+	}
+	if completion > 0 {
+		aiTokens.WithLabelValues(model, "completion").Add(float64(completion))
+	}
+}
+
+// ObserveTool records a tool execution
+func ObserveTool(tool string, err error, duration time.Duration) {
+	toolExecutions.WithLabelValues(tool, outcome(err)).Inc()
+	toolDuration.WithLabelValues(tool).Observe(duration.Seconds())
+}
+
+// RateLimitRejected counts a request refused by limiter
+func RateLimitRejected(limiter string) {
+	rateLimitRejections.WithLabelValues(limiter).Inc()
+}
+
+// StreamStarted marks an SSE stream as open; call the returned func when it
+// closes
+func StreamStarted() func() {
+	activeStreams.Inc()
+	return activeStreams.Dec
+}
+
+// GenerationStarted marks a chat generation as in flight; call the returned
+// func when it ends
+func GenerationStarted() func() {
+	activeGenerations.Inc()
+	return activeGenerations.Dec
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
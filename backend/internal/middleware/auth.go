@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"strings"
 
+	"gryt-backend/internal/services"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -81,4 +83,14 @@ func GetUserIDFromStdContext(ctx context.Context) (string, bool) {
 // SetUserIDInContext sets user ID in standard context
 func SetUserIDInContext(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, "user_id", userID)
-}
\ No newline at end of file
+}
+
+// GetAuditActor describes the caller of the current request for the audit trail
+func GetAuditActor(c *gin.Context) services.AuditActor {
+	userID, _ := GetUserIDFromContext(c)
+	return services.AuditActor{
+		UserID:    userID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
@@ -1,40 +1,65 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"gryt-backend/internal/logging"
+	"gryt-backend/internal/metrics"
 	"gryt-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
-// Logger middleware untuk logging requests
+// Logger middleware writes one structured access log record per request.
+// Only the path is logged, never the query string, because unlock and OIDC
+// links carry tokens there.
 func Logger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
-		)
-	})
+	return func(c *gin.Context) {
+		start := time.Now()
+		logging.SetRoute(c.Request.Context(), c.FullPath())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
 }
 
 // Recovery middleware untuk panic recovery
 func Recovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
-		log.Printf("Panic recovered: %v", recovered)
+		slog.ErrorContext(c.Request.Context(), "panic recovered", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
 		})
@@ -95,9 +120,9 @@ func RateLimit(rateLimitService *services.RateLimitService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 		
-		log.Printf("[DEBUG] RateLimit check for IP: %s, Path: %s", ip, c.Request.URL.Path)
 		if !rateLimitService.Allow(ip) {
-			log.Printf("[DEBUG] Rate limit exceeded for IP: %s", ip)
+			slog.WarnContext(c.Request.Context(), "rate limit exceeded", "ip", ip)
+			metrics.RateLimitRejected("global")
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "Rate limit exceeded",
 				"message": "Too many requests, please try again later",
@@ -106,7 +131,6 @@ func RateLimit(rateLimitService *services.RateLimitService) gin.HandlerFunc {
 			return
 		}
 
-		log.Printf("[DEBUG] Rate limit OK for IP: %s", ip)
 		c.Next()
 	}
 }
@@ -123,11 +147,17 @@ func Auth(authService *services.AuthService) gin.HandlerFunc {
 		// Try X-Access-Key header first
 		accessKey := c.GetHeader("X-Access-Key")
 		if accessKey != "" {
-			log.Printf("[DEBUG] Auth middleware: using X-Access-Key: %s", accessKey)
-			// Validate access key
-			user, err := authService.ValidateAccessKey(accessKey)
+			// Validate access key, throttled per IP like the login endpoint
+			user, err := authService.AuthenticateAccessKey(GetAuditActor(c), accessKey)
+			if RespondLoginBlocked(c, err) {
+				c.Abort()
+				return
+			}
 			if err != nil || user == nil {
-				log.Printf("[DEBUG] Auth middleware: X-Access-Key validation failed: %v", err)
+				authService.RecordRejectedCredential(GetAuditActor(c), services.AuditAccessKeyRejected, map[string]interface{}{
+					"key_fingerprint": services.SecretFingerprint(accessKey),
+					"path":            c.Request.URL.Path,
+				})
 				c.JSON(http.StatusUnauthorized, gin.H{
 					"error": "Invalid access key",
 					"message": "Please check your access key and try again",
@@ -139,6 +169,7 @@ func Auth(authService *services.AuthService) gin.HandlerFunc {
 			// Set user info dalam context
 			c.Set("user_id", user.ID)
 			c.Set("user", user)
+			logging.SetUserID(c.Request.Context(), user.ID)
 			c.Next()
 			return
 		}
@@ -168,6 +199,10 @@ func Auth(authService *services.AuthService) gin.HandlerFunc {
 		// Validate token
 		userID, err := authService.ValidateToken(token)
 		if err != nil {
+			authService.RecordRejectedCredential(GetAuditActor(c), services.AuditTokenRejected, map[string]interface{}{
+				"reason": err.Error(),
+				"path":   c.Request.URL.Path,
+			})
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid or expired token",
 			})
@@ -177,10 +212,36 @@ func Auth(authService *services.AuthService) gin.HandlerFunc {
 
 		// Set user ID dalam context
 		c.Set("user_id", userID)
+		logging.SetUserID(c.Request.Context(), userID)
 		c.Next()
 	}
 }
 
+// RespondLoginBlocked answers 429 with Retry-After when a login attempt or
+// an access key was refused by brute-force protection
+func RespondLoginBlocked(c *gin.Context, err error) bool {
+	var blocked *services.LoginBlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(blocked.RetryAfter.Seconds()))
+	message := "Too many failed attempts, please wait before trying again"
+	if blocked.Locked {
+		message = "Too many failed attempts, login is temporarily locked"
+	}
+
+	metrics.RateLimitRejected("login")
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed attempts",
+		"message":     message,
+		"locked":      blocked.Locked,
+		"retry_after": retryAfter,
+	})
+	return true
+}
+
 // AccessKey middleware untuk validasi access key
 func AccessKey(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -258,8 +319,12 @@ func CORS() gin.HandlerFunc {
 func isPublicEndpoint(path string) bool {
 	publicPaths := []string{
 		"/health",
+		"/livez",
+		"/readyz",
 		"/api/auth/login",
 		"/api/auth/validate-key",
+		"/api/auth/unlock",
+		"/api/auth/oidc/",
 	}
 
 	for _, publicPath := range publicPaths {
@@ -336,6 +401,7 @@ func AIRateLimit() gin.HandlerFunc {
 		}
 
 		if !aiRateLimiter.Allow(clientID) {
+			metrics.RateLimitRejected("ai")
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "AI rate limit exceeded",
 				"message": "Too many AI requests, please try again later",
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission middleware allows the request only when the authenticated
+// user's role grants perm. Must run after Auth.
+func RequirePermission(authService *services.AuthService, perm services.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, authService)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "User not authenticated",
+			})
+			c.Abort()
+			return
+		}
+
+		if !services.HasPermission(user.Role, perm) {
+			authService.RecordPermissionDenied(GetAuditActor(c), string(perm), c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "You do not have permission to perform this action",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// currentUser returns the user loaded by Auth, fetching it when only the
+// user ID is known (Bearer token requests)
+func currentUser(c *gin.Context, authService *services.AuthService) (*database.User, bool) {
+	if value, exists := c.Get("user"); exists {
+		if user, ok := value.(*database.User); ok && user != nil {
+			return user, true
+		}
+	}
+
+	userID, exists := GetUserIDFromContext(c)
+	if !exists || userID == "" {
+		return nil, false
+	}
+
+	user, err := authService.GetUserByID(userID)
+	if err != nil || user == nil {
+		return nil, false
+	}
+
+	c.Set("user", user)
+	return user, true
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const responseControllerKey = "response_controller"
+
+// WriteTimeout replaces http.Server.WriteTimeout with a per-request write
+// deadline so long-lived routes (SSE) can extend theirs with
+// StreamTimeout. Register it before any middleware that wraps the writer
+// (gzip), since the deadline is set on the underlying connection.
+func WriteTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rc := http.NewResponseController(c.Writer)
+		if d > 0 {
+			// Not every writer supports deadlines (e.g. httptest); ignore
+			_ = rc.SetWriteDeadline(time.Now().Add(d))
+		}
+		c.Set(responseControllerKey, rc)
+		c.Next()
+	}
+}
+
+// StreamTimeout gives a streaming route its own write deadline. Zero means
+// no deadline; the stream then ends when the generation ends or the client
+// disconnects.
+func StreamTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(responseControllerKey); ok {
+			if rc, ok := v.(*http.ResponseController); ok {
+				var deadline time.Time
+				if d > 0 {
+					deadline = time.Now().Add(d)
+				}
+				_ = rc.SetWriteDeadline(deadline)
+			}
+		}
+		c.Next()
+	}
+}
@@ -74,13 +74,64 @@ type ToolResult struct {
 	Error      string                 `json:"error,omitempty"`
 }
 
-// MessageMetadata represents additional metadata for messages
+// MessageMetadata represents additional metadata for messages. For
+// generated messages it records the effective model and parameters.
 type MessageMetadata struct {
-	Model       string  `json:"model,omitempty"`
-	TokensUsed  int     `json:"tokens_used,omitempty"`
-	Latency     int64   `json:"latency,omitempty"` // in milliseconds
-	Temperature float64 `json:"temperature,omitempty"`
-	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	TokensUsed  int      `json:"tokens_used,omitempty"`
+	Latency     int64    `json:"latency,omitempty"` // in milliseconds
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Partial     bool     `json:"partial,omitempty"` // generation was interrupted
+	PersonaID   string   `json:"persona_id,omitempty"`
+
+	// Citations are the knowledge base passages the reply was given
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// Citation points to a knowledge base passage given to the model; Index is
+// the [n] the reply cites it by
+type Citation struct {
+	Index           int     `json:"index"`
+	KnowledgeBaseID string  `json:"knowledge_base_id"`
+	DocumentID      string  `json:"document_id"`
+	DocumentName    string  `json:"document_name"`
+	Page            int     `json:"page"`
+	ChunkID         string  `json:"chunk_id"`
+	Score           float32 `json:"score"`
+	Excerpt         string  `json:"excerpt"`
+}
+
+// GenerationParams are the model and sampling parameters a client may pick
+// per message or store as session defaults. Nil/empty means inherit.
+type GenerationParams struct {
+	Model       string   `json:"model,omitempty" form:"model"`
+	Temperature *float64 `json:"temperature,omitempty" form:"temperature"`
+	MaxTokens   *int     `json:"max_tokens,omitempty" form:"max_tokens"`
+	TopP        *float64 `json:"top_p,omitempty" form:"top_p"`
+}
+
+// IsZero reports whether no parameter is set
+func (p GenerationParams) IsZero() bool {
+	return p.Model == "" && p.Temperature == nil && p.MaxTokens == nil && p.TopP == nil
+}
+
+// Merge returns p with every unset field taken from defaults
+func (p GenerationParams) Merge(defaults GenerationParams) GenerationParams {
+	if p.Model == "" {
+		p.Model = defaults.Model
+	}
+	if p.Temperature == nil {
+		p.Temperature = defaults.Temperature
+	}
+	if p.MaxTokens == nil {
+		p.MaxTokens = defaults.MaxTokens
+	}
+	if p.TopP == nil {
+		p.TopP = defaults.TopP
+	}
+	return p
 }
 
 // SearchQuery represents a search query
@@ -150,6 +201,31 @@ func (mm *MessageMetadata) Scan(value interface{}) error {
 	}
 }
 
+// Value implements driver.Valuer for GenerationParams; unset params are
+// stored as NULL
+func (p GenerationParams) Value() (driver.Value, error) {
+	if p.IsZero() {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan implements sql.Scanner for GenerationParams
+func (p *GenerationParams) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("cannot scan %T into GenerationParams", value)
+	}
+}
+
 // Value implements driver.Valuer for SearchResults
 func (sr SearchResults) Value() (driver.Value, error) {
 	return json.Marshal(sr)
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Template variable types
+const (
+	VarString  = "string"  // single line text
+	VarText    = "text"    // multi-line text
+	VarNumber  = "number"  // any number
+	VarInteger = "integer" // whole number
+	VarBoolean = "boolean"
+	VarEnum    = "enum" // one of Options
+)
+
+// TemplateVariable defines a {{name}} placeholder in a prompt template
+type TemplateVariable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Options     []string    `json:"options,omitempty"`    // enum only
+	MaxLength   int         `json:"max_length,omitempty"` // string/text only, 0 = no limit
+}
+
+// TemplateVariables is stored as a JSON array
+type TemplateVariables []TemplateVariable
+
+// Value implements driver.Valuer
+func (v TemplateVariables) Value() (driver.Value, error) {
+	if v == nil {
+		v = TemplateVariables{}
+	}
+	return json.Marshal([]TemplateVariable(v))
+}
+
+// Scan implements sql.Scanner
+func (v *TemplateVariables) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, (*[]TemplateVariable)(v))
+	case string:
+		return json.Unmarshal([]byte(data), (*[]TemplateVariable)(v))
+	default:
+		return fmt.Errorf("cannot scan %T into TemplateVariables", value)
+	}
+}
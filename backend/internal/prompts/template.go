@@ -0,0 +1,256 @@
+// Package prompts parses and renders prompt templates with {{variable}}
+// placeholders
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gryt-backend/internal/models"
+)
+
+var (
+	// ErrInvalidTemplate is returned for a body or variable definitions that
+	// cannot be saved
+	ErrInvalidTemplate = errors.New("invalid template")
+	// ErrInvalidValues is returned when render values are missing, unknown
+	// or of the wrong type
+	ErrInvalidValues = errors.New("invalid template values")
+)
+
+// Limits on a single template
+const (
+	MaxBodyLength = 32000
+	MaxVariables  = 50
+)
+
+// placeholder matches {{name}} and {{ name }}
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Placeholders returns the variable names used in body, in order of first
+// use
+func Placeholders(body string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range placeholder.FindAllStringSubmatch(body, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Define checks body and the variable definitions against each other and
+// returns the complete list in placeholder order. Placeholders without a
+// definition become required string variables; definitions the body does
+// not use are rejected.
+func Define(body string, vars models.TemplateVariables) (models.TemplateVariables, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalidTemplate)
+	}
+	if len(body) > MaxBodyLength {
+		return nil, fmt.Errorf("%w: body must be at most %d characters", ErrInvalidTemplate, MaxBodyLength)
+	}
+
+	defined := make(map[string]models.TemplateVariable, len(vars))
+	for _, v := range vars {
+		if _, dup := defined[v.Name]; dup {
+			return nil, fmt.Errorf("%w: variable %q is defined twice", ErrInvalidTemplate, v.Name)
+		}
+		if err := checkVariable(&v); err != nil {
+			return nil, err
+		}
+		defined[v.Name] = v
+	}
+
+	names := Placeholders(body)
+	if len(names) > MaxVariables {
+		return nil, fmt.Errorf("%w: at most %d variables are allowed", ErrInvalidTemplate, MaxVariables)
+	}
+
+	result := make(models.TemplateVariables, 0, len(names))
+	used := make(map[string]bool, len(names))
+	for _, name := range names {
+		used[name] = true
+		v, ok := defined[name]
+		if !ok {
+			v = models.TemplateVariable{Name: name, Type: models.VarString, Required: true}
+		}
+		result = append(result, v)
+	}
+	for _, v := range vars {
+		if !used[v.Name] {
+			return nil, fmt.Errorf("%w: variable %q is not used in the body", ErrInvalidTemplate, v.Name)
+		}
+	}
+
+	return result, nil
+}
+
+// checkVariable validates one definition; an empty type becomes string
+func checkVariable(v *models.TemplateVariable) error {
+	if !variableName.MatchString(v.Name) {
+		return fmt.Errorf("%w: variable name %q must be a letter or _ followed by letters, digits or _ (max 64)", ErrInvalidTemplate, v.Name)
+	}
+	if v.Type == "" {
+		v.Type = models.VarString
+	}
+
+	switch v.Type {
+	case models.VarString, models.VarText:
+		if v.MaxLength < 0 {
+			return fmt.Errorf("%w: variable %q: max_length must not be negative", ErrInvalidTemplate, v.Name)
+		}
+	case models.VarNumber, models.VarInteger, models.VarBoolean:
+	case models.VarEnum:
+		if len(v.Options) == 0 {
+			return fmt.Errorf("%w: variable %q: enum needs options", ErrInvalidTemplate, v.Name)
+		}
+	default:
+		return fmt.Errorf("%w: variable %q has unknown type %q", ErrInvalidTemplate, v.Name, v.Type)
+	}
+	if v.Type != models.VarEnum && len(v.Options) > 0 {
+		return fmt.Errorf("%w: variable %q: options are only allowed for enum", ErrInvalidTemplate, v.Name)
+	}
+
+	if v.Default != nil {
+		if _, err := format(*v, v.Default); err != nil {
+			return fmt.Errorf("%w: variable %q: default %v", ErrInvalidTemplate, v.Name, err)
+		}
+	}
+	return nil
+}
+
+// Render substitutes values into body. Missing optional variables use
+// their default or render empty. Every problem is reported at once in the
+// returned error.
+func Render(body string, vars models.TemplateVariables, values map[string]interface{}) (string, error) {
+	var problems []string
+
+	defined := make(map[string]bool, len(vars))
+	rendered := make(map[string]string, len(vars))
+	for _, v := range vars {
+		defined[v.Name] = true
+
+		value, ok := values[v.Name]
+		if !ok || value == nil {
+			value = v.Default
+		}
+		if value == nil {
+			if v.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", v.Name))
+			}
+			continue
+		}
+
+		s, err := format(v, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %v", v.Name, err))
+			continue
+		}
+		if v.Required && strings.TrimSpace(s) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", v.Name))
+			continue
+		}
+		rendered[v.Name] = s
+	}
+
+	var unknown []string
+	for name := range values {
+		if !defined[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("%s is not a variable of this template", name))
+	}
+
+	if len(problems) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidValues, strings.Join(problems, "; "))
+	}
+
+	// One pass, so values that contain {{...}} are not expanded again
+	return placeholder.ReplaceAllStringFunc(body, func(m string) string {
+		return rendered[placeholder.FindStringSubmatch(m)[1]]
+	}), nil
+}
+
+// format checks value against the variable's type and returns its text
+func format(v models.TemplateVariable, value interface{}) (string, error) {
+	switch v.Type {
+	case models.VarString, models.VarText:
+		s, ok := value.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		if v.Type == models.VarString && strings.ContainsAny(s, "\r\n") {
+			return "", errors.New("must be a single line")
+		}
+		if v.MaxLength > 0 && len([]rune(s)) > v.MaxLength {
+			return "", fmt.Errorf("must be at most %d characters", v.MaxLength)
+		}
+		return s, nil
+
+	case models.VarNumber, models.VarInteger:
+		f, ok := number(value)
+		if !ok {
+			return "", errors.New("must be a number")
+		}
+		if v.Type == models.VarInteger {
+			if f != math.Trunc(f) {
+				return "", errors.New("must be a whole number")
+			}
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case models.VarBoolean:
+		switch b := value.(type) {
+		case bool:
+			return strconv.FormatBool(b), nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return strconv.FormatBool(parsed), nil
+			}
+		}
+		return "", errors.New("must be true or false")
+
+	case models.VarEnum:
+		s, ok := value.(string)
+		if ok {
+			for _, option := range v.Options {
+				if s == option {
+					return s, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("must be one of %s", strings.Join(v.Options, ", "))
+	}
+
+	return "", fmt.Errorf("has unknown type %q", v.Type)
+}
+
+// number accepts JSON numbers and numeric strings (form values)
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, !math.IsNaN(n) && !math.IsInf(n, 0)
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	return 0, false
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidRole   = errors.New("invalid role")
+	ErrSelfLockout   = errors.New("admins cannot deactivate or demote themselves")
+	ErrInvalidAmount = errors.New("token amounts must not be negative")
+)
+
+// AdminService implements the administrative user management API. Every
+// mutating call is recorded in the audit trail.
+type AdminService struct {
+	userRepo  *database.UserRepository
+	usageRepo *database.UsageRepository
+	audit     *AuditService
+	settings  *config.Store
+}
+
+func NewAdminService(userRepo *database.UserRepository, usageRepo *database.UsageRepository, audit *AuditService, settings *config.Store) *AdminService {
+	return &AdminService{
+		userRepo:  userRepo,
+		usageRepo: usageRepo,
+		audit:     audit,
+		settings:  settings,
+	}
+}
+
+func (s *AdminService) ListUsers(filter database.UserFilter) ([]database.User, int, error) {
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.userRepo.List(filter)
+}
+
+func (s *AdminService) GetUser(userID string) (*database.User, error) {
+	user, err := s.userRepo.GetByIDAnyStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *AdminService) SetUserActive(actor AuditActor, userID string, active bool) (*database.User, error) {
+	action := AuditUserActivate
+	if !active {
+		action = AuditUserDeactivate
+	}
+
+	if !active && actor.UserID == userID {
+		s.record(actor, action, userID, AuditDenied, nil)
+		return nil, ErrSelfLockout
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.SetActive(userID, active); err != nil {
+		s.record(actor, action, userID, AuditFailure, nil)
+		return nil, err
+	}
+	user.IsActive = active
+
+	s.record(actor, action, userID, AuditSuccess, nil)
+	return user, nil
+}
+
+func (s *AdminService) SetUserRole(actor AuditActor, userID, role string) (*database.User, error) {
+	if !IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if actor.UserID == userID && role != RoleAdmin {
+		s.record(actor, AuditUserRole, userID, AuditDenied, map[string]interface{}{"role": role})
+		return nil, ErrSelfLockout
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := user.Role
+	if err := s.userRepo.SetRole(userID, role); err != nil {
+		s.record(actor, AuditUserRole, userID, AuditFailure, map[string]interface{}{"role": role})
+		return nil, err
+	}
+	user.Role = role
+
+	s.record(actor, AuditUserRole, userID, AuditSuccess, map[string]interface{}{
+		"previous_role": previous,
+		"role":          role,
+	})
+	return user, nil
+}
+
+// GrantTokens adds chat and search tokens on top of the user's balance
+func (s *AdminService) GrantTokens(actor AuditActor, userID string, chatTokens, searchTokens int) (*database.User, error) {
+	if chatTokens < 0 || searchTokens < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	if _, err := s.GetUser(userID); err != nil {
+		return nil, err
+	}
+
+	meta := map[string]interface{}{"chat_tokens": chatTokens, "search_tokens": searchTokens}
+	if err := s.userRepo.AddTokens(userID, chatTokens, searchTokens); err != nil {
+		s.record(actor, AuditTokensGrant, userID, AuditFailure, meta)
+		return nil, err
+	}
+
+	s.record(actor, AuditTokensGrant, userID, AuditSuccess, meta)
+	return s.GetUser(userID)
+}
+
+// ResetTokens sets the balance to the given values, or to the configured
+// per-user defaults when they are nil
+func (s *AdminService) ResetTokens(actor AuditActor, userID string, chatTokens, searchTokens *int) (*database.User, error) {
+	limits := s.settings.Get().Limits
+	chat := limits.ChatTokensPerUser
+	if chatTokens != nil {
+		chat = *chatTokens
+	}
+	search := limits.SearchTokensPerUser
+	if searchTokens != nil {
+		search = *searchTokens
+	}
+	if chat < 0 || search < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := map[string]interface{}{
+		"previous_chat_tokens":   user.ChatTokens,
+		"previous_search_tokens": user.SearchTokens,
+		"chat_tokens":            chat,
+		"search_tokens":          search,
+	}
+	if err := s.userRepo.UpdateTokens(userID, chat, search); err != nil {
+		s.record(actor, AuditTokensReset, userID, AuditFailure, meta)
+		return nil, err
+	}
+	user.ChatTokens = chat
+	user.SearchTokens = search
+
+	s.record(actor, AuditTokensReset, userID, AuditSuccess, meta)
+	return user, nil
+}
+
+// RotateAccessKey replaces the user's access key and returns the new one.
+// The old key stops working immediately.
+func (s *AdminService) RotateAccessKey(actor AuditActor, userID string) (string, error) {
+	return s.replaceAccessKey(actor, userID, AuditAccessKeyRotate)
+}
+
+// RevokeAccessKey replaces the user's access key with one that is never
+// disclosed, so the user can only log in through other means
+func (s *AdminService) RevokeAccessKey(actor AuditActor, userID string) error {
+	_, err := s.replaceAccessKey(actor, userID, AuditAccessKeyRevoke)
+	return err
+}
+
+func (s *AdminService) replaceAccessKey(actor AuditActor, userID, action string) (string, error) {
+	if _, err := s.GetUser(userID); err != nil {
+		return "", err
+	}
+
+	accessKey, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.userRepo.UpdateAccessKey(userID, accessKey); err != nil {
+		s.record(actor, action, userID, AuditFailure, nil)
+		return "", err
+	}
+
+	s.record(actor, action, userID, AuditSuccess, nil)
+	return accessKey, nil
+}
+
+func (s *AdminService) GetUserUsage(userID string, since time.Time) (*database.UserUsage, error) {
+	usage, err := s.usageRepo.GetUserUsage(userID, since)
+	if err != nil {
+		return nil, err
+	}
+	if usage == nil {
+		return nil, ErrUserNotFound
+	}
+	return usage, nil
+}
+
+func (s *AdminService) GetUsageSummary(since time.Time, limit int) ([]database.UserUsage, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return s.usageRepo.GetTopUsage(since, limit)
+}
+
+func (s *AdminService) record(actor AuditActor, action, targetID, outcome string, meta map[string]interface{}) {
+	s.audit.Record(AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		TargetType: "user",
+		TargetID:   targetID,
+		Outcome:    outcome,
+		Metadata:   meta,
+	})
+}
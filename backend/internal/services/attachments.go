@@ -0,0 +1,446 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrQuotaExceeded      = errors.New("attachment quota exceeded")
+	ErrInvalidDownloadURL = errors.New("invalid or expired download link")
+)
+
+// Limits on attachments
+const (
+	MaxAttachmentName     = 255
+	MaxMessageAttachments = 10
+	attachmentListLimit   = 200
+)
+
+// Blob sweeping: blobs nobody refers to any more (a deleted user's uploads)
+// are removed once they are older than blobSweepAge
+const (
+	blobSweepAge   = time.Hour
+	blobSweepBatch = 100
+)
+
+// AttachmentService stores uploaded files in the blob store, deduplicated
+// by content, and hands out signed download links
+type AttachmentService struct {
+	attachments *database.AttachmentRepository
+	store       storage.Store
+	config      config.StorageConfig
+}
+
+func NewAttachmentService(attachments *database.AttachmentRepository, store storage.Store, cfg config.StorageConfig) *AttachmentService {
+	return &AttachmentService{attachments: attachments, store: store, config: cfg}
+}
+
+// AttachmentLink is an attachment with a signed download URL
+type AttachmentLink struct {
+	database.Attachment
+	URL          string    `json:"url"`
+	URLExpiresAt time.Time `json:"url_expires_at"`
+}
+
+// AttachmentUsage is what a user stores against their quota; Quota 0 is
+// unlimited
+type AttachmentUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+	Quota int64 `json:"quota"`
+}
+
+// MaxFileSize is the largest file that can be uploaded, in bytes
+func (s *AttachmentService) MaxFileSize() int64 {
+	return s.config.MaxFileSize
+}
+
+// MaxMessageSize is the most that can be uploaded with one chat message,
+// all files together, in bytes
+func (s *AttachmentService) MaxMessageSize() int64 {
+	return s.config.MaxMessageSize
+}
+
+// Upload is a file that was read and checked but is not stored yet
+type Upload struct {
+	Name     string
+	MimeType string // sniffed from the content
+	SHA256   string
+	Data     []byte
+}
+
+// Attachment describes the upload as the attachment it will become, without
+// an ID
+func (u *Upload) Attachment() database.Attachment {
+	return database.Attachment{SHA256: u.SHA256, Name: u.Name, MimeType: u.MimeType, Size: int64(len(u.Data))}
+}
+
+// ReadFile reads a multipart upload, refusing it when over the size limit
+func (s *AttachmentService) ReadFile(file *multipart.FileHeader) (*Upload, error) {
+	limit := s.config.MaxFileSize
+	if file.Size > limit {
+		return nil, fmt.Errorf("%w: %s is larger than %d MB", ErrInvalidAttachment, file.Filename, limit>>20)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", ErrInvalidAttachment, file.Filename)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", ErrInvalidAttachment, file.Filename)
+	}
+	return s.Prepare(file.Filename, data)
+}
+
+// Prepare checks a file called name and detects its type. The type is
+// sniffed from the content, not taken from the client.
+func (s *AttachmentService) Prepare(name string, data []byte) (*Upload, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "." || name == string(filepath.Separator) || name == "" {
+		return nil, fmt.Errorf("%w: file name is required", ErrInvalidAttachment)
+	}
+	if utf8.RuneCountInString(name) > MaxAttachmentName {
+		return nil, fmt.Errorf("%w: file name is longer than %d characters", ErrInvalidAttachment, MaxAttachmentName)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %s is empty", ErrInvalidAttachment, name)
+	}
+	if int64(len(data)) > s.config.MaxFileSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d MB", ErrInvalidAttachment, name, s.config.MaxFileSize>>20)
+	}
+
+	sum := sha256.Sum256(data)
+	return &Upload{
+		Name:     name,
+		MimeType: SniffMimeType(name, data),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Data:     data,
+	}, nil
+}
+
+// Store saves an upload as the user's attachment. Content the user already
+// stores costs no quota; content anyone already stores is not written to
+// the blob store again.
+func (s *AttachmentService) Store(ctx context.Context, userID string, u *Upload) (*AttachmentLink, error) {
+	a := u.Attachment()
+	a.ID = uuid.New().String()
+	a.UserID = userID
+
+	repo := s.attachments.WithContext(ctx)
+	err := repo.Create(&a, s.config.UserQuota, func() error {
+		if err := s.store.Put(ctx, a.SHA256, u.Data, a.MimeType); err != nil {
+			return fmt.Errorf("failed to store attachment: %w", err)
+		}
+		return nil
+	})
+	var quotaErr *database.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return nil, fmt.Errorf("%w: %s needs %d KB but only %d KB of %d MB is left", ErrQuotaExceeded,
+			a.Name, (a.Size+1023)>>10, max(quotaErr.Quota-quotaErr.Used, 0)>>10, quotaErr.Quota>>20)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := repo.Get(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.link(*stored), nil
+}
+
+// Get returns the user's attachment with a fresh download link
+func (s *AttachmentService) Get(ctx context.Context, userID, id string) (*AttachmentLink, error) {
+	a, err := s.attachment(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.link(*a), nil
+}
+
+// List returns the user's newest attachments with download links
+func (s *AttachmentService) List(ctx context.Context, userID string) ([]AttachmentLink, error) {
+	attachments, err := s.attachments.WithContext(ctx).List(userID, attachmentListLimit)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]AttachmentLink, len(attachments))
+	for i, a := range attachments {
+		links[i] = *s.link(a)
+	}
+	return links, nil
+}
+
+// Usage returns the user's storage use and quota
+func (s *AttachmentService) Usage(ctx context.Context, userID string) (*AttachmentUsage, error) {
+	bytes, files, err := s.attachments.WithContext(ctx).Usage(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &AttachmentUsage{Bytes: bytes, Files: files, Quota: s.config.UserQuota}, nil
+}
+
+// Delete removes the user's attachment, also from the messages it was
+// sent with. Its blob is removed once no other upload uses it.
+func (s *AttachmentService) Delete(ctx context.Context, userID, id string) error {
+	a, err := s.attachment(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.attachments.WithContext(ctx).Delete(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAttachmentNotFound
+	}
+
+	if _, err := s.collect(ctx, a.SHA256); err != nil {
+		// The sweep retries it
+		slog.WarnContext(ctx, "failed to remove attachment blob", "sha256", a.SHA256, "error", err)
+	}
+	return nil
+}
+
+// Resolve returns the user's attachments called ids, in that order and
+// without repeats
+func (s *AttachmentService) Resolve(ctx context.Context, userID string, ids []string) ([]database.Attachment, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > MaxMessageAttachments {
+		return nil, fmt.Errorf("%w: at most %d attachments per message", ErrInvalidAttachment, MaxMessageAttachments)
+	}
+
+	found, err := s.attachments.WithContext(ctx).GetMany(userID, unique)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]database.Attachment, len(found))
+	for _, a := range found {
+		byID[a.ID] = a
+	}
+
+	attachments := make([]database.Attachment, 0, len(unique))
+	for _, id := range unique {
+		a, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrAttachmentNotFound, id)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+// MessageLinks returns the attachments of the given messages with download
+// links, by message ID
+func (s *AttachmentService) MessageLinks(ctx context.Context, messageIDs []string) (map[string][]AttachmentLink, error) {
+	attachments, err := s.attachments.WithContext(ctx).ForMessages(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string][]AttachmentLink)
+	for _, a := range attachments {
+		links[a.MessageID] = append(links[a.MessageID], *s.link(a.Attachment))
+	}
+	return links, nil
+}
+
+// Open checks a signed download link and opens the attachment's bytes;
+// the caller closes the reader
+func (s *AttachmentService) Open(ctx context.Context, id, expires, signature string) (*database.Attachment, io.ReadCloser, error) {
+	if !s.validSignature(id, expires, signature) {
+		return nil, nil, ErrInvalidDownloadURL
+	}
+	a, err := s.attachments.WithContext(ctx).Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a == nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	r, err := s.store.Get(ctx, a.SHA256)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, r, nil
+}
+
+// RunSweep removes unreferenced blobs every interval until ctx is done
+func (s *AttachmentService) RunSweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil {
+				slog.Error("failed to sweep attachment blobs", "error", err)
+			} else if n > 0 {
+				slog.Info("unused attachment blobs removed", "count", n)
+			}
+		}
+	}
+}
+
+// Sweep removes blobs no attachment refers to any more
+func (s *AttachmentService) Sweep(ctx context.Context) (int, error) {
+	removed := 0
+	for {
+		blobs, err := s.attachments.WithContext(ctx).UnusedBlobs(time.Now().Add(-blobSweepAge), blobSweepBatch)
+		if err != nil {
+			return removed, err
+		}
+		progress := false
+		for _, sha := range blobs {
+			ok, err := s.collect(ctx, sha)
+			if err != nil {
+				return removed, err
+			}
+			if ok {
+				removed++
+				progress = true
+			}
+		}
+		if len(blobs) < blobSweepBatch || !progress {
+			return removed, nil
+		}
+	}
+}
+
+// collect removes a blob, row and bytes, if nothing refers to it
+func (s *AttachmentService) collect(ctx context.Context, sha string) (bool, error) {
+	return s.attachments.WithContext(ctx).DeleteBlobIfUnused(sha, func() error {
+		if err := s.store.Delete(ctx, sha); err != nil {
+			return fmt.Errorf("failed to delete blob: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *AttachmentService) attachment(ctx context.Context, userID, id string) (*database.Attachment, error) {
+	a, err := s.attachments.WithContext(ctx).Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || a.UserID != userID {
+		return nil, ErrAttachmentNotFound
+	}
+	return a, nil
+}
+
+// link signs a download URL for a that is valid for URLExpiry
+func (s *AttachmentService) link(a database.Attachment) *AttachmentLink {
+	expires := time.Now().Add(s.config.URLExpiry).Truncate(time.Second)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	query := url.Values{"expires": {exp}, "signature": {s.sign(a.ID, exp)}}
+	return &AttachmentLink{
+		Attachment:   a,
+		URL:          s.config.PublicURL + "/api/files/" + url.PathEscape(a.ID) + "?" + query.Encode(),
+		URLExpiresAt: expires,
+	}
+}
+
+func (s *AttachmentService) sign(id, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.URLSecret))
+	mac.Write([]byte("attachment-download\n" + id + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AttachmentService) validSignature(id, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(id, expires)))
+}
+
+// extensionTypes are the types told apart by file name only: text formats
+// sniff as text/plain and office documents as zip. The system MIME table
+// is used for other extensions.
+var extensionTypes = map[string]string{
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// SniffMimeType detects the type of an upload from its content. Content
+// that only sniffs as plain text, zip or unknown bytes takes the type of
+// its extension when that fits; formats with a signature (images, PDF,
+// HTML...) are never relabelled by the name.
+func SniffMimeType(name string, data []byte) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+
+	ext := strings.ToLower(filepath.Ext(name))
+	byName, ok := extensionTypes[ext]
+	if !ok && ext != "" {
+		byName, _, _ = mime.ParseMediaType(mime.TypeByExtension(ext))
+	}
+	if byName == "" || len(byName) > 100 {
+		return sniffed
+	}
+
+	switch sniffed {
+	case "text/plain":
+		if strings.HasPrefix(byName, "text/") || byName == "application/json" || byName == "application/xml" || byName == "application/yaml" {
+			return byName
+		}
+	case "application/zip":
+		if strings.HasPrefix(byName, "application/vnd.") || byName == "application/epub+zip" {
+			return byName
+		}
+	case "application/octet-stream":
+		if !strings.HasPrefix(byName, "text/") && !strings.HasPrefix(byName, "image/") &&
+			byName != "application/pdf" && byName != "application/zip" {
+			return byName
+		}
+	}
+	return sniffed
+}
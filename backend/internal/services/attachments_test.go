@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+)
+
+func TestSniffMimeType(t *testing.T) {
+	const (
+		docx = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+		xlsx = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	)
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	zip := "PK\x03\x04\x14\x00\x00\x00"
+	binary := "\x00\x01\x02\x03\xfe\xff"
+
+	tests := []struct {
+		name, data, want string
+	}{
+		{"notes.txt", "hello", "text/plain"},
+		{"README.MD", "# Title", "text/markdown"},
+		{"data.csv", "a,b\n1,2\n", "text/csv"},
+		{"config.json", `{"a": 1}`, "application/json"},
+		{"compose.yml", "a: 1", "application/yaml"},
+		{"noextension", "hello", "text/plain"},
+		{"report.docx", zip, docx},
+		{"sheet.XLSX", zip, xlsx},
+		{"report.docx", binary, docx},
+		{"archive.zip", zip, "application/zip"},
+		{"photo.png", png, "image/png"},
+		{"page.html", "<!DOCTYPE html><p>hi", "text/html"},
+		{"report.pdf", "%PDF-1.7\n", "application/pdf"},
+
+		// Content with a signature keeps its type whatever the name says
+		{"invoice.txt", png, "image/png"},
+		{"image.png", "<html><script>alert(1)</script>", "text/html"},
+		{"notes.md", "%PDF-1.7\n", "application/pdf"},
+		{"report.docx", png, "image/png"},
+
+		// Names do not turn plain text or unknown bytes into something else
+		{"fake.pdf", "hello", "text/plain"},
+		{"fake.png", "hello", "text/plain"},
+		{"fake.docx", "hello", "text/plain"},
+		{"fake.zip", binary, "application/octet-stream"},
+		{"fake.pdf", binary, "application/octet-stream"},
+		{"fake.txt", binary, "application/octet-stream"},
+		{"notes.csv", zip, "application/zip"},
+	}
+	for _, tt := range tests {
+		if got := SniffMimeType(tt.name, []byte(tt.data)); got != tt.want {
+			t.Errorf("SniffMimeType(%q, %q) = %q, want %q", tt.name, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentDownloadURL(t *testing.T) {
+	svc := NewAttachmentService(nil, nil, config.StorageConfig{
+		URLSecret: "url-secret",
+		URLExpiry: 10 * time.Minute,
+		PublicURL: "https://gryt.test",
+	})
+	link := svc.link(database.Attachment{ID: "att/1"})
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "gryt.test" || u.EscapedPath() != "/api/files/att%2F1" {
+		t.Errorf("URL = %s", link.URL)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	if exp, _ := strconv.ParseInt(expires, 10, 64); exp != link.URLExpiresAt.Unix() || time.Until(link.URLExpiresAt) > 10*time.Minute {
+		t.Errorf("expires = %s, URLExpiresAt = %v", expires, link.URLExpiresAt)
+	}
+	if !svc.validSignature("att/1", expires, signature) {
+		t.Fatalf("the link's own signature is invalid")
+	}
+
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	tampered := []byte(signature)
+	tampered[0] ^= 1
+	other := NewAttachmentService(nil, nil, config.StorageConfig{URLSecret: "other-secret"})
+	tests := []struct {
+		name                   string
+		id, expires, signature string
+	}{
+		{"other attachment", "att/2", expires, signature},
+		{"extended expiry", "att/1", expires + "0", signature},
+		{"expired", "att/1", past, svc.sign("att/1", past)},
+		{"expiry not a number", "att/1", "soon", svc.sign("att/1", "soon")},
+		{"no signature", "att/1", expires, ""},
+		{"tampered signature", "att/1", expires, string(tampered)},
+		{"signed with another secret", "att/1", expires, other.sign("att/1", expires)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if svc.validSignature(tt.id, tt.expires, tt.signature) {
+				t.Errorf("validSignature = true")
+			}
+			// Rejected before the database is asked for the attachment
+			if _, _, err := svc.Open(context.Background(), tt.id, tt.expires, tt.signature); !errors.Is(err, ErrInvalidDownloadURL) {
+				t.Errorf("Open = %v, want %v", err, ErrInvalidDownloadURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+
+	"gryt-backend/internal/database"
+)
+
+// Audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// Audit actions
+const (
+	AuditLogin             = "auth.login"
+	AuditTokenRefresh      = "auth.token.refresh"
+	AuditAccessKeyRejected = "auth.access_key.rejected"
+	AuditTokenRejected     = "auth.token.rejected"
+	AuditLockout           = "auth.lockout"
+	AuditUnlock            = "auth.unlock"
+	AuditPermissionDenied  = "authz.denied"
+	AuditUserActivate      = "admin.user.activate"
+	AuditUserDeactivate    = "admin.user.deactivate"
+	AuditUserRole          = "admin.user.role"
+	AuditTokensGrant       = "admin.tokens.grant"
+	AuditTokensReset       = "admin.tokens.reset"
+	AuditAccessKeyRotate   = "admin.access_key.rotate"
+	AuditAccessKeyRevoke   = "admin.access_key.revoke"
+	AuditAuditExport       = "admin.audit.export"
+	AuditLockoutClear      = "admin.lockout.unlock"
+	AuditModelCreate       = "admin.model.create"
+	AuditModelUpdate       = "admin.model.update"
+	AuditModelDelete       = "admin.model.delete"
+	AuditModelSync         = "admin.model.sync"
+	AuditPersonaCreate     = "admin.persona.create"
+	AuditPersonaUpdate     = "admin.persona.update"
+	AuditPersonaDelete     = "admin.persona.delete"
+)
+
+// AuditActor identifies who performed an action and from where. UserID is
+// empty for unauthenticated callers.
+type AuditActor struct {
+	UserID    string
+	IP        string
+	UserAgent string
+}
+
+// AuditEntry describes an event to be recorded
+type AuditEntry struct {
+	Actor      AuditActor
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	Metadata   map[string]interface{}
+}
+
+// AuditService is the single emitter for the security audit trail
+type AuditService struct {
+	auditRepo *database.AuditRepository
+}
+
+func NewAuditService(auditRepo *database.AuditRepository) *AuditService {
+	return &AuditService{auditRepo: auditRepo}
+}
+
+// Record writes an event. Failures are logged rather than returned so that
+// auditing never breaks the action being audited.
+func (s *AuditService) Record(entry AuditEntry) {
+	if entry.Outcome == "" {
+		entry.Outcome = AuditSuccess
+	}
+
+	userAgent := entry.Actor.UserAgent
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	event := &database.AuditEvent{
+		ActorID:    entry.Actor.UserID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IP:         entry.Actor.IP,
+		UserAgent:  userAgent,
+		Outcome:    entry.Outcome,
+	}
+
+	if len(entry.Metadata) > 0 {
+		if data, err := json.Marshal(entry.Metadata); err == nil {
+			event.Metadata = string(data)
+		}
+	}
+
+	if err := s.auditRepo.Create(event); err != nil {
+		slog.Error("failed to write audit event", "action", entry.Action, "target_id", entry.TargetID, "error", err)
+	}
+}
+
+// Query returns audit events matching the filter
+func (s *AuditService) Query(filter database.AuditFilter) ([]database.AuditEvent, int, error) {
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 100
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.auditRepo.Query(filter)
+}
+
+// QueryAfter returns the next page of an export: up to limit events with an
+// id above afterID, oldest first
+func (s *AuditService) QueryAfter(filter database.AuditFilter, afterID int64, limit int) ([]database.AuditEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return s.auditRepo.QueryAfter(filter, afterID, limit)
+}
+
+// SecretFingerprint returns a short, non-reversible identifier for a secret
+// so repeated attempts with the same value can be correlated in the audit
+// trail without storing the value itself
+func SecretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:6])
+}
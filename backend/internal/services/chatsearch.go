@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gryt-backend/internal/ai"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/vector"
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+// Limits on chat search
+const (
+	MaxSearchQuery   = 200
+	MaxSearchTerms   = 10
+	MaxSearchResults = 50
+	searchTitleHits  = 5
+	snippetWidth     = 160 // runes around the first match
+
+	// semanticCandidates caps the nearest neighbours fetched per semantic
+	// search; semanticMinScore drops the ones unrelated to the query
+	semanticCandidates = 500
+	semanticMinScore   = 0.2
+)
+
+// SemanticIndex finds a user's messages by meaning
+type SemanticIndex interface {
+	SearchSimilar(ctx context.Context, userID, query string, k int) ([]vector.Match, error)
+}
+
+// SearchInput searches the user's conversations. To is exclusive.
+// Semantic ranks messages by meaning instead of matching words.
+type SearchInput struct {
+	Query    string
+	Semantic bool
+	Role     string
+	Model    string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Offset   int
+}
+
+// SessionMatch is a session whose title matches the search
+type SessionMatch struct {
+	database.ChatSession
+	Highlight string `json:"title_highlight"`
+	Link      string `json:"link"`
+}
+
+// MessageMatch is a message matching the search with a highlighted
+// snippet of its content
+type MessageMatch struct {
+	database.MessageHit
+	Snippet string `json:"snippet"`
+	Link    string `json:"link"`
+}
+
+// SearchResult is one page of search results. Sessions (title matches)
+// are only returned on the first page of a keyword search without
+// role/model filters.
+type SearchResult struct {
+	Query    string         `json:"query"`
+	Sessions []SessionMatch `json:"sessions"`
+	Messages []MessageMatch `json:"messages"`
+	HasMore  bool           `json:"has_more"`
+}
+
+// Search finds the user's messages and sessions matching input.Query.
+// Snippets and highlights are HTML-escaped with matches in <mark>.
+func (s *SessionService) Search(ctx context.Context, userID string, input SearchInput) (*SearchResult, error) {
+	query := strings.TrimSpace(input.Query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidSearch)
+	}
+	if utf8.RuneCountInString(query) > MaxSearchQuery {
+		return nil, fmt.Errorf("%w: q must be at most %d characters", ErrInvalidSearch, MaxSearchQuery)
+	}
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: q has no searchable words", ErrInvalidSearch)
+	}
+	switch input.Role {
+	case "", "user", "assistant", "system":
+	default:
+		return nil, fmt.Errorf("%w: role must be user, assistant or system", ErrInvalidSearch)
+	}
+	if input.Limit <= 0 || input.Limit > MaxSearchResults {
+		input.Limit = 20
+	}
+	if input.Offset < 0 {
+		input.Offset = 0
+	}
+
+	q := database.MessageSearch{
+		Query:  query,
+		Role:   input.Role,
+		Model:  input.Model,
+		From:   input.From,
+		To:     input.To,
+		Limit:  input.Limit + 1,
+		Offset: input.Offset,
+	}
+	var hits []database.MessageHit
+	var err error
+	if input.Semantic {
+		hits, err = s.searchSemantic(ctx, userID, q)
+	} else {
+		hits, err = s.chat.SearchMessages(userID, q)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SearchResult{Query: query, Sessions: []SessionMatch{}, Messages: make([]MessageMatch, 0, len(hits))}
+	if len(hits) > input.Limit {
+		hits, result.HasMore = hits[:input.Limit], true
+	}
+	for _, hit := range hits {
+		result.Messages = append(result.Messages, MessageMatch{
+			MessageHit: hit,
+			Snippet:    snippet(hit.Content, terms, snippetWidth),
+			Link:       sessionLink(hit.SessionID),
+		})
+	}
+
+	if !input.Semantic && input.Offset == 0 && input.Role == "" && input.Model == "" {
+		sessions, err := s.chat.SearchSessionTitles(userID, q, searchTitleHits)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range sessions {
+			result.Sessions = append(result.Sessions, SessionMatch{
+				ChatSession: session,
+				Highlight:   snippet(session.Title, terms, MaxTitleLength),
+				Link:        sessionLink(session.ID),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// searchSemantic returns the page q.Offset, q.Limit of the user's messages
+// nearest in meaning to q.Query that pass q's filters, best first. The
+// neighbours are fetched before filtering, so narrow filters can leave
+// fewer results than exist.
+func (s *SessionService) searchSemantic(ctx context.Context, userID string, q database.MessageSearch) ([]database.MessageHit, error) {
+	k := q.Offset + q.Limit
+	if q.Role != "" || q.Model != "" || q.From != nil || q.To != nil {
+		k *= 4
+	}
+	matches, err := s.semantic.SearchSimilar(ctx, userID, q.Query, min(k, semanticCandidates))
+	if err != nil {
+		if errors.Is(err, ai.ErrEmbeddingsDisabled) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if m.Score >= semanticMinScore {
+			ids = append(ids, m.ID)
+		}
+	}
+	found, err := s.chat.GetMessageHits(userID, ids, q)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]database.MessageHit, len(found))
+	for _, hit := range found {
+		byID[hit.ID] = hit
+	}
+
+	// Keep the index's order; drop what the filters (or the trash) removed
+	hits := make([]database.MessageHit, 0, len(found))
+	for _, m := range matches {
+		if hit, ok := byID[m.ID]; ok {
+			hit.Score = float64(m.Score)
+			hits = append(hits, hit)
+		}
+	}
+	if q.Offset >= len(hits) {
+		return []database.MessageHit{}, nil
+	}
+	return hits[q.Offset:min(q.Offset+q.Limit, len(hits))], nil
+}
+
+func sessionLink(sessionID string) string {
+	return "/api/ai/chat/sessions/" + sessionID
+}
+
+// searchTerms splits a query into distinct lowercased words
+func searchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := unique(words)
+	if len(terms) > MaxSearchTerms {
+		terms = terms[:MaxSearchTerms]
+	}
+	return terms
+}
+
+// snippet cuts about width runes of text around the first match of any
+// term, HTML-escapes it and wraps every match in <mark>
+func snippet(text string, terms []string, width int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// marked[i] is true for runes inside a match
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if !runesEqual(lower[i:i+len(t)], t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := 0
+	if first > width/3 {
+		start = first - width/3
+		// Start at a word when one begins close enough
+		if space := strings.IndexRune(string(runes[start:first]), ' '); space >= 0 {
+			start += utf8.RuneCountInString(string(runes[start:first])[:space]) + 1
+		}
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		part := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			part = "<mark>" + part + "</mark>"
+		}
+		b.WriteString(part)
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/extract"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrKnowledgeBaseNotFound = errors.New("knowledge base not found")
+	ErrDocumentNotFound      = errors.New("document not found")
+	ErrInvalidKnowledgeBase  = errors.New("invalid knowledge base")
+	ErrInvalidDocument       = errors.New("invalid document")
+	ErrKnowledgeDisabled     = errors.New("knowledge bases need an embedding model")
+)
+
+// Limits on knowledge bases
+const (
+	MaxKnowledgeBaseName     = 100
+	MaxKnowledgeBaseDesc     = 1000
+	MaxDocumentName          = 255
+	MaxDocumentSize          = 20 << 20 // bytes
+	MaxDocumentChunks        = 5000
+	MaxSessionKnowledgeBases = 10
+)
+
+// Chunking of document text, in runes
+const (
+	chunkSize    = 1200
+	chunkOverlap = 200
+)
+
+// KnowledgeIndex embeds document chunks and drops deleted ones
+type KnowledgeIndex interface {
+	EmbeddingsEnabled() bool
+	WakeEmbeddings()
+	ForgetVectors(ctx context.Context, ids []string) error
+}
+
+// KnowledgeService manages knowledge bases, their documents and which
+// sessions retrieve from them
+type KnowledgeService struct {
+	knowledge *database.KnowledgeRepository
+	chat      *database.ChatRepository
+	index     KnowledgeIndex
+}
+
+func NewKnowledgeService(knowledge *database.KnowledgeRepository, chat *database.ChatRepository, index KnowledgeIndex) *KnowledgeService {
+	return &KnowledgeService{knowledge: knowledge, chat: chat, index: index}
+}
+
+// KnowledgeBaseInput creates or changes a knowledge base; on update nil
+// fields are left alone
+type KnowledgeBaseInput struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// KnowledgeBaseDetail is a knowledge base with its documents
+type KnowledgeBaseDetail struct {
+	database.KnowledgeBase
+	DocumentList []database.KnowledgeDocument `json:"document_list"`
+}
+
+func (s *KnowledgeService) List(userID string) ([]database.KnowledgeBase, error) {
+	return s.knowledge.ListBases(userID)
+}
+
+// Get returns the user's knowledge base with its documents
+func (s *KnowledgeService) Get(userID, id string) (*KnowledgeBaseDetail, error) {
+	kb, err := s.base(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.knowledge.Documents(id)
+	if err != nil {
+		return nil, err
+	}
+	return &KnowledgeBaseDetail{KnowledgeBase: *kb, DocumentList: docs}, nil
+}
+
+func (s *KnowledgeService) Create(userID string, input KnowledgeBaseInput) (*database.KnowledgeBase, error) {
+	if input.Name == nil {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidKnowledgeBase)
+	}
+	kb := &database.KnowledgeBase{ID: uuid.New().String(), UserID: userID}
+	if err := applyKnowledgeBaseInput(kb, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.knowledge.CreateBase(kb); err != nil {
+		return nil, err
+	}
+	return s.knowledge.GetBase(userID, kb.ID)
+}
+
+func (s *KnowledgeService) Update(userID, id string, input KnowledgeBaseInput) (*database.KnowledgeBase, error) {
+	kb, err := s.base(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyKnowledgeBaseInput(kb, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.knowledge.UpdateBase(kb); err != nil {
+		return nil, err
+	}
+	return s.knowledge.GetBase(userID, id)
+}
+
+// Delete removes the knowledge base and its documents, and detaches it
+// from every session
+func (s *KnowledgeService) Delete(ctx context.Context, userID, id string) error {
+	if _, err := s.base(userID, id); err != nil {
+		return err
+	}
+	chunks, err := s.knowledge.ChunkIDs(id, "")
+	if err != nil {
+		return err
+	}
+
+	if err := s.knowledge.DeleteBase(userID, id); err != nil {
+		return err
+	}
+	s.forget(ctx, chunks)
+	return nil
+}
+
+// AddDocument extracts the text of an upload, splits it into chunks and
+// queues them for embedding. The document is "processing" until every
+// chunk is embedded.
+func (s *KnowledgeService) AddDocument(userID, kbID, name, mimeType string, data []byte) (*database.KnowledgeDocument, error) {
+	if !s.index.EmbeddingsEnabled() {
+		return nil, ErrKnowledgeDisabled
+	}
+	if _, err := s.base(userID, kbID); err != nil {
+		return nil, err
+	}
+
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "." || name == string(filepath.Separator) || name == "" {
+		return nil, fmt.Errorf("%w: file name is required", ErrInvalidDocument)
+	}
+	if utf8.RuneCountInString(name) > MaxDocumentName {
+		return nil, fmt.Errorf("%w: file name is longer than %d characters", ErrInvalidDocument, MaxDocumentName)
+	}
+	if len(data) > MaxDocumentSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d MB", ErrInvalidDocument, name, MaxDocumentSize>>20)
+	}
+
+	doc, err := extract.Extract(name, mimeType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	pieces := extract.Split(doc, chunkSize, chunkOverlap)
+	if len(pieces) == 0 {
+		return nil, fmt.Errorf("%w: %s has no text", ErrInvalidDocument, name)
+	}
+	if len(pieces) > MaxDocumentChunks {
+		return nil, fmt.Errorf("%w: %s has too much text", ErrInvalidDocument, name)
+	}
+
+	stored := &database.KnowledgeDocument{
+		ID:              uuid.New().String(),
+		KnowledgeBaseID: kbID,
+		Name:            name,
+		MimeType:        documentMimeType(mimeType, doc.Kind),
+		Size:            int64(len(data)),
+		Pages:           len(doc.Pages),
+		Chunks:          len(pieces),
+		Status:          database.DocumentProcessing,
+	}
+	chunks := make([]database.KnowledgeChunk, len(pieces))
+	for i, p := range pieces {
+		chunks[i] = database.KnowledgeChunk{
+			ID:              uuid.New().String(),
+			DocumentID:      stored.ID,
+			KnowledgeBaseID: kbID,
+			Ordinal:         i,
+			Page:            p.Page,
+			Content:         p.Text,
+		}
+	}
+
+	if err := s.knowledge.CreateDocument(stored, chunks); err != nil {
+		return nil, err
+	}
+	s.index.WakeEmbeddings()
+	return stored, nil
+}
+
+// DeleteDocument removes a document; its chunks are no longer retrieved
+func (s *KnowledgeService) DeleteDocument(ctx context.Context, userID, kbID, id string) error {
+	if _, err := s.base(userID, kbID); err != nil {
+		return err
+	}
+	chunks, err := s.knowledge.ChunkIDs(kbID, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.knowledge.DeleteDocument(kbID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrDocumentNotFound
+	}
+	s.forget(ctx, chunks)
+	return nil
+}
+
+// SessionBases returns the knowledge bases attached to the user's session
+func (s *KnowledgeService) SessionBases(userID, sessionID string) ([]database.KnowledgeBase, error) {
+	if err := s.checkSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	ids, err := s.knowledge.SessionBases(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	bases := make([]database.KnowledgeBase, 0, len(ids))
+	for _, id := range ids {
+		kb, err := s.knowledge.GetBase(userID, id)
+		if err != nil {
+			return nil, err
+		}
+		if kb != nil {
+			bases = append(bases, *kb)
+		}
+	}
+	return bases, nil
+}
+
+// SetSessionBases replaces the knowledge bases the session retrieves from;
+// an empty list detaches all of them
+func (s *KnowledgeService) SetSessionBases(userID, sessionID string, kbIDs []string) ([]database.KnowledgeBase, error) {
+	if err := s.checkSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(kbIDs))
+	ids := make([]string, 0, len(kbIDs))
+	for _, id := range kbIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > MaxSessionKnowledgeBases {
+		return nil, fmt.Errorf("%w: at most %d knowledge bases per session", ErrInvalidKnowledgeBase, MaxSessionKnowledgeBases)
+	}
+	for _, id := range ids {
+		if _, err := s.base(userID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.knowledge.SetSessionBases(sessionID, ids); err != nil {
+		return nil, err
+	}
+	return s.SessionBases(userID, sessionID)
+}
+
+// base returns the user's knowledge base or ErrKnowledgeBaseNotFound
+func (s *KnowledgeService) base(userID, id string) (*database.KnowledgeBase, error) {
+	kb, err := s.knowledge.GetBase(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if kb == nil {
+		return nil, ErrKnowledgeBaseNotFound
+	}
+	return kb, nil
+}
+
+func (s *KnowledgeService) checkSession(userID, sessionID string) error {
+	session, err := s.chat.GetUserSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// forget drops deleted chunks from the vector index. A failure only leaves
+// stale vectors, which retrieval skips.
+func (s *KnowledgeService) forget(ctx context.Context, chunks []string) {
+	if err := s.index.ForgetVectors(ctx, chunks); err != nil {
+		slog.WarnContext(ctx, "failed to remove document vectors", "chunks", len(chunks), "error", err)
+	}
+}
+
+func applyKnowledgeBaseInput(kb *database.KnowledgeBase, input KnowledgeBaseInput) error {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return fmt.Errorf("%w: name is required", ErrInvalidKnowledgeBase)
+		}
+		if utf8.RuneCountInString(name) > MaxKnowledgeBaseName {
+			return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidKnowledgeBase, MaxKnowledgeBaseName)
+		}
+		kb.Name = name
+	}
+	if input.Description != nil {
+		desc := strings.TrimSpace(*input.Description)
+		if utf8.RuneCountInString(desc) > MaxKnowledgeBaseDesc {
+			return fmt.Errorf("%w: description is longer than %d characters", ErrInvalidKnowledgeBase, MaxKnowledgeBaseDesc)
+		}
+		kb.Description = desc
+	}
+	return nil
+}
+
+// documentMimeType keeps the uploaded type (without parameters) when it
+// names one, else uses the type of the detected kind
+func documentMimeType(mimeType, kind string) string {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil && mediaType != "application/octet-stream" && len(mediaType) <= 100 {
+		return mediaType
+	}
+	return extract.MimeType(kind)
+}
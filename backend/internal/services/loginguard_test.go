@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gryt-backend/internal/config"
+)
+
+// newTestGuard returns a guard on a clock that only moves when advance is
+// called
+func newTestGuard() (*LoginGuard, func(time.Duration)) {
+	g := NewLoginGuard(config.LockoutConfig{
+		Window:          15 * time.Minute,
+		LockoutDuration: 30 * time.Minute,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+	})
+	now := time.Now()
+	g.now = func() time.Time { return now }
+	return g, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLoginGuardDelay(t *testing.T) {
+	g, _ := newTestGuard()
+	for _, tt := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	} {
+		if got := g.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	g.config.BaseDelay = 0
+	if got := g.delay(3); got != 0 {
+		t.Errorf("delay without BaseDelay = %v, want 0", got)
+	}
+}
+
+func blockedFor(t *testing.T, err error) *LoginBlockedError {
+	t.Helper()
+	var blocked *LoginBlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want a *LoginBlockedError", err)
+	}
+	return blocked
+}
+
+func TestLoginGuardCheck(t *testing.T) {
+	account, ip := accountGuardKey(" Alice@Example.com"), ipGuardKey("192.0.2.1")
+	if account != "account:alice@example.com" {
+		t.Errorf("accountGuardKey = %q", account)
+	}
+
+	t.Run("back-off delay", func(t *testing.T) {
+		g, advance := newTestGuard()
+		g.Fail(account, 5)
+		g.Fail(account, 5)
+		if blocked := blockedFor(t, g.Check(account, ip)); blocked.Locked || blocked.RetryAfter != 2*time.Second {
+			t.Errorf("after 2 failures = %+v, want a 2s delay", blocked)
+		}
+		advance(2 * time.Second)
+		if err := g.Check(account, ip); err != nil {
+			t.Errorf("after the delay = %v, want nil", err)
+		}
+	})
+
+	t.Run("lockout at the threshold", func(t *testing.T) {
+		g, advance := newTestGuard()
+		for i := 1; i <= 3; i++ {
+			locked, until := g.Fail(ip, 3)
+			if locked != (i == 3) {
+				t.Errorf("failure %d locked = %v", i, locked)
+			}
+			if i == 3 && until != g.now().Add(30*time.Minute) {
+				t.Errorf("locked until %v, want 30m from now", until)
+			}
+		}
+		// Further failures do not extend the lockout
+		if locked, _ := g.Fail(ip, 3); locked {
+			t.Errorf("failure after lockout reported a new lockout")
+		}
+
+		advance(10 * time.Minute)
+		if blocked := blockedFor(t, g.Check(account, ip)); !blocked.Locked || blocked.RetryAfter != 20*time.Minute {
+			t.Errorf("locked = %+v, want locked for 20m", blocked)
+		}
+		if lockouts := g.Lockouts(); len(lockouts) != 1 || lockouts[0].Kind != "ip" || lockouts[0].Value != "192.0.2.1" || lockouts[0].Failures != 4 {
+			t.Errorf("Lockouts = %+v", lockouts)
+		}
+
+		advance(20 * time.Minute)
+		if err := g.Check(ip); err != nil {
+			t.Errorf("after the lockout = %v, want nil", err)
+		}
+		if len(g.records) != 0 {
+			t.Errorf("expired lockout was kept")
+		}
+	})
+
+	t.Run("lockout wins over a longer delay", func(t *testing.T) {
+		g, advance := newTestGuard()
+		g.Fail(ip, 1)
+		advance(29*time.Minute + 55*time.Second)
+		for range 6 {
+			g.Fail(account, 0)
+		}
+		if blocked := blockedFor(t, g.Check(account, ip)); !blocked.Locked || blocked.RetryAfter != 5*time.Second {
+			t.Errorf("blocked = %+v, want the 5s lockout", blocked)
+		}
+	})
+
+	t.Run("threshold 0 never locks", func(t *testing.T) {
+		g, _ := newTestGuard()
+		for range 100 {
+			if locked, _ := g.Fail(account, 0); locked {
+				t.Fatal("locked with threshold 0")
+			}
+		}
+	})
+
+	t.Run("window restarts the count", func(t *testing.T) {
+		g, advance := newTestGuard()
+		g.Fail(account, 3)
+		g.Fail(account, 3)
+		advance(16 * time.Minute)
+		if locked, _ := g.Fail(account, 3); locked {
+			t.Errorf("failure after the window locked the account")
+		}
+		if rec := g.records[account]; rec.failures != 1 {
+			t.Errorf("failures = %d after the window, want 1", rec.failures)
+		}
+	})
+
+	t.Run("reset and unlock", func(t *testing.T) {
+		g, _ := newTestGuard()
+		g.Fail(account, 3)
+		g.Reset(account)
+		if err := g.Check(account); err != nil {
+			t.Errorf("after Reset = %v, want nil", err)
+		}
+
+		g.Fail(ip, 1)
+		if !g.Unlock(ip) {
+			t.Errorf("Unlock of a locked IP = false")
+		}
+		if g.Unlock(ip) {
+			t.Errorf("second Unlock = true")
+		}
+		g.Fail(account, 3)
+		if g.Unlock(account) {
+			t.Errorf("Unlock of a delayed but unlocked account = true")
+		}
+	})
+}
+
+func TestLoginGuardSweep(t *testing.T) {
+	g, advance := newTestGuard()
+	g.Fail(accountGuardKey("stale@example.com"), 3)
+	g.Fail(ipGuardKey("192.0.2.1"), 1)
+	advance(20 * time.Minute)
+
+	// The first failure after a window sweeps: the stale record is past the
+	// window, the lockout still has 10 minutes to run
+	g.Fail(accountGuardKey("new@example.com"), 3)
+	for key, want := range map[string]bool{
+		"account:stale@example.com": false,
+		"ip:192.0.2.1":              true,
+		"account:new@example.com":   true,
+	} {
+		if _, ok := g.records[key]; ok != want {
+			t.Errorf("record %s kept = %v, want %v", key, ok, want)
+		}
+	}
+
+	advance(11 * time.Minute)
+	g.Fail(accountGuardKey("new@example.com"), 3)
+	if _, ok := g.records["ip:192.0.2.1"]; !ok {
+		t.Errorf("swept again before a window passed")
+	}
+	advance(5 * time.Minute)
+	g.Fail(accountGuardKey("new@example.com"), 3)
+	if _, ok := g.records["ip:192.0.2.1"]; ok {
+		t.Errorf("expired lockout was not swept")
+	}
+}
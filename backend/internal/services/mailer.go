@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"gryt-backend/internal/config"
+)
+
+// Mailer sends plain-text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailer returns an SMTP mailer, or a mailer that only logs when SMTP is
+// not configured (local development)
+func NewMailer(cfg config.MailConfig) Mailer {
+	if cfg.SMTPHost == "" {
+		return logMailer{}
+	}
+	return &smtpMailer{config: cfg}
+}
+
+type smtpMailer struct {
+	config config.MailConfig
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	from, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + from.String() + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.SMTPHost)
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.config.SMTPHost, m.config.SMTPPort)
+	if err := smtp.SendMail(addr, auth, from.Address, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	// Credentials in the body (unlock links) are masked by the log redactor
+	slog.Info("mail not sent, SMTP not configured", "to", to, "subject", subject, "body", body)
+	return nil
+}
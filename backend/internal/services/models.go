@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gryt-backend/internal/ai"
+	"gryt-backend/internal/database"
+)
+
+var (
+	ErrModelNotFound = errors.New("model not found")
+	ErrModelExists   = errors.New("a model with this name already exists")
+	ErrInvalidModel  = errors.New("invalid model")
+)
+
+// ModelService manages the model catalogue. Changes take effect on this
+// instance immediately and on others within the catalogue cache TTL.
+type ModelService struct {
+	repo    *database.ModelRepository
+	catalog *ai.Catalog
+	client  *ai.Client
+	audit   *AuditService
+}
+
+func NewModelService(repo *database.ModelRepository, catalog *ai.Catalog, client *ai.Client, audit *AuditService) *ModelService {
+	return &ModelService{
+		repo:    repo,
+		catalog: catalog,
+		client:  client,
+		audit:   audit,
+	}
+}
+
+// ModelInput carries the editable fields of a catalogue entry. Nil fields
+// are left unchanged on update.
+type ModelInput struct {
+	Name              string   `json:"model"`
+	DisplayName       *string  `json:"display_name"`
+	Provider          *string  `json:"provider"`
+	Description       *string  `json:"description"`
+	ContextLength     *int     `json:"context_length"`
+	MaxTokens         *int     `json:"max_tokens"`
+	Temperature       *float64 `json:"temperature"`
+	Enabled           *bool    `json:"enabled"`
+	InputCostPer1K    *float64 `json:"cost_per_1k_input_tokens"`
+	OutputCostPer1K   *float64 `json:"cost_per_1k_output_tokens"`
+	SupportsStreaming *bool    `json:"supports_streaming"`
+	SupportsTools     *bool    `json:"supports_tools"`
+	SupportsVision    *bool    `json:"supports_vision"`
+}
+
+func (s *ModelService) List(enabledOnly bool) ([]database.ModelConfig, error) {
+	return s.repo.List(enabledOnly)
+}
+
+func (s *ModelService) Get(id int64) (*database.ModelConfig, error) {
+	model, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, ErrModelNotFound
+	}
+	return model, nil
+}
+
+func (s *ModelService) Create(actor AuditActor, input ModelInput) (*database.ModelConfig, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: model is required", ErrInvalidModel)
+	}
+
+	existing, err := s.repo.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrModelExists
+	}
+
+	model := &database.ModelConfig{
+		Name:              name,
+		DisplayName:       name,
+		Provider:          database.ProviderOf(name),
+		MaxTokens:         4096,
+		Temperature:       0.7,
+		Enabled:           true,
+		SupportsStreaming: true,
+		Source:            database.ModelSourceAdmin,
+	}
+	input.apply(model)
+	if err := validateModel(model); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(model); err != nil {
+		s.record(actor, AuditModelCreate, name, AuditFailure, nil)
+		return nil, err
+	}
+	s.catalog.Invalidate()
+
+	s.record(actor, AuditModelCreate, name, AuditSuccess, map[string]interface{}{"enabled": model.Enabled})
+	return model, nil
+}
+
+func (s *ModelService) Update(actor AuditActor, id int64, input ModelInput) (*database.ModelConfig, error) {
+	model, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if input.Name != "" && input.Name != model.Name {
+		return nil, fmt.Errorf("%w: the model name cannot be changed, create a new entry instead", ErrInvalidModel)
+	}
+
+	previous := *model
+	input.apply(model)
+	if err := validateModel(model); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(model); err != nil {
+		s.record(actor, AuditModelUpdate, model.Name, AuditFailure, nil)
+		return nil, err
+	}
+	s.catalog.Invalidate()
+
+	meta := map[string]interface{}{}
+	if previous.Enabled != model.Enabled {
+		meta["enabled"] = model.Enabled
+	}
+	s.record(actor, AuditModelUpdate, model.Name, AuditSuccess, meta)
+	return model, nil
+}
+
+func (s *ModelService) Delete(actor AuditActor, id int64) error {
+	model, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(id); err != nil {
+		s.record(actor, AuditModelDelete, model.Name, AuditFailure, nil)
+		return err
+	}
+	s.catalog.Invalidate()
+
+	s.record(actor, AuditModelDelete, model.Name, AuditSuccess, nil)
+	return nil
+}
+
+// Sync pulls the gateway's model list into the catalogue
+func (s *ModelService) Sync(ctx context.Context, actor AuditActor) (*ai.SyncResult, error) {
+	result, err := s.catalog.Sync(ctx, s.client)
+	if err != nil {
+		s.record(actor, AuditModelSync, "", AuditFailure, map[string]interface{}{"reason": err.Error()})
+		return nil, err
+	}
+
+	s.record(actor, AuditModelSync, "", AuditSuccess, map[string]interface{}{
+		"added":   result.Added,
+		"updated": result.Updated,
+	})
+	return result, nil
+}
+
+func (s *ModelService) record(actor AuditActor, action, targetID, outcome string, meta map[string]interface{}) {
+	s.audit.Record(AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		TargetType: "model",
+		TargetID:   targetID,
+		Outcome:    outcome,
+		Metadata:   meta,
+	})
+}
+
+func (in ModelInput) apply(model *database.ModelConfig) {
+	if in.DisplayName != nil {
+		model.DisplayName = strings.TrimSpace(*in.DisplayName)
+	}
+	if in.Provider != nil {
+		model.Provider = strings.TrimSpace(*in.Provider)
+	}
+	if in.Description != nil {
+		model.Description = *in.Description
+	}
+	if in.ContextLength != nil {
+		model.ContextLength = *in.ContextLength
+	}
+	if in.MaxTokens != nil {
+		model.MaxTokens = *in.MaxTokens
+	}
+	if in.Temperature != nil {
+		model.Temperature = *in.Temperature
+	}
+	if in.Enabled != nil {
+		model.Enabled = *in.Enabled
+	}
+	if in.InputCostPer1K != nil {
+		model.InputCostPer1K = *in.InputCostPer1K
+	}
+	if in.OutputCostPer1K != nil {
+		model.OutputCostPer1K = *in.OutputCostPer1K
+	}
+	if in.SupportsStreaming != nil {
+		model.SupportsStreaming = *in.SupportsStreaming
+	}
+	if in.SupportsTools != nil {
+		model.SupportsTools = *in.SupportsTools
+	}
+	if in.SupportsVision != nil {
+		model.SupportsVision = *in.SupportsVision
+	}
+}
+
+func validateModel(model *database.ModelConfig) error {
+	switch {
+	case len(model.Name) > 100:
+		return fmt.Errorf("%w: model must be at most 100 characters", ErrInvalidModel)
+	case model.DisplayName == "" || len(model.DisplayName) > 200:
+		return fmt.Errorf("%w: display_name must be 1-200 characters", ErrInvalidModel)
+	case model.Provider == "" || len(model.Provider) > 50:
+		return fmt.Errorf("%w: provider must be 1-50 characters", ErrInvalidModel)
+	case len(model.Description) > 500:
+		return fmt.Errorf("%w: description must be at most 500 characters", ErrInvalidModel)
+	case model.ContextLength < 0:
+		return fmt.Errorf("%w: context_length must not be negative", ErrInvalidModel)
+	case model.MaxTokens <= 0:
+		return fmt.Errorf("%w: max_tokens must be positive", ErrInvalidModel)
+	case model.ContextLength > 0 && model.MaxTokens > model.ContextLength:
+		return fmt.Errorf("%w: max_tokens must not exceed context_length", ErrInvalidModel)
+	case model.Temperature < 0 || model.Temperature > 2:
+		return fmt.Errorf("%w: temperature must be between 0 and 2", ErrInvalidModel)
+	case model.InputCostPer1K < 0 || model.OutputCostPer1K < 0:
+		return fmt.Errorf("%w: costs must not be negative", ErrInvalidModel)
+	}
+	return nil
+}
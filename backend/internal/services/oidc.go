@@ -0,0 +1,568 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("OIDC login is not enabled")
+	ErrOIDCInvalidState = errors.New("invalid or expired OIDC state")
+)
+
+const (
+	// OIDCStateTTL is how long a started login may take, and the lifetime
+	// of the state cookie that carries it
+	OIDCStateTTL        = 10 * time.Minute
+	oidcJWKSMinInterval = time.Minute
+)
+
+// oidcUserStore and oidcIdentityStore are the parts of the user and identity
+// repositories that provisioning needs
+type oidcUserStore interface {
+	GetByID(id string) (*database.User, error)
+	GetByEmail(email string) (*database.User, error)
+	Create(user *database.User) error
+}
+
+type oidcIdentityStore interface {
+	GetByIssuerSubject(issuer, subject string) (*database.UserIdentity, error)
+	Create(identity *database.UserIdentity) error
+	TouchLogin(id, email string) error
+}
+
+// OIDCService handles single sign-on through an OpenID Connect provider
+// using the authorization code flow with PKCE. The server keeps no state per
+// login: state, nonce and PKCE verifier travel in a signed cookie bound to
+// the browser that started the flow.
+type OIDCService struct {
+	userRepo     oidcUserStore
+	identityRepo oidcIdentityStore
+	config       config.OIDCConfig
+	secret       []byte        // signs the state cookie
+	settings     *config.Store // per-user token defaults, hot-reloadable
+	httpClient   *http.Client
+
+	mu          sync.Mutex
+	provider    *oidcProvider
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// oidcProvider holds the subset of the discovery document we rely on
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcStateClaims is the content of the state cookie
+type oidcStateClaims struct {
+	Type     string `json:"type"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+type oidcClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Nonce         string      `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// emailVerified returns the email_verified claim and whether the provider
+// sent it at all. Some providers send the claim as a string.
+func (c *oidcClaims) emailVerified() (verified, present bool) {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v, true
+	case string:
+		return v == "true", v == "true" || v == "false"
+	}
+	return false, false
+}
+
+func NewOIDCService(userRepo oidcUserStore, identityRepo oidcIdentityStore, settings *config.Store) *OIDCService {
+	cfg := settings.Get()
+	return &OIDCService{
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		config:       cfg.Auth.OIDC,
+		secret:       []byte(cfg.Auth.JWTSecret),
+		settings:     settings,
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// Enabled reports whether OIDC login is configured
+func (s *OIDCService) Enabled() bool {
+	return s.config.Enabled
+}
+
+// SecureCookie reports whether the state cookie should be HTTPS only, which
+// is the case whenever the callback is served over HTTPS
+func (s *OIDCService) SecureCookie() bool {
+	return strings.HasPrefix(s.config.RedirectURL, "https://")
+}
+
+// AuthCodeURL starts a login. It returns the provider URL the browser should
+// be sent to and the signed state the caller must set as a cookie and hand
+// back to Exchange.
+func (s *OIDCService) AuthCodeURL(ctx context.Context) (authURL, stateCookie string, err error) {
+	if !s.config.Enabled {
+		return "", "", ErrOIDCDisabled
+	}
+
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	stateCookie, err = jwt.NewWithClaims(jwt.SigningMethodHS256, oidcStateClaims{
+		Type:     "oidc_state",
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(OIDCStateTTL)),
+		},
+	}).SignedString(s.secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign OIDC state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.config.ClientID},
+		"redirect_uri":          {s.config.RedirectURL},
+		"scope":                 {strings.Join(s.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.AuthorizationEndpoint + separator + params.Encode(), stateCookie, nil
+}
+
+// Exchange completes a login: it checks the state against the cookie set by
+// AuthCodeURL, redeems the authorization code, verifies the ID token and
+// returns the local user, provisioning one if needed
+func (s *OIDCService) Exchange(ctx context.Context, stateCookie, state, code string) (*database.User, error) {
+	if !s.config.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+
+	pending, err := s.parseState(stateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(pending.State)) != 1 {
+		return nil, ErrOIDCInvalidState
+	}
+
+	if code == "" {
+		return nil, errors.New("authorization code is required")
+	}
+
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.redeemCode(ctx, provider, code, pending.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.verifyIDToken(ctx, provider, tokens.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if claims.Nonce != pending.Nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+
+	return s.provisionUser(provider.Issuer, claims)
+}
+
+// parseState verifies the signature and expiry of a state cookie
+func (s *OIDCService) parseState(stateCookie string) (*oidcStateClaims, error) {
+	claims := &oidcStateClaims{}
+	_, err := jwt.ParseWithClaims(stateCookie, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != "oidc_state" {
+		return nil, errors.New("not an OIDC state token")
+	}
+	return claims, nil
+}
+
+func (s *OIDCService) discover(ctx context.Context) (*oidcProvider, error) {
+	s.mu.Lock()
+	provider := s.provider
+	s.mu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	var doc oidcProvider
+	if err := s.getJSON(ctx, s.config.IssuerURL+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	if strings.TrimSuffix(doc.Issuer, "/") != s.config.IssuerURL {
+		return nil, fmt.Errorf("OIDC issuer mismatch: expected %s, got %s", s.config.IssuerURL, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing required endpoints")
+	}
+
+	s.mu.Lock()
+	s.provider = &doc
+	s.mu.Unlock()
+
+	return &doc, nil
+}
+
+func (s *OIDCService) redeemCode(ctx context.Context, provider *oidcProvider, code, verifier string) (*oidcTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.config.RedirectURL},
+		"client_id":     {s.config.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint error (status %d): %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDesc)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response did not include an id_token")
+	}
+
+	return &tokens, nil
+}
+
+func (s *OIDCService) verifyIDToken(ctx context.Context, provider *oidcProvider, rawToken string) (*oidcClaims, error) {
+	claims := &oidcClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(ctx, provider, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(s.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("missing sub claim")
+	}
+
+	return claims, nil
+}
+
+// signingKey returns the provider key for kid, refreshing the JWKS when the
+// key is unknown (providers rotate keys without notice)
+func (s *OIDCService) signingKey(ctx context.Context, provider *oidcProvider, kid string) (interface{}, error) {
+	s.mu.Lock()
+	key, ok := s.lookupKey(kid)
+	stale := time.Since(s.keysFetched) > oidcJWKSMinInterval
+	s.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := s.fetchJWKS(ctx, provider.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.keysFetched = time.Now()
+
+	if key, ok := s.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey must be called with s.mu held. An empty kid is accepted only when
+// the provider publishes a single key.
+func (s *OIDCService) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *OIDCService) fetchJWKS(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+
+	if err := s.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+// provisionUser maps verified claims to a local user. Known identities log in
+// directly, otherwise the account is linked by email or created just in time.
+func (s *OIDCService) provisionUser(issuer string, claims *oidcClaims) (*database.User, error) {
+	identity, err := s.identityRepo.GetByIssuerSubject(issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity != nil {
+		user, err := s.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, errors.New("linked user is inactive or no longer exists")
+		}
+		if err := s.identityRepo.TouchLogin(identity.ID, claims.Email); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+	verified, present := claims.emailVerified()
+	if present && !verified {
+		return nil, errors.New("email address is not verified by the identity provider")
+	}
+
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	// Linking hands over an existing account, so the provider must vouch for
+	// the address explicitly; a missing claim is not enough.
+	if user != nil && !verified {
+		return nil, errors.New("email address must be verified by the identity provider to link an existing account")
+	}
+
+	if user == nil {
+		accessKey, err := randomToken(32)
+		if err != nil {
+			return nil, err
+		}
+
+		name := claims.Name
+		if name == "" {
+			name = strings.SplitN(email, "@", 2)[0]
+		}
+
+		user = &database.User{
+			ID:           uuid.New().String(),
+			Email:        email,
+			Name:         name,
+			PasswordHash: sql.NullString{},
+			AccessKey:    accessKey,
+			IsActive:     true,
+			ChatTokens:   s.settings.Get().Limits.ChatTokensPerUser,
+			SearchTokens: s.settings.Get().Limits.SearchTokensPerUser,
+		}
+		if err := s.userRepo.Create(user); err != nil {
+			return nil, fmt.Errorf("failed to provision user: %w", err)
+		}
+	}
+
+	err = s.identityRepo.Create(&database.UserIdentity{
+		ID:      uuid.New().String(),
+		UserID:  user.ID,
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Email:   email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *OIDCService) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gryt-backend/internal/config"
+	"gryt-backend/internal/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP is an OpenID provider serving discovery, JWKS and a token endpoint.
+// The ID token carries the nonce and PKCE challenge of the last authorize
+// URL passed to approve, plus the claims set on the provider.
+type testIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	nonce     string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// approve plays the browser visiting the authorize URL and returns the
+// state the provider sends back to the callback
+func (p *testIdP) approve(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	p.mu.Lock()
+	p.nonce = q.Get("nonce")
+	p.challenge = q.Get("code_challenge")
+	p.mu.Unlock()
+	return q.Get("state")
+}
+
+func (p *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   "gryt",
+		"sub":   "subject-1",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": p.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+type fakeUserStore struct {
+	users []*database.User
+}
+
+func (f *fakeUserStore) GetByID(id string) (*database.User, error) {
+	for _, u := range f.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserStore) GetByEmail(email string) (*database.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserStore) Create(user *database.User) error {
+	f.users = append(f.users, user)
+	return nil
+}
+
+type fakeIdentityStore struct {
+	identities []*database.UserIdentity
+	touched    []string
+}
+
+func (f *fakeIdentityStore) GetByIssuerSubject(issuer, subject string) (*database.UserIdentity, error) {
+	for _, i := range f.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeIdentityStore) Create(identity *database.UserIdentity) error {
+	f.identities = append(f.identities, identity)
+	return nil
+}
+
+func (f *fakeIdentityStore) TouchLogin(id, email string) error {
+	f.touched = append(f.touched, id)
+	return nil
+}
+
+func newTestOIDCService(issuer string, users *fakeUserStore, identities *fakeIdentityStore) *OIDCService {
+	return NewOIDCService(users, identities, config.NewStaticStore(&config.Config{
+		Auth: config.AuthConfig{
+			JWTSecret: "test-secret",
+			OIDC: config.OIDCConfig{
+				Enabled:     true,
+				IssuerURL:   issuer,
+				ClientID:    "gryt",
+				RedirectURL: "https://gryt.test/api/auth/oidc/callback",
+				Scopes:      []string{"openid", "email"},
+			},
+		},
+		Limits: config.LimitsConfig{ChatTokensPerUser: 10, SearchTokensPerUser: 5},
+	}))
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newTestIdP(t)
+	existing := &database.User{ID: "user-1", Email: "alice@example.com", IsActive: true}
+
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		identities  []*database.UserIdentity
+		wantUser    string // "" expects a newly created user
+		wantErr     string
+		wantCreated bool
+	}{
+		{
+			name:        "new user without email_verified",
+			claims:      jwt.MapClaims{"email": "Bob@Example.com", "name": "Bob"},
+			wantCreated: true,
+		},
+		{
+			name:    "new user with unverified email",
+			claims:  jwt.MapClaims{"email": "bob@example.com", "email_verified": false},
+			wantErr: "not verified",
+		},
+		{
+			name:     "link existing account with verified email",
+			claims:   jwt.MapClaims{"email": "alice@example.com", "email_verified": true},
+			wantUser: "user-1",
+		},
+		{
+			name:     "link existing account with verified email as string",
+			claims:   jwt.MapClaims{"email": "ALICE@example.com", "email_verified": "true"},
+			wantUser: "user-1",
+		},
+		{
+			name:    "link existing account without email_verified",
+			claims:  jwt.MapClaims{"email": "alice@example.com"},
+			wantErr: "must be verified",
+		},
+		{
+			name:    "link existing account with unverified email",
+			claims:  jwt.MapClaims{"email": "alice@example.com", "email_verified": "false"},
+			wantErr: "not verified",
+		},
+		{
+			name:       "known identity logs in directly",
+			claims:     jwt.MapClaims{"email": "alice@other.example"},
+			identities: []*database.UserIdentity{{ID: "identity-1", UserID: "user-1", Subject: "subject-1"}},
+			wantUser:   "user-1",
+		},
+		{
+			name:    "nonce mismatch",
+			claims:  jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "nonce": "replayed"},
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "missing email",
+			claims:  jwt.MapClaims{},
+			wantErr: "did not return an email",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserStore{users: []*database.User{existing}}
+			identities := &fakeIdentityStore{}
+			for _, i := range tt.identities {
+				i.Issuer = idp.URL
+				identities.identities = append(identities.identities, i)
+			}
+			svc := newTestOIDCService(idp.URL, users, identities)
+			idp.claims = tt.claims
+
+			authURL, cookie, err := svc.AuthCodeURL(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := idp.approve(t, authURL)
+
+			user, err := svc.Exchange(context.Background(), cookie, state, "good-code")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if len(identities.identities) != len(tt.identities) {
+					t.Errorf("identity linked despite error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantCreated {
+				if len(users.users) != 2 || user != users.users[1] {
+					t.Fatalf("user %+v was not created", user)
+				}
+				if user.Email != "bob@example.com" || user.ChatTokens != 10 || user.SearchTokens != 5 {
+					t.Errorf("created user = %+v", user)
+				}
+			} else if user.ID != tt.wantUser || len(users.users) != 1 {
+				t.Fatalf("user = %s with %d users, want %s", user.ID, len(users.users), tt.wantUser)
+			}
+
+			if tt.identities != nil {
+				if len(identities.touched) != 1 {
+					t.Errorf("known identity was not touched")
+				}
+				return
+			}
+			if len(identities.identities) != 1 || identities.identities[0].UserID != user.ID || identities.identities[0].Issuer != idp.URL {
+				t.Errorf("identities = %+v, want one linked to %s", identities.identities, user.ID)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeState(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.claims = jwt.MapClaims{"email": "bob@example.com"}
+	svc := newTestOIDCService(idp.URL, &fakeUserStore{}, &fakeIdentityStore{})
+	ctx := context.Background()
+
+	attackerURL, attackerCookie, err := svc.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	victimURL, victimCookie, err := svc.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attackerState := idp.approve(t, attackerURL)
+	victimState := idp.approve(t, victimURL)
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, oidcStateClaims{
+		Type:             "oidc_state",
+		State:            victimState,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, oidcStateClaims{
+		Type:             "oidc_state",
+		State:            victimState,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}).SignedString([]byte("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+	}{
+		{"no cookie", "", victimState},
+		{"callback started in another browser", victimCookie, attackerState},
+		{"no state", victimCookie, ""},
+		{"expired cookie", expired, victimState},
+		{"cookie signed with another key", forged, victimState},
+		{"cookie is not a state token", attackerCookie + "x", attackerState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Exchange(ctx, tt.cookie, tt.state, "good-code"); !errors.Is(err, ErrOIDCInvalidState) {
+				t.Errorf("err = %v, want %v", err, ErrOIDCInvalidState)
+			}
+		})
+	}
+
+	if _, err := svc.Exchange(ctx, victimCookie, victimState, "good-code"); err != nil {
+		t.Errorf("matching cookie and state: %v", err)
+	}
+}
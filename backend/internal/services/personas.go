@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gryt-backend/internal/ai"
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPersonaNotFound = errors.New("persona not found")
+	ErrPersonaReadOnly = errors.New("global personas can only be changed by an admin")
+	ErrInvalidPersona  = errors.New("invalid persona")
+)
+
+// PersonaService manages personas. Users manage their own; global personas
+// (no owner) are visible to everyone and managed by admins.
+type PersonaService struct {
+	repo  *database.PersonaRepository
+	ai    *ai.Service
+	audit *AuditService
+}
+
+func NewPersonaService(repo *database.PersonaRepository, aiService *ai.Service, audit *AuditService) *PersonaService {
+	return &PersonaService{
+		repo:  repo,
+		ai:    aiService,
+		audit: audit,
+	}
+}
+
+// PersonaInput is the full editable state of a persona; updates replace
+// every field. AllowedTools nil means every enabled tool, an empty list
+// means none.
+type PersonaInput struct {
+	Name         string                  `json:"name"`
+	Description  string                  `json:"description"`
+	SystemPrompt string                  `json:"system_prompt"`
+	Params       models.GenerationParams `json:"params"`
+	AllowedTools []string                `json:"allowed_tools"`
+}
+
+// List returns the user's personas followed by the global ones
+func (s *PersonaService) List(userID string) ([]database.Persona, error) {
+	return s.repo.ListVisible(userID)
+}
+
+// ListGlobal returns the personas shared with every user
+func (s *PersonaService) ListGlobal() ([]database.Persona, error) {
+	return s.repo.ListGlobal()
+}
+
+// Get returns a persona the user owns or a global one
+func (s *PersonaService) Get(ctx context.Context, userID, id string) (*database.Persona, error) {
+	persona, err := s.ai.Persona(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if persona == nil {
+		return nil, ErrPersonaNotFound
+	}
+	return persona, nil
+}
+
+func (s *PersonaService) Create(ctx context.Context, userID string, input PersonaInput) (*database.Persona, error) {
+	persona := &database.Persona{ID: uuid.New().String(), UserID: &userID}
+	if err := s.apply(ctx, persona, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(persona); err != nil {
+		return nil, err
+	}
+	return persona, nil
+}
+
+func (s *PersonaService) Update(ctx context.Context, userID, id string, input PersonaInput) (*database.Persona, error) {
+	persona, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if persona.IsGlobal() {
+		return nil, ErrPersonaReadOnly
+	}
+	if err := s.apply(ctx, persona, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(persona); err != nil {
+		return nil, err
+	}
+	return persona, nil
+}
+
+// Delete removes one of the user's personas. Sessions using it fall back to
+// their own or the configured system prompt.
+func (s *PersonaService) Delete(ctx context.Context, userID, id string) error {
+	persona, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if persona.IsGlobal() {
+		return ErrPersonaReadOnly
+	}
+	return s.repo.Delete(id)
+}
+
+func (s *PersonaService) CreateGlobal(ctx context.Context, actor AuditActor, input PersonaInput) (*database.Persona, error) {
+	persona := &database.Persona{ID: uuid.New().String()}
+	if err := s.apply(ctx, persona, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(persona); err != nil {
+		s.record(actor, AuditPersonaCreate, persona.ID, AuditFailure, nil)
+		return nil, err
+	}
+
+	s.record(actor, AuditPersonaCreate, persona.ID, AuditSuccess, map[string]interface{}{"name": persona.Name})
+	return persona, nil
+}
+
+func (s *PersonaService) UpdateGlobal(ctx context.Context, actor AuditActor, id string, input PersonaInput) (*database.Persona, error) {
+	persona, err := s.getGlobal(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, persona, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(persona); err != nil {
+		s.record(actor, AuditPersonaUpdate, id, AuditFailure, nil)
+		return nil, err
+	}
+
+	s.record(actor, AuditPersonaUpdate, id, AuditSuccess, map[string]interface{}{"name": persona.Name})
+	return persona, nil
+}
+
+func (s *PersonaService) DeleteGlobal(actor AuditActor, id string) error {
+	persona, err := s.getGlobal(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(id); err != nil {
+		s.record(actor, AuditPersonaDelete, id, AuditFailure, nil)
+		return err
+	}
+
+	s.record(actor, AuditPersonaDelete, id, AuditSuccess, map[string]interface{}{"name": persona.Name})
+	return nil
+}
+
+func (s *PersonaService) getGlobal(id string) (*database.Persona, error) {
+	persona, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if persona == nil || !persona.IsGlobal() {
+		return nil, ErrPersonaNotFound
+	}
+	return persona, nil
+}
+
+func (s *PersonaService) record(actor AuditActor, action, targetID, outcome string, meta map[string]interface{}) {
+	s.audit.Record(AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		TargetType: "persona",
+		TargetID:   targetID,
+		Outcome:    outcome,
+		Metadata:   meta,
+	})
+}
+
+// apply validates input and copies it onto persona
+func (s *PersonaService) apply(ctx context.Context, persona *database.Persona, input PersonaInput) error {
+	name := strings.TrimSpace(input.Name)
+	prompt := strings.TrimSpace(input.SystemPrompt)
+	switch {
+	case name == "" || len(name) > 100:
+		return fmt.Errorf("%w: name must be 1-100 characters", ErrInvalidPersona)
+	case len(input.Description) > 500:
+		return fmt.Errorf("%w: description must be at most 500 characters", ErrInvalidPersona)
+	case prompt == "":
+		return fmt.Errorf("%w: system_prompt is required", ErrInvalidPersona)
+	case len(prompt) > ai.MaxSystemPrompt:
+		return fmt.Errorf("%w: system_prompt must be at most %d characters", ErrInvalidPersona, ai.MaxSystemPrompt)
+	}
+
+	if err := s.ai.ValidateParams(ctx, input.Params); err != nil {
+		if errors.Is(err, ai.ErrInvalidParams) {
+			return fmt.Errorf("%w: %v", ErrInvalidPersona, err)
+		}
+		return err
+	}
+
+	tools, err := validateTools(input.AllowedTools)
+	if err != nil {
+		return err
+	}
+
+	persona.Name = name
+	persona.Description = input.Description
+	persona.SystemPrompt = prompt
+	persona.Params = input.Params
+	persona.AllowedTools = tools
+	return nil
+}
+
+// validateTools rejects unknown tool names and drops duplicates, keeping a
+// nil list nil
+func validateTools(tools []string) (database.StringList, error) {
+	if tools == nil {
+		return nil, nil
+	}
+
+	known := make(map[string]bool)
+	for _, name := range ai.ToolNames() {
+		known[name] = true
+	}
+
+	list := make(database.StringList, 0, len(tools))
+	seen := make(map[string]bool)
+	for _, name := range tools {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown tool %q", ErrInvalidPersona, name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	return list, nil
+}
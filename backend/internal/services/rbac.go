@@ -0,0 +1,62 @@
+package services
+
+// Roles a user can hold
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// Permission names checked by middleware.RequirePermission
+type Permission string
+
+const (
+	PermUsersRead     Permission = "users:read"
+	PermUsersWrite    Permission = "users:write"
+	PermRolesWrite    Permission = "roles:write"
+	PermTokensWrite   Permission = "tokens:write"
+	PermUsageRead     Permission = "usage:read"
+	PermKeysWrite     Permission = "keys:write"
+	PermAuditRead     Permission = "audit:read"
+	PermLockouts      Permission = "lockouts:write"
+	PermModelsWrite   Permission = "models:write"
+	PermPersonasWrite Permission = "personas:write"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleUser: {},
+	RoleSupport: {
+		PermUsersRead,
+		PermTokensWrite,
+		PermUsageRead,
+		PermLockouts,
+	},
+	RoleAdmin: {
+		PermUsersRead,
+		PermUsersWrite,
+		PermRolesWrite,
+		PermTokensWrite,
+		PermUsageRead,
+		PermKeysWrite,
+		PermAuditRead,
+		PermLockouts,
+		PermModelsWrite,
+		PermPersonasWrite,
+	},
+}
+
+// IsValidRole reports whether role is a known role name
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants perm
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
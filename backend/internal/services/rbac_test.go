@@ -0,0 +1,45 @@
+package services
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	all := []Permission{
+		PermUsersRead, PermUsersWrite, PermRolesWrite, PermTokensWrite, PermUsageRead,
+		PermKeysWrite, PermAuditRead, PermLockouts, PermModelsWrite, PermPersonasWrite,
+	}
+	granted := map[string][]Permission{
+		RoleUser:    {},
+		RoleSupport: {PermUsersRead, PermTokensWrite, PermUsageRead, PermLockouts},
+		RoleAdmin:   all,
+		"":          {},
+		"root":      {},
+		"Admin":     {},
+	}
+
+	for role, perms := range granted {
+		want := map[Permission]bool{}
+		for _, p := range perms {
+			want[p] = true
+		}
+		for _, perm := range append(all, "users:*", "") {
+			if got := HasPermission(role, perm); got != want[perm] {
+				t.Errorf("HasPermission(%q, %q) = %v, want %v", role, perm, got, want[perm])
+			}
+		}
+	}
+}
+
+func TestIsValidRole(t *testing.T) {
+	for role, want := range map[string]bool{
+		RoleUser:    true,
+		RoleSupport: true,
+		RoleAdmin:   true,
+		"":          false,
+		"Admin":     false,
+		"superuser": false,
+	} {
+		if got := IsValidRole(role); got != want {
+			t.Errorf("IsValidRole(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
@@ -1,15 +1,19 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	"gryt-backend/internal/ai"
 	"gryt-backend/internal/config"
 	"gryt-backend/internal/database"
+	"gryt-backend/internal/storage"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
@@ -18,66 +22,425 @@ import (
 
 // Services contains all service dependencies
 type Services struct {
-	Auth      *AuthService
-	Chat      *ChatService
-	Search    *SearchService
-	RateLimit *RateLimitService
-	AI        *ai.Service
+	Auth        *AuthService
+	OIDC        *OIDCService
+	Admin       *AdminService
+	Models      *ModelService
+	Personas    *PersonaService
+	Teams       *TeamService
+	Templates   *TemplateService
+	Sessions    *SessionService
+	Knowledge   *KnowledgeService
+	Attachments *AttachmentService
+	Audit       *AuditService
+	Chat        *ChatService
+	Search      *SearchService
+	RateLimit   *RateLimitService
+	AI          *ai.Service
 }
 
-// NewServices creates new services instance
-func NewServices(db *database.DB, cfg *config.Config) *Services {
+// NewServices creates new services instance. It fails when the attachment
+// store cannot be set up.
+func NewServices(db *database.DB, settings *config.Store) (*Services, error) {
+	cfg := settings.Get()
 	userRepo := database.NewUserRepository(db)
 	chatRepo := database.NewChatRepository(db)
 	searchRepo := database.NewSearchRepository(db)
+	identityRepo := database.NewIdentityRepository(db)
+	usageRepo := database.NewUsageRepository(db)
+	auditService := NewAuditService(database.NewAuditRepository(db))
+	mailer := NewMailer(cfg.Mail)
+	teamService := NewTeamService(database.NewTeamRepository(db), userRepo)
+
+	// Attachment bytes live in the blob store, shared with the AI service
+	// which sends them to the model
+	blobs, err := newBlobStore(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize AI client and service
 	aiClient := ai.NewClient(cfg)
-	aiService := ai.NewService(aiClient, db, &cfg.AI)
+	aiService := ai.NewService(aiClient, db, settings, blobs)
+
+	rateLimit := NewRateLimitService(cfg.Limits.RateLimitPerMinute)
+	settings.OnReload(func(old, new *config.Config) {
+		if old.Limits.RateLimitPerMinute != new.Limits.RateLimitPerMinute {
+			rateLimit.SetRate(new.Limits.RateLimitPerMinute)
+		}
+		// Models added to ai.models are seeded; edits to existing ones are
+		// made through the admin API
+		if !reflect.DeepEqual(old.AI.Models, new.AI.Models) {
+			if added, err := aiService.Catalog().Seed(context.Background(), new.AI.Models); err != nil {
+				slog.Error("failed to seed model catalogue", "error", err)
+			} else if added > 0 {
+				slog.Info("model catalogue seeded from config", "added", added)
+			}
+		}
+		// A default missing from the catalogue only falls back, see
+		// Catalog.Default
+		if old.AI.Model != new.AI.Model {
+			if model, err := aiService.Catalog().Lookup(context.Background(), new.AI.Model); err == nil && model == nil {
+				slog.Warn("AI_MODEL is not an enabled model in the catalogue", "model", new.AI.Model)
+			}
+		}
+	})
 
 	return &Services{
-		Auth:      NewAuthService(userRepo, cfg.Auth),
-		Chat:      NewChatService(chatRepo, userRepo, cfg),
-		Search:    NewSearchService(searchRepo, userRepo, cfg),
-		RateLimit: NewRateLimitService(cfg.Limits.RateLimitPerMinute),
-		AI:        aiService,
+		Auth:        NewAuthService(userRepo, auditService, mailer, cfg.Auth),
+		OIDC:        NewOIDCService(userRepo, identityRepo, settings),
+		Admin:       NewAdminService(userRepo, usageRepo, auditService, settings),
+		Models:      NewModelService(database.NewModelRepository(db), aiService.Catalog(), aiClient, auditService),
+		Personas:    NewPersonaService(database.NewPersonaRepository(db), aiService, auditService),
+		Teams:       teamService,
+		Templates:   NewTemplateService(database.NewTemplateRepository(db), teamService),
+		Sessions:    NewSessionService(chatRepo, database.NewFolderRepository(db), aiService),
+		Knowledge:   NewKnowledgeService(database.NewKnowledgeRepository(db), chatRepo, aiService),
+		Attachments: NewAttachmentService(database.NewAttachmentRepository(db), blobs, cfg.Storage),
+		Audit:       auditService,
+		Chat:        NewChatService(chatRepo, userRepo, cfg),
+		Search:      NewSearchService(searchRepo, userRepo, cfg),
+		RateLimit:   rateLimit,
+		AI:          aiService,
+	}, nil
+}
+
+// newBlobStore creates the configured blob store. There is no fallback:
+// uploads must not land on a node's local disk when S3 was configured.
+func newBlobStore(cfg config.StorageConfig) (storage.Store, error) {
+	store, err := storage.New(storage.Config{
+		Backend:   cfg.Backend,
+		Path:      cfg.Path,
+		Endpoint:  cfg.S3.Endpoint,
+		Region:    cfg.S3.Region,
+		Bucket:    cfg.S3.Bucket,
+		AccessKey: cfg.S3.AccessKey,
+		SecretKey: cfg.S3.SecretKey,
+		PathStyle: cfg.S3.PathStyle,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s attachment store: %w", cfg.Backend, err)
 	}
+	return store, nil
 }
 
+// ErrInvalidCredentials wraps every login failure caused by what the caller
+// supplied. Only these count towards lockout, so a database outage does not
+// lock everyone out.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
 // AuthService handles authentication
 type AuthService struct {
 	userRepo *database.UserRepository
+	audit    *AuditService
+	guard    *LoginGuard
+	mailer   Mailer
 	config   config.AuthConfig
 }
 
-func NewAuthService(userRepo *database.UserRepository, cfg config.AuthConfig) *AuthService {
+func NewAuthService(userRepo *database.UserRepository, audit *AuditService, mailer Mailer, cfg config.AuthConfig) *AuthService {
 	return &AuthService{
 		userRepo: userRepo,
+		audit:    audit,
+		guard:    NewLoginGuard(cfg.Lockout),
+		mailer:   mailer,
 		config:   cfg,
 	}
 }
 
 func (s *AuthService) ValidateAccessKey(accessKey string) (*database.User, error) {
 	if accessKey == "" {
-		return nil, errors.New("access key is required")
+		return nil, fmt.Errorf("%w: access key is required", ErrInvalidCredentials)
 	}
 
-	log.Printf("[DEBUG] ValidateAccessKey called with: %s", accessKey)
 	user, err := s.userRepo.GetByAccessKey(accessKey)
 	if err != nil {
-		log.Printf("[DEBUG] ValidateAccessKey error: %v", err)
 		return nil, fmt.Errorf("failed to validate access key: %w", err)
 	}
 
 	if user == nil {
-		log.Printf("[DEBUG] ValidateAccessKey: user not found for access key: %s", accessKey)
-		return nil, errors.New("invalid access key")
+		return nil, fmt.Errorf("%w: invalid access key", ErrInvalidCredentials)
 	}
 
-	log.Printf("[DEBUG] ValidateAccessKey: user found: %+v", user)
 	return user, nil
 }
 
+// LoginWithAccessKey validates an access key for an interactive login and
+// records the attempt in the audit trail
+func (s *AuthService) LoginWithAccessKey(actor AuditActor, accessKey string) (*database.User, error) {
+	meta := map[string]interface{}{
+		"key_fingerprint": SecretFingerprint(accessKey),
+	}
+
+	// Access keys are not tied to an account until they match, so only the
+	// client IP can be throttled here
+	ipKey := ipGuardKey(actor.IP)
+	if err := s.guard.Check(ipKey); err != nil {
+		s.recordLogin(actor, "access_key", nil, err, meta)
+		return nil, err
+	}
+
+	user, err := s.ValidateAccessKey(accessKey)
+	if errors.Is(err, ErrInvalidCredentials) {
+		s.registerFailure(actor, ipKey, s.config.Lockout.MaxIPFailures, "")
+	}
+	s.recordLogin(actor, "access_key", user, err, meta)
+	return user, err
+}
+
+// AuthenticateAccessKey checks an X-Access-Key header sent to an API route.
+// It goes through the same IP guard as LoginWithAccessKey, so keys cannot be
+// guessed faster against API routes than against the login endpoint.
+func (s *AuthService) AuthenticateAccessKey(actor AuditActor, accessKey string) (*database.User, error) {
+	ipKey := ipGuardKey(actor.IP)
+	if err := s.guard.Check(ipKey); err != nil {
+		return nil, err
+	}
+
+	user, err := s.ValidateAccessKey(accessKey)
+	if errors.Is(err, ErrInvalidCredentials) {
+		s.registerFailure(actor, ipKey, s.config.Lockout.MaxIPFailures, "")
+	} else if err == nil {
+		s.guard.Reset(ipKey)
+	}
+	return user, err
+}
+
+// LoginWithPassword authenticates with email and password and records the
+// attempt in the audit trail
+func (s *AuthService) LoginWithPassword(actor AuditActor, email, password string) (*database.User, error) {
+	meta := map[string]interface{}{
+		"email": email,
+	}
+
+	accountKey := accountGuardKey(email)
+	ipKey := ipGuardKey(actor.IP)
+	if err := s.guard.Check(accountKey, ipKey); err != nil {
+		s.recordLogin(actor, "password", nil, err, meta)
+		return nil, err
+	}
+
+	user, err := s.AuthenticateUser(email, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		s.registerFailure(actor, accountKey, s.config.Lockout.MaxAccountFailures, email)
+		s.registerFailure(actor, ipKey, s.config.Lockout.MaxIPFailures, "")
+	} else if err == nil {
+		// Only the account is cleared; one valid login must not reset the
+		// counter of an IP that is guessing other accounts
+		s.guard.Reset(accountKey)
+	}
+	s.recordLogin(actor, "password", user, err, meta)
+	return user, err
+}
+
+// registerFailure counts a failure against key and, when it triggers a
+// lockout, records it and emails an unlock link for account lockouts
+func (s *AuthService) registerFailure(actor AuditActor, key string, threshold int, email string) {
+	locked, until := s.guard.Fail(key, threshold)
+	if !locked {
+		return
+	}
+
+	kind, value, _ := strings.Cut(key, ":")
+	s.audit.Record(AuditEntry{
+		Actor:      actor,
+		Action:     AuditLockout,
+		TargetType: kind,
+		TargetID:   value,
+		Outcome:    AuditSuccess,
+		Metadata: map[string]interface{}{
+			"locked_until": until.UTC().Format(time.RFC3339),
+			"threshold":    threshold,
+		},
+	})
+
+	if email != "" {
+		go s.sendUnlockEmail(email, until)
+	}
+}
+
+// sendUnlockEmail mails an unlock link to the owner of a locked account.
+// Unknown addresses are skipped silently so lockouts do not reveal which
+// emails are registered.
+func (s *AuthService) sendUnlockEmail(email string, until time.Time) {
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil || user == nil {
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"type":  "unlock",
+		"email": strings.ToLower(user.Email),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.config.JWTSecret))
+	if err != nil {
+		slog.Error("failed to sign unlock token", "error", err)
+		return
+	}
+
+	body := fmt.Sprintf("Halo %s,\n\n"+
+		"Akun GRYT kamu dikunci sementara sampai %s karena terlalu banyak percobaan login yang gagal.\n\n"+
+		"Kalau itu kamu, buka link berikut untuk membuka kunci sekarang (berlaku 1 jam):\n%s?token=%s\n\n"+
+		"Kalau bukan kamu, abaikan email ini dan pertimbangkan untuk mengganti password.\n",
+		user.Name, until.UTC().Format("2006-01-02 15:04 MST"), s.config.Lockout.UnlockURL, token)
+
+	if err := s.mailer.Send(user.Email, "Akun GRYT dikunci sementara", body); err != nil {
+		slog.Error("failed to send unlock email", "user_id", user.ID, "error", err)
+	}
+}
+
+// UnlockWithToken lifts an account lockout using the token from the unlock
+// email
+func (s *AuthService) UnlockWithToken(actor AuditActor, tokenString string) error {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(s.config.JWTSecret), nil
+	})
+
+	var email string
+	if err == nil {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if ok && token.Valid && claims["type"] == "unlock" {
+			email, _ = claims["email"].(string)
+		}
+		if email == "" {
+			err = errors.New("invalid unlock token")
+		}
+	}
+
+	entry := AuditEntry{
+		Actor:      actor,
+		Action:     AuditUnlock,
+		TargetType: lockoutKindAccount,
+		TargetID:   email,
+		Outcome:    AuditSuccess,
+		Metadata:   map[string]interface{}{"method": "email"},
+	}
+	if err != nil {
+		entry.Outcome = AuditFailure
+		entry.Metadata["reason"] = err.Error()
+		s.audit.Record(entry)
+		return errors.New("invalid or expired unlock token")
+	}
+
+	entry.Metadata["was_locked"] = s.guard.Unlock(accountGuardKey(email))
+	s.audit.Record(entry)
+	return nil
+}
+
+// Lockouts lists active account and IP lockouts
+func (s *AuthService) Lockouts() []Lockout {
+	return s.guard.Lockouts()
+}
+
+// AdminUnlock lifts a lockout on behalf of an operator. kind is "account"
+// (value is an email) or "ip".
+func (s *AuthService) AdminUnlock(actor AuditActor, kind, value string) (bool, error) {
+	var key string
+	switch kind {
+	case lockoutKindAccount:
+		key = accountGuardKey(value)
+		value = strings.ToLower(strings.TrimSpace(value))
+	case lockoutKindIP:
+		key = ipGuardKey(value)
+	default:
+		return false, fmt.Errorf("unknown lockout kind %q", kind)
+	}
+
+	unlocked := s.guard.Unlock(key)
+	s.audit.Record(AuditEntry{
+		Actor:      actor,
+		Action:     AuditLockoutClear,
+		TargetType: kind,
+		TargetID:   value,
+		Outcome:    AuditSuccess,
+		Metadata:   map[string]interface{}{"was_locked": unlocked},
+	})
+	return unlocked, nil
+}
+
+// RecordLogin records the outcome of a login performed outside AuthService,
+// such as single sign-on
+func (s *AuthService) RecordLogin(actor AuditActor, method string, user *database.User, err error) {
+	s.recordLogin(actor, method, user, err, nil)
+}
+
+func (s *AuthService) recordLogin(actor AuditActor, method string, user *database.User, err error, meta map[string]interface{}) {
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	meta["method"] = method
+
+	entry := AuditEntry{
+		Actor:      actor,
+		Action:     AuditLogin,
+		TargetType: "user",
+		Outcome:    AuditSuccess,
+		Metadata:   meta,
+	}
+
+	if err != nil || user == nil {
+		entry.Outcome = AuditFailure
+		if err != nil {
+			meta["reason"] = err.Error()
+		}
+	} else {
+		entry.Actor.UserID = user.ID
+		entry.TargetID = user.ID
+	}
+
+	s.audit.Record(entry)
+}
+
+// Refresh validates a refresh token and records the rotation
+func (s *AuthService) Refresh(actor AuditActor, refreshToken string) (string, error) {
+	userID, err := s.ValidateRefreshToken(refreshToken)
+
+	entry := AuditEntry{
+		Actor:      actor,
+		Action:     AuditTokenRefresh,
+		TargetType: "user",
+		Outcome:    AuditSuccess,
+	}
+	if err != nil {
+		entry.Outcome = AuditFailure
+		entry.Metadata = map[string]interface{}{"reason": err.Error()}
+	} else {
+		entry.Actor.UserID = userID
+		entry.TargetID = userID
+	}
+	s.audit.Record(entry)
+
+	return userID, err
+}
+
+// RecordRejectedCredential records a request that presented an invalid
+// access key or bearer token
+func (s *AuthService) RecordRejectedCredential(actor AuditActor, action string, meta map[string]interface{}) {
+	s.audit.Record(AuditEntry{
+		Actor:    actor,
+		Action:   action,
+		Outcome:  AuditFailure,
+		Metadata: meta,
+	})
+}
+
+// RecordPermissionDenied records an authenticated request rejected by RBAC
+func (s *AuthService) RecordPermissionDenied(actor AuditActor, permission, path string) {
+	s.audit.Record(AuditEntry{
+		Actor:      actor,
+		Action:     AuditPermissionDenied,
+		TargetType: "route",
+		TargetID:   path,
+		Outcome:    AuditDenied,
+		Metadata:   map[string]interface{}{"permission": permission},
+	})
+}
+
 func (s *AuthService) GenerateToken(userID string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
@@ -111,12 +474,28 @@ func (s *AuthService) ValidateToken(tokenString string) (string, error) {
 		if !ok {
 			return "", errors.New("invalid user_id in token")
 		}
+		if err := s.checkActive(userID); err != nil {
+			return "", err
+		}
 		return userID, nil
 	}
 
 	return "", errors.New("invalid token")
 }
 
+// checkActive rejects tokens of users deactivated or deleted after the
+// token was issued
+func (s *AuthService) checkActive(userID string) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user is inactive or no longer exists")
+	}
+	return nil
+}
+
 func (s *AuthService) HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -129,7 +508,7 @@ func (s *AuthService) CheckPassword(password, hash string) bool {
 
 func (s *AuthService) AuthenticateUser(email, password string) (*database.User, error) {
 	if email == "" || password == "" {
-		return nil, errors.New("email and password are required")
+		return nil, fmt.Errorf("%w: email and password are required", ErrInvalidCredentials)
 	}
 
 	user, err := s.userRepo.GetByEmail(email)
@@ -138,16 +517,16 @@ func (s *AuthService) AuthenticateUser(email, password string) (*database.User,
 	}
 
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, fmt.Errorf("%w: user not found", ErrInvalidCredentials)
 	}
 
 	// Check if password hash exists
 	if !user.PasswordHash.Valid || user.PasswordHash.String == "" {
-		return nil, errors.New("password authentication not available for this user")
+		return nil, fmt.Errorf("%w: password authentication not available for this user", ErrInvalidCredentials)
 	}
 
 	if !s.CheckPassword(password, user.PasswordHash.String) {
-		return nil, errors.New("invalid password")
+		return nil, fmt.Errorf("%w: invalid password", ErrInvalidCredentials)
 	}
 
 	return user, nil
@@ -192,6 +571,9 @@ func (s *AuthService) ValidateRefreshToken(tokenString string) (string, error) {
 		if !ok {
 			return "", errors.New("invalid user_id in refresh token")
 		}
+		if err := s.checkActive(userID); err != nil {
+			return "", err
+		}
 		return userID, nil
 	}
 
@@ -353,6 +735,19 @@ func NewRateLimitService(requestsPerMinute int) *RateLimitService {
 	}
 }
 
+// SetRate changes the limit for new and existing keys (config reload)
+func (s *RateLimitService) SetRate(requestsPerMinute int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rate = rate.Every(time.Minute / time.Duration(requestsPerMinute))
+	s.burst = requestsPerMinute
+	for _, limiter := range s.limiters {
+		limiter.SetLimit(s.rate)
+		limiter.SetBurst(s.burst)
+	}
+}
+
 func (s *RateLimitService) GetLimiter(key string) *rate.Limiter {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -370,6 +765,13 @@ func (s *RateLimitService) Allow(key string) bool {
 	return s.GetLimiter(key).Allow()
 }
 
+// Size returns the number of tracked limiter keys
+func (s *RateLimitService) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.limiters)
+}
+
 // Helper function untuk generate ID
 func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
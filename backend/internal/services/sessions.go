@@ -0,0 +1,419 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gryt-backend/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSessionNotFound = errors.New("chat session not found")
+	ErrFolderNotFound  = errors.New("folder not found")
+	ErrInvalidSession  = errors.New("invalid session update")
+	ErrInvalidFolder   = errors.New("invalid folder")
+)
+
+// Limits on session organisation
+const (
+	MaxTitleLength  = 255 // chat_sessions.title
+	MaxFolderDepth  = 5
+	MaxFolderName   = 100
+	MaxTagLength    = 50
+	MaxSessionTags  = 20
+	MaxBulkSessions = 100
+)
+
+// Bulk actions
+const (
+	BulkMove      = "move"
+	BulkTag       = "tag"
+	BulkUntag     = "untag"
+	BulkPin       = "pin"
+	BulkUnpin     = "unpin"
+	BulkArchive   = "archive"
+	BulkUnarchive = "unarchive"
+	BulkDelete    = "delete"
+)
+
+// SessionService organises a user's chat sessions: titles, folders, tags,
+// pinning and archiving, one at a time or in bulk
+type SessionService struct {
+	chat     *database.ChatRepository
+	folders  *database.FolderRepository
+	semantic SemanticIndex
+}
+
+func NewSessionService(chat *database.ChatRepository, folders *database.FolderRepository, semantic SemanticIndex) *SessionService {
+	return &SessionService{chat: chat, folders: folders, semantic: semantic}
+}
+
+// SessionUpdate changes one session; nil fields are left alone. FolderID ""
+// moves the session out of any folder, Tags replaces all tags.
+type SessionUpdate struct {
+	Title    *string   `json:"title,omitempty"`
+	FolderID *string   `json:"folder_id,omitempty"`
+	Pinned   *bool     `json:"pinned,omitempty"`
+	Archived *bool     `json:"archived,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+}
+
+// BulkInput applies one action to many sessions. FolderID is used by move
+// ("" = out of any folder), Tags by tag and untag.
+type BulkInput struct {
+	SessionIDs []string `json:"session_ids" binding:"required"`
+	Action     string   `json:"action" binding:"required"`
+	FolderID   string   `json:"folder_id,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// FolderInput creates or changes a folder. On update nil fields are left
+// alone and ParentID "" moves the folder to the top level.
+type FolderInput struct {
+	Name     *string `json:"name,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// Update changes the user's session and returns it
+func (s *SessionService) Update(userID, sessionID string, input SessionUpdate) (*database.ChatSession, error) {
+	session, err := s.chat.GetUserSession(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	// Validate everything before changing anything
+	var title string
+	if input.Title != nil {
+		if title, err = normalizeTitle(*input.Title); err != nil {
+			return nil, err
+		}
+	}
+	if input.FolderID != nil {
+		if err := s.checkFolder(userID, *input.FolderID); err != nil {
+			return nil, err
+		}
+	}
+	change := database.SessionChange{FolderID: input.FolderID, Pinned: input.Pinned, Archived: input.Archived}
+	if input.Tags != nil {
+		tags, err := normalizeTags(*input.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) > MaxSessionTags {
+			return nil, fmt.Errorf("%w: at most %d tags per session", ErrInvalidSession, MaxSessionTags)
+		}
+		change.SetTags = &tags
+	}
+
+	if input.Title != nil {
+		if err := s.chat.RenameSession(sessionID, title); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.chat.UpdateSessions(userID, []string{sessionID}, change); err != nil {
+		return nil, err
+	}
+
+	return s.chat.GetUserSession(userID, sessionID)
+}
+
+// Bulk applies input.Action to the user's sessions among input.SessionIDs
+// and returns how many were changed. Ids of other users' sessions are
+// skipped.
+func (s *SessionService) Bulk(userID string, input BulkInput) (int, error) {
+	ids := unique(input.SessionIDs)
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("%w: session_ids is required", ErrInvalidSession)
+	}
+	if len(ids) > MaxBulkSessions {
+		return 0, fmt.Errorf("%w: at most %d sessions per request", ErrInvalidSession, MaxBulkSessions)
+	}
+
+	yes, no := true, false
+	var change database.SessionChange
+	switch input.Action {
+	case BulkMove:
+		if err := s.checkFolder(userID, input.FolderID); err != nil {
+			return 0, err
+		}
+		change.FolderID = &input.FolderID
+	case BulkTag, BulkUntag:
+		tags, err := normalizeTags(input.Tags)
+		if err != nil {
+			return 0, err
+		}
+		if len(tags) == 0 {
+			return 0, fmt.Errorf("%w: tags is required", ErrInvalidSession)
+		}
+		if input.Action == BulkUntag {
+			change.RemoveTags = tags
+			break
+		}
+		most, err := s.chat.CountSessionTags(ids, tags)
+		if err != nil {
+			return 0, err
+		}
+		if most > MaxSessionTags {
+			return 0, fmt.Errorf("%w: at most %d tags per session", ErrInvalidSession, MaxSessionTags)
+		}
+		change.AddTags = tags
+	case BulkPin:
+		change.Pinned = &yes
+	case BulkUnpin:
+		change.Pinned = &no
+	case BulkArchive:
+		change.Archived = &yes
+	case BulkUnarchive:
+		change.Archived = &no
+	case BulkDelete:
+		change.Delete = true
+	default:
+		return 0, fmt.Errorf("%w: unknown action %q", ErrInvalidSession, input.Action)
+	}
+
+	return s.chat.UpdateSessions(userID, ids, change)
+}
+
+// Tags lists the user's tags with their session counts
+func (s *SessionService) Tags(userID string) ([]database.TagCount, error) {
+	return s.chat.UserTags(userID)
+}
+
+// Folders lists the user's folders; clients build the tree from parent_id
+func (s *SessionService) Folders(userID string) ([]database.ChatFolder, error) {
+	return s.folders.List(userID)
+}
+
+func (s *SessionService) CreateFolder(userID string, input FolderInput) (*database.ChatFolder, error) {
+	if input.Name == nil {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidFolder)
+	}
+	name, err := normalizeFolderName(*input.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := &database.ChatFolder{ID: uuid.New().String(), UserID: userID, Name: name}
+	if input.ParentID != nil && *input.ParentID != "" {
+		folders, err := s.folders.List(userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := newFolderTree(folders).checkMove(folder.ID, *input.ParentID); err != nil {
+			return nil, err
+		}
+		folder.ParentID = input.ParentID
+	}
+
+	if err := s.folders.Create(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// UpdateFolder renames and/or moves a folder
+func (s *SessionService) UpdateFolder(userID, id string, input FolderInput) (*database.ChatFolder, error) {
+	folders, err := s.folders.List(userID)
+	if err != nil {
+		return nil, err
+	}
+	tree := newFolderTree(folders)
+	folder, ok := tree.byID[id]
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+
+	if input.Name != nil {
+		if folder.Name, err = normalizeFolderName(*input.Name); err != nil {
+			return nil, err
+		}
+	}
+	if input.ParentID != nil {
+		folder.ParentID = nil
+		if parent := *input.ParentID; parent != "" {
+			if err := tree.checkMove(id, parent); err != nil {
+				return nil, err
+			}
+			folder.ParentID = &parent
+		}
+	}
+
+	if err := s.folders.Update(&folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// DeleteFolder deletes a folder and its subfolders. Their sessions are
+// kept and become unfiled.
+func (s *SessionService) DeleteFolder(userID, id string) error {
+	folder, err := s.folders.Get(userID, id)
+	if err != nil {
+		return err
+	}
+	if folder == nil {
+		return ErrFolderNotFound
+	}
+	return s.folders.Delete(userID, id)
+}
+
+// checkFolder accepts "" (no folder) or one of the user's folders
+func (s *SessionService) checkFolder(userID, folderID string) error {
+	if folderID == "" {
+		return nil
+	}
+	folder, err := s.folders.Get(userID, folderID)
+	if err != nil {
+		return err
+	}
+	if folder == nil {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// folderTree answers nesting questions about a user's folders
+type folderTree struct {
+	byID     map[string]database.ChatFolder
+	children map[string][]string
+}
+
+func newFolderTree(folders []database.ChatFolder) *folderTree {
+	t := &folderTree{byID: make(map[string]database.ChatFolder), children: make(map[string][]string)}
+	for _, f := range folders {
+		t.byID[f.ID] = f
+		if f.ParentID != nil {
+			t.children[*f.ParentID] = append(t.children[*f.ParentID], f.ID)
+		}
+	}
+	return t
+}
+
+func (t *folderTree) has(id string) bool {
+	_, ok := t.byID[id]
+	return ok
+}
+
+// checkMove checks that folder id, existing or about to be created, can be
+// placed under parent with all its subfolders
+func (t *folderTree) checkMove(id, parent string) error {
+	if !t.has(parent) {
+		return ErrFolderNotFound
+	}
+	if parent == id || t.isAncestor(id, parent) {
+		return fmt.Errorf("%w: a folder cannot be moved into itself", ErrInvalidFolder)
+	}
+	if t.depth(parent)+t.height(id) > MaxFolderDepth {
+		return fmt.Errorf("%w: folders nest at most %d levels", ErrInvalidFolder, MaxFolderDepth)
+	}
+	return nil
+}
+
+// depth is 1 for a top-level folder
+func (t *folderTree) depth(id string) int {
+	depth := 0
+	for seen := 0; id != "" && seen <= len(t.byID); seen++ {
+		depth++
+		f, ok := t.byID[id]
+		if !ok || f.ParentID == nil {
+			break
+		}
+		id = *f.ParentID
+	}
+	return depth
+}
+
+// height is 1 for a folder without subfolders
+func (t *folderTree) height(id string) int {
+	return t.heightWithin(id, len(t.byID))
+}
+
+// heightWithin looks at most limit levels down, which only a parent cycle
+// left by concurrent moves can exceed
+func (t *folderTree) heightWithin(id string, limit int) int {
+	highest := 0
+	if limit > 0 {
+		for _, child := range t.children[id] {
+			if h := t.heightWithin(child, limit-1); h > highest {
+				highest = h
+			}
+		}
+	}
+	return highest + 1
+}
+
+// isAncestor reports whether ancestor is above id
+func (t *folderTree) isAncestor(ancestor, id string) bool {
+	for seen := 0; seen <= len(t.byID); seen++ {
+		f, ok := t.byID[id]
+		if !ok || f.ParentID == nil {
+			return false
+		}
+		if *f.ParentID == ancestor {
+			return true
+		}
+		id = *f.ParentID
+	}
+	return false
+}
+
+func normalizeTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", fmt.Errorf("%w: title is required", ErrInvalidSession)
+	}
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return "", fmt.Errorf("%w: title must be at most %d characters", ErrInvalidSession, MaxTitleLength)
+	}
+	return title, nil
+}
+
+func normalizeFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxFolderName {
+		return "", fmt.Errorf("%w: name must be 1-%d characters", ErrInvalidFolder, MaxFolderName)
+	}
+	return name, nil
+}
+
+// normalizeTags lowercases tags, collapses inner whitespace and drops
+// duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidSession, tag, MaxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gryt-backend/internal/database"
+)
+
+// testFolderTree is
+//
+//	a > b > c > d > f
+//	e > g
+//	x > y > x, a cycle left by two concurrent moves
+//	orphan, whose parent was deleted
+func testFolderTree() *folderTree {
+	var folders []database.ChatFolder
+	for _, f := range [][2]string{
+		{"a", ""}, {"b", "a"}, {"c", "b"}, {"d", "c"}, {"f", "d"},
+		{"e", ""}, {"g", "e"},
+		{"x", "y"}, {"y", "x"},
+		{"orphan", "gone"},
+	} {
+		folder := database.ChatFolder{ID: f[0], Name: f[0]}
+		if f[1] != "" {
+			folder.ParentID = &f[1]
+		}
+		folders = append(folders, folder)
+	}
+	return newFolderTree(folders)
+}
+
+func TestFolderTreeShape(t *testing.T) {
+	tree := testFolderTree()
+	for _, tt := range []struct {
+		id            string
+		depth, height int
+	}{
+		{"a", 1, 5},
+		{"c", 3, 3},
+		{"f", 5, 1},
+		{"e", 1, 2},
+		{"orphan", 2, 1},
+		{"new", 1, 1},
+	} {
+		if got := tree.depth(tt.id); got != tt.depth {
+			t.Errorf("depth(%s) = %d, want %d", tt.id, got, tt.depth)
+		}
+		if got := tree.height(tt.id); got != tt.height {
+			t.Errorf("height(%s) = %d, want %d", tt.id, got, tt.height)
+		}
+	}
+
+	// A cycle has no real depth or height; both must end and be too deep
+	// to move anything into
+	if d, h := tree.depth("x"), tree.height("x"); d <= MaxFolderDepth || h <= MaxFolderDepth {
+		t.Errorf("cycle depth, height = %d, %d; want both above %d", d, h, MaxFolderDepth)
+	}
+}
+
+func TestFolderTreeIsAncestor(t *testing.T) {
+	tree := testFolderTree()
+	for _, tt := range []struct {
+		ancestor, id string
+		want         bool
+	}{
+		{"a", "b", true},
+		{"a", "f", true},
+		{"c", "f", true},
+		{"f", "a", false},
+		{"a", "a", false},
+		{"a", "g", false},
+		{"e", "orphan", false},
+		{"x", "y", true},
+		{"a", "x", false},
+		{"missing", "f", false},
+	} {
+		if got := tree.isAncestor(tt.ancestor, tt.id); got != tt.want {
+			t.Errorf("isAncestor(%s, %s) = %v, want %v", tt.ancestor, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFolderTreeCheckMove(t *testing.T) {
+	tree := testFolderTree()
+	for _, tt := range []struct {
+		id, parent string
+		wantErr    error
+		wantMsg    string
+	}{
+		{"new", "a", nil, ""},
+		{"new", "d", nil, ""},
+		{"new", "orphan", nil, ""},
+		{"e", "c", nil, ""},
+		{"b", "e", nil, ""},
+		{"f", "e", nil, ""},
+		{"new", "missing", ErrFolderNotFound, ""},
+		{"new", "f", ErrInvalidFolder, "nest at most"},
+		{"e", "d", ErrInvalidFolder, "nest at most"},
+		{"a", "g", ErrInvalidFolder, "nest at most"},
+		{"a", "a", ErrInvalidFolder, "into itself"},
+		{"a", "f", ErrInvalidFolder, "into itself"},
+		{"b", "c", ErrInvalidFolder, "into itself"},
+		{"x", "y", ErrInvalidFolder, "into itself"},
+		{"g", "x", ErrInvalidFolder, "nest at most"},
+	} {
+		err := tree.checkMove(tt.id, tt.parent)
+		if !errors.Is(err, tt.wantErr) || (err != nil && !strings.Contains(err.Error(), tt.wantMsg)) {
+			t.Errorf("checkMove(%s, %s) = %v, want %v %q", tt.id, tt.parent, err, tt.wantErr, tt.wantMsg)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gryt-backend/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTeamNotFound  = errors.New("team not found")
+	ErrTeamForbidden = errors.New("only team owners can do this")
+	ErrInvalidTeam   = errors.New("invalid team")
+)
+
+// TeamService manages teams. Any user can create a team and becomes its
+// owner; owners add and remove members, members can leave.
+type TeamService struct {
+	repo     *database.TeamRepository
+	userRepo *database.UserRepository
+}
+
+func NewTeamService(repo *database.TeamRepository, userRepo *database.UserRepository) *TeamService {
+	return &TeamService{repo: repo, userRepo: userRepo}
+}
+
+// List returns the teams the user belongs to
+func (s *TeamService) List(userID string) ([]database.Team, error) {
+	return s.repo.ListForUser(userID)
+}
+
+func (s *TeamService) Create(userID, name string) (*database.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be 1-100 characters", ErrInvalidTeam)
+	}
+
+	team := &database.Team{ID: uuid.New().String(), Name: name, CreatedBy: &userID, Role: database.TeamRoleOwner}
+	if err := s.repo.Create(team, userID); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// Get returns a team the user belongs to and its members
+func (s *TeamService) Get(userID, teamID string) (*database.Team, []database.TeamMember, error) {
+	team, role, err := s.membership(userID, teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	team.Role = role
+
+	members, err := s.repo.Members(teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return team, members, nil
+}
+
+// AddMember adds the user with email to the team, or changes their role
+func (s *TeamService) AddMember(userID, teamID, email, role string) (*database.User, error) {
+	if err := s.requireOwner(userID, teamID); err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = database.TeamRoleMember
+	}
+	if role != database.TeamRoleMember && role != database.TeamRoleOwner {
+		return nil, fmt.Errorf("%w: role must be %s or %s", ErrInvalidTeam, database.TeamRoleMember, database.TeamRoleOwner)
+	}
+
+	member, err := s.userRepo.GetByEmail(strings.TrimSpace(email))
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrUserNotFound
+	}
+	if member.ID == userID && role != database.TeamRoleOwner {
+		if err := s.keepAnOwner(teamID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.SetMember(teamID, member.ID, role); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes memberID from the team. Owners can remove anyone,
+// members only themselves. The last owner cannot leave.
+func (s *TeamService) RemoveMember(userID, teamID, memberID string) error {
+	_, role, err := s.membership(userID, teamID)
+	if err != nil {
+		return err
+	}
+	if memberID != userID && role != database.TeamRoleOwner {
+		return ErrTeamForbidden
+	}
+
+	memberRole, err := s.repo.MemberRole(teamID, memberID)
+	if err != nil {
+		return err
+	}
+	if memberRole == "" {
+		return ErrUserNotFound
+	}
+	if memberRole == database.TeamRoleOwner {
+		if err := s.keepAnOwner(teamID); err != nil {
+			return err
+		}
+	}
+
+	return s.repo.RemoveMember(teamID, memberID)
+}
+
+// Delete removes the team. Templates shared with it become private.
+func (s *TeamService) Delete(userID, teamID string) error {
+	if err := s.requireOwner(userID, teamID); err != nil {
+		return err
+	}
+	return s.repo.Delete(teamID)
+}
+
+// IsMember reports whether userID belongs to the team
+func (s *TeamService) IsMember(userID, teamID string) (bool, error) {
+	role, err := s.repo.MemberRole(teamID, userID)
+	return role != "", err
+}
+
+// membership returns the team and the user's role, or ErrTeamNotFound if
+// the user is not a member
+func (s *TeamService) membership(userID, teamID string) (*database.Team, string, error) {
+	role, err := s.repo.MemberRole(teamID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" {
+		return nil, "", ErrTeamNotFound
+	}
+
+	team, err := s.repo.GetByID(teamID)
+	if err != nil {
+		return nil, "", err
+	}
+	if team == nil {
+		return nil, "", ErrTeamNotFound
+	}
+	return team, role, nil
+}
+
+func (s *TeamService) requireOwner(userID, teamID string) error {
+	_, role, err := s.membership(userID, teamID)
+	if err != nil {
+		return err
+	}
+	if role != database.TeamRoleOwner {
+		return ErrTeamForbidden
+	}
+	return nil
+}
+
+// keepAnOwner refuses to remove or demote the only owner
+func (s *TeamService) keepAnOwner(teamID string) error {
+	owners, err := s.repo.CountOwners(teamID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return fmt.Errorf("%w: a team needs at least one owner, delete the team instead", ErrInvalidTeam)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gryt-backend/internal/database"
+	"gryt-backend/internal/models"
+	"gryt-backend/internal/prompts"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTemplateNotFound  = errors.New("template not found")
+	ErrTemplateForbidden = errors.New("only the template owner can change it")
+	ErrInvalidTemplate   = errors.New("invalid template")
+)
+
+// TemplateService manages prompt templates. A template is private to its
+// owner or shared with one team; team members can read and use it, only
+// the owner can change it.
+type TemplateService struct {
+	repo  *database.TemplateRepository
+	teams *TeamService
+}
+
+func NewTemplateService(repo *database.TemplateRepository, teams *TeamService) *TemplateService {
+	return &TemplateService{repo: repo, teams: teams}
+}
+
+// TemplateInput carries the editable fields of a template. Nil fields are
+// left unchanged on update; TeamID "" makes the template private. A change
+// to Body or Variables saves a new version.
+type TemplateInput struct {
+	Name        *string                   `json:"name"`
+	Description *string                   `json:"description"`
+	TeamID      *string                   `json:"team_id"`
+	Body        *string                   `json:"body"`
+	Variables   *models.TemplateVariables `json:"variables"`
+}
+
+// List returns the user's templates and those shared with their teams
+func (s *TemplateService) List(userID string) ([]database.PromptTemplate, error) {
+	return s.repo.ListVisible(userID)
+}
+
+// Get returns a template the user owns or that is shared with their team
+func (s *TemplateService) Get(userID, id string) (*database.PromptTemplate, error) {
+	tmpl, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, ErrTemplateNotFound
+	}
+	if tmpl.OwnerID == userID {
+		return tmpl, nil
+	}
+	if tmpl.TeamID != nil {
+		member, err := s.teams.IsMember(userID, *tmpl.TeamID)
+		if err != nil {
+			return nil, err
+		}
+		if member {
+			return tmpl, nil
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+func (s *TemplateService) Create(userID string, input TemplateInput) (*database.PromptTemplate, error) {
+	if input.Name == nil || input.Body == nil {
+		return nil, fmt.Errorf("%w: name and body are required", ErrInvalidTemplate)
+	}
+
+	tmpl := &database.PromptTemplate{ID: uuid.New().String(), OwnerID: userID}
+	if _, err := s.apply(userID, tmpl, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (s *TemplateService) Update(userID, id string, input TemplateInput) (*database.PromptTemplate, error) {
+	tmpl, err := s.owned(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := s.apply(userID, tmpl, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(tmpl, changed, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(id)
+}
+
+// Delete removes a template and its history
+func (s *TemplateService) Delete(userID, id string) error {
+	if _, err := s.owned(userID, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+// Versions lists a template's history, newest first
+func (s *TemplateService) Versions(userID, id string) ([]database.TemplateVersion, error) {
+	if _, err := s.Get(userID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Versions(id)
+}
+
+// Version returns one version of a template; 0 means the current one
+func (s *TemplateService) Version(userID, id string, version int) (*database.TemplateVersion, error) {
+	tmpl, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return &database.TemplateVersion{
+			TemplateID: tmpl.ID,
+			Version:    tmpl.CurrentVersion,
+			Body:       tmpl.Body,
+			Variables:  tmpl.Variables,
+			CreatedAt:  tmpl.UpdatedAt,
+		}, nil
+	}
+
+	v, err := s.repo.GetVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%w: version %d", ErrTemplateNotFound, version)
+	}
+	return v, nil
+}
+
+// Render fills a template version (0 = current) with values. Value errors
+// wrap prompts.ErrInvalidValues.
+func (s *TemplateService) Render(userID, id string, version int, values map[string]interface{}) (string, *database.TemplateVersion, error) {
+	v, err := s.Version(userID, id, version)
+	if err != nil {
+		return "", nil, err
+	}
+
+	text, err := prompts.Render(v.Body, v.Variables, values)
+	if err != nil {
+		return "", nil, err
+	}
+	return text, v, nil
+}
+
+func (s *TemplateService) owned(userID, id string) (*database.PromptTemplate, error) {
+	tmpl, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.OwnerID != userID {
+		return nil, ErrTemplateForbidden
+	}
+	return tmpl, nil
+}
+
+// apply validates input and copies it onto tmpl. It reports whether the
+// body or variables changed, i.e. a new version is needed.
+func (s *TemplateService) apply(userID string, tmpl *database.PromptTemplate, input TemplateInput) (bool, error) {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || len(name) > 100 {
+			return false, fmt.Errorf("%w: name must be 1-100 characters", ErrInvalidTemplate)
+		}
+		tmpl.Name = name
+	}
+	if input.Description != nil {
+		if len(*input.Description) > 500 {
+			return false, fmt.Errorf("%w: description must be at most 500 characters", ErrInvalidTemplate)
+		}
+		tmpl.Description = *input.Description
+	}
+	if input.TeamID != nil {
+		if *input.TeamID == "" {
+			tmpl.TeamID = nil
+		} else {
+			member, err := s.teams.IsMember(userID, *input.TeamID)
+			if err != nil {
+				return false, err
+			}
+			if !member {
+				return false, ErrTeamNotFound
+			}
+			teamID := *input.TeamID
+			tmpl.TeamID = &teamID
+		}
+	}
+
+	if input.Body == nil && input.Variables == nil {
+		return false, nil
+	}
+
+	body, vars := tmpl.Body, tmpl.Variables
+	if input.Body != nil {
+		body = *input.Body
+	}
+	if input.Variables != nil {
+		vars = *input.Variables
+	}
+	vars, err := prompts.Define(body, vars)
+	if err != nil {
+		return false, err
+	}
+
+	changed := body != tmpl.Body || !reflect.DeepEqual(vars, tmpl.Variables)
+	tmpl.Body, tmpl.Variables = body, vars
+	return changed, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	store := NewLocal(root)
+	ctx := context.Background()
+	key := "abcdef0123456789"
+
+	if err := store.Put(ctx, key, []byte("first"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	// Putting a key again replaces its bytes
+	if err := store.Put(ctx, key, []byte("second"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	sharded := filepath.Join(root, "ab", "cd", key)
+	if data, err := os.ReadFile(sharded); err != nil || string(data) != "second" {
+		t.Fatalf("%s = %q, %v; want the blob", sharded, data, err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(sharded))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("shard directory has %d entries (%v), want only the blob", len(entries), err)
+	}
+
+	if data, err := ReadAll(ctx, store, key); err != nil || string(data) != "second" {
+		t.Errorf("ReadAll = %q, %v; want second", data, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing key = %v, want nil", err)
+	}
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	root := t.TempDir()
+	store := NewLocal(filepath.Join(root, "blobs"))
+	ctx := context.Background()
+
+	for _, key := range []string{
+		"",
+		"abc",
+		"../../etc/passwd",
+		"abcd/../../x",
+		"ABCDEF01",
+		"abcdefg1",
+		"abcd ef",
+		strings.Repeat("a", 129),
+	} {
+		if err := store.Put(ctx, key, []byte("x"), ""); err == nil {
+			t.Errorf("Put(%q) accepted", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want an invalid key error", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) accepted", key)
+		}
+	}
+
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("invalid keys created %d entries", len(entries))
+	}
+}
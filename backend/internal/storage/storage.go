@@ -0,0 +1,85 @@
+// Package storage keeps attachment bytes in a blob store: a directory on
+// local disk or a bucket of an S3-compatible service (AWS S3, MinIO, R2...)
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Backends
+const (
+	BackendLocal = "local" // files under a directory
+	BackendS3    = "s3"    // S3-compatible bucket
+)
+
+// ErrNotFound is returned by Get for a key that is not stored
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs by key. Keys are chosen by the caller (lowercase hex
+// content hashes); putting a key again replaces its bytes.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the blob; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob; a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a backend. Path is only used by the local
+// backend, the rest only by s3.
+type Config struct {
+	Backend   string
+	Path      string
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// New creates the store for cfg.Backend
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", BackendLocal:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("storage backend local needs a path")
+		}
+		return NewLocal(cfg.Path), nil
+	case BackendS3:
+		if cfg.Endpoint == "" || cfg.Bucket == "" {
+			return nil, fmt.Errorf("storage backend s3 needs an endpoint and a bucket")
+		}
+		return NewS3(cfg.Endpoint, cfg.Region, cfg.Bucket, cfg.AccessKey, cfg.SecretKey, cfg.PathStyle), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// ReadAll reads a whole blob
+func ReadAll(ctx context.Context, s Store, key string) ([]byte, error) {
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// validKey accepts the lowercase hex keys the store is used with, so a key
+// can never escape the local root or change an S3 path
+func validKey(key string) bool {
+	if len(key) < 4 || len(key) > 128 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package vector
+
+import (
+	"context"
+	"sync"
+)
+
+// Flat compares the query with every vector of the owner. Exact, and fast
+// enough for a few thousand vectors per owner.
+type Flat struct {
+	mu     sync.RWMutex
+	owners map[string]map[string][]float32 // owner -> id -> unit vector
+	owner  map[string]string               // id -> owner
+}
+
+func NewFlat() *Flat {
+	return &Flat{owners: make(map[string]map[string][]float32), owner: make(map[string]string)}
+}
+
+func (f *Flat) Upsert(_ context.Context, items []Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, item := range items {
+		f.remove(item.ID)
+		vectors := f.owners[item.Owner]
+		if vectors == nil {
+			vectors = make(map[string][]float32)
+			f.owners[item.Owner] = vectors
+		}
+		vectors[item.ID] = normalize(item.Vector)
+		f.owner[item.ID] = item.Owner
+	}
+	return nil
+}
+
+func (f *Flat) Delete(_ context.Context, ids []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range ids {
+		f.remove(id)
+	}
+	return nil
+}
+
+func (f *Flat) remove(id string) {
+	owner, ok := f.owner[id]
+	if !ok {
+		return
+	}
+	delete(f.owner, id)
+	delete(f.owners[owner], id)
+	if len(f.owners[owner]) == 0 {
+		delete(f.owners, owner)
+	}
+}
+
+func (f *Flat) Search(_ context.Context, owner string, query []float32, k int) ([]Match, error) {
+	query = normalize(query)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	vectors := f.owners[owner]
+	ids := make([]string, 0, len(vectors))
+	best := topK{k: k}
+	for id, v := range vectors {
+		// Vectors from another embedding model are skipped until re-embedded
+		if len(v) != len(query) {
+			continue
+		}
+		ids = append(ids, id)
+		best.push(candidate{node: len(ids) - 1, dist: 1 - dot(v, query)})
+	}
+
+	matches := make([]Match, 0, k)
+	for _, c := range best.sorted() {
+		matches = append(matches, Match{ID: ids[c.node], Score: 1 - c.dist})
+	}
+	return matches, nil
+}
@@ -0,0 +1,249 @@
+package vector
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+)
+
+// HNSW keeps one hierarchical navigable small world graph per owner, so a
+// search only walks the owner's vectors. Deleted vectors stay in the graph
+// as tombstones (still walked, never returned) until they make up half of
+// it, then the graph is rebuilt.
+type HNSW struct {
+	mu             sync.RWMutex
+	m              int // links per node and layer (2m on layer 0)
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+	graphs         map[string]*graph // owner -> graph
+	owner          map[string]string // id -> owner
+}
+
+type node struct {
+	id      string
+	vec     []float32 // unit length
+	links   [][]int   // neighbours per layer, 0..level
+	deleted bool
+}
+
+type graph struct {
+	dim      int
+	nodes    []*node
+	ids      map[string]int // live nodes
+	entry    int            // -1 while empty
+	maxLevel int
+	deleted  int
+}
+
+// NewHNSW creates an HNSW index. m is the number of links per node,
+// efConstruction and efSearch the candidate list sizes when inserting and
+// searching; larger is more accurate and slower.
+func NewHNSW(m, efConstruction, efSearch int) *HNSW {
+	return &HNSW{
+		m:              m,
+		efConstruction: efConstruction,
+		efSearch:       efSearch,
+		levelMult:      1 / math.Log(float64(m)),
+		graphs:         make(map[string]*graph),
+		owner:          make(map[string]string),
+	}
+}
+
+func newGraph(dim int) *graph {
+	return &graph{dim: dim, ids: make(map[string]int), entry: -1}
+}
+
+func (h *HNSW) Upsert(_ context.Context, items []Item) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, item := range items {
+		v := normalize(item.Vector)
+		h.remove(item.ID)
+
+		g := h.graphs[item.Owner]
+		if g == nil || g.dim != len(v) {
+			// A new embedding model: the owner's old vectors are dropped and
+			// come back as they are re-embedded
+			if g != nil {
+				for id := range g.ids {
+					delete(h.owner, id)
+				}
+			}
+			g = newGraph(len(v))
+			h.graphs[item.Owner] = g
+		}
+		h.insert(g, item.ID, v)
+		h.owner[item.ID] = item.Owner
+	}
+	return nil
+}
+
+func (h *HNSW) Delete(_ context.Context, ids []string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, id := range ids {
+		h.remove(id)
+	}
+	return nil
+}
+
+func (h *HNSW) remove(id string) {
+	owner, ok := h.owner[id]
+	if !ok {
+		return
+	}
+	delete(h.owner, id)
+
+	g := h.graphs[owner]
+	g.nodes[g.ids[id]].deleted = true
+	delete(g.ids, id)
+	g.deleted++
+
+	switch {
+	case len(g.ids) == 0:
+		delete(h.graphs, owner)
+	case g.deleted > len(g.nodes)/2:
+		rebuilt := newGraph(g.dim)
+		for _, n := range g.nodes {
+			if !n.deleted {
+				h.insert(rebuilt, n.id, n.vec)
+			}
+		}
+		h.graphs[owner] = rebuilt
+	}
+}
+
+func (h *HNSW) Search(_ context.Context, owner string, query []float32, k int) ([]Match, error) {
+	query = normalize(query)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	g := h.graphs[owner]
+	if g == nil || g.dim != len(query) || k <= 0 {
+		return []Match{}, nil
+	}
+
+	ep := g.entry
+	for l := g.maxLevel; l > 0; l-- {
+		ep = g.greedy(query, ep, l)
+	}
+	ef := max(h.efSearch, k)
+	ef += min(g.deleted, ef) // room for tombstones
+
+	matches := make([]Match, 0, k)
+	for _, c := range g.searchLayer(query, ep, ef, 0) {
+		if n := g.nodes[c.node]; !n.deleted {
+			matches = append(matches, Match{ID: n.id, Score: 1 - c.dist})
+			if len(matches) == k {
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (h *HNSW) randomLevel() int {
+	return int(math.Floor(-math.Log(1-rand.Float64()) * h.levelMult))
+}
+
+// insert adds a unit vector to g
+func (h *HNSW) insert(g *graph, id string, v []float32) {
+	level := h.randomLevel()
+	n := &node{id: id, vec: v, links: make([][]int, level+1)}
+	idx := len(g.nodes)
+	g.nodes = append(g.nodes, n)
+	g.ids[id] = idx
+
+	if g.entry < 0 {
+		g.entry, g.maxLevel = idx, level
+		return
+	}
+
+	ep := g.entry
+	for l := g.maxLevel; l > level; l-- {
+		ep = g.greedy(v, ep, l)
+	}
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		found := g.searchLayer(v, ep, h.efConstruction, l)
+		maxLinks := h.m
+		if l == 0 {
+			maxLinks = 2 * h.m
+		}
+
+		neighbours := found
+		if len(neighbours) > h.m {
+			neighbours = neighbours[:h.m]
+		}
+		for _, c := range neighbours {
+			n.links[l] = append(n.links[l], c.node)
+			other := g.nodes[c.node]
+			other.links[l] = append(other.links[l], idx)
+			if len(other.links[l]) > maxLinks {
+				g.prune(other, l, maxLinks)
+			}
+		}
+		ep = found[0].node
+	}
+
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = idx, level
+	}
+}
+
+// greedy walks layer from ep towards q and returns the closest node found
+func (g *graph) greedy(q []float32, ep, layer int) int {
+	best, bestDist := ep, 1-dot(q, g.nodes[ep].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range g.nodes[best].links[layer] {
+			if d := 1 - dot(q, g.nodes[nb].vec); d < bestDist {
+				best, bestDist, changed = nb, d, true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer returns up to ef nodes of layer nearest to q, nearest first
+func (g *graph) searchLayer(q []float32, ep, ef, layer int) []candidate {
+	start := candidate{node: ep, dist: 1 - dot(q, g.nodes[ep].vec)}
+	visited := map[int]bool{ep: true}
+	candidates := &nearest{start}
+	results := topK{k: ef}
+	results.push(start)
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(candidate)
+		if results.h.Len() >= ef && c.dist > results.h.nearest[0].dist {
+			break
+		}
+		for _, nb := range g.nodes[c.node].links[layer] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			d := 1 - dot(q, g.nodes[nb].vec)
+			if results.h.Len() < ef || d < results.h.nearest[0].dist {
+				heap.Push(candidates, candidate{node: nb, dist: d})
+				results.push(candidate{node: nb, dist: d})
+			}
+		}
+	}
+	return results.sorted()
+}
+
+// prune keeps the limit links of n on layer that are closest to it
+func (g *graph) prune(n *node, layer, limit int) {
+	links := n.links[layer]
+	sort.Slice(links, func(i, j int) bool {
+		return dot(n.vec, g.nodes[links[i]].vec) > dot(n.vec, g.nodes[links[j]].vec)
+	})
+	n.links[layer] = links[:limit]
+}
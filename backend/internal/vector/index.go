@@ -0,0 +1,151 @@
+// Package vector stores embedding vectors per owner and finds the ones
+// nearest to a query by cosine similarity
+package vector
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+)
+
+// Backends
+const (
+	BackendFlat   = "flat"   // in-process brute force, exact
+	BackendHNSW   = "hnsw"   // in-process HNSW graph per owner, approximate
+	BackendQdrant = "qdrant" // external Qdrant collection
+)
+
+// Item is a vector to index. Owner scopes searches (a user ID).
+type Item struct {
+	ID     string
+	Owner  string
+	Vector []float32
+}
+
+// Match is a search result; Score is the cosine similarity (-1..1)
+type Match struct {
+	ID    string  `json:"id"`
+	Score float32 `json:"score"`
+}
+
+// Index stores vectors and searches them. Upserting an ID again replaces
+// its vector.
+type Index interface {
+	Upsert(ctx context.Context, items []Item) error
+	Delete(ctx context.Context, ids []string) error
+	// Search returns up to k of owner's items most similar to query, best
+	// first
+	Search(ctx context.Context, owner string, query []float32, k int) ([]Match, error)
+}
+
+// Config selects and configures a backend. URL, APIKey and Collection are
+// only used by external backends.
+type Config struct {
+	Backend    string
+	URL        string
+	APIKey     string
+	Collection string
+}
+
+// New creates the index for cfg.Backend
+func New(cfg Config) (Index, error) {
+	switch cfg.Backend {
+	case BackendFlat:
+		return NewFlat(), nil
+	case "", BackendHNSW:
+		return NewHNSW(16, 200, 64), nil
+	case BackendQdrant:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("vector backend qdrant needs a URL")
+		}
+		return NewQdrant(cfg.URL, cfg.APIKey, cfg.Collection), nil
+	default:
+		return nil, fmt.Errorf("unknown vector backend %q", cfg.Backend)
+	}
+}
+
+// InMemory reports whether index loses its vectors on restart and has to
+// be loaded again from the database
+func InMemory(index Index) bool {
+	switch index.(type) {
+	case *Flat, *HNSW:
+		return true
+	}
+	return false
+}
+
+// normalize returns v scaled to unit length, so cosine similarity is a dot
+// product
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	for i, x := range v {
+		out[i] = x * norm
+	}
+	return out
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// candidate is a node and its distance (1 - similarity) to the query
+type candidate struct {
+	node int
+	dist float32
+}
+
+// nearest is a min-heap on distance
+type nearest []candidate
+
+func (h nearest) Len() int            { return len(h) }
+func (h nearest) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h nearest) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nearest) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *nearest) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// farthest is a max-heap on distance
+type farthest struct{ nearest }
+
+func (h farthest) Less(i, j int) bool { return h.nearest[i].dist > h.nearest[j].dist }
+
+// topK keeps the k nearest candidates pushed into it
+type topK struct {
+	k int
+	h farthest
+}
+
+func (t *topK) push(c candidate) {
+	if t.h.Len() < t.k {
+		heap.Push(&t.h, c)
+	} else if t.k > 0 && c.dist < t.h.nearest[0].dist {
+		t.h.nearest[0] = c
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// sorted returns the kept candidates, nearest first
+func (t *topK) sorted() []candidate {
+	out := make([]candidate, t.h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&t.h).(candidate)
+	}
+	return out
+}
@@ -0,0 +1,182 @@
+package vector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Qdrant stores vectors in a Qdrant collection over its REST API. The
+// collection is created on first use with the size of the first vector
+// and cosine distance; owners are a payload filter.
+type Qdrant struct {
+	baseURL    string
+	apiKey     string
+	collection string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	ready bool // collection exists
+}
+
+// pointNamespace derives Qdrant point UUIDs from item IDs
+var pointNamespace = uuid.MustParse("6f1f6a4e-4a7b-4c55-9d0e-2b1c1f3c9a10")
+
+func NewQdrant(baseURL, apiKey, collection string) *Qdrant {
+	if collection == "" {
+		collection = "chat_messages"
+	}
+	return &Qdrant{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		collection: collection,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func pointID(id string) string {
+	return uuid.NewSHA1(pointNamespace, []byte(id)).String()
+}
+
+func (q *Qdrant) Upsert(ctx context.Context, items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := q.ensureCollection(ctx, len(items[0].Vector)); err != nil {
+		return err
+	}
+
+	points := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		points[i] = map[string]interface{}{
+			"id":      pointID(item.ID),
+			"vector":  item.Vector,
+			"payload": map[string]string{"id": item.ID, "owner": item.Owner},
+		}
+	}
+	return q.do(ctx, http.MethodPut, "/points?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+func (q *Qdrant) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = pointID(id)
+	}
+	return q.do(ctx, http.MethodPost, "/points/delete?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+func (q *Qdrant) Search(ctx context.Context, owner string, query []float32, k int) ([]Match, error) {
+	body := map[string]interface{}{
+		"vector":       query,
+		"limit":        k,
+		"with_payload": []string{"id"},
+		"filter": map[string]interface{}{
+			"must": []map[string]interface{}{
+				{"key": "owner", "match": map[string]string{"value": owner}},
+			},
+		},
+	}
+	var resp struct {
+		Result []struct {
+			Score   float32 `json:"score"`
+			Payload struct {
+				ID string `json:"id"`
+			} `json:"payload"`
+		} `json:"result"`
+	}
+	if err := q.do(ctx, http.MethodPost, "/points/search", body, &resp); err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(resp.Result))
+	for _, r := range resp.Result {
+		matches = append(matches, Match{ID: r.Payload.ID, Score: r.Score})
+	}
+	return matches, nil
+}
+
+// ensureCollection creates the collection and its owner index if missing
+func (q *Qdrant) ensureCollection(ctx context.Context, dim int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready {
+		return nil
+	}
+
+	err := q.do(ctx, http.MethodGet, "", nil, nil)
+	var qe *qdrantError
+	if errors.As(err, &qe) && qe.status == http.StatusNotFound {
+		create := map[string]interface{}{"vectors": map[string]interface{}{"size": dim, "distance": "Cosine"}}
+		if err = q.do(ctx, http.MethodPut, "", create, nil); err == nil {
+			err = q.do(ctx, http.MethodPut, "/index?wait=true", map[string]string{"field_name": "owner", "field_schema": "keyword"}, nil)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	q.ready = true
+	return nil
+}
+
+type qdrantError struct {
+	status int
+	body   string
+}
+
+func (e *qdrantError) Error() string {
+	return fmt.Sprintf("qdrant error (status %d): %s", e.status, e.body)
+}
+
+// do sends a request to the collection endpoint plus path and decodes the
+// response into out when given
+func (q *Qdrant) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	endpoint := q.baseURL + "/collections/" + url.PathEscape(q.collection) + path
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &qdrantError{status: resp.StatusCode, body: strings.TrimSpace(string(raw))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"log"
+	"embed"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,39 +11,102 @@ import (
 	"time"
 
 	"gryt-backend/internal/api"
+	"gryt-backend/internal/buildinfo"
 	"gryt-backend/internal/config"
 	"gryt-backend/internal/database"
+	"gryt-backend/internal/health"
+	"gryt-backend/internal/logging"
+	"gryt-backend/internal/metrics"
 	"gryt-backend/internal/middleware"
 	"gryt-backend/internal/services"
+	"gryt-backend/internal/tracing"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/secure"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// Migration files, used to know which schema version this binary expects
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found")
+	envErr := godotenv.Load()
+
+	// Load configuration (env over optional CONFIG_FILE)
+	settings, err := config.NewStore()
+	if err != nil {
+		slog.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	cfg := settings.Get()
+
+	// Structured logging (level & format from config)
+	logging.Setup(cfg.Server)
+	if envErr != nil {
+		slog.Warn(".env file not found, using process environment")
+	}
+	if settings.Path() != "" {
+		slog.Info("configuration file loaded", "file", settings.Path())
 	}
 
-	// Load configuration
-	cfg, err := config.Load()
+	// Tracing (exporter chosen by TRACING_EXPORTER)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, buildinfo.Version)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
 	}
 
 	// Initialize database
 	db, err := database.NewConnection(cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
 	}
 	defer db.Close()
+	metrics.RegisterDBStats(db.DB.DB, cfg.Database.Database)
 
 	// Initialize services
-	services := services.NewServices(db, cfg)
+	services, err := services.NewServices(db, settings)
+	if err != nil {
+		slog.Error("failed to initialize services", "error", err)
+		os.Exit(1)
+	}
+
+	// Config models only seed the catalogue; rows already in
+	// ai_model_configs (admin edits) win
+	if added, err := services.AI.Catalog().Seed(context.Background(), cfg.AI.Models); err != nil {
+		slog.Warn("failed to seed model catalogue", "error", err)
+	} else if added > 0 {
+		slog.Info("model catalogue seeded from config", "added", added)
+	}
+
+	// The default model may be enabled in ai.models or only in the
+	// database, so it is checked against the seeded catalogue
+	if model, err := services.AI.Catalog().Lookup(context.Background(), cfg.AI.Model); err != nil {
+		slog.Warn("failed to check AI_MODEL against the model catalogue", "error", err)
+	} else if model == nil {
+		slog.Error("AI_MODEL is not an enabled model in the catalogue (ai.models or ai_model_configs)", "model", cfg.AI.Model)
+		os.Exit(1)
+	}
+
+	// Readiness checks: database & schema are critical, the AI gateway and
+	// rate limit store only degrade the service
+	expectedMigration, err := health.LatestMigration(migrationFiles, "migrations")
+	if err != nil {
+		slog.Error("failed to read embedded migrations", "error", err)
+		os.Exit(1)
+	}
+	checker := health.NewChecker(3 * time.Second)
+	checker.Add("database", true, health.Database(db))
+	checker.Add("migrations", true, health.Migrations(db, expectedMigration))
+	checker.Add("ai_gateway", false, health.Cached(30*time.Second, health.AIGateway(services.AI.GetClient())))
+	checker.Add("rate_limit", false, health.RateLimitStore(services.RateLimit))
 
 	// Set Gin mode
 	if cfg.Server.Environment == "production" {
@@ -52,7 +116,17 @@ func main() {
 	// Initialize router
 	r := gin.New()
 
+	// Client IPs drive login lockout and rate limits, so forwarded headers
+	// are only believed from configured proxies
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+
 	// Security middleware
+	// Per-request write deadline; must wrap the raw writer, before gzip
+	r.Use(middleware.WriteTimeout(cfg.Server.WriteTimeout))
+
 	r.Use(secure.New(secure.Config{
 		SSLRedirect:          cfg.Server.Environment == "production",
 		STSSeconds:           31536000,
@@ -68,7 +142,7 @@ func main() {
 		AllowOrigins:     []string{cfg.Server.FrontendURL},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -77,28 +151,63 @@ func main() {
 	middleware.InitAIRateLimit(10)
 
 	// Custom middleware
+	r.Use(middleware.RequestID())
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
 	r.Use(middleware.Logger())
+	r.Use(middleware.Metrics())
 	r.Use(middleware.Recovery())
 	r.Use(middleware.Security())
 	r.Use(middleware.RateLimit(services.RateLimit))
 
 	// Setup routes
-	api.SetupRoutes(r, services, db)
+	api.SetupRoutes(r, services, db, cfg, checker)
 
 	// Server configuration
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
 		Handler:      r,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout: cfg.Server.ReadTimeout,
+		// No server-wide WriteTimeout: it would cut SSE streams. Deadlines
+		// are set per request by middleware.WriteTimeout/StreamTimeout.
+		IdleTimeout: cfg.Server.IdleTimeout,
 	}
 
 	// Start server
 	go func() {
-		log.Printf("Server starting on port %s", cfg.Server.Port)
+		build := buildinfo.Get()
+		slog.Info("server starting", "port", cfg.Server.Port, "environment", cfg.Server.Environment, "version", build.Version, "commit", build.Commit, "build_date", build.BuildDate)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+			slog.Error("server failed to start", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Hot reload of models, tools, prompts & limits: SIGHUP or a change
+	// to the config file
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go settings.Watch(watchCtx, 5*time.Second)
+
+	if cfg.AI.ModelSyncInterval > 0 {
+		go services.AI.Catalog().RunSync(watchCtx, services.AI.GetClient(), cfg.AI.ModelSyncInterval)
+	}
+
+	// Purge sessions that outlived AI_SESSION_RETENTION in the trash
+	go services.AI.RunPurge(watchCtx, time.Hour)
+
+	// Embed new chat messages for semantic search (AI_EMBEDDING_MODEL)
+	go services.AI.RunEmbeddings(watchCtx, time.Minute)
+
+	// Remove attachment blobs nothing refers to (e.g. of deleted users)
+	go services.Attachments.RunSweep(watchCtx, time.Hour)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := settings.Reload(); err != nil {
+				slog.Error("config reload failed, keeping previous configuration", "error", err)
+			}
 		}
 	}()
 
@@ -107,15 +216,38 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Server shutting down...")
+	// Stop new chats and report not-ready, but keep serving (probes, the
+	// running streams) while generations drain
+	generations := services.AI.Generations()
+	checker.SetDraining()
+	slog.Info("server shutting down, draining generations", "active", generations.Active(), "drain_timeout", cfg.Server.DrainTimeout)
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.DrainTimeout)
+	if err := generations.Drain(drainCtx); err != nil {
+		slog.Warn("drain timeout reached, cancelling generations", "active", generations.Active())
+		generations.Abort()
+
+		// Give aborted generations a moment to persist their partial answer
+		persistCtx, cancelPersist := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := generations.Drain(persistCtx); err != nil {
+			slog.Error("generations did not stop after cancel", "active", generations.Active())
+		}
+		cancelPersist()
+	}
+	cancelDrain()
 
 	// Graceful shutdown dengan timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		slog.Error("server forced to shutdown", "error", err)
+		os.Exit(1)
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
 	}
 
-	log.Println("Server exited")
+	slog.Info("server exited")
 }
\ No newline at end of file
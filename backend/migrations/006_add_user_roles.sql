@@ -0,0 +1,9 @@
+-- Migration: Add role column to users table
+-- Created: 2025-01-20
+-- Description: Role-based access control (user, admin, support) and promote the seeded admin
+
+ALTER TABLE users
+    ADD COLUMN role ENUM('user', 'admin', 'support') NOT NULL DEFAULT 'user' AFTER name,
+    ADD INDEX idx_users_role (role);
+
+UPDATE users SET role = 'admin' WHERE id = 'admin-001';
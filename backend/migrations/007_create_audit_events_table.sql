@@ -0,0 +1,21 @@
+-- Migration: Create audit_events table
+-- Created: 2025-01-20
+-- Description: Audit trail for administrative and security-relevant actions
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor_id VARCHAR(36) NULL,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL DEFAULT '',
+    target_id VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    outcome ENUM('success', 'failure', 'denied') NOT NULL DEFAULT 'success',
+    metadata JSON,
+    created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3),
+    
+    INDEX idx_audit_events_actor_id (actor_id),
+    INDEX idx_audit_events_action (action),
+    INDEX idx_audit_events_target (target_type, target_id),
+    INDEX idx_audit_events_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,21 @@
+-- Migration: Create schema_migrations table
+-- Created: 2025-01-23
+-- Description: Record applied migration versions so /readyz can detect a schema older than the binary.
+--              Every migration from now on ends with an INSERT IGNORE into this table.
+
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES
+    (1, '001_create_users_table'),
+    (2, '002_create_chat_sessions_table'),
+    (3, '003_create_chat_messages_table'),
+    (4, '004_create_ai_tables'),
+    (5, '005_create_user_identities_table'),
+    (6, '006_add_user_roles'),
+    (7, '007_create_audit_events_table'),
+    (8, '008_make_audit_events_append_only'),
+    (9, '009_create_schema_migrations_table');
@@ -0,0 +1,43 @@
+-- Migration: Extend ai_model_configs into the model catalogue
+-- Created: 2025-01-24
+-- Description: ai_model_configs becomes the source of truth for /api/ai/models and the model used per request.
+--              Adds context length, description and sync bookkeeping; model names use gateway ids (provider/model).
+
+ALTER TABLE ai_model_configs
+    ADD COLUMN description VARCHAR(500) NOT NULL DEFAULT '' AFTER provider,
+    ADD COLUMN context_length INT NOT NULL DEFAULT 0 AFTER description,
+    ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT 'admin' AFTER supports_vision, -- seed, config, gateway, admin
+    ADD COLUMN last_synced_at TIMESTAMP NULL DEFAULT NULL AFTER source;
+
+UPDATE ai_model_configs SET cost_per_1k_input_tokens = 0 WHERE cost_per_1k_input_tokens IS NULL;
+UPDATE ai_model_configs SET cost_per_1k_output_tokens = 0 WHERE cost_per_1k_output_tokens IS NULL;
+
+ALTER TABLE ai_model_configs
+    MODIFY cost_per_1k_input_tokens DECIMAL(10,6) NOT NULL DEFAULT 0,
+    MODIFY cost_per_1k_output_tokens DECIMAL(10,6) NOT NULL DEFAULT 0;
+
+-- Seeds from 004 used bare names; the gateway expects provider/model
+UPDATE ai_model_configs
+SET model_name = CONCAT(provider, '/', model_name), source = 'seed'
+WHERE model_name NOT LIKE '%/%';
+
+-- Catalogue matching the default AI_MODEL list. Pricing in USD per 1K tokens.
+INSERT INTO ai_model_configs
+    (model_name, display_name, provider, description, context_length, max_tokens, temperature,
+     cost_per_1k_input_tokens, cost_per_1k_output_tokens, supports_streaming, supports_tools, supports_vision, source)
+VALUES
+    ('openai/gpt-4o', 'GPT-4o', 'openai', 'Most capable GPT-4 model', 128000, 4096, 0.70, 0.002500, 0.010000, TRUE, TRUE, TRUE, 'seed'),
+    ('openai/gpt-4o-mini', 'GPT-4o Mini', 'openai', 'Faster and more affordable GPT-4 model', 128000, 2048, 0.70, 0.000150, 0.000600, TRUE, TRUE, TRUE, 'seed'),
+    ('openai/gpt-4-turbo', 'GPT-4 Turbo', 'openai', 'Previous generation GPT-4 model', 128000, 4096, 0.70, 0.010000, 0.030000, TRUE, TRUE, TRUE, 'seed'),
+    ('anthropic/claude-sonnet-4', 'Claude Sonnet 4', 'anthropic', 'Anthropic''s balanced model, default for GRYT', 200000, 4096, 0.70, 0.003000, 0.015000, TRUE, TRUE, TRUE, 'seed'),
+    ('anthropic/claude-3-5-sonnet-20241022', 'Claude 3.5 Sonnet', 'anthropic', 'Previous generation Sonnet', 200000, 4096, 0.70, 0.003000, 0.015000, TRUE, TRUE, TRUE, 'seed'),
+    ('anthropic/claude-3-haiku-20240307', 'Claude 3 Haiku', 'anthropic', 'Fast and cheap, used for background tasks', 200000, 2048, 0.70, 0.000250, 0.001250, TRUE, TRUE, TRUE, 'seed'),
+    ('google/gemini-1.5-pro', 'Gemini 1.5 Pro', 'google', 'Long-context Gemini model', 2000000, 4096, 0.70, 0.001250, 0.005000, TRUE, TRUE, TRUE, 'seed'),
+    ('google/gemini-1.5-flash', 'Gemini 1.5 Flash', 'google', 'Fast long-context Gemini model', 1000000, 2048, 0.70, 0.000075, 0.000300, TRUE, TRUE, TRUE, 'seed')
+ON DUPLICATE KEY UPDATE
+    description = IF(description = '', VALUES(description), description),
+    context_length = IF(context_length = 0, VALUES(context_length), context_length),
+    cost_per_1k_input_tokens = IF(cost_per_1k_input_tokens = 0, VALUES(cost_per_1k_input_tokens), cost_per_1k_input_tokens),
+    cost_per_1k_output_tokens = IF(cost_per_1k_output_tokens = 0, VALUES(cost_per_1k_output_tokens), cost_per_1k_output_tokens);
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (10, '010_extend_ai_model_configs');
@@ -0,0 +1,12 @@
+-- Migration: Add generation parameters to chat sessions and messages
+-- Created: 2025-01-24
+-- Description: Per-session default model/temperature/max_tokens/top_p, and the
+--              effective parameters recorded on every generated message
+
+ALTER TABLE chat_sessions
+    ADD COLUMN params JSON NULL AFTER title;
+
+ALTER TABLE chat_messages
+    ADD COLUMN metadata JSON NULL AFTER tokens;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (11, '011_add_chat_generation_params');
@@ -0,0 +1,30 @@
+-- Migration: Create personas table
+-- Created: 2025-01-25
+-- Description: Reusable personas (named system prompt + default model/params + allowed tools).
+--              user_id NULL means a global persona managed by admins. Sessions may reference a
+--              persona or carry their own system prompt.
+
+CREATE TABLE IF NOT EXISTS personas (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NULL,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    system_prompt TEXT NOT NULL,
+    params JSON NULL,
+    allowed_tools JSON NULL, -- NULL = every enabled tool
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    INDEX idx_personas_user_id (user_id),
+    INDEX idx_personas_name (name),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE chat_sessions
+    ADD COLUMN persona_id VARCHAR(36) NULL AFTER params,
+    ADD COLUMN system_prompt TEXT NULL AFTER persona_id,
+    ADD INDEX idx_chat_sessions_persona_id (persona_id),
+    ADD CONSTRAINT fk_chat_sessions_persona FOREIGN KEY (persona_id) REFERENCES personas(id) ON DELETE SET NULL;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (12, '012_create_personas_table');
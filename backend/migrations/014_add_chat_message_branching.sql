@@ -0,0 +1,42 @@
+-- Migration: Turn chat messages into a tree
+-- Created: 2025-01-26
+-- Description: parent_id links every message to the one it follows, so edits and
+--              regenerated replies become sibling branches. chat_sessions.active_message_id
+--              is the leaf of the branch the user is on; history replay walks up from it.
+--              created_at gets millisecond precision so a user message and its reply
+--              saved in the same second keep their order.
+
+ALTER TABLE chat_messages
+    MODIFY created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3),
+    ADD COLUMN parent_id VARCHAR(36) NULL AFTER session_id,
+    ADD INDEX idx_chat_messages_parent_id (parent_id),
+    ADD CONSTRAINT fk_chat_messages_parent FOREIGN KEY (parent_id) REFERENCES chat_messages(id) ON DELETE CASCADE;
+
+-- No foreign key: it would form a cycle with chat_messages.session_id. A dangling
+-- id is treated like NULL (the newest message is used).
+ALTER TABLE chat_sessions
+    ADD COLUMN active_message_id VARCHAR(36) NULL AFTER system_prompt;
+
+-- Existing conversations are linear: chain each message to the previous one.
+-- Messages saved in the same second are ordered user before assistant.
+UPDATE chat_messages m
+JOIN (
+    SELECT id, LAG(id) OVER (
+        PARTITION BY session_id
+        ORDER BY created_at, FIELD(role, 'system', 'user', 'assistant'), id
+    ) AS prev_id
+    FROM chat_messages
+) ordered ON ordered.id = m.id
+SET m.parent_id = ordered.prev_id
+WHERE m.parent_id IS NULL AND ordered.prev_id IS NOT NULL;
+
+UPDATE chat_sessions s
+SET s.active_message_id = (
+    SELECT m.id FROM chat_messages m
+    WHERE m.session_id = s.id
+    ORDER BY m.created_at DESC, FIELD(m.role, 'system', 'user', 'assistant') DESC, m.id DESC
+    LIMIT 1
+)
+WHERE s.active_message_id IS NULL;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (14, '014_add_chat_message_branching');
@@ -0,0 +1,14 @@
+-- Migration: Mark chat sessions whose title may be generated
+-- Created: 2025-01-26
+-- Description: auto_title is TRUE while a session still has the placeholder title
+--              ("Chat Session <date>"). After an exchange a short title is generated
+--              with a cheap model and the flag is cleared; a manual rename clears it too,
+--              so a generated title never overwrites one the user chose.
+
+ALTER TABLE chat_sessions
+    ADD COLUMN auto_title BOOLEAN NOT NULL DEFAULT FALSE AFTER title;
+
+-- Existing sessions with the placeholder get a title on their next message
+UPDATE chat_sessions SET auto_title = TRUE WHERE title LIKE 'Chat Session %';
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (15, '015_add_chat_session_auto_title');
@@ -0,0 +1,23 @@
+-- Migration: Soft-deleted chat sessions
+-- Created: 2025-01-27
+-- Description: chat_sessions.deleted_at (already in 002) now marks sessions in the trash.
+--              They can be restored until a background job purges them after the
+--              retention period (AI_SESSION_RETENTION). The index serves the cursor
+--              pagination of session lists (user, trash or not, newest first).
+--
+--              The parent_id foreign key from 014 changes to ON DELETE SET NULL: InnoDB
+--              stops nested cascades at 15 levels, so purging a session whose messages
+--              form a longer chain failed. The session's own foreign key still deletes
+--              every message.
+
+ALTER TABLE chat_sessions
+    ADD INDEX idx_chat_sessions_user_list (user_id, deleted_at, updated_at, id),
+    ADD INDEX idx_chat_sessions_deleted_at (deleted_at);
+
+ALTER TABLE chat_messages
+    DROP FOREIGN KEY fk_chat_messages_parent;
+
+ALTER TABLE chat_messages
+    ADD CONSTRAINT fk_chat_messages_parent FOREIGN KEY (parent_id) REFERENCES chat_messages(id) ON DELETE SET NULL;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (16, '016_add_chat_session_trash');
@@ -0,0 +1,42 @@
+-- Migration: Organise chat sessions with folders, tags, pinning and archiving
+-- Created: 2025-01-27
+-- Description: chat_folders nest through parent_id (at most 5 levels, enforced by the
+--              service, which keeps the delete cascade well under InnoDB's limit).
+--              Deleting a folder deletes its subfolders; their sessions become unfiled.
+--              Tags are free-form, stored lowercased per session. pinned_at/archived_at
+--              are NULL when a session is not pinned/archived.
+
+CREATE TABLE IF NOT EXISTS chat_folders (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    parent_id VARCHAR(36) NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    INDEX idx_chat_folders_user_id (user_id),
+    INDEX idx_chat_folders_parent_id (parent_id),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES chat_folders(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE chat_sessions
+    ADD COLUMN folder_id VARCHAR(36) NULL AFTER user_id,
+    ADD COLUMN pinned_at TIMESTAMP NULL AFTER is_active,
+    ADD COLUMN archived_at TIMESTAMP NULL AFTER pinned_at,
+    ADD INDEX idx_chat_sessions_folder_id (folder_id),
+    ADD CONSTRAINT fk_chat_sessions_folder FOREIGN KEY (folder_id) REFERENCES chat_folders(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS chat_session_tags (
+    session_id VARCHAR(36) NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (session_id, tag),
+    INDEX idx_chat_session_tags_tag (tag),
+
+    FOREIGN KEY (session_id) REFERENCES chat_sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (17, '017_create_chat_folders_and_tags');
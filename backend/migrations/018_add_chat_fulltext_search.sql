@@ -0,0 +1,14 @@
+-- Migration: Full-text search over chat messages and session titles
+-- Created: 2025-01-28
+-- Description: FULLTEXT indexes for GET /api/ai/chat/search (MATCH ... AGAINST in
+--              natural language mode). Words shorter than innodb_ft_min_token_size
+--              (default 3) and InnoDB stopwords are not indexed. Backends without
+--              FULLTEXT fall back to LIKE in the repository.
+
+ALTER TABLE chat_messages
+    ADD FULLTEXT INDEX ft_chat_messages_content (content);
+
+ALTER TABLE chat_sessions
+    ADD FULLTEXT INDEX ft_chat_sessions_title (title);
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (18, '018_add_chat_fulltext_search');
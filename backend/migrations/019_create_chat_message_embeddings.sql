@@ -0,0 +1,23 @@
+-- Migration: Embeddings of chat messages for semantic search
+-- Created: 2025-01-28
+-- Description: One row per embedded message, written by the embedding worker. A row
+--              only counts for the model and requested dimensions (0 = model default)
+--              it was made with; changing AI_EMBEDDING_MODEL or AI_EMBEDDING_DIMENSIONS
+--              re-embeds every message.
+--              vector holds little-endian float32s; NULL marks a message the gateway
+--              refused to embed, so it is not retried. The in-process vector index is
+--              loaded from this table on start.
+
+CREATE TABLE IF NOT EXISTS chat_message_embeddings (
+    message_id VARCHAR(36) PRIMARY KEY,
+    model VARCHAR(100) NOT NULL,
+    dimensions INT NOT NULL,
+    vector MEDIUMBLOB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_chat_message_embeddings_model (model, dimensions),
+
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (19, '019_create_chat_message_embeddings');
@@ -0,0 +1,80 @@
+-- Migration: Knowledge bases for retrieval-augmented chat
+-- Created: 2025-01-29
+-- Description: A knowledge base is a user's collection of uploaded documents. Each
+--              document is text-extracted and split into chunks on upload; chunks
+--              never span pages so answers can cite document and page.
+--              The embedding worker embeds chunks like chat messages: a row in
+--              knowledge_chunk_embeddings only counts for its model and dimensions, a
+--              NULL vector marks a chunk the gateway refused. A document is 'ready'
+--              once every chunk has a row for the current model.
+--              Sessions attach knowledge bases through chat_session_knowledge_bases.
+
+CREATE TABLE IF NOT EXISTS knowledge_bases (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    INDEX idx_knowledge_bases_user_id (user_id),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS knowledge_documents (
+    id VARCHAR(36) PRIMARY KEY,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    pages INT NOT NULL,
+    chunks INT NOT NULL,
+    status ENUM('processing', 'ready') NOT NULL DEFAULT 'processing',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_knowledge_documents_base (knowledge_base_id),
+    INDEX idx_knowledge_documents_status (status),
+
+    FOREIGN KEY (knowledge_base_id) REFERENCES knowledge_bases(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS knowledge_chunks (
+    id VARCHAR(36) PRIMARY KEY,
+    document_id VARCHAR(36) NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    ordinal INT NOT NULL,
+    page INT NOT NULL,
+    content TEXT NOT NULL,
+
+    INDEX idx_knowledge_chunks_document (document_id, ordinal),
+    INDEX idx_knowledge_chunks_base (knowledge_base_id),
+
+    FOREIGN KEY (document_id) REFERENCES knowledge_documents(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS knowledge_chunk_embeddings (
+    chunk_id VARCHAR(36) PRIMARY KEY,
+    model VARCHAR(100) NOT NULL,
+    dimensions INT NOT NULL,
+    vector MEDIUMBLOB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_knowledge_chunk_embeddings_model (model, dimensions),
+
+    FOREIGN KEY (chunk_id) REFERENCES knowledge_chunks(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS chat_session_knowledge_bases (
+    session_id VARCHAR(36) NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (session_id, knowledge_base_id),
+    INDEX idx_chat_session_knowledge_bases_base (knowledge_base_id),
+
+    FOREIGN KEY (session_id) REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (knowledge_base_id) REFERENCES knowledge_bases(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (20, '020_create_knowledge_bases');
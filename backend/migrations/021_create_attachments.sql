@@ -0,0 +1,49 @@
+-- Migration: Persistent chat attachments
+-- Created: 2025-01-30
+-- Description: Uploaded files live in the blob store (local disk or S3), keyed by
+--              the SHA-256 of their content, so identical files are stored once.
+--              attachment_blobs has one row per stored blob; attachments is a
+--              user's upload of a blob under a file name. A blob is removed from
+--              the store once no attachment refers to it (the RESTRICT foreign key
+--              keeps a blob row that is still in use).
+--              chat_message_attachments links user messages to the attachments
+--              they were sent with; an edited message can reuse them.
+
+CREATE TABLE IF NOT EXISTS attachment_blobs (
+    sha256 CHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_attachment_blobs_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_attachments_user (user_id, created_at),
+    INDEX idx_attachments_sha256 (sha256),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (sha256) REFERENCES attachment_blobs(sha256)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS chat_message_attachments (
+    message_id VARCHAR(36) NOT NULL,
+    attachment_id VARCHAR(36) NOT NULL,
+    position INT NOT NULL,
+
+    PRIMARY KEY (message_id, attachment_id),
+    INDEX idx_chat_message_attachments_attachment (attachment_id),
+
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version, name) VALUES (21, '021_create_attachments');